@@ -0,0 +1,209 @@
+// Package api реализует JSON REST API для интеграции с внешними системами (CRM и т.п.):
+// просмотр и фильтрация тикетов, ответы поддержки с вложениями, смена статуса и данные пользователей.
+//
+// Все запросы, кроме получения описания OpenAPI, требуют заголовка "Authorization: Bearer <токен>".
+// Ошибки возвращаются в едином формате {"error": {"code": "...", "message": "..."}}.
+package api
+
+import (
+	"crypto/subtle"
+	_ "embed"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"supportTicketBotGo/database"
+	"supportTicketBotGo/logger"
+	"supportTicketBotGo/storage"
+)
+
+// Prefix - путь, под которым обслуживается API
+const Prefix = "/api/v1/"
+
+// Параметры постраничной выдачи
+const (
+	defaultPageLimit = 50
+	maxPageLimit     = 200
+)
+
+//go:embed openapi.yaml
+var openAPISpec []byte
+
+// Deps - хранилища, с которыми работает API
+type Deps struct {
+	Users       database.UserRepository
+	Tickets     database.TicketRepository
+	Messages    database.MessageRepository
+	Attachments database.AttachmentRepository
+	Storage     storage.Storage
+}
+
+// Server обрабатывает запросы к API
+type Server struct {
+	deps  Deps
+	token string
+}
+
+// NewServer создает обработчик API. Если token пустой, API отключен и отвечает 404.
+func NewServer(deps Deps, token string) *Server {
+	return &Server{deps: deps, token: token}
+}
+
+// Register добавляет обработчик API в mux
+func (s *Server) Register(mux *http.ServeMux) {
+	mux.Handle(Prefix, s)
+}
+
+// ServeHTTP разбирает путь запроса и передает его обработчику ресурса
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.token == "" {
+		writeError(w, http.StatusNotFound, "not_found", "API отключен")
+		return
+	}
+
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, Prefix), "/")
+	if path == "openapi.yaml" {
+		w.Header().Set("Content-Type", "application/yaml")
+		w.Write(openAPISpec)
+		return
+	}
+
+	if !s.authorized(r) {
+		writeError(w, http.StatusUnauthorized, "unauthorized", "неверный или отсутствующий токен")
+		return
+	}
+
+	parts := strings.Split(path, "/")
+	switch parts[0] {
+	case "tickets":
+		s.serveTickets(w, r, parts[1:])
+	case "users":
+		s.serveUsers(w, r, parts[1:])
+	default:
+		writeError(w, http.StatusNotFound, "not_found", "ресурс не найден")
+	}
+}
+
+// authorized проверяет токен из заголовка Authorization
+func (s *Server) authorized(r *http.Request) bool {
+	header := r.Header.Get("Authorization")
+	if !strings.HasPrefix(header, "Bearer ") {
+		return false
+	}
+	token := strings.TrimPrefix(header, "Bearer ")
+	return subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) == 1
+}
+
+// page - параметры постраничной выдачи из запроса (?limit=&offset=)
+type page struct {
+	Limit  int
+	Offset int
+}
+
+// pageJSON - страница списка в ответе
+type pageJSON struct {
+	Items  interface{} `json:"items"`
+	Total  int         `json:"total"`
+	Limit  int         `json:"limit"`
+	Offset int         `json:"offset"`
+}
+
+// parsePage читает limit и offset; limit ограничен maxPageLimit
+func parsePage(r *http.Request) (page, error) {
+	p := page{Limit: defaultPageLimit}
+	query := r.URL.Query()
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit <= 0 {
+			return p, errBadRequest("limit должен быть положительным числом")
+		}
+		if limit > maxPageLimit {
+			limit = maxPageLimit
+		}
+		p.Limit = limit
+	}
+	if value := query.Get("offset"); value != "" {
+		offset, err := strconv.Atoi(value)
+		if err != nil || offset < 0 {
+			return p, errBadRequest("offset должен быть неотрицательным числом")
+		}
+		p.Offset = offset
+	}
+	return p, nil
+}
+
+// apiError - ошибка с HTTP-кодом и машиночитаемым кодом для ответа клиенту
+type apiError struct {
+	status  int
+	code    string
+	message string
+}
+
+func (e *apiError) Error() string {
+	return e.message
+}
+
+func errBadRequest(message string) *apiError {
+	return &apiError{status: http.StatusBadRequest, code: "bad_request", message: message}
+}
+
+func errNotFound(message string) *apiError {
+	return &apiError{status: http.StatusNotFound, code: "not_found", message: message}
+}
+
+// writeFailure отвечает ошибкой: apiError передается клиенту как есть,
+// остальные ошибки записываются в журнал и скрываются за кодом internal
+func writeFailure(w http.ResponseWriter, err error) {
+	if apiErr, ok := err.(*apiError); ok {
+		writeError(w, apiErr.status, apiErr.code, apiErr.message)
+		return
+	}
+	logger.Error.Printf("Ошибка API: %v", err)
+	writeError(w, http.StatusInternalServerError, "internal", "внутренняя ошибка сервера")
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	var body struct {
+		Error struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	body.Error.Code = code
+	body.Error.Message = message
+	writeJSON(w, status, body)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logger.Error.Printf("Ошибка при записи ответа API: %v", err)
+	}
+}
+
+// decodeJSON читает тело запроса в v, отклоняя неизвестные поля
+func decodeJSON(r *http.Request, v interface{}) error {
+	decoder := json.NewDecoder(http.MaxBytesReader(nil, r.Body, 1<<20))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		return errBadRequest("некорректный JSON: " + err.Error())
+	}
+	return nil
+}
+
+// methodNotAllowed отвечает 405 со списком разрешенных методов
+func methodNotAllowed(w http.ResponseWriter, allowed ...string) {
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	writeError(w, http.StatusMethodNotAllowed, "method_not_allowed", "метод не поддерживается")
+}
+
+// parseID разбирает числовой идентификатор из пути
+func parseID(value, name string) (int64, error) {
+	id, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || id <= 0 {
+		return 0, errBadRequest("некорректный " + name)
+	}
+	return id, nil
+}
@@ -0,0 +1,284 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"supportTicketBotGo/database"
+	"supportTicketBotGo/storage"
+)
+
+const testToken = "test-token"
+
+// testAPI - сервер API на MemoryStore и MemoryStorage с одним тикетом пользователя 100
+type testAPI struct {
+	t        *testing.T
+	server   *httptest.Server
+	store    *database.MemoryStore
+	files    *storage.MemoryStorage
+	ticketID int
+}
+
+func newTestAPI(t *testing.T, token string) *testAPI {
+	t.Helper()
+	store, files := database.NewMemoryStore(), storage.NewMemoryStorage()
+	if err := store.CreateUser(100); err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	ticketID, err := store.CreateTicket(&database.Ticket{UserID: 100, Title: "Вопрос: доступ", Description: "Не могу войти", Category: "вопрос"})
+	if err != nil {
+		t.Fatalf("CreateTicket: %v", err)
+	}
+
+	mux := http.NewServeMux()
+	NewServer(Deps{Users: store, Tickets: store, Messages: store, Attachments: store, Storage: files}, token).Register(mux)
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return &testAPI{t: t, server: server, store: store, files: files, ticketID: ticketID}
+}
+
+// do выполняет запрос с токеном testToken и возвращает ответ с прочитанным телом
+func (a *testAPI) do(method, path, contentType string, body io.Reader) (*http.Response, []byte) {
+	a.t.Helper()
+	req, err := http.NewRequest(method, a.server.URL+Prefix+path, body)
+	if err != nil {
+		a.t.Fatalf("NewRequest: %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		a.t.Fatalf("%s %s: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	return resp, data
+}
+
+func (a *testAPI) json(method, path, body string) (*http.Response, []byte) {
+	return a.do(method, path, "application/json", strings.NewReader(body))
+}
+
+// expectError проверяет код ответа и машиночитаемый код ошибки
+func expectError(t *testing.T, resp *http.Response, body []byte, status int, code string) {
+	t.Helper()
+	var failure struct {
+		Error struct {
+			Code string `json:"code"`
+		} `json:"error"`
+	}
+	json.Unmarshal(body, &failure)
+	if resp.StatusCode != status || failure.Error.Code != code {
+		t.Fatalf("ответ %d %s, ожидалось %d с кодом %s", resp.StatusCode, body, status, code)
+	}
+}
+
+func ticketPath(id int, rest string) string {
+	return "tickets/" + strconv.Itoa(id) + rest
+}
+
+func TestAuthorization(t *testing.T) {
+	a := newTestAPI(t, testToken)
+	tests := []struct {
+		name   string
+		header string
+		status int
+	}{
+		{"без токена", "", http.StatusUnauthorized},
+		{"неверный токен", "Bearer wrong", http.StatusUnauthorized},
+		{"без Bearer", testToken, http.StatusUnauthorized},
+		{"верный токен", "Bearer " + testToken, http.StatusOK},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest(http.MethodGet, a.server.URL+Prefix+"tickets", nil)
+		if tt.header != "" {
+			req.Header.Set("Authorization", tt.header)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tt.status {
+			t.Errorf("%s: код %d, ожидался %d", tt.name, resp.StatusCode, tt.status)
+		}
+	}
+
+	// Описание OpenAPI доступно без токена
+	resp, err := http.Get(a.server.URL + Prefix + "openapi.yaml")
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("openapi.yaml: %v, %v", resp, err)
+	}
+	resp.Body.Close()
+}
+
+func TestDisabledWithoutToken(t *testing.T) {
+	a := newTestAPI(t, "")
+	resp, body := a.do(http.MethodGet, "tickets", "", nil)
+	expectError(t, resp, body, http.StatusNotFound, "not_found")
+}
+
+func TestParsePage(t *testing.T) {
+	tests := []struct {
+		query   string
+		want    page
+		wantErr bool
+	}{
+		{"", page{Limit: defaultPageLimit}, false},
+		{"limit=10&offset=20", page{Limit: 10, Offset: 20}, false},
+		{"limit=200", page{Limit: 200}, false},
+		{"limit=1000", page{Limit: maxPageLimit}, false},
+		{"limit=0", page{}, true},
+		{"limit=-5", page{}, true},
+		{"limit=abc", page{}, true},
+		{"offset=0", page{Limit: defaultPageLimit}, false},
+		{"offset=-1", page{}, true},
+		{"offset=1.5", page{}, true},
+	}
+	for _, tt := range tests {
+		got, err := parsePage(httptest.NewRequest(http.MethodGet, "/?"+tt.query, nil))
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parsePage(%q): нет ошибки", tt.query)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("parsePage(%q) = %+v, %v, ожидалось %+v", tt.query, got, err, tt.want)
+		}
+	}
+}
+
+func TestStatusTransitionConflict(t *testing.T) {
+	a := newTestAPI(t, testToken)
+	resp, body := a.json(http.MethodPut, ticketPath(a.ticketID, "/status"), `{"status": "closed"}`)
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), `"status":"closed"`) {
+		t.Fatalf("закрытие тикета: %d %s", resp.StatusCode, body)
+	}
+
+	resp, body = a.json(http.MethodPut, ticketPath(a.ticketID, "/status"), `{"status": "in_progress"}`)
+	expectError(t, resp, body, http.StatusConflict, "invalid_transition")
+
+	resp, body = a.json(http.MethodPut, ticketPath(a.ticketID, "/status"), `{"status": "unknown"}`)
+	expectError(t, resp, body, http.StatusBadRequest, "bad_request")
+}
+
+func TestClosedTicketRejectsReplies(t *testing.T) {
+	a := newTestAPI(t, testToken)
+	if err := a.store.UpdateTicketStatus(a.ticketID, database.StatusClosed); err != nil {
+		t.Fatalf("UpdateTicketStatus: %v", err)
+	}
+
+	resp, body := a.json(http.MethodPost, ticketPath(a.ticketID, "/messages"), `{"text": "Ответ", "sender_id": 7}`)
+	expectError(t, resp, body, http.StatusConflict, "ticket_closed")
+
+	content, contentType := multipartFile(t, "file.txt", []byte("текст"), "7")
+	resp, body = a.do(http.MethodPost, ticketPath(a.ticketID, "/attachments"), contentType, content)
+	expectError(t, resp, body, http.StatusConflict, "ticket_closed")
+}
+
+func TestSupportMessages(t *testing.T) {
+	a := newTestAPI(t, testToken)
+
+	resp, body := a.json(http.MethodPost, ticketPath(a.ticketID, "/messages"), `{"text": "Ответ без автора"}`)
+	expectError(t, resp, body, http.StatusBadRequest, "bad_request")
+
+	for _, text := range []string{"Первый", "Второй", "Третий"} {
+		resp, body := a.json(http.MethodPost, ticketPath(a.ticketID, "/messages"), `{"text": "`+text+`", "sender_id": 7}`)
+		if resp.StatusCode != http.StatusCreated {
+			t.Fatalf("ответ поддержки: %d %s", resp.StatusCode, body)
+		}
+	}
+	if ticket, _ := a.store.GetTicketByID(a.ticketID); ticket.Status != database.StatusWaitingUser {
+		t.Fatalf("статус после ответа: %s", ticket.Status)
+	}
+
+	resp, body = a.do(http.MethodGet, ticketPath(a.ticketID, "/messages?limit=2&offset=1"), "", nil)
+	var result struct {
+		Items []messageJSON `json:"items"`
+		Total int           `json:"total"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("список сообщений: %d %s", resp.StatusCode, body)
+	}
+	if result.Total != 3 || len(result.Items) != 2 || result.Items[0].Text != "Второй" || result.Items[1].Text != "Третий" {
+		t.Fatalf("страница сообщений: %+v", result)
+	}
+}
+
+// multipartFile возвращает тело multipart/form-data с полем file и, если задан, sender_id
+func multipartFile(t *testing.T, name string, data []byte, senderID string) (io.Reader, string) {
+	t.Helper()
+	var buf bytes.Buffer
+	form := multipart.NewWriter(&buf)
+	if senderID != "" {
+		form.WriteField("sender_id", senderID)
+	}
+	part, err := form.CreateFormFile("file", name)
+	if err != nil {
+		t.Fatalf("CreateFormFile: %v", err)
+	}
+	part.Write(data)
+	form.Close()
+	return &buf, form.FormDataContentType()
+}
+
+func TestUploadAttachment(t *testing.T) {
+	a := newTestAPI(t, testToken)
+
+	content, contentType := multipartFile(t, "../отчет май.pdf", []byte("%PDF-1.4 отчет"), "7")
+	resp, body := a.do(http.MethodPost, ticketPath(a.ticketID, "/attachments"), contentType, content)
+	var attachment attachmentJSON
+	if err := json.Unmarshal(body, &attachment); err != nil || resp.StatusCode != http.StatusCreated {
+		t.Fatalf("загрузка: %d %s", resp.StatusCode, body)
+	}
+	if attachment.FileName != "отчет_май.pdf" || attachment.SenderID != 7 || attachment.Kind != string(database.AttachmentDocument) {
+		t.Fatalf("вложение: %+v", attachment)
+	}
+	if keys := a.files.Keys(); len(keys) != 1 {
+		t.Fatalf("файлы в хранилище: %q", keys)
+	}
+
+	content, contentType = multipartFile(t, "file.txt", []byte("без автора"), "")
+	resp, body = a.do(http.MethodPost, ticketPath(a.ticketID, "/attachments"), contentType, content)
+	expectError(t, resp, body, http.StatusBadRequest, "bad_request")
+}
+
+func TestUploadTooLarge(t *testing.T) {
+	a := newTestAPI(t, testToken)
+	content, contentType := multipartFile(t, "big.bin", make([]byte, maxUploadSize+1), "7")
+	resp, body := a.do(http.MethodPost, ticketPath(a.ticketID, "/attachments"), contentType, content)
+	expectError(t, resp, body, http.StatusRequestEntityTooLarge, "too_large")
+	if keys := a.files.Keys(); len(keys) != 0 {
+		t.Fatalf("файлы в хранилище: %q", keys)
+	}
+}
+
+func TestSafeFileName(t *testing.T) {
+	tests := []struct {
+		name, want string
+	}{
+		{"report.pdf", "report.pdf"},
+		{"отчет май.pdf", "отчет_май.pdf"},
+		{"../../etc/passwd", "passwd"},
+		{`C:\Users\agent\scan.png`, "scan.png"},
+		{"a;rm -rf$(x).txt", "a_rm_-rf__x_.txt"},
+		{"..", "file"},
+		{".hidden", "hidden"},
+		{"", "file"},
+	}
+	for _, tt := range tests {
+		if got := safeFileName(tt.name); got != tt.want {
+			t.Errorf("safeFileName(%q) = %q, ожидалось %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,576 @@
+package api
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"supportTicketBotGo/database"
+	"supportTicketBotGo/logger"
+	"supportTicketBotGo/storage"
+)
+
+// maxUploadSize - ограничение размера вложения: больше Telegram не отдаст боту при повторной отправке
+const maxUploadSize = 20 << 20
+
+// ticketJSON - тикет в ответах API
+type ticketJSON struct {
+	ID          int        `json:"id"`
+	UserID      int64      `json:"user_id"`
+	Title       string     `json:"title"`
+	Description string     `json:"description"`
+	Status      string     `json:"status"`
+	StatusTitle string     `json:"status_title"`
+	Category    string     `json:"category"`
+	AssignedTo  *int64     `json:"assigned_to"`
+	CreatedAt   time.Time  `json:"created_at"`
+	ClosedAt    *time.Time `json:"closed_at"`
+}
+
+// messageJSON - сообщение тикета в ответах API
+type messageJSON struct {
+	ID         int       `json:"id"`
+	TicketID   int       `json:"ticket_id"`
+	SenderType string    `json:"sender_type"`
+	SenderID   int64     `json:"sender_id"`
+	Text       string    `json:"text"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// attachmentJSON - вложение тикета в ответах API
+type attachmentJSON struct {
+	ID         int       `json:"id"`
+	TicketID   int       `json:"ticket_id"`
+	Kind       string    `json:"kind"`
+	SenderType string    `json:"sender_type"`
+	SenderID   int64     `json:"sender_id"`
+	MimeType   string    `json:"mime_type,omitempty"`
+	FileSize   int64     `json:"file_size,omitempty"`
+	FileName   string    `json:"file_name,omitempty"`
+	MessageID  int       `json:"message_id,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	ContentURL string    `json:"content_url"`   // скачивание через API
+	URL        string    `json:"url,omitempty"` // прямая ссылка, если ее выдает хранилище
+}
+
+func newTicketJSON(t *database.Ticket) ticketJSON {
+	result := ticketJSON{
+		ID:          t.ID,
+		UserID:      t.UserID,
+		Title:       t.Title,
+		Description: t.Description,
+		Status:      t.Status.Code(),
+		StatusTitle: t.Status.Title(),
+		Category:    t.Category,
+		CreatedAt:   t.CreatedAt,
+	}
+	if t.AssignedTo.Valid {
+		result.AssignedTo = &t.AssignedTo.Int64
+	}
+	if t.ClosedAt.Valid {
+		result.ClosedAt = &t.ClosedAt.Time
+	}
+	return result
+}
+
+func newMessageJSON(m *database.TicketMessage) messageJSON {
+	return messageJSON{
+		ID:         m.ID,
+		TicketID:   m.TicketID,
+		SenderType: m.SenderType,
+		SenderID:   m.SenderID,
+		Text:       m.Message,
+		CreatedAt:  m.CreatedAt,
+	}
+}
+
+func (s *Server) newAttachmentJSON(a *database.TicketAttachment) attachmentJSON {
+	result := attachmentJSON{
+		ID:         a.ID,
+		TicketID:   a.TicketID,
+		Kind:       string(a.Kind),
+		SenderType: a.SenderType,
+		SenderID:   a.SenderID,
+		MimeType:   a.MimeType,
+		FileSize:   a.FileSize,
+		FileName:   a.FileName,
+		MessageID:  a.MessageID,
+		CreatedAt:  a.CreatedAt,
+		ContentURL: fmt.Sprintf("%stickets/%d/attachments/%d/content", Prefix, a.TicketID, a.ID),
+	}
+	// Ссылки file:// локального хранилища снаружи бесполезны
+	if url, err := s.deps.Storage.URL(a.StorageKey); err == nil && strings.HasPrefix(url, "http") {
+		result.URL = url
+	}
+	return result
+}
+
+// serveTickets обрабатывает запросы /tickets/...:
+//
+//	GET /tickets                                  - список с фильтрами
+//	GET /tickets/{id}                             - тикет
+//	PUT /tickets/{id}/status                      - смена статуса
+//	GET, POST /tickets/{id}/messages              - сообщения, ответ поддержки
+//	GET, POST /tickets/{id}/attachments           - вложения, загрузка вложения
+//	GET /tickets/{id}/attachments/{aid}/content   - содержимое вложения
+func (s *Server) serveTickets(w http.ResponseWriter, r *http.Request, parts []string) {
+	if len(parts) == 0 || parts[0] == "" {
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w, http.MethodGet)
+			return
+		}
+		s.listTickets(w, r)
+		return
+	}
+
+	id, err := parseID(parts[0], "ID тикета")
+	if err != nil {
+		writeFailure(w, err)
+		return
+	}
+	ticket, err := s.ticket(int(id))
+	if err != nil {
+		writeFailure(w, err)
+		return
+	}
+
+	switch {
+	case len(parts) == 1:
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w, http.MethodGet)
+			return
+		}
+		writeJSON(w, http.StatusOK, newTicketJSON(ticket))
+
+	case len(parts) == 2 && parts[1] == "status":
+		if r.Method != http.MethodPut {
+			methodNotAllowed(w, http.MethodPut)
+			return
+		}
+		s.setTicketStatus(w, r, ticket)
+
+	case len(parts) == 2 && parts[1] == "messages":
+		switch r.Method {
+		case http.MethodGet:
+			s.listMessages(w, r, ticket)
+		case http.MethodPost:
+			s.addSupportMessage(w, r, ticket)
+		default:
+			methodNotAllowed(w, http.MethodGet, http.MethodPost)
+		}
+
+	case len(parts) == 2 && parts[1] == "attachments":
+		switch r.Method {
+		case http.MethodGet:
+			s.listAttachments(w, ticket)
+		case http.MethodPost:
+			s.uploadAttachment(w, r, ticket)
+		default:
+			methodNotAllowed(w, http.MethodGet, http.MethodPost)
+		}
+
+	case len(parts) == 4 && parts[1] == "attachments" && parts[3] == "content":
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w, http.MethodGet)
+			return
+		}
+		attachmentID, err := parseID(parts[2], "ID вложения")
+		if err != nil {
+			writeFailure(w, err)
+			return
+		}
+		s.serveAttachmentContent(w, ticket, int(attachmentID))
+
+	default:
+		writeError(w, http.StatusNotFound, "not_found", "ресурс не найден")
+	}
+}
+
+// ticket получает тикет, превращая отсутствие тикета в ошибку 404
+func (s *Server) ticket(ticketID int) (*database.Ticket, error) {
+	ticket, err := s.deps.Tickets.GetTicketByID(ticketID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errNotFound(fmt.Sprintf("тикет #%d не найден", ticketID))
+	}
+	return ticket, err
+}
+
+// listTickets отдает страницу тикетов. Фильтры: status (коды через запятую), category, user_id, assigned_to.
+func (s *Server) listTickets(w http.ResponseWriter, r *http.Request) {
+	p, err := parsePage(r)
+	if err != nil {
+		writeFailure(w, err)
+		return
+	}
+	filter, err := parseTicketFilter(r)
+	if err != nil {
+		writeFailure(w, err)
+		return
+	}
+	filter.Limit, filter.Offset = p.Limit, p.Offset
+	s.writeTicketPage(w, filter)
+}
+
+// writeTicketPage отдает страницу тикетов по фильтру
+func (s *Server) writeTicketPage(w http.ResponseWriter, filter database.TicketFilter) {
+	tickets, total, err := s.deps.Tickets.ListTickets(filter)
+	if err != nil {
+		writeFailure(w, err)
+		return
+	}
+	items := make([]ticketJSON, 0, len(tickets))
+	for i := range tickets {
+		items = append(items, newTicketJSON(&tickets[i]))
+	}
+	writeJSON(w, http.StatusOK, pageJSON{Items: items, Total: total, Limit: filter.Limit, Offset: filter.Offset})
+}
+
+func parseTicketFilter(r *http.Request) (database.TicketFilter, error) {
+	query := r.URL.Query()
+	filter := database.TicketFilter{Category: query.Get("category")}
+
+	if value := query.Get("status"); value != "" {
+		for _, code := range strings.Split(value, ",") {
+			status, err := database.ParseTicketStatus(code)
+			if err != nil {
+				return filter, errBadRequest(err.Error())
+			}
+			filter.Statuses = append(filter.Statuses, status)
+		}
+	}
+	if value := query.Get("user_id"); value != "" {
+		userID, err := parseID(value, "user_id")
+		if err != nil {
+			return filter, err
+		}
+		filter.UserID = userID
+	}
+	if value := query.Get("assigned_to"); value != "" {
+		agentID, err := parseID(value, "assigned_to")
+		if err != nil {
+			return filter, err
+		}
+		filter.AssignedTo = agentID
+	}
+	return filter, nil
+}
+
+// setTicketStatus меняет статус тикета. Пользователь получает уведомление о смене статуса.
+func (s *Server) setTicketStatus(w http.ResponseWriter, r *http.Request, ticket *database.Ticket) {
+	var req struct {
+		Status string `json:"status"`
+	}
+	if err := decodeJSON(r, &req); err != nil {
+		writeFailure(w, err)
+		return
+	}
+	status, err := database.ParseTicketStatus(req.Status)
+	if err != nil {
+		writeFailure(w, errBadRequest(err.Error()))
+		return
+	}
+
+	err = s.deps.Tickets.UpdateTicketStatus(ticket.ID, status)
+	if errors.Is(err, database.ErrStatusTransition) {
+		writeError(w, http.StatusConflict, "invalid_transition",
+			fmt.Sprintf("нельзя сменить статус «%s» на «%s»", ticket.Status.Title(), status.Title()))
+		return
+	}
+	if err != nil {
+		writeFailure(w, err)
+		return
+	}
+	logger.Info.With(logger.TicketID(ticket.ID)).Printf("API: статус тикета #%d изменен на %q", ticket.ID, status)
+
+	updated, err := s.ticket(ticket.ID)
+	if err != nil {
+		writeFailure(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, newTicketJSON(updated))
+}
+
+// listMessages отдает страницу сообщений тикета в порядке добавления
+func (s *Server) listMessages(w http.ResponseWriter, r *http.Request, ticket *database.Ticket) {
+	p, err := parsePage(r)
+	if err != nil {
+		writeFailure(w, err)
+		return
+	}
+	messages, total, err := s.deps.Messages.ListTicketMessages(ticket.ID, p.Limit, p.Offset)
+	if err != nil {
+		writeFailure(w, err)
+		return
+	}
+	items := make([]messageJSON, 0, len(messages))
+	for i := range messages {
+		items = append(items, newMessageJSON(&messages[i]))
+	}
+	writeJSON(w, http.StatusOK, pageJSON{Items: items, Total: total, Limit: p.Limit, Offset: p.Offset})
+}
+
+// addSupportMessage добавляет ответ поддержки. Как и ответ агента из Telegram, он переводит
+// тикет в статус "ожидает ответа пользователя", а пользователь получает уведомление.
+func (s *Server) addSupportMessage(w http.ResponseWriter, r *http.Request, ticket *database.Ticket) {
+	var req struct {
+		Text     string `json:"text"`
+		SenderID int64  `json:"sender_id"`
+	}
+	if err := decodeJSON(r, &req); err != nil {
+		writeFailure(w, err)
+		return
+	}
+	if strings.TrimSpace(req.Text) == "" {
+		writeFailure(w, errBadRequest("пустой текст сообщения"))
+		return
+	}
+	if req.SenderID <= 0 {
+		writeFailure(w, errBadRequest("не задан sender_id сотрудника поддержки"))
+		return
+	}
+	if err := checkTicketOpen(ticket); err != nil {
+		writeFailure(w, err)
+		return
+	}
+
+	message := &database.TicketMessage{
+		TicketID:   ticket.ID,
+		SenderType: "support",
+		SenderID:   req.SenderID,
+		Message:    req.Text,
+	}
+	if _, err := s.deps.Messages.AddTicketMessage(message); err != nil {
+		writeFailure(w, err)
+		return
+	}
+	s.awaitUser(ticket.ID)
+	logger.Info.With(logger.TicketID(ticket.ID)).Printf("API: добавлен ответ поддержки в тикет #%d", ticket.ID)
+
+	if message.CreatedAt.IsZero() {
+		message.CreatedAt = time.Now()
+	}
+	writeJSON(w, http.StatusCreated, newMessageJSON(message))
+}
+
+// listAttachments отдает все вложения тикета
+func (s *Server) listAttachments(w http.ResponseWriter, ticket *database.Ticket) {
+	attachments, err := s.deps.Attachments.GetTicketAttachments(ticket.ID)
+	if err != nil {
+		writeFailure(w, err)
+		return
+	}
+	items := make([]attachmentJSON, 0, len(attachments))
+	for i := range attachments {
+		items = append(items, s.newAttachmentJSON(&attachments[i]))
+	}
+	writeJSON(w, http.StatusOK, pageJSON{Items: items, Total: len(items), Limit: len(items)})
+}
+
+// uploadAttachment принимает файл (multipart/form-data, поле file) от поддержки.
+// Файл сохраняется в хранилище без file_id: при первом показе бот загрузит его в Telegram.
+func (s *Server) uploadAttachment(w http.ResponseWriter, r *http.Request, ticket *database.Ticket) {
+	if err := checkTicketOpen(ticket); err != nil {
+		writeFailure(w, err)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize+1<<20)
+	if err := r.ParseMultipartForm(1 << 20); err != nil {
+		writeFailure(w, errBadRequest("ожидается multipart/form-data с файлом до 20 МБ: "+err.Error()))
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		writeFailure(w, errBadRequest("не передан файл (поле file)"))
+		return
+	}
+	defer file.Close()
+	if header.Size > maxUploadSize {
+		writeFailure(w, &apiError{status: http.StatusRequestEntityTooLarge, code: "too_large", message: "файл больше 20 МБ"})
+		return
+	}
+	data, err := io.ReadAll(file)
+	if err != nil {
+		writeFailure(w, err)
+		return
+	}
+
+	senderID, err := parseSenderID(r.FormValue("sender_id"))
+	if err != nil {
+		writeFailure(w, err)
+		return
+	}
+
+	mimeType := header.Header.Get("Content-Type")
+	if mimeType == "" || mimeType == "application/octet-stream" {
+		mimeType = http.DetectContentType(data)
+	}
+	if mediaType, _, err := mime.ParseMediaType(mimeType); err == nil {
+		mimeType = mediaType
+	}
+	kind := database.AttachmentKind(r.FormValue("kind"))
+	if kind == "" {
+		kind = attachmentKindByMime(mimeType)
+	}
+	if !kind.Valid() {
+		writeFailure(w, errBadRequest(fmt.Sprintf("неизвестный тип вложения: %s", kind)))
+		return
+	}
+
+	fileName := safeFileName(header.Filename)
+	key := storage.AttachmentKey(ticket.ID, fmt.Sprintf("%d_api_%s", time.Now().UnixNano(), fileName))
+	if err := s.deps.Storage.Put(key, bytes.NewReader(data), int64(len(data)), mimeType); err != nil {
+		writeFailure(w, fmt.Errorf("ошибка при сохранении файла: %v", err))
+		return
+	}
+
+	messageID, err := s.deps.Messages.AddTicketMessage(&database.TicketMessage{
+		TicketID:   ticket.ID,
+		SenderType: "support",
+		SenderID:   senderID,
+		Message:    fmt.Sprintf("прикрепил %s %s", kind.Noun(), fileName),
+	})
+	if err != nil {
+		writeFailure(w, err)
+		return
+	}
+
+	attachment := &database.TicketAttachment{
+		TicketID:   ticket.ID,
+		Kind:       kind,
+		SenderType: "support",
+		SenderID:   senderID,
+		StorageKey: key,
+		MimeType:   mimeType,
+		FileSize:   int64(len(data)),
+		FileName:   fileName,
+		MessageID:  messageID,
+		CreatedAt:  time.Now(),
+	}
+	if attachment.ID, err = s.deps.Attachments.AddTicketAttachment(attachment); err != nil {
+		writeFailure(w, err)
+		return
+	}
+	s.awaitUser(ticket.ID)
+	logger.Info.With(logger.TicketID(ticket.ID)).Printf("API: к тикету #%d прикреплен файл %s", ticket.ID, key)
+
+	writeJSON(w, http.StatusCreated, s.newAttachmentJSON(attachment))
+}
+
+// serveAttachmentContent отдает содержимое вложения из хранилища
+func (s *Server) serveAttachmentContent(w http.ResponseWriter, ticket *database.Ticket, attachmentID int) {
+	attachments, err := s.deps.Attachments.GetTicketAttachments(ticket.ID)
+	if err != nil {
+		writeFailure(w, err)
+		return
+	}
+	var attachment *database.TicketAttachment
+	for i := range attachments {
+		if attachments[i].ID == attachmentID {
+			attachment = &attachments[i]
+			break
+		}
+	}
+	if attachment == nil {
+		writeFailure(w, errNotFound(fmt.Sprintf("вложение %d не найдено в тикете #%d", attachmentID, ticket.ID)))
+		return
+	}
+
+	file, err := s.deps.Storage.Get(attachment.StorageKey)
+	if errors.Is(err, storage.ErrNotFound) {
+		writeFailure(w, errNotFound("файл вложения отсутствует в хранилище"))
+		return
+	}
+	if err != nil {
+		writeFailure(w, err)
+		return
+	}
+	defer file.Close()
+
+	contentType := attachment.MimeType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	fileName := attachment.FileName
+	if fileName == "" {
+		fileName = filepath.Base(attachment.StorageKey)
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": fileName}))
+	if attachment.FileSize > 0 {
+		w.Header().Set("Content-Length", strconv.FormatInt(attachment.FileSize, 10))
+	}
+	if _, err := io.Copy(w, file); err != nil {
+		logger.Error.Printf("Ошибка при отдаче вложения %s: %v", attachment.StorageKey, err)
+	}
+}
+
+// parseSenderID разбирает Telegram ID сотрудника поддержки: по нему бот показывает пользователю имя отвечающего
+func parseSenderID(value string) (int64, error) {
+	if value == "" {
+		return 0, errBadRequest("не задан sender_id сотрудника поддержки")
+	}
+	return parseID(value, "sender_id")
+}
+
+// checkTicketOpen запрещает отвечать в закрытых и отмененных тикетах
+func checkTicketOpen(ticket *database.Ticket) error {
+	if ticket.Status.IsFinal() {
+		return &apiError{status: http.StatusConflict, code: "ticket_closed",
+			message: fmt.Sprintf("тикет #%d в статусе «%s»", ticket.ID, ticket.Status.Title())}
+	}
+	return nil
+}
+
+// awaitUser переводит тикет в ожидание ответа пользователя после ответа поддержки
+func (s *Server) awaitUser(ticketID int) {
+	if err := s.deps.Tickets.UpdateTicketStatus(ticketID, database.StatusWaitingUser); err != nil {
+		logger.Error.With(logger.TicketID(ticketID)).Printf("Ошибка при обновлении статуса тикета %d: %v", ticketID, err)
+	}
+}
+
+// attachmentKindByMime выбирает способ показа вложения в Telegram по MIME-типу
+func attachmentKindByMime(mimeType string) database.AttachmentKind {
+	switch mimeType {
+	case "image/jpeg", "image/png":
+		return database.AttachmentPhoto
+	case "video/mp4":
+		return database.AttachmentVideo
+	case "audio/mpeg", "audio/mp4", "audio/x-m4a":
+		return database.AttachmentAudio
+	case "audio/ogg":
+		return database.AttachmentVoice
+	default:
+		return database.AttachmentDocument
+	}
+}
+
+// safeFileName оставляет от имени файла только безопасные для ключа хранилища символы
+func safeFileName(name string) string {
+	name = filepath.Base(strings.ReplaceAll(name, "\\", "/"))
+	var b strings.Builder
+	for _, r := range name {
+		switch {
+		case unicode.IsLetter(r), unicode.IsDigit(r), r == '.', r == '-', r == '_':
+			b.WriteRune(r)
+		default:
+			b.WriteRune('_')
+		}
+	}
+	result := strings.Trim(b.String(), ".")
+	if result == "" {
+		return "file"
+	}
+	return result
+}
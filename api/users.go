@@ -0,0 +1,103 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"supportTicketBotGo/database"
+)
+
+// userJSON - пользователь в ответах API
+type userJSON struct {
+	ID           int64      `json:"id"`
+	FullName     string     `json:"full_name"`
+	Phone        string     `json:"phone"`
+	LocationLat  float64    `json:"location_lat"`
+	LocationLng  float64    `json:"location_lng"`
+	BirthDate    *time.Time `json:"birth_date"`
+	IsRegistered bool       `json:"is_registered"`
+	RegisteredAt *time.Time `json:"registered_at"`
+	HasAvatar    bool       `json:"has_avatar"`
+	Role         string     `json:"role"`
+}
+
+func newUserJSON(u *database.User, role string) userJSON {
+	result := userJSON{
+		ID:           u.ID,
+		FullName:     u.FullName,
+		Phone:        u.Phone,
+		LocationLat:  u.LocationLat,
+		LocationLng:  u.LocationLng,
+		IsRegistered: u.IsRegistered,
+		HasAvatar:    u.HasAvatar,
+		Role:         role,
+	}
+	if !u.BirthDate.IsZero() {
+		result.BirthDate = &u.BirthDate
+	}
+	if !u.RegisteredAt.IsZero() {
+		result.RegisteredAt = &u.RegisteredAt
+	}
+	return result
+}
+
+// serveUsers обрабатывает запросы /users/...:
+//
+//	GET /users/{id}          - профиль пользователя
+//	GET /users/{id}/tickets  - тикеты пользователя (фильтры как у /tickets)
+func (s *Server) serveUsers(w http.ResponseWriter, r *http.Request, parts []string) {
+	if len(parts) == 0 || parts[0] == "" {
+		writeError(w, http.StatusNotFound, "not_found", "ресурс не найден")
+		return
+	}
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	userID, err := parseID(parts[0], "ID пользователя")
+	if err != nil {
+		writeFailure(w, err)
+		return
+	}
+	user, err := s.deps.Users.GetUserByID(userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeFailure(w, errNotFound(fmt.Sprintf("пользователь %d не найден", userID)))
+		return
+	}
+	if err != nil {
+		writeFailure(w, err)
+		return
+	}
+
+	switch {
+	case len(parts) == 1:
+		role, err := s.deps.Users.GetUserRole(userID)
+		if err != nil {
+			writeFailure(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, newUserJSON(user, role))
+
+	case len(parts) == 2 && parts[1] == "tickets":
+		p, err := parsePage(r)
+		if err != nil {
+			writeFailure(w, err)
+			return
+		}
+		filter, err := parseTicketFilter(r)
+		if err != nil {
+			writeFailure(w, err)
+			return
+		}
+		filter.UserID = user.ID
+		filter.Limit, filter.Offset = p.Limit, p.Offset
+		s.writeTicketPage(w, filter)
+
+	default:
+		writeError(w, http.StatusNotFound, "not_found", "ресурс не найден")
+	}
+}
@@ -0,0 +1,311 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"supportTicketBotGo/database"
+	"supportTicketBotGo/fsm"
+	"supportTicketBotGo/logger"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Состояния режима агента поддержки
+const (
+	stateAgentMenu  = "agent_menu"
+	stateAgentReply = "agent_replying"
+)
+
+// Префикс callback data для действий агента
+const agentCallbackPrefix = "agent_"
+
+// Максимальное количество тикетов в очереди, показываемое агенту за раз
+const agentQueueLimit = 20
+
+// registerAgentDialogs регистрирует состояния режима агента
+func (h *Handler) registerAgentDialogs(m *fsm.Machine) {
+	m.Register(fsm.State{
+		Name:        stateAgentMenu,
+		Prompt:      "🧑‍💼 Режим агента поддержки. Выберите действие:",
+		Keyboard:    func() interface{} { return GetAgentMenuKeyboard() },
+		Handle:      h.handleAgentMenu,
+		Transitions: []string{stateAgentReply},
+	})
+	m.Register(fsm.State{
+		Name:    stateAgentReply,
+		OnEnter: h.enterAgentReply,
+		Handle:  h.handleAgentReply,
+		Back:    stateAgentMenu,
+	})
+}
+
+// HandleAgentCommand обрабатывает команду /agent: переводит агента в режим поддержки
+func (h *Handler) HandleAgentCommand(message *tgbotapi.Message) {
+	isAgent, err := h.deps.Users.IsAgent(message.From.ID)
+	if err != nil {
+		logger.Error.Printf("Ошибка при проверке роли пользователя %d: %v", message.From.ID, err)
+		h.SendErrorMessage(message.Chat.ID, "Произошла ошибка при проверке прав доступа")
+		return
+	}
+	if !isAgent {
+		h.SafeSendMessage(tgbotapi.NewMessage(message.Chat.ID, "⚠️ Эта команда доступна только сотрудникам поддержки."))
+		return
+	}
+
+	h.startDialog(message.Chat.ID, message.From.ID, stateAgentMenu, &UserState{})
+}
+
+func (h *Handler) handleAgentMenu(ctx *fsm.Context) (string, error) {
+	switch ctx.Text() {
+	case "📥 Очередь тикетов":
+		tickets, err := h.deps.Tickets.GetTicketQueue(agentQueueLimit)
+		if err != nil {
+			logger.Error.Printf("Ошибка при получении очереди тикетов: %v", err)
+			h.SendErrorMessage(ctx.ChatID, "Не удалось загрузить очередь тикетов")
+			return fsm.Stay, nil
+		}
+		h.sendAgentTicketList(ctx, "📥 *Очередь открытых тикетов*", "📭 Очередь пуста — все тикеты разобраны.", tickets)
+
+	case "🧑‍💻 Мои тикеты":
+		tickets, err := h.deps.Tickets.GetAgentTickets(ctx.UserID)
+		if err != nil {
+			logger.Error.Printf("Ошибка при получении тикетов агента %d: %v", ctx.UserID, err)
+			h.SendErrorMessage(ctx.ChatID, "Не удалось загрузить ваши тикеты")
+			return fsm.Stay, nil
+		}
+		h.sendAgentTicketList(ctx, "🧑‍💻 *Тикеты в вашей работе*", "📭 У вас нет тикетов в работе.", tickets)
+
+	case "🚪 Выйти из режима агента":
+		h.reply(ctx, "🏠 Главное меню", GetMainMenuKeyboard())
+		return fsm.Exit, nil
+
+	default:
+		h.reply(ctx, "Пожалуйста, выберите действие из меню агента:", GetAgentMenuKeyboard())
+	}
+	return fsm.Stay, nil
+}
+
+// sendAgentTicketList отправляет агенту список тикетов с кнопками для открытия каждого
+func (h *Handler) sendAgentTicketList(ctx *fsm.Context, title string, emptyText string, tickets []database.Ticket) {
+	if len(tickets) == 0 {
+		h.reply(ctx, emptyText, nil)
+		return
+	}
+
+	rows := make([][]tgbotapi.InlineKeyboardButton, 0, len(tickets))
+	for _, ticket := range tickets {
+		label := truncateString(fmt.Sprintf("#%d %s %s", ticket.ID, ticket.Status.Emoji(), ticket.Title), 60)
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(label, fmt.Sprintf("agent_open_%d", ticket.ID)),
+		))
+	}
+
+	msg := tgbotapi.NewMessage(ctx.ChatID, fmt.Sprintf("%s (%d)", title, len(tickets)))
+	msg.ParseMode = "Markdown"
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
+	h.SafeSendMessage(msg)
+}
+
+func (h *Handler) enterAgentReply(ctx *fsm.Context) (string, error) {
+	h.reply(ctx, fmt.Sprintf("✏️ Напишите ответ пользователю или прикрепите файл — они будут добавлены в тикет #%d.\n\n"+
+		"⬅️ Для возврата в меню агента нажмите 'Назад'", dialogState(ctx).TicketID),
+		tgbotapi.NewReplyKeyboard(tgbotapi.NewKeyboardButtonRow(tgbotapi.NewKeyboardButton("⬅️ Назад"))))
+	return fsm.Stay, nil
+}
+
+func (h *Handler) handleAgentReply(ctx *fsm.Context) (string, error) {
+	ticketID := dialogState(ctx).TicketID
+
+	// Роль могли снять, пока агент был в режиме ответа
+	isAgent, err := h.deps.Users.IsAgent(ctx.UserID)
+	if err != nil {
+		logger.Error.Printf("Ошибка при проверке роли пользователя %d: %v", ctx.UserID, err)
+		h.SendErrorMessage(ctx.ChatID, "Произошла ошибка при проверке прав доступа")
+		return fsm.Stay, nil
+	}
+	if !isAgent {
+		h.reply(ctx, "⚠️ Отвечать в тикеты могут только сотрудники поддержки.", GetMainMenuKeyboard())
+		return fsm.Exit, nil
+	}
+
+	ticket, err := h.deps.Tickets.GetTicketByID(ticketID)
+	if err != nil {
+		logger.Error.With(logger.TicketID(ticketID)).Printf("Ошибка при получении тикета %d: %v", ticketID, err)
+		h.SendErrorMessage(ctx.ChatID, "Произошла ошибка при доступе к тикету")
+		return fsm.Stay, nil
+	}
+	if ticket.Status.IsFinal() {
+		h.reply(ctx, "🔒 Тикет закрыт и не может быть обновлен.", nil)
+		return stateAgentMenu, nil
+	}
+
+	if attachment := messageAttachment(ctx.Message); attachment != nil {
+		if err := h.saveTicketAttachment(attachment, ticketID, "support", ctx.UserID); err != nil {
+			logger.Error.With(logger.TicketID(ticketID)).Printf("Ошибка при сохранении вложения агента в тикет %d: %v", ticketID, err)
+			h.SendErrorMessage(ctx.ChatID, "Произошла ошибка при сохранении файла")
+			return fsm.Stay, nil
+		}
+		h.reply(ctx, fmt.Sprintf("✅ Файл прикреплен к тикету #%d: %s", ticketID, attachment.Kind.Title()), nil)
+	} else {
+		if strings.TrimSpace(ctx.Text()) == "" {
+			h.reply(ctx, "Пожалуйста, отправьте текст ответа или файл.", nil)
+			return fsm.Stay, nil
+		}
+
+		_, err := h.deps.Messages.AddTicketMessage(&database.TicketMessage{
+			TicketID:   ticketID,
+			SenderType: "support",
+			SenderID:   ctx.UserID,
+			Message:    ctx.Text(),
+		})
+		if err != nil {
+			logger.Error.With(logger.TicketID(ticketID)).Printf("Ошибка при добавлении ответа агента в тикет %d: %v", ticketID, err)
+			h.SendErrorMessage(ctx.ChatID, "Произошла ошибка при отправке ответа")
+			return fsm.Stay, nil
+		}
+		h.reply(ctx, fmt.Sprintf("✅ Ответ добавлен в тикет #%d.", ticketID), nil)
+	}
+
+	// После ответа поддержки тикет ждет реакции пользователя
+	err = h.deps.Tickets.UpdateTicketStatus(ticketID, database.StatusWaitingUser)
+	if err != nil {
+		logger.Error.With(logger.TicketID(ticketID)).Printf("Ошибка при обновлении статуса тикета %d: %v", ticketID, err)
+	}
+	return fsm.Stay, nil
+}
+
+// handleAgentCallback обрабатывает нажатия на inline-кнопки агента
+func (h *Handler) handleAgentCallback(query *tgbotapi.CallbackQuery, chatID int64) {
+	agentID := query.From.ID
+
+	isAgent, err := h.deps.Users.IsAgent(agentID)
+	if err != nil || !isAgent {
+		h.answerCallback(query.ID, "⚠️ Действие доступно только сотрудникам поддержки")
+		return
+	}
+
+	action, ticketID, err := parseTicketCallback(strings.TrimPrefix(query.Data, agentCallbackPrefix))
+	if err != nil {
+		logger.Warning.Printf("Не удалось разобрать callback агента %d: %v", agentID, err)
+		h.answerCallback(query.ID, "⚠️ Неизвестное действие")
+		return
+	}
+
+	ticket, err := h.deps.Tickets.GetTicketByID(ticketID)
+	if err != nil {
+		logger.Error.With(logger.TicketID(ticketID)).Printf("Ошибка при получении тикета %d: %v", ticketID, err)
+		h.answerCallback(query.ID, "⚠️ Тикет не найден")
+		return
+	}
+
+	switch {
+	case action == "open":
+		h.answerCallback(query.ID, "")
+		h.showAgentTicket(chatID, ticket)
+
+	case action == "take":
+		if err := h.deps.Tickets.AssignTicket(ticketID, agentID); err != nil {
+			logger.Warning.Printf("Агент %d не смог взять тикет %d: %v", agentID, ticketID, err)
+			h.answerCallback(query.ID, "⚠️ Тикет уже взят в работу другим агентом")
+			return
+		}
+		h.answerCallback(query.ID, fmt.Sprintf("✅ Тикет #%d назначен на вас", ticketID))
+
+	case action == "reply":
+		// Неназначенный тикет автоматически переходит к ответившему агенту
+		if !ticket.AssignedTo.Valid {
+			if err := h.deps.Tickets.AssignTicket(ticketID, agentID); err != nil {
+				logger.Warning.With(logger.TicketID(ticketID)).Printf("Не удалось назначить тикет %d агенту %d: %v", ticketID, agentID, err)
+			}
+		}
+		h.answerCallback(query.ID, "")
+		h.startDialog(chatID, agentID, stateAgentReply, &UserState{TicketID: ticketID})
+
+	case action == "status":
+		if ticket.Status.IsFinal() {
+			h.answerCallback(query.ID, "🔒 Статус закрытого тикета изменить нельзя")
+			return
+		}
+		h.answerCallback(query.ID, "")
+		msg := tgbotapi.NewMessage(chatID, fmt.Sprintf("📈 Выберите новый статус тикета #%d (текущий: %s):",
+			ticketID, ticket.Status.Label()))
+		msg.ReplyMarkup = GetAgentStatusKeyboard(ticketID, ticket.Status)
+		h.SafeSendMessage(msg)
+
+	case strings.HasPrefix(action, "set_"):
+		status, err := database.ParseTicketStatus(strings.TrimPrefix(action, "set_"))
+		if err != nil {
+			h.answerCallback(query.ID, "⚠️ Неизвестный статус")
+			return
+		}
+
+		err = h.deps.Tickets.UpdateTicketStatus(ticketID, status)
+		if errors.Is(err, database.ErrStatusTransition) {
+			h.answerCallback(query.ID, fmt.Sprintf("⚠️ Нельзя перевести тикет из статуса «%s» в «%s»",
+				ticket.Status.Title(), status.Title()))
+			return
+		}
+		if err != nil {
+			logger.Error.With(logger.TicketID(ticketID)).Printf("Ошибка при обновлении статуса тикета %d: %v", ticketID, err)
+			h.answerCallback(query.ID, "⚠️ Не удалось изменить статус")
+			return
+		}
+		h.answerCallback(query.ID, fmt.Sprintf("✅ Статус тикета #%d: %s", ticketID, status.Label()))
+
+	default:
+		logger.Warning.Printf("Неизвестное действие агента %q от пользователя %d", action, agentID)
+		h.answerCallback(query.ID, "⚠️ Неизвестное действие")
+	}
+}
+
+// showAgentTicket отправляет агенту карточку тикета с последними сообщениями и кнопками действий
+func (h *Handler) showAgentTicket(chatID int64, ticket *database.Ticket) {
+	messages, err := h.deps.Messages.GetTicketMessages(ticket.ID)
+	if err != nil {
+		logger.Error.With(logger.TicketID(ticket.ID)).Printf("Ошибка при получении сообщений тикета %d: %v", ticket.ID, err)
+		h.SendErrorMessage(chatID, "Не удалось загрузить сообщения тикета")
+		return
+	}
+
+	author, err := h.deps.Users.GetUserByID(ticket.UserID)
+	authorName := "Пользователь"
+	if err == nil && author.FullName != "" {
+		authorName = author.FullName
+	}
+
+	assignee := "не назначен"
+	if ticket.AssignedTo.Valid {
+		assignee = fmt.Sprintf("агент %d", ticket.AssignedTo.Int64)
+	}
+
+	category := h.findCategory(ticket.Category)
+	routing := ""
+	if category.RoutingGroup != "" {
+		routing = fmt.Sprintf("\n👥 Группа: %s", category.RoutingGroup)
+	}
+
+	var text strings.Builder
+	text.WriteString(fmt.Sprintf("🎫 Тикет #%d\n\n📝 Тема: %s\n👤 Автор: %s\n🏷️ Категория: %s\n⚡ Приоритет: %s%s\n📊 Статус: %s %s\n🧑‍💼 Исполнитель: %s\n\n💬 Последние сообщения:\n",
+		ticket.ID, ticket.Title, authorName, category.Label(), category.DefaultPriority.Label(), routing,
+		ticket.Status.Emoji(), ticket.Status.Title(), assignee))
+
+	// Показываем только последние сообщения, чтобы карточка помещалась в одно сообщение Telegram
+	const maxMessages = 10
+	if len(messages) > maxMessages {
+		messages = messages[len(messages)-maxMessages:]
+	}
+	for _, m := range messages {
+		sender := "👤 Пользователь"
+		if m.SenderType != "user" {
+			sender = "👨‍💼 Поддержка"
+		}
+		text.WriteString(fmt.Sprintf("\n%s (%s):\n%s\n", sender, m.CreatedAt.Format("02.01.2006 15:04"),
+			truncateString(m.Message, 300)))
+	}
+
+	msg := tgbotapi.NewMessage(chatID, text.String())
+	msg.ReplyMarkup = GetAgentTicketKeyboard(ticket.ID)
+	h.SafeSendMessage(msg)
+}
@@ -0,0 +1,494 @@
+package bot
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"supportTicketBotGo/database"
+	"supportTicketBotGo/logger"
+	"supportTicketBotGo/storage"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Кнопка просмотра вложений тикета. Старая подпись "🖼 Просмотреть фото"
+// продолжает работать у пользователей, которым еще не пришла новая клавиатура.
+const (
+	buttonViewAttachments       = "📎 Просмотреть вложения"
+	buttonViewAttachmentsLegacy = "🖼 Просмотреть фото"
+)
+
+// maxShownAttachments - сколько последних вложений показывает просмотрщик
+const maxShownAttachments = 50
+
+// mediaGroupLimit - наибольшее число файлов в одном альбоме sendMediaGroup
+const mediaGroupLimit = 10
+
+// defaultExtensions - расширения файлов по умолчанию, если их не удалось определить
+var defaultExtensions = map[database.AttachmentKind]string{
+	database.AttachmentPhoto:     ".jpg",
+	database.AttachmentDocument:  ".bin",
+	database.AttachmentVoice:     ".ogg",
+	database.AttachmentVideo:     ".mp4",
+	database.AttachmentVideoNote: ".mp4",
+	database.AttachmentAudio:     ".mp3",
+}
+
+// isViewAttachmentsButton проверяет, нажал ли пользователь кнопку просмотра вложений
+func isViewAttachmentsButton(text string) bool {
+	return text == buttonViewAttachments || text == buttonViewAttachmentsLegacy
+}
+
+// messageAttachment извлекает вложение из сообщения Telegram.
+// Возвращает nil, если в сообщении нет файла поддерживаемого типа.
+func messageAttachment(message *tgbotapi.Message) *database.TicketAttachment {
+	switch {
+	case len(message.Photo) > 0:
+		// Берем фотографию наилучшего качества
+		photo := message.Photo[len(message.Photo)-1]
+		return &database.TicketAttachment{
+			Kind: database.AttachmentPhoto, FileID: photo.FileID,
+			MimeType: "image/jpeg", FileSize: int64(photo.FileSize),
+		}
+	case message.Document != nil:
+		return &database.TicketAttachment{
+			Kind: database.AttachmentDocument, FileID: message.Document.FileID,
+			MimeType: message.Document.MimeType, FileSize: int64(message.Document.FileSize),
+			FileName: message.Document.FileName,
+		}
+	case message.Voice != nil:
+		return &database.TicketAttachment{
+			Kind: database.AttachmentVoice, FileID: message.Voice.FileID,
+			MimeType: message.Voice.MimeType, FileSize: int64(message.Voice.FileSize),
+		}
+	case message.Video != nil:
+		return &database.TicketAttachment{
+			Kind: database.AttachmentVideo, FileID: message.Video.FileID,
+			MimeType: message.Video.MimeType, FileSize: int64(message.Video.FileSize),
+			FileName: message.Video.FileName,
+		}
+	case message.VideoNote != nil:
+		return &database.TicketAttachment{
+			Kind: database.AttachmentVideoNote, FileID: message.VideoNote.FileID,
+			MimeType: "video/mp4", FileSize: int64(message.VideoNote.FileSize),
+		}
+	case message.Audio != nil:
+		return &database.TicketAttachment{
+			Kind: database.AttachmentAudio, FileID: message.Audio.FileID,
+			MimeType: message.Audio.MimeType, FileSize: int64(message.Audio.FileSize),
+			FileName: message.Audio.FileName,
+		}
+	}
+	return nil
+}
+
+// attachmentExt определяет расширение файла: по исходному имени, затем по MIME-типу
+// из сообщения, затем по Content-Type ответа Telegram
+func attachmentExt(attachment *database.TicketAttachment, contentType string) string {
+	if ext := filepath.Ext(attachment.FileName); ext != "" {
+		return strings.ToLower(ext)
+	}
+	for _, mimeType := range []string{attachment.MimeType, contentType} {
+		switch mimeType {
+		case "":
+			continue
+		case "image/jpeg", "image/jpg":
+			return ".jpg"
+		case "audio/ogg":
+			return ".ogg"
+		case "audio/mpeg":
+			return ".mp3"
+		}
+		if exts, err := mime.ExtensionsByType(mimeType); err == nil && len(exts) > 0 {
+			return exts[0]
+		}
+	}
+	return defaultExtensions[attachment.Kind]
+}
+
+// saveTicketAttachment скачивает файл из Telegram, сохраняет его в хранилище
+// и добавляет в тикет сообщение о прикреплении вместе с записью о вложении.
+// Если записать вложение в базу не удалось, файл удаляется из хранилища.
+func (h *Handler) saveTicketAttachment(attachment *database.TicketAttachment, ticketID int, senderType string, senderID int64) error {
+	// Скачиваем файл
+	resp, err := h.downloadFile(attachment.FileID)
+	if err != nil {
+		return fmt.Errorf("ошибка при скачивании файла: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if attachment.MimeType == "" {
+		attachment.MimeType = resp.Header.Get("Content-Type")
+	}
+
+	// Генерируем имя файла и ключ в хранилище
+	fileName := fmt.Sprintf("%d_%s%s", time.Now().Unix(), attachment.FileID, attachmentExt(attachment, resp.Header.Get("Content-Type")))
+	key := storage.AttachmentKey(ticketID, fileName)
+
+	// Сохраняем содержимое в хранилище
+	err = h.deps.Storage.Put(key, resp.Body, resp.ContentLength, attachment.MimeType)
+	if err != nil {
+		return fmt.Errorf("ошибка при сохранении файла: %v", err)
+	}
+	if attachment.FileSize == 0 && resp.ContentLength > 0 {
+		attachment.FileSize = resp.ContentLength
+	}
+
+	// Добавляем сообщение о прикреплении файла
+	displayName := attachment.FileName
+	if displayName == "" {
+		displayName = fileName
+	}
+	ticketMessage := &database.TicketMessage{
+		TicketID:   ticketID,
+		SenderType: senderType,
+		SenderID:   senderID,
+		Message:    fmt.Sprintf("прикрепил %s %s", attachment.Kind.Noun(), displayName),
+	}
+
+	// Получаем ID сообщения после его добавления
+	messageID, err := h.deps.Messages.AddTicketMessage(ticketMessage)
+	if err != nil {
+		h.deleteStoredFile(key)
+		return fmt.Errorf("ошибка при добавлении сообщения в тикет: %v", err)
+	}
+
+	// Сохраняем информацию о вложении в базу данных
+	attachment.TicketID = ticketID
+	attachment.SenderType = senderType
+	attachment.SenderID = senderID
+	attachment.StorageKey = key
+	attachment.MessageID = messageID
+
+	_, err = h.deps.Attachments.AddTicketAttachment(attachment)
+	if err != nil {
+		// Без записи о вложении файл никто не покажет - не оставляем его в хранилище
+		h.deleteStoredFile(key)
+		return fmt.Errorf("ошибка при сохранении информации о вложении: %v", err)
+	}
+
+	return nil
+}
+
+// deleteStoredFile удаляет из хранилища файл, который не удалось прикрепить к тикету
+func (h *Handler) deleteStoredFile(key string) {
+	if err := h.deps.Storage.Delete(key); err != nil {
+		logger.Error.Printf("Ошибка при удалении файла %s из хранилища: %v", key, err)
+	}
+}
+
+// attachmentSendConfig создает запрос отправки вложения подходящим методом Telegram.
+// У видеосообщений нет подписи, поэтому caption для них нужно отправлять отдельно.
+func attachmentSendConfig(chatID int64, attachment database.TicketAttachment, file tgbotapi.RequestFileData, caption string) tgbotapi.Chattable {
+	switch attachment.Kind {
+	case database.AttachmentPhoto:
+		config := tgbotapi.NewPhoto(chatID, file)
+		config.Caption = caption
+		return config
+	case database.AttachmentVoice:
+		config := tgbotapi.NewVoice(chatID, file)
+		config.Caption = caption
+		return config
+	case database.AttachmentVideo:
+		config := tgbotapi.NewVideo(chatID, file)
+		config.Caption = caption
+		return config
+	case database.AttachmentVideoNote:
+		return tgbotapi.NewVideoNote(chatID, 0, file)
+	case database.AttachmentAudio:
+		config := tgbotapi.NewAudio(chatID, file)
+		config.Caption = caption
+		return config
+	default:
+		config := tgbotapi.NewDocument(chatID, file)
+		config.Caption = caption
+		return config
+	}
+}
+
+// attachmentFileName возвращает имя, под которым вложение отправляется пользователю
+func attachmentFileName(attachment database.TicketAttachment, index int) string {
+	if attachment.FileName != "" {
+		return attachment.FileName
+	}
+	ext := path.Ext(attachment.StorageKey)
+	if ext == "" {
+		ext = defaultExtensions[attachment.Kind]
+	}
+	return fmt.Sprintf("%s_%d%s", attachment.Kind, index, ext)
+}
+
+// formatFileSize форматирует размер файла для подписи
+func formatFileSize(size int64) string {
+	switch {
+	case size >= 1<<20:
+		return fmt.Sprintf("%.1f МБ", float64(size)/(1<<20))
+	case size >= 1<<10:
+		return fmt.Sprintf("%.1f КБ", float64(size)/(1<<10))
+	default:
+		return fmt.Sprintf("%d Б", size)
+	}
+}
+
+// attachmentCaptionFunc формирует подпись к вложению с порядковым номером index (с нуля)
+type attachmentCaptionFunc func(index int, attachment database.TicketAttachment) string
+
+// isAlbumKind сообщает, можно ли отправить вложение в составе альбома с фото и видео
+func isAlbumKind(kind database.AttachmentKind) bool {
+	return kind == database.AttachmentPhoto || kind == database.AttachmentVideo
+}
+
+// sendTicketAttachments отправляет вложения: идущие подряд фото и видео - альбомами
+// до 10 штук, остальные - по одному. Каждый файл сначала отправляется по file_id,
+// и только если Telegram его не принимает - загружается из хранилища.
+// Возвращает число вложений, которые не удалось отправить.
+func (h *Handler) sendTicketAttachments(chatID int64, attachments []database.TicketAttachment, caption attachmentCaptionFunc) int {
+	failed := 0
+	var album []int
+
+	flush := func() {
+		switch len(album) {
+		case 0:
+		case 1:
+			i := album[0]
+			if err := h.sendTicketAttachment(chatID, attachments[i], i+1, caption(i, attachments[i])); err != nil {
+				logger.Error.Printf("Ошибка при отправке вложения %s: %v", attachments[i].StorageKey, err)
+				failed++
+			}
+		default:
+			failed += h.sendAttachmentAlbum(chatID, attachments, album, caption)
+		}
+		album = nil
+	}
+
+	for i, attachment := range attachments {
+		if isAlbumKind(attachment.Kind) {
+			album = append(album, i)
+			if len(album) == mediaGroupLimit {
+				flush()
+			}
+			continue
+		}
+
+		flush()
+		if err := h.sendTicketAttachment(chatID, attachment, i+1, caption(i, attachment)); err != nil {
+			logger.Error.Printf("Ошибка при отправке вложения %s: %v", attachment.StorageKey, err)
+			failed++
+		}
+	}
+	flush()
+
+	return failed
+}
+
+// sendTicketAttachment отправляет одно вложение по file_id, а если Telegram
+// его не принимает - загружает файл из хранилища
+func (h *Handler) sendTicketAttachment(chatID int64, attachment database.TicketAttachment, index int, caption string) error {
+	if attachment.Kind == database.AttachmentVideoNote && caption != "" {
+		h.SafeSendMessage(tgbotapi.NewMessage(chatID, caption))
+		caption = ""
+	}
+
+	if attachment.FileID != "" {
+		_, err := h.dispatcher.Send(attachmentSendConfig(chatID, attachment, tgbotapi.FileID(attachment.FileID), caption))
+		if err == nil {
+			return nil
+		}
+		logger.Warning.Printf("Не удалось отправить вложение %d по file_id, загружаем из хранилища: %v", attachment.ID, err)
+	}
+
+	data, err := h.readStoredFile(attachment.StorageKey)
+	if err != nil {
+		return err
+	}
+
+	fileData := tgbotapi.FileBytes{Name: attachmentFileName(attachment, index), Bytes: data}
+	sent, err := h.dispatcher.Send(attachmentSendConfig(chatID, attachment, fileData, caption))
+	if err != nil {
+		return err
+	}
+	h.refreshAttachmentFileID(attachment, sent)
+	return nil
+}
+
+// sendAttachmentAlbum отправляет фото и видео с индексами indexes одним альбомом.
+// Если Telegram не принимает какой-то из file_id, альбом загружается из хранилища.
+func (h *Handler) sendAttachmentAlbum(chatID int64, attachments []database.TicketAttachment, indexes []int, caption attachmentCaptionFunc) int {
+	media := make([]interface{}, 0, len(indexes))
+	byFileID := true
+	for _, i := range indexes {
+		if attachments[i].FileID == "" {
+			byFileID = false
+			break
+		}
+		media = append(media, albumMedia(attachments[i], tgbotapi.FileID(attachments[i].FileID), caption(i, attachments[i])))
+	}
+	if byFileID {
+		_, err := h.dispatcher.SendMediaGroup(tgbotapi.NewMediaGroup(chatID, media))
+		if err == nil {
+			return 0
+		}
+		logger.Warning.Printf("Не удалось отправить альбом по file_id, загружаем из хранилища: %v", err)
+	}
+
+	// Открываем файлы из хранилища; недоступные пропускаем, чтобы показать остальные
+	failed := 0
+	var uploaded []int
+	var uploads []tgbotapi.RequestFileData
+	media = media[:0]
+	for _, i := range indexes {
+		data, err := h.readStoredFile(attachments[i].StorageKey)
+		if err != nil {
+			logger.Error.Printf("Ошибка при получении вложения %s из хранилища: %v", attachments[i].StorageKey, err)
+			failed++
+			continue
+		}
+
+		fileData := tgbotapi.FileBytes{Name: attachmentFileName(attachments[i], i+1), Bytes: data}
+		media = append(media, albumMedia(attachments[i], fileData, caption(i, attachments[i])))
+		uploaded = append(uploaded, i)
+		uploads = append(uploads, fileData)
+	}
+
+	switch len(uploaded) {
+	case 0:
+		return failed
+	case 1:
+		// Альбом должен содержать хотя бы два элемента
+		i := uploaded[0]
+		sent, err := h.dispatcher.Send(attachmentSendConfig(chatID, attachments[i], uploads[0], caption(i, attachments[i])))
+		if err != nil {
+			logger.Error.Printf("Ошибка при отправке вложения %s: %v", attachments[i].StorageKey, err)
+			return failed + 1
+		}
+		h.refreshAttachmentFileID(attachments[i], sent)
+		return failed
+	}
+
+	sent, err := h.dispatcher.SendMediaGroup(tgbotapi.NewMediaGroup(chatID, media))
+	if err != nil {
+		logger.Error.Printf("Ошибка при отправке альбома вложений: %v", err)
+		return failed + len(uploaded)
+	}
+	for n, i := range uploaded {
+		if n < len(sent) {
+			h.refreshAttachmentFileID(attachments[i], sent[n])
+		}
+	}
+	return failed
+}
+
+// readStoredFile читает файл из хранилища целиком: очередь отправки может повторить
+// загрузку, а поток из хранилища прочитать второй раз нельзя
+func (h *Handler) readStoredFile(key string) ([]byte, error) {
+	file, err := h.deps.Storage.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return io.ReadAll(file)
+}
+
+// albumMedia создает элемент альбома для фото или видео
+func albumMedia(attachment database.TicketAttachment, file tgbotapi.RequestFileData, caption string) interface{} {
+	if attachment.Kind == database.AttachmentVideo {
+		video := tgbotapi.NewInputMediaVideo(file)
+		video.Caption = caption
+		return video
+	}
+	photo := tgbotapi.NewInputMediaPhoto(file)
+	photo.Caption = caption
+	return photo
+}
+
+// refreshAttachmentFileID запоминает file_id, который Telegram выдал при повторной загрузке файла,
+// чтобы в следующий раз отправить вложение без загрузки
+func (h *Handler) refreshAttachmentFileID(attachment database.TicketAttachment, sent tgbotapi.Message) {
+	uploaded := messageAttachment(&sent)
+	if uploaded == nil || uploaded.FileID == "" || uploaded.FileID == attachment.FileID {
+		return
+	}
+	err := h.deps.Attachments.UpdateTicketAttachmentFileID(attachment.ID, uploaded.FileID)
+	if err != nil {
+		logger.Error.Printf("Ошибка при обновлении file_id вложения %d: %v", attachment.ID, err)
+	}
+}
+
+// showTicketAttachments отображает вложения тикета, отправляя каждое подходящим методом
+func (h *Handler) showTicketAttachments(chatID int64, ticketID int) {
+	// Получаем все вложения тикета
+	attachments, err := h.deps.Attachments.GetTicketAttachments(ticketID)
+	if err != nil {
+		logger.Error.With(logger.TicketID(ticketID)).Printf("Ошибка при получении вложений тикета %d: %v", ticketID, err)
+		h.SendErrorMessage(chatID, "Не удалось загрузить вложения тикета")
+		return
+	}
+
+	if len(attachments) == 0 {
+		msg := tgbotapi.NewMessage(chatID, "📎 В этом тикете нет вложений.")
+		h.SafeSendMessage(msg)
+		return
+	}
+
+	// Отправляем сообщение с количеством вложений
+	msg := tgbotapi.NewMessage(chatID,
+		fmt.Sprintf("📎 *Вложения к тикету #%d*\n\nНайдено вложений: %d", ticketID, len(attachments)))
+	msg.ParseMode = "Markdown"
+	h.SafeSendMessage(msg)
+
+	// Показываем только последние вложения
+	total := len(attachments)
+	if total > maxShownAttachments {
+		attachments = attachments[total-maxShownAttachments:]
+		warningMsg := tgbotapi.NewMessage(chatID,
+			fmt.Sprintf("⚠️ Показаны только последние %d из %d вложений", maxShownAttachments, total))
+		h.SafeSendMessage(warningMsg)
+	}
+
+	// Имена сотрудников поддержки запрашиваем один раз на отправителя
+	senders := make(map[int64]string)
+	senderName := func(attachment database.TicketAttachment) string {
+		if attachment.SenderType == "user" {
+			return "👤 Вы"
+		}
+		if name, ok := senders[attachment.SenderID]; ok {
+			return name
+		}
+		supportName, err := h.deps.Users.GetUserNameByID(attachment.SenderID)
+		if err != nil {
+			supportName = "Поддержка"
+		}
+		senders[attachment.SenderID] = "👨‍💼 " + supportName
+		return senders[attachment.SenderID]
+	}
+
+	failed := h.sendTicketAttachments(chatID, attachments, func(i int, attachment database.TicketAttachment) string {
+		caption := fmt.Sprintf("%s #%d\n👤 Отправитель: %s\n🕒 Дата: %s",
+			attachment.Kind.Title(), i+1, senderName(attachment), attachment.CreatedAt.Format("02.01.2006 15:04"))
+		if attachment.FileName != "" {
+			caption += "\n📝 Файл: " + attachment.FileName
+		}
+		if attachment.FileSize > 0 {
+			caption += "\n💾 Размер: " + formatFileSize(attachment.FileSize)
+		}
+		return caption
+	})
+	if failed > 0 {
+		errorMsg := tgbotapi.NewMessage(chatID, fmt.Sprintf("⚠️ Недоступно вложений: %d", failed))
+		h.SafeSendMessage(errorMsg)
+	}
+
+	// Отправляем кнопку "Назад"
+	backMsg := tgbotapi.NewMessage(chatID, "⬅️ Для возврата к диалогу нажмите 'Назад'")
+	backMsg.ReplyMarkup = tgbotapi.NewReplyKeyboard(
+		tgbotapi.NewKeyboardButtonRow(
+			tgbotapi.NewKeyboardButton("⬅️ Назад"),
+		),
+	)
+	h.SafeSendMessage(backMsg)
+}
@@ -0,0 +1,235 @@
+package bot
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"supportTicketBotGo/database"
+	"supportTicketBotGo/logger"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Параметры доставки рассылок
+const (
+	broadcastBatchSize    = 50
+	broadcastPollInterval = 10 * time.Second // так подхватываются рассылки, запущенные из CLI
+	broadcastStaleAfter   = 5 * time.Minute
+	// broadcastMaxInFlight - сколько сообщений рассылки могут ждать ответа Telegram одновременно.
+	// Отправки не ждут друг друга, поэтому скорость задает rate, а не время ответа Bot API.
+	broadcastMaxInFlight = 100
+	// DefaultBroadcastRate - сообщений рассылки в секунду: часть общего лимита Telegram
+	// остается на ответы пользователям
+	DefaultBroadcastRate = 20.0
+)
+
+// Broadcaster отправляет сообщения запущенных рассылок (таблицы broadcasts и broadcast_recipients).
+// Получатели обрабатываются пачками; статус рассылки перечитывается перед каждой пачкой,
+// поэтому пауза и отмена вступают в силу в течение нескольких секунд.
+// Сообщения отправляются через диспетчер без ожидания ответа, результат записывается по его получении.
+type Broadcaster struct {
+	dispatcher *Dispatcher
+	mu         sync.Mutex // защищает bucket, который подменяется в SetRate
+	bucket     *tokenBucket
+	slots      chan struct{}  // занятые места для отправок, ожидающих ответа
+	inFlight   sync.WaitGroup // отправки, результат которых еще не записан
+	wake       chan struct{}
+	stop       chan struct{}
+	done       chan struct{}
+	stopOnce   sync.Once
+}
+
+// NewBroadcaster создает обработчик рассылок, отправляющий не больше rate сообщений в секунду
+func NewBroadcaster(dispatcher *Dispatcher, rate float64) *Broadcaster {
+	if rate <= 0 {
+		rate = DefaultBroadcastRate
+	}
+	return &Broadcaster{
+		dispatcher: dispatcher,
+		bucket:     newTokenBucket(rate, 1),
+		slots:      make(chan struct{}, broadcastMaxInFlight),
+		wake:       make(chan struct{}, 1),
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+}
+
+// SetRate меняет скорость рассылки; rate <= 0 - значение по умолчанию
+func (b *Broadcaster) SetRate(rate float64) {
+	if rate <= 0 {
+		rate = DefaultBroadcastRate
+	}
+	b.mu.Lock()
+	b.bucket = newTokenBucket(rate, 1)
+	b.mu.Unlock()
+}
+
+// Start запускает обработку рассылок в отдельной горутине
+func (b *Broadcaster) Start() {
+	go b.run()
+}
+
+// Wake сообщает обработчику о запуске или возобновлении рассылки. Не блокирует вызывающего.
+func (b *Broadcaster) Wake() {
+	select {
+	case b.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Stop останавливает обработку. Захваченные, но не отправленные получатели возвращаются в очередь.
+func (b *Broadcaster) Stop() {
+	b.stopOnce.Do(func() {
+		close(b.stop)
+		<-b.done
+	})
+}
+
+func (b *Broadcaster) run() {
+	defer close(b.done)
+
+	ticker := time.NewTicker(broadcastPollInterval)
+	defer ticker.Stop()
+
+	// Продолжаем рассылки, прерванные остановкой бота
+	b.processPending()
+
+	for {
+		select {
+		case <-b.stop:
+			return
+		case <-b.wake:
+		case <-ticker.C:
+		}
+		b.processPending()
+	}
+}
+
+// processPending отправляет сообщения всем захваченным получателям запущенных рассылок
+// и ждет записи результатов
+func (b *Broadcaster) processPending() {
+	defer b.inFlight.Wait()
+	for {
+		recipients, err := database.ClaimBroadcastRecipients(broadcastBatchSize, broadcastStaleAfter)
+		if err != nil {
+			logger.Error.Printf("Ошибка при получении получателей рассылок: %v", err)
+			return
+		}
+
+		broadcasts := make(map[int64]*database.Broadcast)
+		for i, recipient := range recipients {
+			broadcast, ok := broadcasts[recipient.BroadcastID]
+			if !ok {
+				broadcast, err = database.GetBroadcast(recipient.BroadcastID)
+				if err != nil {
+					logger.Error.Printf("Ошибка при получении рассылки %d: %v", recipient.BroadcastID, err)
+				}
+				broadcasts[recipient.BroadcastID] = broadcast
+			}
+			if broadcast == nil || broadcast.Status != database.BroadcastRunning {
+				b.release(recipients[i : i+1])
+				continue
+			}
+
+			if !b.waitTurn() {
+				b.release(recipients[i:])
+				return
+			}
+			b.deliver(broadcast, recipient)
+		}
+
+		if len(recipients) < broadcastBatchSize {
+			break
+		}
+	}
+
+	// Рассылка завершается, когда записаны результаты всех отправок
+	b.inFlight.Wait()
+	completed, err := database.CompleteFinishedBroadcasts()
+	if err != nil {
+		logger.Error.Printf("Ошибка при завершении рассылок: %v", err)
+		return
+	}
+	for _, id := range completed {
+		logger.Info.Printf("Рассылка %d завершена", id)
+	}
+}
+
+// deliver ставит сообщение рассылки одному получателю в очередь диспетчера; результат
+// записывается после ответа Telegram. Вызывается после waitTurn, занявшего место в slots.
+func (b *Broadcaster) deliver(broadcast *database.Broadcast, recipient database.BroadcastRecipient) {
+	msg := tgbotapi.NewMessage(recipient.UserID, broadcast.Text)
+	msg.ParseMode = broadcast.ParseMode
+
+	b.inFlight.Add(1)
+	err := b.dispatcher.SendAsync(msg, func(_ tgbotapi.Message, err error) {
+		b.record(broadcast, recipient, err)
+	})
+	if err != nil {
+		b.record(broadcast, recipient, err)
+	}
+}
+
+// record записывает результат отправки и освобождает место в slots
+func (b *Broadcaster) record(broadcast *database.Broadcast, recipient database.BroadcastRecipient, err error) {
+	defer b.inFlight.Done()
+	defer func() { <-b.slots }()
+
+	switch {
+	case err == nil:
+		err = database.MarkBroadcastRecipientSent(broadcast.ID, recipient.UserID)
+	case errors.Is(err, ErrDispatcherStopped):
+		err = database.ReleaseBroadcastRecipient(broadcast.ID, recipient.UserID)
+	case isBotBlocked(err):
+		logger.Info.Printf("Пользователь %d заблокировал бота, рассылка %d", recipient.UserID, broadcast.ID)
+		err = database.MarkBroadcastRecipientBlocked(broadcast.ID, recipient.UserID)
+	default:
+		logger.Warning.Printf("Ошибка при отправке рассылки %d пользователю %d: %v", broadcast.ID, recipient.UserID, err)
+		err = database.MarkBroadcastRecipientFailed(broadcast.ID, recipient.UserID, err.Error())
+	}
+	if err != nil {
+		logger.Error.Printf("Ошибка при записи результата рассылки %d для %d: %v", broadcast.ID, recipient.UserID, err)
+	}
+}
+
+// waitTurn ограничивает скорость рассылки и число отправок, ожидающих ответа.
+// Возвращает false, если обработчик останавливается.
+func (b *Broadcaster) waitTurn() bool {
+	select {
+	case b.slots <- struct{}{}:
+	case <-b.stop:
+		return false
+	}
+
+	b.mu.Lock()
+	at := b.bucket.reserve(time.Now())
+	b.mu.Unlock()
+	timer := time.NewTimer(time.Until(at))
+	defer timer.Stop()
+	select {
+	case <-b.stop:
+		<-b.slots
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// release возвращает захваченных получателей в очередь
+func (b *Broadcaster) release(recipients []database.BroadcastRecipient) {
+	for _, recipient := range recipients {
+		if err := database.ReleaseBroadcastRecipient(recipient.BroadcastID, recipient.UserID); err != nil {
+			logger.Error.Printf("Ошибка при возврате получателя %d рассылки %d в очередь: %v",
+				recipient.UserID, recipient.BroadcastID, err)
+		}
+	}
+}
+
+// isBotBlocked сообщает, что Telegram отказал в отправке, потому что пользователь
+// заблокировал бота или удалил аккаунт (403 Forbidden)
+func isBotBlocked(err error) bool {
+	var apiErr *tgbotapi.Error
+	return errors.As(err, &apiErr) && apiErr.Code == http.StatusForbidden
+}
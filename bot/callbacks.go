@@ -0,0 +1,122 @@
+package bot
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"supportTicketBotGo/logger"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Действия inline-клавиатуры тикета (префиксы callback data, см. GetTicketInlineKeyboard)
+const (
+	callbackPhotos = "photos"
+	callbackStatus = "status"
+	callbackReply  = "reply"
+	callbackClose  = "close"
+	callbackOpen   = "open" // кнопка уведомления, см. GetTicketNotificationKeyboard
+)
+
+// parseTicketCallback разбирает callback data вида "<действие>_<ID тикета>"
+func parseTicketCallback(data string) (string, int, error) {
+	sep := strings.LastIndex(data, "_")
+	if sep <= 0 || sep == len(data)-1 {
+		return "", 0, fmt.Errorf("некорректный формат callback data: %q", data)
+	}
+
+	ticketID, err := strconv.Atoi(data[sep+1:])
+	if err != nil {
+		return "", 0, fmt.Errorf("некорректный ID тикета в callback data %q: %v", data, err)
+	}
+
+	return data[:sep], ticketID, nil
+}
+
+// answerCallback подтверждает получение callback-запроса, чтобы у кнопки пропал индикатор загрузки.
+// Если text не пустой, Telegram покажет его пользователю во всплывающем уведомлении.
+func (h *Handler) answerCallback(callbackID string, text string) {
+	_, err := h.bot.Request(tgbotapi.NewCallback(callbackID, text))
+	if err != nil {
+		logger.Error.Printf("Ошибка при ответе на callback-запрос: %v", err)
+	}
+}
+
+// HandleCallbackQuery обрабатывает нажатия на inline-кнопки тикета
+func (h *Handler) HandleCallbackQuery(query *tgbotapi.CallbackQuery) {
+	userID := query.From.ID
+
+	// Сообщение может отсутствовать (например, если оно слишком старое),
+	// в личном чате с ботом ID чата совпадает с ID пользователя
+	chatID := userID
+	if query.Message != nil {
+		chatID = query.Message.Chat.ID
+	}
+
+	// Действия агентов поддержки проверяют права отдельно
+	if strings.HasPrefix(query.Data, agentCallbackPrefix) {
+		h.handleAgentCallback(query, chatID)
+		return
+	}
+
+	action, ticketID, err := parseTicketCallback(query.Data)
+	if err != nil {
+		logger.Warning.Printf("Не удалось разобрать callback от пользователя %d: %v", userID, err)
+		h.answerCallback(query.ID, "⚠️ Неизвестное действие")
+		return
+	}
+
+	// Проверяем, существует ли тикет и принадлежит ли он пользователю
+	ticket, err := h.deps.Tickets.GetTicketByID(ticketID)
+	if err != nil || ticket.UserID != userID {
+		logger.Warning.Printf("Пользователь %d запросил недоступный тикет %d: %v", userID, ticketID, err)
+		h.answerCallback(query.ID, "⚠️ Тикет не найден или у вас нет доступа к нему")
+		return
+	}
+
+	switch action {
+	case callbackOpen:
+		h.answerCallback(query.ID, "")
+		if ticket.Status.IsFinal() {
+			h.startDialog(chatID, userID, stateViewingHistoryTicket, &UserState{TicketID: ticketID})
+		} else {
+			h.startDialog(chatID, userID, stateViewingTicket, &UserState{TicketID: ticketID})
+		}
+
+	case callbackPhotos:
+		h.answerCallback(query.ID, "")
+		h.showTicketAttachments(chatID, ticketID)
+
+	case callbackStatus:
+		h.answerCallback(query.ID, "")
+		h.showTicketStatus(chatID, ticketID)
+
+	case callbackReply:
+		if ticket.Status.IsFinal() {
+			h.answerCallback(query.ID, "🔒 Тикет закрыт и не может быть обновлен")
+			return
+		}
+		h.answerCallback(query.ID, "")
+
+		// Переводим пользователя в режим диалога по тикету
+		h.setUserState(userID, &UserState{State: stateViewingTicket, TicketID: ticketID})
+
+		msg := tgbotapi.NewMessage(chatID,
+			fmt.Sprintf("✏️ Напишите сообщение или прикрепите файл — они будут добавлены в тикет #%d.", ticketID))
+		msg.ReplyMarkup = GetTicketReplyKeyboard()
+		h.SafeSendMessage(msg)
+
+	case callbackClose:
+		if ticket.Status.IsFinal() {
+			h.answerCallback(query.ID, "🔒 Тикет уже закрыт")
+			return
+		}
+		h.answerCallback(query.ID, "")
+		h.HandleCloseTicket(chatID, userID, ticketID)
+
+	default:
+		logger.Warning.Printf("Неизвестное действие callback %q от пользователя %d", action, userID)
+		h.answerCallback(query.ID, "⚠️ Неизвестное действие")
+	}
+}
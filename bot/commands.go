@@ -0,0 +1,148 @@
+package bot
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"supportTicketBotGo/database"
+	"supportTicketBotGo/logger"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// HandleTicketCommand обрабатывает команду /ticket <ID>: показывает карточку тикета
+// и переводит пользователя в режим просмотра тикета из истории
+func (h *Handler) HandleTicketCommand(message *tgbotapi.Message) {
+	args := message.CommandArguments()
+	if args == "" {
+		msg := tgbotapi.NewMessage(message.Chat.ID, "⚠️ Пожалуйста, укажите ID тикета: /ticket <ID>")
+		h.SafeSendMessage(msg)
+		return
+	}
+
+	// Преобразуем ID тикета в число
+	ticketID, err := strconv.Atoi(args)
+	if err != nil {
+		msg := tgbotapi.NewMessage(message.Chat.ID, "⚠️ Некорректный ID тикета. Используйте формат: /ticket <ID>")
+		h.SafeSendMessage(msg)
+		return
+	}
+
+	// Получаем информацию о тикете
+	ticket, err := h.deps.Tickets.GetTicketByID(ticketID)
+	if err != nil {
+		logger.Error.With(logger.TicketID(ticketID)).Printf("Ошибка при получении тикета %d: %v", ticketID, err)
+		msg := tgbotapi.NewMessage(message.Chat.ID, "⚠️ Тикет не найден или произошла ошибка при его получении.")
+		h.SafeSendMessage(msg)
+		return
+	}
+
+	// Проверяем, принадлежит ли тикет пользователю
+	if ticket.UserID != message.From.ID {
+		msg := tgbotapi.NewMessage(message.Chat.ID, "⚠️ У вас нет доступа к этому тикету.")
+		h.SafeSendMessage(msg)
+		return
+	}
+
+	h.startDialog(message.Chat.ID, message.From.ID, stateViewingHistoryTicket, &UserState{TicketID: ticketID})
+}
+
+// showTicketCard отправляет карточку тикета с историей сообщений и вложениями
+func (h *Handler) showTicketCard(chatID int64, ticketID int) {
+	ticket, err := h.deps.Tickets.GetTicketByID(ticketID)
+	if err != nil {
+		logger.Error.With(logger.TicketID(ticketID)).Printf("Ошибка при получении тикета %d: %v", ticketID, err)
+		h.SendErrorMessage(chatID, "Не удалось загрузить информацию о тикете")
+		return
+	}
+
+	// Получаем сообщения тикета
+	messages, err := h.deps.Messages.GetTicketMessages(ticketID)
+	if err != nil {
+		logger.Error.With(logger.TicketID(ticketID)).Printf("Ошибка при получении сообщений тикета %d: %v", ticketID, err)
+		msg := tgbotapi.NewMessage(chatID, "⚠️ Ошибка при получении сообщений тикета.")
+		h.SafeSendMessage(msg)
+		return
+	}
+
+	// Форматируем даты
+	createdDate := ticket.CreatedAt.Format("02.01.2006 15:04")
+	closedDate := ""
+	if ticket.Status == database.StatusClosed && ticket.ClosedAt.Valid {
+		closedDate = fmt.Sprintf("\n🔒 Закрыт: %s", ticket.ClosedAt.Time.Format("02.01.2006 15:04"))
+	}
+
+	// Определяем эмодзи статуса
+	statusEmoji := ticket.Status.Emoji()
+
+	// Создаем сообщение с информацией о тикете
+	ticketInfo := fmt.Sprintf(
+		"🔖 *Тикет #%d*\n%s %s\n\n📝 Категория: %s\n📅 Создан: %s%s\n💬 Сообщений: %d\n\n*Описание:*\n%s",
+		ticket.ID,
+		statusEmoji,
+		strings.ReplaceAll(ticket.Title, "*", "\\*"), // Экранируем звездочки
+		h.getCategoryName(ticket.Category),
+		createdDate,
+		closedDate,
+		len(messages),
+		strings.ReplaceAll(ticket.Description, "*", "\\*"), // Экранируем звездочки
+	)
+
+	msg := tgbotapi.NewMessage(chatID, ticketInfo)
+	msg.ParseMode = "Markdown"
+	if ticket.Status.IsFinal() {
+		msg.ReplyMarkup = GetClosedTicketInlineKeyboard(ticket.ID)
+	} else {
+		msg.ReplyMarkup = GetTicketInlineKeyboard(ticket.ID)
+	}
+	h.SafeSendMessage(msg)
+
+	// Отправляем историю сообщений
+	if len(messages) > 0 {
+		historyMsg := "📜 *История сообщений:*\n\n"
+		for i, m := range messages {
+			senderType := "👤 Вы"
+			if m.SenderType == "admin" || m.SenderType == "support" {
+				senderType = "👨‍💼 Поддержка"
+			}
+			msgTime := m.CreatedAt.Format("02.01.2006 15:04")
+			// Экранируем специальные символы в сообщении
+			messageText := strings.ReplaceAll(m.Message, "*", "\\*")
+			messageText = strings.ReplaceAll(messageText, "_", "\\_")
+			historyMsg += fmt.Sprintf("%d. %s (%s):\n%s\n\n", i+1, senderType, msgTime, messageText)
+		}
+
+		msg := tgbotapi.NewMessage(chatID, historyMsg)
+		msg.ParseMode = "Markdown"
+		h.SafeSendMessage(msg)
+	}
+
+	// Получаем и отправляем вложения тикета
+	attachments, err := h.deps.Attachments.GetTicketAttachments(ticketID)
+	if err != nil {
+		logger.Error.With(logger.TicketID(ticketID)).Printf("Ошибка при получении вложений тикета %d: %v", ticketID, err)
+	} else if len(attachments) > 0 {
+		attachmentsMsg := tgbotapi.NewMessage(chatID, "📎 *Вложения:*")
+		attachmentsMsg.ParseMode = "Markdown"
+		h.SafeSendMessage(attachmentsMsg)
+
+		h.sendTicketAttachments(chatID, attachments, func(i int, attachment database.TicketAttachment) string {
+			caption := fmt.Sprintf("%s #%d", attachment.Kind.Title(), i+1)
+			if attachment.SenderType == "user" {
+				return caption + " (от вас)"
+			}
+			return caption + " (от поддержки)"
+		})
+	}
+
+	// Показываем клавиатуру для навигации
+	keyboard := tgbotapi.NewReplyKeyboard(
+		tgbotapi.NewKeyboardButtonRow(
+			tgbotapi.NewKeyboardButton("⬅️ Назад к истории"),
+		),
+	)
+	navMsg := tgbotapi.NewMessage(chatID, "Используйте кнопку ниже для возврата к истории тикетов")
+	navMsg.ReplyMarkup = keyboard
+	h.SafeSendMessage(navMsg)
+}
@@ -0,0 +1,67 @@
+package bot
+
+import (
+	"supportTicketBotGo/database"
+	"supportTicketBotGo/fsm"
+	"supportTicketBotGo/storage"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Deps - зависимости обработчиков бота: хранилища данных, файлов и состояний диалогов.
+// Обработчики не обращаются к PostgreSQL напрямую, поэтому в тестах
+// их можно запустить на database.MemoryStore и MemoryStateStore.
+type Deps struct {
+	Users       database.UserRepository
+	Tickets     database.TicketRepository
+	Messages    database.MessageRepository
+	Attachments database.AttachmentRepository
+	Categories  database.CategoryRepository
+	States      StateStore
+	Storage     storage.Storage
+}
+
+// NewPostgresDeps возвращает зависимости на PostgreSQL с указанными хранилищами состояний и файлов
+func NewPostgresDeps(states StateStore, files storage.Storage) Deps {
+	store := database.NewPostgresStore()
+	return Deps{
+		Users: store, Tickets: store, Messages: store, Attachments: store, Categories: store,
+		States: states, Storage: files,
+	}
+}
+
+// NewMemoryDeps возвращает зависимости, целиком хранящие данные в памяти процесса
+func NewMemoryDeps() Deps {
+	store := database.NewMemoryStore()
+	return Deps{
+		Users: store, Tickets: store, Messages: store, Attachments: store, Categories: store,
+		States: NewMemoryStateStore(DefaultStateTTL), Storage: storage.NewMemoryStorage(),
+	}
+}
+
+// complete сообщает, заданы ли все зависимости
+func (d Deps) complete() bool {
+	return d.Users != nil && d.Tickets != nil && d.Messages != nil && d.Attachments != nil &&
+		d.Categories != nil && d.States != nil && d.Storage != nil
+}
+
+// Handler обрабатывает обновления Telegram: команды, сообщения и нажатия на кнопки.
+// Все, с чем работают обработчики, передается при создании, поэтому несколько
+// обработчиков с разными хранилищами (например, в параллельных тестах) не мешают друг другу.
+type Handler struct {
+	bot        *tgbotapi.BotAPI
+	deps       Deps
+	dispatcher *Dispatcher
+	dialogs    *fsm.Machine
+}
+
+// NewHandler создает обработчик, отправляющий сообщения через dispatcher.
+// Паникует, если какая-то из зависимостей не задана: это ошибка при запуске, а не во время работы.
+func NewHandler(bot *tgbotapi.BotAPI, deps Deps, dispatcher *Dispatcher) *Handler {
+	if !deps.complete() {
+		panic("bot: не заданы зависимости обработчика")
+	}
+	h := &Handler{bot: bot, deps: deps, dispatcher: dispatcher}
+	h.dialogs = h.newDialogMachine()
+	return h
+}
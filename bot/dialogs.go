@@ -0,0 +1,578 @@
+package bot
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"supportTicketBotGo/database"
+	"supportTicketBotGo/fsm"
+	"supportTicketBotGo/logger"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Состояния диалогов
+const (
+	stateAwaitingFullName = "awaiting_fullname"
+	stateAwaitingPhone    = "awaiting_phone"
+
+	stateTicketCategory    = "creating_ticket_category"
+	stateTicketDescription = "creating_ticket_description"
+	stateTicketConfirm     = "creating_ticket_confirm"
+
+	stateViewingTickets       = "viewing_tickets"
+	stateViewingTicket        = "viewing_ticket"
+	stateViewingHistory       = "viewing_history"
+	stateViewingHistoryTicket = "viewing_history_ticket"
+)
+
+// Тексты кнопок отмены и возврата, обрабатываемые машиной состояний
+var cancelButtons = []string{"❌ Отмена", "Отмена", "⬅️ Назад", "⬅️ Назад к истории"}
+
+// newDialogMachine создает машину состояний всех диалогов бота
+func (h *Handler) newDialogMachine() *fsm.Machine {
+	m := fsm.New(func(ctx *fsm.Context, text string, markup interface{}) {
+		msg := tgbotapi.NewMessage(ctx.ChatID, text)
+		if markup != nil {
+			msg.ReplyMarkup = markup
+		}
+		h.SafeSendMessage(msg)
+	})
+	m.OnCancel(cancelButtons, h.cancelDialog)
+
+	// Регистрация
+	m.Register(fsm.State{
+		Name:          stateAwaitingFullName,
+		Prompt:        "Пожалуйста, введите ваше полное имя (Фамилия Имя Отчество):",
+		Keyboard:      removeKeyboard,
+		Handle:        h.handleFullName,
+		Transitions:   []string{stateAwaitingPhone},
+		DisableCancel: true,
+	})
+	m.Register(fsm.State{
+		Name:          stateAwaitingPhone,
+		Prompt:        "Спасибо! Теперь, пожалуйста, поделитесь своим контактом:",
+		Keyboard:      func() interface{} { return GetContactKeyboard() },
+		Handle:        h.handlePhone,
+		DisableCancel: true,
+	})
+
+	// Создание тикета
+	m.Register(fsm.State{
+		Name:        stateTicketCategory,
+		Prompt:      "🎯 Выберите категорию обращения:",
+		Keyboard:    func() interface{} { return GetCategoryKeyboard(h.activeCategories()) },
+		Handle:      h.handleTicketCategory,
+		Transitions: []string{stateTicketDescription},
+	})
+	m.Register(fsm.State{
+		Name:        stateTicketDescription,
+		Prompt:      "Пожалуйста, введите описание вашего обращения:",
+		Keyboard:    removeKeyboard,
+		Handle:      h.handleTicketDescription,
+		Transitions: []string{stateTicketConfirm},
+	})
+	m.Register(fsm.State{
+		Name:    stateTicketConfirm,
+		OnEnter: h.enterTicketConfirm,
+		Handle:  h.handleTicketConfirm,
+	})
+
+	// Просмотр активных тикетов
+	m.Register(fsm.State{
+		Name:        stateViewingTickets,
+		OnEnter:     h.enterViewingTickets,
+		Handle:      h.handleViewingTickets,
+		Transitions: []string{stateViewingTicket},
+	})
+	m.Register(fsm.State{
+		Name:    stateViewingTicket,
+		OnEnter: h.enterViewingTicket,
+		Handle:  h.handleViewingTicket,
+		Back:    stateViewingTickets,
+	})
+
+	// Просмотр истории тикетов
+	m.Register(fsm.State{
+		Name:    stateViewingHistory,
+		OnEnter: h.enterViewingHistory,
+		Handle:  func(ctx *fsm.Context) (string, error) { return fsm.Exit, nil },
+	})
+	m.Register(fsm.State{
+		Name:    stateViewingHistoryTicket,
+		OnEnter: h.enterViewingHistoryTicket,
+		Handle:  h.handleViewingHistoryTicket,
+		Back:    stateViewingHistory,
+	})
+
+	// Режим агента поддержки
+	h.registerAgentDialogs(m)
+
+	return m
+}
+
+// dialogState возвращает данные диалога из контекста машины состояний
+func dialogState(ctx *fsm.Context) *UserState {
+	return ctx.Data.(*UserState)
+}
+
+// startDialog переводит пользователя в состояние name и сохраняет результат
+func (h *Handler) startDialog(chatID int64, userID int64, name string, state *UserState) {
+	ctx := &fsm.Context{Bot: h.bot, UserID: userID, ChatID: chatID, Data: state}
+	next, err := h.dialogs.Start(ctx, name)
+	h.saveDialog(ctx, next, err)
+}
+
+// runDialog обрабатывает сообщение в текущем состоянии пользователя и сохраняет результат
+func (h *Handler) runDialog(message *tgbotapi.Message, state *UserState) {
+	ctx := &fsm.Context{
+		Bot:     h.bot,
+		Message: message,
+		UserID:  message.From.ID,
+		ChatID:  message.Chat.ID,
+		State:   state.State,
+		Data:    state,
+	}
+	next, err := h.dialogs.Handle(ctx)
+	h.saveDialog(ctx, next, err)
+}
+
+// saveDialog сохраняет или удаляет состояние пользователя после перехода
+func (h *Handler) saveDialog(ctx *fsm.Context, next string, err error) {
+	if err != nil {
+		logger.Error.Printf("Ошибка в диалоге пользователя %d (состояние %s): %v", ctx.UserID, ctx.State, err)
+		h.SendErrorMessage(ctx.ChatID, "Произошла ошибка, попробуйте еще раз")
+	}
+
+	if next == fsm.Exit || next == "" {
+		h.clearUserState(ctx.UserID)
+		return
+	}
+
+	state := dialogState(ctx)
+	state.State = next
+	h.setUserState(ctx.UserID, state)
+}
+
+// cancelDialog - глобальное поведение кнопок отмены: возврат в главное меню
+func (h *Handler) cancelDialog(ctx *fsm.Context) (string, error) {
+	text := "🏠 Главное меню"
+	if strings.HasPrefix(ctx.State, "creating_ticket") {
+		text = "❌ Создание тикета отменено."
+	}
+
+	msg := tgbotapi.NewMessage(ctx.ChatID, text)
+	msg.ReplyMarkup = GetMainMenuKeyboard()
+	h.SafeSendMessage(msg)
+	return fsm.Exit, nil
+}
+
+func removeKeyboard() interface{} {
+	return tgbotapi.NewRemoveKeyboard(false)
+}
+
+// reply отправляет текстовый ответ в чат диалога
+func (h *Handler) reply(ctx *fsm.Context, text string, markup interface{}) {
+	msg := tgbotapi.NewMessage(ctx.ChatID, text)
+	if markup != nil {
+		msg.ReplyMarkup = markup
+	}
+	h.SafeSendMessage(msg)
+}
+
+// --- Регистрация ---
+
+func (h *Handler) handleFullName(ctx *fsm.Context) (string, error) {
+	// Проверяем ФИО
+	if !validateFullName(ctx.Text()) {
+		h.reply(ctx, "Некорректное ФИО. Пожалуйста, введите полное имя (Фамилия Имя Отчество):", nil)
+		return fsm.Stay, nil
+	}
+
+	// Сохраняем ФИО и запрашиваем контакт
+	dialogState(ctx).FullName = ctx.Text()
+	return stateAwaitingPhone, nil
+}
+
+func (h *Handler) handlePhone(ctx *fsm.Context) (string, error) {
+	message := ctx.Message
+	state := dialogState(ctx)
+
+	// Ожидаем, что пользователь поделится контактом
+	if message.Contact == nil {
+		h.reply(ctx, "Пожалуйста, нажмите кнопку 'Поделиться контактом':", GetContactKeyboard())
+		return fsm.Stay, nil
+	}
+
+	// Проверяем, что телефон принадлежит этому пользователю
+	if message.Contact.UserID != message.From.ID {
+		h.reply(ctx, "Пожалуйста, поделитесь своим контактом, а не чужим:", GetContactKeyboard())
+		return fsm.Stay, nil
+	}
+
+	// Сохраняем телефон и сразу завершаем регистрацию
+	state.Phone = message.Contact.PhoneNumber
+	state.LocationLat = 0.0
+	state.LocationLng = 0.0
+	// Устанавливаем дату рождения по умолчанию (нулевая дата)
+	state.BirthDate = time.Time{}
+
+	// Пытаемся сохранить аватар пользователя
+	hasAvatar, err := h.saveUserAvatar(ctx.UserID)
+	if err != nil {
+		logger.Warning.Printf("Не удалось сохранить аватар пользователя %d: %v", ctx.UserID, err)
+	}
+
+	// Завершаем регистрацию
+	user := &database.User{
+		ID:           ctx.UserID,
+		FullName:     state.FullName,
+		Phone:        state.Phone,
+		LocationLat:  state.LocationLat,
+		LocationLng:  state.LocationLng,
+		BirthDate:    state.BirthDate,
+		IsRegistered: true,
+		HasAvatar:    hasAvatar,
+	}
+
+	err = h.deps.Users.UpdateUserRegistration(user)
+	if err != nil {
+		logger.Error.Printf("Ошибка при обновлении данных пользователя %d: %v", ctx.UserID, err)
+		h.SendErrorMessage(ctx.ChatID, "Произошла ошибка при регистрации")
+		return fsm.Exit, nil
+	}
+
+	// Отправляем сообщение об успешной регистрации
+	h.reply(ctx, "Поздравляем! Вы успешно зарегистрированы в системе поддержки.", GetMainMenuKeyboard())
+	return fsm.Exit, nil
+}
+
+// --- Создание тикета ---
+
+func (h *Handler) handleTicketCategory(ctx *fsm.Context) (string, error) {
+	categories := h.activeCategories()
+	text := strings.TrimSpace(ctx.Text())
+
+	// Принимаем и текст кнопки, и название категории без эмодзи
+	for _, c := range categories {
+		if text == c.Label() || strings.EqualFold(text, c.Name) {
+			dialogState(ctx).TicketCat = c.Code
+			return stateTicketDescription, nil
+		}
+	}
+
+	h.reply(ctx, "Пожалуйста, выберите категорию из предложенных вариантов:", GetCategoryKeyboard(categories))
+	return fsm.Stay, nil
+}
+
+func (h *Handler) handleTicketDescription(ctx *fsm.Context) (string, error) {
+	text := ctx.Text()
+
+	// Сохраняем описание тикета
+	if len(text) < 10 || len(text) > 1000 {
+		h.reply(ctx, "Описание должно содержать от 10 до 1000 символов. Пожалуйста, введите корректное описание:", nil)
+		return fsm.Stay, nil
+	}
+
+	state := dialogState(ctx)
+	state.TicketDesc = text
+
+	// Автоматически генерируем заголовок тикета
+	state.TicketTitle = generateTicketTitle(h.findCategory(state.TicketCat), state.TicketDesc)
+	return stateTicketConfirm, nil
+}
+
+func (h *Handler) enterTicketConfirm(ctx *fsm.Context) (string, error) {
+	state := dialogState(ctx)
+
+	// Предлагаем подтвердить создание тикета
+	confirmText := fmt.Sprintf("Пожалуйста, подтвердите создание тикета:\n\n"+
+		"Заголовок: %s\n"+
+		"Описание: %s\n"+
+		"Категория: %s\n\n"+
+		"Всё верно?", state.TicketTitle, state.TicketDesc, h.getCategoryName(state.TicketCat))
+
+	h.reply(ctx, confirmText, GetConfirmKeyboard())
+	return fsm.Stay, nil
+}
+
+func (h *Handler) handleTicketConfirm(ctx *fsm.Context) (string, error) {
+	state := dialogState(ctx)
+
+	switch ctx.Text() {
+	case "✅ Да", "Да":
+		// Создаем тикет в базе данных
+		ticket := &database.Ticket{
+			UserID:      ctx.UserID,
+			Title:       state.TicketTitle,
+			Description: state.TicketDesc,
+			Status:      database.StatusCreated,
+			Category:    state.TicketCat,
+		}
+
+		ticketID, err := h.deps.Tickets.CreateTicket(ticket)
+		if err != nil {
+			logger.Error.Printf("Ошибка при создании тикета для пользователя %d: %v", ctx.UserID, err)
+			h.SendErrorMessage(ctx.ChatID, "Произошла ошибка при создании тикета")
+			return fsm.Stay, nil
+		}
+
+		// Создаем первое сообщение в тикете
+		ticketMessage := &database.TicketMessage{
+			TicketID:   ticketID,
+			SenderType: "user",
+			SenderID:   ctx.UserID,
+			Message:    state.TicketDesc,
+		}
+
+		_, err = h.deps.Messages.AddTicketMessage(ticketMessage)
+		if err != nil {
+			logger.Error.Printf("Ошибка при добавлении сообщения в тикет для пользователя %d: %v", ctx.UserID, err)
+		}
+
+		// Отправляем сообщение об успешном создании тикета
+		h.reply(ctx, fmt.Sprintf("🎊 Тикет #%d успешно создан! Наши специалисты свяжутся с вами в ближайшее время.", ticketID),
+			GetMainMenuKeyboard())
+		return fsm.Exit, nil
+
+	case "❌ Нет", "Нет":
+		// Отменяем создание тикета
+		h.reply(ctx, "❌ Создание тикета отменено.", GetMainMenuKeyboard())
+		return fsm.Exit, nil
+
+	default:
+		// Некорректный ответ
+		h.reply(ctx, "Пожалуйста, выберите 'Да' или 'Нет':", GetConfirmKeyboard())
+		return fsm.Stay, nil
+	}
+}
+
+// --- Просмотр активных тикетов ---
+
+func (h *Handler) enterViewingTickets(ctx *fsm.Context) (string, error) {
+	tickets, err := h.deps.Tickets.GetActiveTicketsByUserID(ctx.UserID)
+	if err != nil {
+		logger.Error.Printf("Ошибка при получении активных тикетов пользователя %d: %v", ctx.UserID, err)
+		h.SendErrorMessage(ctx.ChatID, "Произошла ошибка при получении тикетов")
+		return fsm.Exit, nil
+	}
+
+	if len(tickets) == 0 {
+		h.reply(ctx, "📭 У вас нет активных тикетов.", GetMainMenuKeyboard())
+		return fsm.Exit, nil
+	}
+
+	// Создаем клавиатуру с тикетами
+	ticketButtons := make([][]tgbotapi.KeyboardButton, 0, len(tickets)+1)
+
+	for _, ticket := range tickets {
+		// Получаем количество сообщений в тикете
+		count, err := h.deps.Messages.GetTicketMessageCount(ticket.ID)
+		if err != nil {
+			logger.Error.With(logger.TicketID(ticket.ID)).Printf("Ошибка при получении количества сообщений тикета %d: %v", ticket.ID, err)
+			count = 0
+		}
+
+		// Определяем эмодзи статуса
+		statusEmoji := ticket.Status.Emoji()
+
+		// Создаем кнопку с информацией о тикете
+		buttonLabel := fmt.Sprintf("#%d %s %s | %d смс",
+			ticket.ID, statusEmoji, ticket.Title, count)
+
+		ticketButtons = append(ticketButtons, tgbotapi.NewKeyboardButtonRow(
+			tgbotapi.NewKeyboardButton(buttonLabel),
+		))
+	}
+
+	// Добавляем кнопку "Назад"
+	ticketButtons = append(ticketButtons, tgbotapi.NewKeyboardButtonRow(
+		tgbotapi.NewKeyboardButton("⬅️ Назад"),
+	))
+
+	h.reply(ctx, "Ваши активные тикеты:", tgbotapi.NewReplyKeyboard(ticketButtons...))
+	return fsm.Stay, nil
+}
+
+func (h *Handler) handleViewingTickets(ctx *fsm.Context) (string, error) {
+	// Проверяем, нажал ли пользователь на тикет
+	// Формат кнопки: "#ID статус заголовок | N смс"
+	ticketID, ok := h.parseTicketButton(ctx)
+	if !ok {
+		return fsm.Stay, nil
+	}
+
+	dialogState(ctx).TicketID = ticketID
+	return stateViewingTicket, nil
+}
+
+// parseTicketButton извлекает ID тикета из текста кнопки списка и проверяет доступ к нему
+func (h *Handler) parseTicketButton(ctx *fsm.Context) (int, bool) {
+	text := ctx.Text()
+	if !strings.HasPrefix(text, "#") {
+		// Если сообщение не распознано, просим выбрать тикет из списка
+		h.reply(ctx, "Пожалуйста, выберите тикет из списка или нажмите 'Назад':", nil)
+		return 0, false
+	}
+
+	parts := strings.Split(text, " ")
+	if len(parts) < 2 {
+		// Некорректный формат
+		h.reply(ctx, "Не удалось определить тикет. Пожалуйста, выберите тикет из списка:", nil)
+		return 0, false
+	}
+
+	// Извлекаем ID тикета из текста кнопки
+	ticketIDStr := parts[0][1:] // Убираем символ # в начале
+	ticketID, err := strconv.Atoi(ticketIDStr)
+	if err != nil {
+		logger.Error.Printf("Ошибка при парсинге ID тикета: %v", err)
+		h.reply(ctx, "Не удалось определить ID тикета. Пожалуйста, выберите тикет из списка:", nil)
+		return 0, false
+	}
+
+	// Проверяем, существует ли тикет и принадлежит ли он пользователю
+	ticket, err := h.deps.Tickets.GetTicketByID(ticketID)
+	if err != nil || ticket.UserID != ctx.UserID {
+		logger.Error.With(logger.TicketID(ticketID)).Printf("Ошибка при получении тикета %d: %v", ticketID, err)
+		h.reply(ctx, "Тикет не найден или вы не имеете доступа к нему.", nil)
+		return 0, false
+	}
+
+	return ticketID, true
+}
+
+func (h *Handler) enterViewingTicket(ctx *fsm.Context) (string, error) {
+	// Загружаем сообщения тикета
+	h.showTicketConversation(ctx.ChatID, dialogState(ctx).TicketID)
+	return fsm.Stay, nil
+}
+
+func (h *Handler) handleViewingTicket(ctx *fsm.Context) (string, error) {
+	message := ctx.Message
+	state := dialogState(ctx)
+
+	// Если пользователь нажал "Просмотреть вложения"
+	if isViewAttachmentsButton(message.Text) {
+		h.showTicketAttachments(ctx.ChatID, state.TicketID)
+		return fsm.Stay, nil
+	}
+
+	// Проверяем, активен ли тикет
+	ticket, err := h.deps.Tickets.GetTicketByID(state.TicketID)
+	if err != nil {
+		logger.Error.Printf("Ошибка при получении тикета %d: %v", state.TicketID, err)
+		h.SendErrorMessage(ctx.ChatID, "Произошла ошибка при доступе к тикету")
+		return fsm.Stay, nil
+	}
+
+	if ticket.Status.IsFinal() {
+		h.reply(ctx, "Тикет закрыт и не может быть обновлен.", nil)
+		return fsm.Stay, nil
+	}
+
+	// Проверяем, есть ли в сообщении файл (фото, документ, голосовое, видео или аудио)
+	if attachment := messageAttachment(message); attachment != nil {
+		h.attachTicketFile(ctx, state.TicketID, attachment)
+		return fsm.Stay, nil
+	}
+
+	// Если пользователь нажал "Закрыть тикет"
+	if message.Text == "❌ Закрыть тикет" {
+		// Закрываем тикет
+		err := h.deps.Tickets.CloseTicket(state.TicketID, ctx.UserID)
+		if err != nil {
+			logger.Error.Printf("Ошибка при закрытии тикета %d: %v", state.TicketID, err)
+			h.SendErrorMessage(ctx.ChatID, fmt.Sprintf("Не удалось закрыть тикет: %v", err))
+			return fsm.Stay, nil
+		}
+
+		h.reply(ctx, "✅ Тикет успешно закрыт", GetMainMenuKeyboard())
+		return fsm.Exit, nil
+	}
+
+	// Сообщения без текста (стикеры, геопозиция и т.п.) в тикет не сохраняем
+	if strings.TrimSpace(message.Text) == "" {
+		h.reply(ctx, "⚠️ Такой тип сообщения не поддерживается. Отправьте текст, фото, документ, голосовое сообщение или видео.", nil)
+		return fsm.Stay, nil
+	}
+
+	// Добавляем сообщение пользователя в тикет
+	ticketMessage := &database.TicketMessage{
+		TicketID:   state.TicketID,
+		SenderType: "user",
+		SenderID:   ctx.UserID,
+		Message:    message.Text,
+	}
+
+	messageID, err := h.deps.Messages.AddTicketMessage(ticketMessage)
+	if err != nil {
+		logger.Error.Printf("Ошибка при добавлении сообщения в тикет %d: %d %v", state.TicketID, messageID, err)
+		h.SendErrorMessage(ctx.ChatID, "Произошла ошибка при отправке сообщения")
+		return fsm.Stay, nil
+	}
+
+	// Пользователь ответил - тикет ждет действий поддержки
+	err = h.deps.Tickets.UpdateTicketStatus(state.TicketID, database.StatusWaitingSupport)
+	if err != nil {
+		logger.Error.Printf("Ошибка при обновлении статуса тикета %d: %v", state.TicketID, err)
+	}
+
+	// Отправляем уведомление об успешной отправке сообщения
+	h.reply(ctx, "🎉 Ваше сообщение успешно отправлено!", nil)
+
+	// Показываем обновленный диалог
+	h.showTicketConversation(ctx.ChatID, state.TicketID)
+	return fsm.Stay, nil
+}
+
+// attachTicketFile сохраняет вложение пользователя из сообщения и прикрепляет его к тикету
+func (h *Handler) attachTicketFile(ctx *fsm.Context, ticketID int, attachment *database.TicketAttachment) {
+	err := h.saveTicketAttachment(attachment, ticketID, "user", ctx.UserID)
+	if err != nil {
+		logger.Error.With(logger.TicketID(ticketID)).Printf("Ошибка при сохранении вложения в тикет %d: %v", ticketID, err)
+		h.SendErrorMessage(ctx.ChatID, "Произошла ошибка при сохранении файла")
+		return
+	}
+
+	// Пользователь прислал файл - тикет ждет действий поддержки
+	err = h.deps.Tickets.UpdateTicketStatus(ticketID, database.StatusWaitingSupport)
+	if err != nil {
+		logger.Error.With(logger.TicketID(ticketID)).Printf("Ошибка при обновлении статуса тикета %d: %v", ticketID, err)
+	}
+
+	// Подтверждаем прикрепление файла
+	h.reply(ctx, fmt.Sprintf("✅ Файл успешно прикреплен к тикету: %s", attachment.Kind.Title()), nil)
+
+	// Показываем обновленный диалог
+	h.showTicketConversation(ctx.ChatID, ticketID)
+}
+
+// --- Просмотр истории тикетов ---
+
+func (h *Handler) enterViewingHistory(ctx *fsm.Context) (string, error) {
+	h.showTicketHistory(ctx.ChatID, ctx.UserID)
+	// История - это список карточек с командами /ticket, отдельного ввода она не ожидает
+	return fsm.Exit, nil
+}
+
+func (h *Handler) enterViewingHistoryTicket(ctx *fsm.Context) (string, error) {
+	h.showTicketCard(ctx.ChatID, dialogState(ctx).TicketID)
+	return fsm.Stay, nil
+}
+
+func (h *Handler) handleViewingHistoryTicket(ctx *fsm.Context) (string, error) {
+	// Если пользователь нажал "Просмотреть вложения"
+	if isViewAttachmentsButton(ctx.Text()) {
+		h.showTicketAttachments(ctx.ChatID, dialogState(ctx).TicketID)
+		return fsm.Stay, nil
+	}
+
+	// В режиме просмотра истории нельзя отправлять сообщения
+	h.reply(ctx, "📖 Этот тикет открыт только для просмотра.\n\n"+
+		"📎 Вы можете просмотреть вложения тикета\n"+
+		"⬅️ Или вернуться к истории тикетов", nil)
+	return fsm.Stay, nil
+}
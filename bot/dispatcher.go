@@ -0,0 +1,434 @@
+package bot
+
+import (
+	"errors"
+	"math/rand"
+	"net"
+	"net/http"
+	"reflect"
+	"sync"
+	"time"
+
+	"supportTicketBotGo/logger"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Параметры повторной отправки
+const (
+	dispatcherBaseBackoff     = 500 * time.Millisecond
+	dispatcherMaxBackoff      = 30 * time.Second
+	dispatcherMaxRateLimited  = 10 // сколько раз подряд можно получить 429 по одному сообщению
+	dispatcherIdleChatTTL     = 5 * time.Minute
+	dispatcherPruneChatsAbove = 1000
+)
+
+// ErrDispatcherStopped возвращается при отправке после остановки диспетчера
+var ErrDispatcherStopped = errors.New("отправка сообщений остановлена")
+
+// RateLimits - ограничения скорости отправки сообщений.
+// Telegram допускает около 30 сообщений в секунду от бота, около одного сообщения
+// в секунду в личный чат (короткие всплески допустимы) и 20 сообщений в минуту в группу.
+type RateLimits struct {
+	GlobalPerSecond float64 // всего сообщений в секунду
+	ChatPerSecond   float64 // сообщений в секунду в личный чат
+	ChatBurst       int     // сколько сообщений подряд можно отправить в чат без ожидания
+	GroupPerMinute  float64 // сообщений в минуту в группу (чаты с отрицательным ID)
+	MaxAttempts     int     // попыток отправки при сетевых ошибках и ошибках 5xx
+}
+
+// DefaultRateLimits возвращает ограничения, соответствующие документации Bot API
+func DefaultRateLimits() RateLimits {
+	return RateLimits{
+		GlobalPerSecond: 30,
+		ChatPerSecond:   1,
+		ChatBurst:       20,
+		GroupPerMinute:  20,
+		MaxAttempts:     5,
+	}
+}
+
+// withDefaults заменяет незаданные ограничения значениями по умолчанию
+func (l RateLimits) withDefaults() RateLimits {
+	defaults := DefaultRateLimits()
+	if l.GlobalPerSecond <= 0 {
+		l.GlobalPerSecond = defaults.GlobalPerSecond
+	}
+	if l.ChatPerSecond <= 0 {
+		l.ChatPerSecond = defaults.ChatPerSecond
+	}
+	if l.ChatBurst <= 0 {
+		l.ChatBurst = defaults.ChatBurst
+	}
+	if l.GroupPerMinute <= 0 {
+		l.GroupPerMinute = defaults.GroupPerMinute
+	}
+	if l.MaxAttempts <= 0 {
+		l.MaxAttempts = defaults.MaxAttempts
+	}
+	return l
+}
+
+// Dispatcher - очередь исходящих сообщений бота.
+// Сообщения в один чат отправляются строго по очереди, с учетом ограничений
+// скорости на чат и на бота в целом. Ответ 429 приостанавливает чат на retry_after,
+// сетевые ошибки и ошибки 5xx повторяются с экспоненциальной задержкой.
+//
+// Загрузки файлов передавайте как tgbotapi.FileBytes: FileReader нельзя прочитать
+// повторно, поэтому при повторной отправке файл окажется пустым.
+type Dispatcher struct {
+	bot *tgbotapi.BotAPI
+
+	mu      sync.Mutex
+	idle    *sync.Cond // сигнал об опустевшей очереди чата
+	limits  RateLimits
+	global  *tokenBucket
+	chats   map[int64]*chatQueue
+	active  int // число чатов, сообщения которых сейчас отправляются
+	stopped bool
+}
+
+// chatQueue - очередь сообщений одного чата
+type chatQueue struct {
+	jobs        []*outboundJob
+	running     bool
+	bucket      *tokenBucket
+	pausedUntil time.Time // до этого момента Telegram запретил отправку (retry_after)
+	lastUsed    time.Time
+}
+
+// outboundJob - исходящее сообщение или альбом
+type outboundJob struct {
+	chattable tgbotapi.Chattable
+	group     *tgbotapi.MediaGroupConfig
+	done      chan outboundResult  // nil для асинхронной отправки
+	onDone    func(outboundResult) // результат асинхронной отправки (SendAsync)
+}
+
+type outboundResult struct {
+	messages []tgbotapi.Message
+	err      error
+}
+
+// NewDispatcher создает очередь исходящих сообщений клиента bot.
+// На одного клиента Bot API должен приходиться один диспетчер: иначе общий лимит не соблюдается.
+func NewDispatcher(bot *tgbotapi.BotAPI, limits RateLimits) *Dispatcher {
+	limits = limits.withDefaults()
+	d := &Dispatcher{
+		bot:    bot,
+		limits: limits,
+		global: newTokenBucket(limits.GlobalPerSecond, limits.GlobalPerSecond),
+		chats:  make(map[int64]*chatQueue),
+	}
+	d.idle = sync.NewCond(&d.mu)
+	return d
+}
+
+// SetLimits меняет ограничения скорости. Уже созданные очереди чатов сохраняют прежние лимиты,
+// пока не опустеют.
+func (d *Dispatcher) SetLimits(limits RateLimits) {
+	limits = limits.withDefaults()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.limits = limits
+	d.global = newTokenBucket(limits.GlobalPerSecond, limits.GlobalPerSecond)
+	for chatID, q := range d.chats {
+		if !q.running {
+			delete(d.chats, chatID)
+		}
+	}
+}
+
+// Send отправляет сообщение через очередь и ждет результата (нужно, если важен ID отправленного сообщения)
+func (d *Dispatcher) Send(c tgbotapi.Chattable) (tgbotapi.Message, error) {
+	result := d.wait(&outboundJob{chattable: c})
+	if result.err != nil || len(result.messages) == 0 {
+		return tgbotapi.Message{}, result.err
+	}
+	return result.messages[0], nil
+}
+
+// SendMediaGroup отправляет альбом через очередь и ждет результата
+func (d *Dispatcher) SendMediaGroup(config tgbotapi.MediaGroupConfig) ([]tgbotapi.Message, error) {
+	result := d.wait(&outboundJob{group: &config})
+	return result.messages, result.err
+}
+
+// Enqueue ставит сообщение в очередь и сразу возвращает управление.
+// Ошибка отправки записывается в журнал.
+func (d *Dispatcher) Enqueue(c tgbotapi.Chattable) {
+	if err := d.enqueue(&outboundJob{chattable: c}); err != nil {
+		logger.Error.Printf("Ошибка при отправке: %v", err)
+	}
+}
+
+// SendAsync ставит сообщение в очередь и сразу возвращает управление. Результат отправки
+// передается в done из горутины очереди чата; Flush и Stop ждут и завершения done.
+// Если диспетчер остановлен, done не вызывается и возвращается ErrDispatcherStopped.
+func (d *Dispatcher) SendAsync(c tgbotapi.Chattable, done func(tgbotapi.Message, error)) error {
+	return d.enqueue(&outboundJob{chattable: c, onDone: func(result outboundResult) {
+		var message tgbotapi.Message
+		if len(result.messages) > 0 {
+			message = result.messages[0]
+		}
+		done(message, result.err)
+	}})
+}
+
+// Flush ждет отправки всех сообщений, поставленных в очередь
+func (d *Dispatcher) Flush() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for d.active > 0 {
+		d.idle.Wait()
+	}
+}
+
+// Stop перестает принимать новые сообщения и ждет отправки очереди не дольше timeout.
+// Возвращает false, если за это время очередь не опустела.
+func (d *Dispatcher) Stop(timeout time.Duration) bool {
+	d.mu.Lock()
+	d.stopped = true
+	d.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		d.Flush()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+func (d *Dispatcher) wait(job *outboundJob) outboundResult {
+	job.done = make(chan outboundResult, 1)
+	if err := d.enqueue(job); err != nil {
+		return outboundResult{err: err}
+	}
+	return <-job.done
+}
+
+// enqueue добавляет сообщение в очередь чата и запускает ее обработку, если она не запущена
+func (d *Dispatcher) enqueue(job *outboundJob) error {
+	chatID := job.chatID()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.stopped {
+		return ErrDispatcherStopped
+	}
+
+	q, ok := d.chats[chatID]
+	if !ok {
+		d.pruneIdleChats()
+		q = &chatQueue{bucket: d.chatBucket(chatID)}
+		d.chats[chatID] = q
+	}
+	q.jobs = append(q.jobs, job)
+	if !q.running {
+		q.running = true
+		d.active++
+		go d.run(chatID, q)
+	}
+	return nil
+}
+
+// chatBucket создает ограничитель скорости для чата. Вызывается под d.mu.
+func (d *Dispatcher) chatBucket(chatID int64) *tokenBucket {
+	if chatID < 0 {
+		return newTokenBucket(d.limits.GroupPerMinute/60, d.limits.GroupPerMinute/4)
+	}
+	return newTokenBucket(d.limits.ChatPerSecond, float64(d.limits.ChatBurst))
+}
+
+// pruneIdleChats забывает давно простаивающие чаты, чтобы карта очередей не росла бесконечно.
+// Вызывается под d.mu.
+func (d *Dispatcher) pruneIdleChats() {
+	if len(d.chats) < dispatcherPruneChatsAbove {
+		return
+	}
+	now := time.Now()
+	for chatID, q := range d.chats {
+		if !q.running && now.Sub(q.lastUsed) > dispatcherIdleChatTTL && now.After(q.pausedUntil) {
+			delete(d.chats, chatID)
+		}
+	}
+}
+
+// run отправляет сообщения чата по одному, пока очередь не опустеет
+func (d *Dispatcher) run(chatID int64, q *chatQueue) {
+	for {
+		d.mu.Lock()
+		if len(q.jobs) == 0 {
+			q.running = false
+			q.lastUsed = time.Now()
+			d.active--
+			d.idle.Broadcast()
+			d.mu.Unlock()
+			return
+		}
+		job := q.jobs[0]
+		q.jobs[0] = nil
+		q.jobs = q.jobs[1:]
+		d.mu.Unlock()
+
+		messages, err := d.deliver(chatID, q, job)
+		switch {
+		case job.done != nil:
+			job.done <- outboundResult{messages: messages, err: err}
+		case job.onDone != nil:
+			job.onDone(outboundResult{messages: messages, err: err})
+		case err != nil:
+			logger.Error.Printf("Ошибка при отправке в чат %d: %v", chatID, err)
+		}
+	}
+}
+
+// deliver отправляет одно сообщение, повторяя попытки после 429 и временных ошибок
+func (d *Dispatcher) deliver(chatID int64, q *chatQueue, job *outboundJob) ([]tgbotapi.Message, error) {
+	attempt, rateLimited := 1, 0
+	for {
+		d.waitTurn(q)
+		messages, err := job.send(d.bot)
+		if err == nil {
+			return messages, nil
+		}
+
+		if retryAfter := retryAfterOf(err); retryAfter > 0 && rateLimited < dispatcherMaxRateLimited {
+			rateLimited++
+			logger.Warning.Printf("Telegram ограничил отправку в чат %d, повтор через %v", chatID, retryAfter)
+			d.mu.Lock()
+			q.pausedUntil = time.Now().Add(retryAfter)
+			d.mu.Unlock()
+			continue
+		}
+
+		d.mu.Lock()
+		maxAttempts := d.limits.MaxAttempts
+		d.mu.Unlock()
+		if !isTransientSendError(err) || attempt >= maxAttempts {
+			return nil, err
+		}
+		delay := backoffDelay(attempt)
+		logger.Warning.Printf("Ошибка при отправке в чат %d (попытка %d из %d), повтор через %v: %v",
+			chatID, attempt, maxAttempts, delay.Round(time.Millisecond), err)
+		time.Sleep(delay)
+		attempt++
+	}
+}
+
+// waitTurn ждет, пока отправку разрешат ограничения чата и бота
+func (d *Dispatcher) waitTurn(q *chatQueue) {
+	d.mu.Lock()
+	at := q.bucket.reserve(time.Now())
+	if q.pausedUntil.After(at) {
+		at = q.pausedUntil
+	}
+	d.mu.Unlock()
+	time.Sleep(time.Until(at))
+
+	d.mu.Lock()
+	at = d.global.reserve(time.Now())
+	d.mu.Unlock()
+	time.Sleep(time.Until(at))
+}
+
+// send выполняет запрос к Bot API
+func (job *outboundJob) send(bot *tgbotapi.BotAPI) ([]tgbotapi.Message, error) {
+	if job.group != nil {
+		return bot.SendMediaGroup(*job.group)
+	}
+	message, err := bot.Send(job.chattable)
+	if err != nil {
+		return nil, err
+	}
+	return []tgbotapi.Message{message}, nil
+}
+
+// chatID возвращает ID чата получателя. У всех конфигураций отправки tgbotapi
+// есть поле ChatID (часто во встроенной BaseChat), общего интерфейса для него нет.
+func (job *outboundJob) chatID() int64 {
+	if job.group != nil {
+		return job.group.ChatID
+	}
+	v := reflect.ValueOf(job.chattable)
+	if v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return 0
+	}
+	field := v.FieldByName("ChatID")
+	if !field.IsValid() || field.Kind() != reflect.Int64 {
+		return 0
+	}
+	return field.Int()
+}
+
+// retryAfterOf возвращает задержку из ответа 429 Too Many Requests
+func retryAfterOf(err error) time.Duration {
+	var apiErr *tgbotapi.Error
+	if !errors.As(err, &apiErr) || apiErr.Code != http.StatusTooManyRequests {
+		return 0
+	}
+	if apiErr.RetryAfter <= 0 {
+		return time.Second
+	}
+	return time.Duration(apiErr.RetryAfter) * time.Second
+}
+
+// isTransientSendError сообщает, имеет ли смысл повторить отправку: ошибки сети
+// и ответы 5xx временные, а остальные ответы Bot API (400, 403 и т.п.) - нет
+func isTransientSendError(err error) bool {
+	var apiErr *tgbotapi.Error
+	if errors.As(err, &apiErr) {
+		return apiErr.Code >= http.StatusInternalServerError
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// backoffDelay возвращает задержку перед повтором с номером attempt (экспонента со случайным разбросом)
+func backoffDelay(attempt int) time.Duration {
+	delay := dispatcherBaseBackoff << (attempt - 1)
+	if delay > dispatcherMaxBackoff || delay <= 0 {
+		delay = dispatcherMaxBackoff
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// tokenBucket - ограничитель скорости «корзина токенов»
+type tokenBucket struct {
+	rate   float64 // токенов в секунду
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate, burst float64) *tokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+	return &tokenBucket{rate: rate, burst: burst, tokens: burst, last: time.Now()}
+}
+
+// reserve занимает токен и возвращает момент, когда им можно воспользоваться.
+// Токены могут уходить в минус: следующие резервы получат более поздний момент.
+func (b *tokenBucket) reserve(now time.Time) time.Time {
+	if now.After(b.last) {
+		b.tokens += now.Sub(b.last).Seconds() * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+		b.last = now
+	}
+	b.tokens--
+	if b.tokens >= 0 {
+		return now
+	}
+	return now.Add(time.Duration(-b.tokens / b.rate * float64(time.Second)))
+}
@@ -0,0 +1,160 @@
+package bot
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"supportTicketBotGo/telegramtest"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// newTestDispatcher запускает поддельный сервер Bot API и диспетчер, подключенный к нему
+func newTestDispatcher(t *testing.T, limits RateLimits) (*telegramtest.Server, *Dispatcher) {
+	t.Helper()
+	server := telegramtest.NewServer()
+	t.Cleanup(server.Close)
+
+	botAPI, err := server.Bot()
+	if err != nil {
+		t.Fatalf("подключение к поддельному серверу: %v", err)
+	}
+	d := NewDispatcher(botAPI, limits)
+	t.Cleanup(func() { d.Stop(5 * time.Second) })
+	return server, d
+}
+
+func TestDispatcherPausesChatOnRetryAfter(t *testing.T) {
+	t.Parallel()
+	server, d := newTestDispatcher(t, RateLimits{})
+	server.FailNext("sendMessage", http.StatusTooManyRequests, 1)
+
+	start := time.Now()
+	sent, err := d.Send(tgbotapi.NewMessage(42, "после паузы"))
+	if err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Fatalf("повтор через %v, до истечения retry_after", elapsed)
+	}
+	if sent.Text != "после паузы" {
+		t.Fatalf("отправлено сообщение %+v", sent)
+	}
+	if calls := server.CallsTo("sendMessage"); len(calls) != 2 {
+		t.Fatalf("вызовов sendMessage: %d, ожидалось 2", len(calls))
+	}
+}
+
+func TestDispatcherRetriesTransientErrors(t *testing.T) {
+	t.Parallel()
+	server, d := newTestDispatcher(t, RateLimits{MaxAttempts: 3})
+	server.FailNext("sendMessage", http.StatusBadGateway, 0)
+	server.FailNext("sendMessage", http.StatusInternalServerError, 0)
+
+	if _, err := d.Send(tgbotapi.NewMessage(42, "с третьей попытки")); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if calls := server.CallsTo("sendMessage"); len(calls) != 3 {
+		t.Fatalf("вызовов sendMessage: %d, ожидалось 3", len(calls))
+	}
+}
+
+func TestDispatcherGivesUpAfterMaxAttempts(t *testing.T) {
+	t.Parallel()
+	server, d := newTestDispatcher(t, RateLimits{MaxAttempts: 2})
+	for i := 0; i < 3; i++ {
+		server.FailNext("sendMessage", http.StatusServiceUnavailable, 0)
+	}
+
+	_, err := d.Send(tgbotapi.NewMessage(42, "не дойдет"))
+	var apiErr *tgbotapi.Error
+	if !errors.As(err, &apiErr) || apiErr.Code != http.StatusServiceUnavailable {
+		t.Fatalf("ожидалась ошибка 503, получено %v", err)
+	}
+	if calls := server.CallsTo("sendMessage"); len(calls) != 2 {
+		t.Fatalf("вызовов sendMessage: %d, ожидалось 2", len(calls))
+	}
+}
+
+func TestDispatcherDoesNotRetryPermanentErrors(t *testing.T) {
+	t.Parallel()
+	server, d := newTestDispatcher(t, RateLimits{})
+	server.FailNext("sendMessage", http.StatusForbidden, 0)
+
+	_, err := d.Send(tgbotapi.NewMessage(42, "бот заблокирован"))
+	if !isBotBlocked(err) {
+		t.Fatalf("ожидалась ошибка 403, получено %v", err)
+	}
+	if calls := server.CallsTo("sendMessage"); len(calls) != 1 {
+		t.Fatalf("вызовов sendMessage: %d, ожидался 1", len(calls))
+	}
+}
+
+func TestDispatcherKeepsChatOrderAfterRetry(t *testing.T) {
+	t.Parallel()
+	server, d := newTestDispatcher(t, RateLimits{})
+	server.FailNext("sendMessage", http.StatusTooManyRequests, 1)
+
+	for _, text := range []string{"первое", "второе", "третье"} {
+		d.Enqueue(tgbotapi.NewMessage(42, text))
+	}
+	d.Flush()
+
+	var texts []string
+	for _, call := range server.CallsTo("sendMessage") {
+		texts = append(texts, call.Text())
+	}
+	want := []string{"первое", "первое", "второе", "третье"}
+	if len(texts) != len(want) {
+		t.Fatalf("отправлено %q, ожидалось %q", texts, want)
+	}
+	for i := range want {
+		if texts[i] != want[i] {
+			t.Fatalf("отправлено %q, ожидалось %q", texts, want)
+		}
+	}
+}
+
+func TestDispatcherSendAsync(t *testing.T) {
+	t.Parallel()
+	server, d := newTestDispatcher(t, RateLimits{})
+	server.FailNext("sendMessage", http.StatusTooManyRequests, 1)
+
+	// Пауза чата, первым получившего 429, не задерживает отправку в остальные
+	results := make(chan int64, 5)
+	start := time.Now()
+	for chatID := int64(1); chatID <= 5; chatID++ {
+		chatID := chatID
+		err := d.SendAsync(tgbotapi.NewMessage(chatID, "рассылка"), func(sent tgbotapi.Message, err error) {
+			if err != nil || sent.Chat.ID != chatID {
+				t.Errorf("чат %d: отправлено %+v, %v", chatID, sent.Chat, err)
+			}
+			results <- chatID
+		})
+		if err != nil {
+			t.Fatalf("SendAsync: %v", err)
+		}
+	}
+	for i := 0; i < 4; i++ {
+		<-results
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Fatalf("остальные чаты ждали паузы первого: %v", elapsed)
+	}
+
+	// Flush ждет и результата отправки, поставленной на паузу
+	d.Flush()
+	if len(results) != 1 {
+		t.Fatalf("после Flush не получен результат для чата на паузе")
+	}
+
+	d.Stop(time.Second)
+	err := d.SendAsync(tgbotapi.NewMessage(1, "после остановки"), func(tgbotapi.Message, error) {
+		t.Error("done вызван после остановки")
+	})
+	if !errors.Is(err, ErrDispatcherStopped) {
+		t.Fatalf("SendAsync после остановки: %v", err)
+	}
+}
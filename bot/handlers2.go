@@ -1,10 +1,9 @@
 package bot
 
 import (
+	"errors"
 	"fmt"
 	"math/rand"
-	"os"
-	"path/filepath"
 	"strings"
 	"time"
 
@@ -16,187 +15,131 @@ import (
 )
 
 // Обработчик сообщений в главном меню
-func HandleMainMenu(bot *tgbotapi.BotAPI, message *tgbotapi.Message) {
+func (h *Handler) HandleMainMenu(message *tgbotapi.Message) {
 	userID := message.From.ID
 
 	switch message.Text {
 	case "🎯 Активные тикеты", "Активные тикеты":
-		tickets, err := database.GetActiveTicketsByUserID(userID)
-		if err != nil {
-			logger.Error.Printf("Ошибка при получении активных тикетов пользователя %d: %v", userID, err)
-			SendErrorMessage(bot, message.Chat.ID, "Произошла ошибка при получении тикетов")
-			return
-		}
+		h.startDialog(message.Chat.ID, userID, stateViewingTickets, &UserState{})
 
-		if len(tickets) == 0 {
-			msg := tgbotapi.NewMessage(message.Chat.ID, "📭 У вас нет активных тикетов.")
-			msg.ReplyMarkup = GetMainMenuKeyboard()
-			SafeSendMessage(bot, msg)
-			return
-		}
+	case "📚 История тикетов", "История тикетов":
+		h.startDialog(message.Chat.ID, userID, stateViewingHistory, &UserState{})
 
-		// Создаем клавиатуру с тикетами
-		ticketButtons := make([][]tgbotapi.KeyboardButton, 0, len(tickets)+1)
+	case "✨ Создать тикет", "Создать тикет":
+		// Начинаем процесс создания тикета с выбора категории
+		h.startDialog(message.Chat.ID, userID, stateTicketCategory, &UserState{})
 
-		for _, ticket := range tickets {
-			// Получаем количество сообщений в тикете
-			count, err := database.GetTicketMessageCount(ticket.ID)
-			if err != nil {
-				logger.Error.Printf("Ошибка при получении количества сообщений тикета %d: %v", ticket.ID, err)
-				count = 0
-			}
+	default:
+		// Если команда не распознана, показываем главное меню
+		msg := tgbotapi.NewMessage(message.Chat.ID,
+			"Пожалуйста, выберите действие из меню:")
+		msg.ReplyMarkup = GetMainMenuKeyboard()
+		h.SafeSendMessage(msg)
+	}
+}
 
-			// Определяем эмодзи статуса
-			statusEmoji := getStatusEmoji(ticket.Status)
+// showTicketHistory отправляет пользователю историю его тикетов
+func (h *Handler) showTicketHistory(chatID int64, userID int64) {
+	tickets, err := h.deps.Tickets.GetTicketHistory(userID)
+	if err != nil {
+		logger.Error.Printf("Ошибка при получении истории тикетов пользователя %d: %v", userID, err)
+		h.SendErrorMessage(chatID, "Произошла ошибка при получении истории тикетов")
+		return
+	}
 
-			// Создаем кнопку с информацией о тикете
-			buttonLabel := fmt.Sprintf("#%d %s %s | %d смс",
-				ticket.ID, statusEmoji, ticket.Title, count)
+	if len(tickets) == 0 {
+		msg := tgbotapi.NewMessage(chatID, "📚 У вас пока нет тикетов.")
+		msg.ReplyMarkup = GetMainMenuKeyboard()
+		h.SafeSendMessage(msg)
+		return
+	}
 
-			ticketButtons = append(ticketButtons, tgbotapi.NewKeyboardButtonRow(
-				tgbotapi.NewKeyboardButton(buttonLabel),
-			))
-		}
+	// Ограничиваем количество тикетов до 50
+	maxTickets := 50
+	var ticketsToShow []database.Ticket
+	var limitMessage string
 
-		// Добавляем кнопку "Назад"
-		ticketButtons = append(ticketButtons, tgbotapi.NewKeyboardButtonRow(
-			tgbotapi.NewKeyboardButton("⬅️ Назад"),
-		))
+	if len(tickets) > maxTickets {
+		ticketsToShow = tickets[len(tickets)-maxTickets:]
+		limitMessage = fmt.Sprintf("⚠️ Показаны последние %d тикетов из всей истории.", maxTickets)
+	} else {
+		ticketsToShow = tickets
+		limitMessage = ""
+	}
 
-		msg := tgbotapi.NewMessage(message.Chat.ID, "Ваши активные тикеты:")
-		msg.ReplyMarkup = tgbotapi.NewReplyKeyboard(ticketButtons...)
-		SafeSendMessage(bot, msg)
+	// Отправляем заголовок истории тикетов
+	headerMsg := tgbotapi.NewMessage(chatID, fmt.Sprintf("📚 *История ваших тикетов* (%d)\n\n%s", len(tickets), limitMessage))
+	headerMsg.ParseMode = "Markdown"
+	headerMsg.ReplyMarkup = GetMainMenuKeyboard()
+	h.SafeSendMessage(headerMsg)
 
-		// Устанавливаем состояние просмотра тикетов
-		userStates[userID] = &UserState{State: "viewing_tickets"}
+	// Формируем блоки тикетов с учетом ограничения размера сообщения
+	const maxMessageSize = 4000 // Оставляем запас от максимального размера 4096
+	var currentBlock strings.Builder
+	messageCounter := 0
 
-	case "📚 История тикетов", "История тикетов":
-		tickets, err := database.GetTicketHistory(userID)
+	for i, ticket := range ticketsToShow {
+		// Получаем количество сообщений в тикете
+		count, err := h.deps.Messages.GetTicketMessageCount(ticket.ID)
 		if err != nil {
-			logger.Error.Printf("Ошибка при получении истории тикетов пользователя %d: %v", userID, err)
-			SendErrorMessage(bot, message.Chat.ID, "Произошла ошибка при получении истории тикетов")
-			return
+			logger.Error.With(logger.TicketID(ticket.ID)).Printf("Ошибка при получении количества сообщений тикета %d: %v", ticket.ID, err)
+			count = 0
 		}
 
-		if len(tickets) == 0 {
-			msg := tgbotapi.NewMessage(message.Chat.ID, "📚 У вас пока нет тикетов.")
-			msg.ReplyMarkup = GetMainMenuKeyboard()
-			SafeSendMessage(bot, msg)
-			return
-		}
+		// Определяем эмодзи статуса
+		statusEmoji := ticket.Status.Emoji()
 
-		// Ограничиваем количество тикетов до 50
-		maxTickets := 50
-		var ticketsToShow []database.Ticket
-		var limitMessage string
+		// Форматируем дату создания
+		createdDate := ticket.CreatedAt.Format("02.01.2006 15:04")
 
-		if len(tickets) > maxTickets {
-			ticketsToShow = tickets[len(tickets)-maxTickets:]
-			limitMessage = fmt.Sprintf("⚠️ Показаны последние %d тикетов из всей истории.", maxTickets)
-		} else {
-			ticketsToShow = tickets
-			limitMessage = ""
+		// Форматируем дату закрытия, если тикет закрыт
+		closedDate := ""
+		if ticket.Status == database.StatusClosed && ticket.ClosedAt.Valid {
+			closedDate = fmt.Sprintf("\n🔒 Закрыт: %s", ticket.ClosedAt.Time.Format("02.01.2006 15:04"))
 		}
 
-		// Отправляем заголовок истории тикетов
-		headerMsg := tgbotapi.NewMessage(message.Chat.ID, fmt.Sprintf("📚 *История ваших тикетов* (%d)\n\n%s", len(tickets), limitMessage))
-		headerMsg.ParseMode = "Markdown"
-		headerMsg.ReplyMarkup = GetMainMenuKeyboard()
-		SafeSendMessage(bot, headerMsg)
-
-		// Формируем блоки тикетов с учетом ограничения размера сообщения
-		const maxMessageSize = 4000 // Оставляем запас от максимального размера 4096
-		var currentBlock strings.Builder
-		messageCounter := 0
-
-		for i, ticket := range ticketsToShow {
-			// Получаем количество сообщений в тикете
-			count, err := database.GetTicketMessageCount(ticket.ID)
-			if err != nil {
-				logger.Error.Printf("Ошибка при получении количества сообщений тикета %d: %v", ticket.ID, err)
-				count = 0
-			}
-
-			// Определяем эмодзи статуса
-			statusEmoji := getStatusEmoji(ticket.Status)
-
-			// Форматируем дату создания
-			createdDate := ticket.CreatedAt.Format("02.01.2006 15:04")
+		// Формируем текст для одного тикета
+		ticketText := fmt.Sprintf(
+			"🔖 *Тикет #%d*\n%s %s\n\n📝 Категория: %s\n📅 Создан: %s%s\n💬 Сообщений: %d\n\nЧтобы просмотреть этот тикет, отправьте команду:\n`/ticket %d`\n\n",
+			ticket.ID,
+			statusEmoji,
+			strings.ReplaceAll(ticket.Title, "*", "\\*"), // Экранируем звездочки
+			h.getCategoryName(ticket.Category),
+			createdDate,
+			closedDate,
+			count,
+			ticket.ID,
+		)
 
-			// Форматируем дату закрытия, если тикет закрыт
-			closedDate := ""
-			if ticket.Status == "закрыт" && ticket.ClosedAt.Valid {
-				closedDate = fmt.Sprintf("\n🔒 Закрыт: %s", ticket.ClosedAt.Time.Format("02.01.2006 15:04"))
+		// Если добавление нового тикета превысит лимит или это последний тикет
+		if currentBlock.Len()+len(ticketText) > maxMessageSize || i == len(ticketsToShow)-1 {
+			// Если это не первый блок и есть что отправить
+			if currentBlock.Len() > 0 {
+				msg := tgbotapi.NewMessage(chatID, currentBlock.String())
+				msg.ParseMode = "Markdown"
+				h.SafeSendMessage(msg)
+				messageCounter++
+				currentBlock.Reset()
 			}
 
-			// Формируем текст для одного тикета
-			ticketText := fmt.Sprintf(
-				"🔖 *Тикет #%d*\n%s %s\n\n📝 Категория: %s\n📅 Создан: %s%s\n💬 Сообщений: %d\n\nЧтобы просмотреть этот тикет, отправьте команду:\n`/ticket %d`\n\n",
-				ticket.ID,
-				statusEmoji,
-				strings.ReplaceAll(ticket.Title, "*", "\\*"), // Экранируем звездочки
-				ticket.Category,
-				createdDate,
-				closedDate,
-				count,
-				ticket.ID,
-			)
-
-			// Если добавление нового тикета превысит лимит или это последний тикет
-			if currentBlock.Len()+len(ticketText) > maxMessageSize || i == len(ticketsToShow)-1 {
-				// Если это не первый блок и есть что отправить
-				if currentBlock.Len() > 0 {
-					msg := tgbotapi.NewMessage(message.Chat.ID, currentBlock.String())
-					msg.ParseMode = "Markdown"
-					SafeSendMessage(bot, msg)
-					messageCounter++
-					currentBlock.Reset()
-				}
+			// Добавляем текущий тикет в новый блок
+			currentBlock.WriteString(ticketText)
 
-				// Добавляем текущий тикет в новый блок
-				currentBlock.WriteString(ticketText)
-
-				// Если это последний тикет, отправляем оставшийся блок
-				if i == len(ticketsToShow)-1 && currentBlock.Len() > 0 {
-					msg := tgbotapi.NewMessage(message.Chat.ID, currentBlock.String())
-					msg.ParseMode = "Markdown"
-					SafeSendMessage(bot, msg)
-				}
-			} else {
-				// Добавляем тикет к текущему блоку
-				currentBlock.WriteString(ticketText)
+			// Если это последний тикет, отправляем оставшийся блок
+			if i == len(ticketsToShow)-1 && currentBlock.Len() > 0 {
+				msg := tgbotapi.NewMessage(chatID, currentBlock.String())
+				msg.ParseMode = "Markdown"
+				h.SafeSendMessage(msg)
 			}
+		} else {
+			// Добавляем тикет к текущему блоку
+			currentBlock.WriteString(ticketText)
 		}
-
-		// Устанавливаем состояние просмотра истории тикетов
-		userStates[userID] = &UserState{State: "main_menu"}
-
-	case "✨ Создать тикет", "Создать тикет":
-		// Начинаем процесс создания тикета с выбора категории
-		userStates[userID] = &UserState{State: "creating_ticket_category"}
-
-		msg := tgbotapi.NewMessage(message.Chat.ID,
-			"🎯 Выберите категорию обращения:")
-		msg.ReplyMarkup = GetCategoryKeyboard()
-		SafeSendMessage(bot, msg)
-
-	default:
-		// Если команда не распознана, показываем главное меню
-		msg := tgbotapi.NewMessage(message.Chat.ID,
-			"Пожалуйста, выберите действие из меню:")
-		msg.ReplyMarkup = GetMainMenuKeyboard()
-		SafeSendMessage(bot, msg)
 	}
 }
 
 // Функция для создания заголовка из категории и описания
-func generateTicketTitle(category, description string) string {
-	// Конвертируем категорию для заголовка
-	categoryPrefix := map[string]string{
-		"спросить": "Вопрос",
-		"проблема": "Проблема",
-		"идея":     "Идея",
-	}[category]
+func generateTicketTitle(category database.Category, description string) string {
 
 	// Берем первые 4 слова из описания
 	words := strings.Fields(description)
@@ -212,192 +155,34 @@ func generateTicketTitle(category, description string) string {
 		shortDescription += "..."
 	}
 
-	return fmt.Sprintf("%s: %s", categoryPrefix, shortDescription)
-}
-
-// getStatusEmoji возвращает эмодзи статуса тикета (внутренняя функция)
-func getStatusEmoji(status string) string {
-	return GetStatusEmoji(status)
-}
-
-// GetStatusEmoji возвращает эмодзи статуса тикета (экспортируемая функция)
-func GetStatusEmoji(status string) string {
-	switch status {
-	case "создан":
-		return "🆕" // Новый тикет
-	case "назначен":
-		return "👨‍💻" // Тикет назначен агенту
-	case "в работе":
-		return "🔧" // Тикет в работе
-	case "ожидает ответа пользователя":
-		return "❓" // Ожидает ответа пользователя
-	case "ожидает действий поддержки":
-		return "⏳" // Ожидает действий поддержки
-	case "закрыт":
-		return "🗃" // Закрытый тикет
-	case "отменён":
-		return "🚫" // Отменённый тикет
-	default:
-		return "❓" // Неизвестный статус
-	}
+	return fmt.Sprintf("%s: %s", category.Prefix(), shortDescription)
 }
 
 // truncateString обрезает строку до указанной длины и добавляет многоточие если нужно
 func truncateString(s string, maxLength int) string {
-	if len(s) <= maxLength {
+	// Считаем символы, а не байты, чтобы не разрезать кириллицу посередине
+	runes := []rune(s)
+	if len(runes) <= maxLength {
 		return s
 	}
-	return s[:maxLength-3] + "..."
-}
-
-// showTicketConversationReadOnly отображает все сообщения тикета в режиме только для чтения
-func showTicketConversationReadOnly(bot *tgbotapi.BotAPI, chatID int64, ticketID int) {
-	// Получаем информацию о тикете
-	ticket, err := database.GetTicketByID(ticketID)
-	if err != nil {
-		logger.Error.Printf("Ошибка при получении тикета %d: %v", ticketID, err)
-		SendErrorMessage(bot, chatID, "Не удалось загрузить информацию о тикете")
-		return
-	}
-
-	// Получаем все сообщения тикета
-	messages, err := database.GetTicketMessages(ticketID)
-	if err != nil {
-		logger.Error.Printf("Ошибка при получении сообщений тикета %d: %v", ticketID, err)
-		SendErrorMessage(bot, chatID, "Не удалось загрузить сообщения тикета")
-		return
-	}
-
-	// Ограничиваем количество сообщений
-	maxMessages := 50
-	if len(messages) > maxMessages {
-		messages = messages[len(messages)-maxMessages:]
-		warningMsg := tgbotapi.NewMessage(chatID,
-			fmt.Sprintf("⚠️ Показаны только последние %d сообщений из %d", maxMessages, len(messages)))
-		SafeSendMessage(bot, warningMsg)
-	}
-
-	// Формируем красивую шапку тикета с эмодзи и пометкой "только для чтения"
-	headerText := fmt.Sprintf("📖 *ТИКЕТ #%d (ТОЛЬКО ПРОСМОТР)* 📖\n\n"+
-		"📝 *Тема:* %s\n"+
-		"📅 *Создан:* %s\n"+
-		"🏷️ *Категория:* %s\n"+
-		"📊 *Статус:* %s %s\n\n"+
-		"💬 *ИСТОРИЯ ДИАЛОГА:*\n",
-		ticket.ID, ticket.Title,
-		ticket.CreatedAt.Format("02.01.2006 15:04"),
-		getCategoryName(ticket.Category),
-		getStatusEmoji(ticket.Status), ticket.Status)
-
-	// Объединяем сообщения в более крупные блоки
-	const maxTelegramMessageSize = 4000
-	var combinedMessages = headerText
-	var messageCounter int
-
-	// Если нет сообщений, покажем это в первом блоке
-	if len(messages) == 0 {
-		combinedMessages += "\n🔍 В этом тикете пока нет сообщений."
-		msg := tgbotapi.NewMessage(chatID, combinedMessages)
-		msg.ParseMode = "Markdown"
-		SafeSendMessage(bot, msg)
-	} else {
-		// Собираем сообщения в блоки
-		for i, message := range messages {
-			var sender string
-			var messagePrefix string
-			var senderEmoji string
-
-			if message.SenderType == "user" {
-				senderEmoji = "👤"
-				sender = "Вы"
-				messagePrefix = "💬"
-			} else {
-				senderEmoji = "👨‍💼"
-				// Получаем имя сотрудника поддержки
-				supportName, err := database.GetUserNameByID(message.SenderID)
-				if err != nil {
-					supportName = "Поддержка"
-				}
-				sender = supportName
-				messagePrefix = "🗨️"
-			}
-
-			// Формируем текст одного сообщения с эмодзи
-			timeStr := message.CreatedAt.Format("02.01.2006 15:04")
-			singleMessage := fmt.Sprintf("%s\n%s %s (%s)\n%s %s\n",
-				getSeparator(messageCounter > 0),
-				senderEmoji, sender,
-				timeStr,
-				messagePrefix,
-				formatMessageText(message.Message))
-
-			// Если это первое сообщение или добавление превысит лимит
-			if messageCounter == 0 || len(combinedMessages)+len(singleMessage) > maxTelegramMessageSize {
-				if messageCounter > 0 {
-					// Отправляем предыдущий блок
-					msg := tgbotapi.NewMessage(chatID, combinedMessages)
-					msg.ParseMode = "Markdown"
-					SafeSendMessage(bot, msg)
-				}
-
-				// Если это первое сообщение в новом блоке (не первый блок)
-				if messageCounter > 0 {
-					// Новый блок начинаем с заголовка продолжения
-					combinedMessages = fmt.Sprintf("📖 *ТИКЕТ #%d (ТОЛЬКО ПРОСМОТР - продолжение)* 📖\n\n", ticket.ID)
-				}
-
-				// Добавляем текущее сообщение
-				combinedMessages += singleMessage
-				messageCounter = 1
-			} else {
-				// Добавляем сообщение к текущему блоку
-				combinedMessages += singleMessage
-				messageCounter++
-			}
-
-			// Для последнего сообщения
-			if i == len(messages)-1 && combinedMessages != "" {
-				msg := tgbotapi.NewMessage(chatID, combinedMessages)
-				msg.ParseMode = "Markdown"
-				SafeSendMessage(bot, msg)
-			}
-		}
-	}
-
-	// Показываем только кнопки для просмотра фото и возврата
-	keyboard := tgbotapi.NewReplyKeyboard(
-		tgbotapi.NewKeyboardButtonRow(
-			tgbotapi.NewKeyboardButton("🖼 Просмотреть фото"),
-		),
-		tgbotapi.NewKeyboardButtonRow(
-			tgbotapi.NewKeyboardButton("⬅️ Назад"),
-		),
-	)
-
-	msg := tgbotapi.NewMessage(chatID,
-		"📖 *Режим просмотра (только чтение)*\n\n"+
-			"🖼 Для просмотра фотографий нажмите 'Просмотреть фото'\n"+
-			"⬅️ Для возврата к истории тикетов нажмите 'Назад'")
-	msg.ParseMode = "Markdown"
-	msg.ReplyMarkup = keyboard
-	SafeSendMessage(bot, msg)
+	return string(runes[:maxLength-3]) + "..."
 }
 
 // showTicketConversation отображает все сообщения тикета
-func showTicketConversation(bot *tgbotapi.BotAPI, chatID int64, ticketID int) {
+func (h *Handler) showTicketConversation(chatID int64, ticketID int) {
 	// Получаем информацию о тикете
-	ticket, err := database.GetTicketByID(ticketID)
+	ticket, err := h.deps.Tickets.GetTicketByID(ticketID)
 	if err != nil {
-		logger.Error.Printf("Ошибка при получении тикета %d: %v", ticketID, err)
-		SendErrorMessage(bot, chatID, "Не удалось загрузить информацию о тикете")
+		logger.Error.With(logger.TicketID(ticketID)).Printf("Ошибка при получении тикета %d: %v", ticketID, err)
+		h.SendErrorMessage(chatID, "Не удалось загрузить информацию о тикете")
 		return
 	}
 
 	// Получаем все сообщения тикета
-	messages, err := database.GetTicketMessages(ticketID)
+	messages, err := h.deps.Messages.GetTicketMessages(ticketID)
 	if err != nil {
-		logger.Error.Printf("Ошибка при получении сообщений тикета %d: %v", ticketID, err)
-		SendErrorMessage(bot, chatID, "Не удалось загрузить сообщения тикета")
+		logger.Error.With(logger.TicketID(ticketID)).Printf("Ошибка при получении сообщений тикета %d: %v", ticketID, err)
+		h.SendErrorMessage(chatID, "Не удалось загрузить сообщения тикета")
 		return
 	}
 
@@ -407,7 +192,7 @@ func showTicketConversation(bot *tgbotapi.BotAPI, chatID int64, ticketID int) {
 		messages = messages[len(messages)-maxMessages:]
 		warningMsg := tgbotapi.NewMessage(chatID,
 			fmt.Sprintf("⚠️ Показаны только последние %d сообщений из %d", maxMessages, len(messages)))
-		SafeSendMessage(bot, warningMsg)
+		h.SafeSendMessage(warningMsg)
 	}
 
 	// Формируем красивую шапку тикета с эмодзи
@@ -419,8 +204,8 @@ func showTicketConversation(bot *tgbotapi.BotAPI, chatID int64, ticketID int) {
 		"💬 *ИСТОРИЯ ДИАЛОГА:*\n",
 		ticket.ID, ticket.Title,
 		ticket.CreatedAt.Format("02.01.2006 15:04"),
-		getCategoryName(ticket.Category),
-		getStatusEmoji(ticket.Status), ticket.Status)
+		h.getCategoryName(ticket.Category),
+		ticket.Status.Emoji(), ticket.Status.Title())
 
 	// Объединяем сообщения в более крупные блоки
 	const maxTelegramMessageSize = 4000 // Немного меньше максимального (4096), для запаса
@@ -432,7 +217,8 @@ func showTicketConversation(bot *tgbotapi.BotAPI, chatID int64, ticketID int) {
 		combinedMessages += "\n🔍 В этом тикете пока нет сообщений."
 		msg := tgbotapi.NewMessage(chatID, combinedMessages)
 		msg.ParseMode = "Markdown"
-		SafeSendMessage(bot, msg)
+		msg.ReplyMarkup = ticketCardKeyboard(ticket)
+		h.SafeSendMessage(msg)
 	} else {
 		// Собираем сообщения в блоки
 		for i, message := range messages {
@@ -447,7 +233,7 @@ func showTicketConversation(bot *tgbotapi.BotAPI, chatID int64, ticketID int) {
 			} else {
 				senderEmoji = "👨‍💼"
 				// Получаем имя сотрудника поддержки
-				supportName, err := database.GetUserNameByID(message.SenderID)
+				supportName, err := h.deps.Users.GetUserNameByID(message.SenderID)
 				if err != nil {
 					supportName = "Поддержка"
 				}
@@ -470,7 +256,7 @@ func showTicketConversation(bot *tgbotapi.BotAPI, chatID int64, ticketID int) {
 					// Отправляем предыдущий блок
 					msg := tgbotapi.NewMessage(chatID, combinedMessages)
 					msg.ParseMode = "Markdown"
-					SafeSendMessage(bot, msg)
+					h.SafeSendMessage(msg)
 				}
 
 				// Если это первое сообщение в новом блоке (не первый блок)
@@ -492,36 +278,29 @@ func showTicketConversation(bot *tgbotapi.BotAPI, chatID int64, ticketID int) {
 			if i == len(messages)-1 && combinedMessages != "" {
 				msg := tgbotapi.NewMessage(chatID, combinedMessages)
 				msg.ParseMode = "Markdown"
-				SafeSendMessage(bot, msg)
+				msg.ReplyMarkup = ticketCardKeyboard(ticket)
+				h.SafeSendMessage(msg)
 			}
 		}
 	}
 
 	// Предлагаем ответить на тикет
-	if ticket.Status != "закрыт" {
+	if !ticket.Status.IsFinal() {
 		// Клавиатура с кнопками
-		keyboard := tgbotapi.NewReplyKeyboard(
-			tgbotapi.NewKeyboardButtonRow(
-				tgbotapi.NewKeyboardButton("🖼 Просмотреть фото"),
-				tgbotapi.NewKeyboardButton("❌ Закрыть тикет"),
-			),
-			tgbotapi.NewKeyboardButtonRow(
-				tgbotapi.NewKeyboardButton("⬅️ Назад"),
-			),
-		)
+		keyboard := GetTicketReplyKeyboard()
 
 		msg := tgbotapi.NewMessage(chatID,
-			"✏️ *Чтобы ответить, просто напишите сообщение или прикрепите фотографию.*\n\n"+
-				"🖼 Для просмотра фотографий нажмите 'Просмотреть фото'\n"+
+			"✏️ *Чтобы ответить, просто напишите сообщение или прикрепите файл: фото, документ, голосовое или видео.*\n\n"+
+				"📎 Для просмотра вложений нажмите 'Просмотреть вложения'\n"+
 				"⬅️ Для возврата в меню нажмите 'Назад'")
 		msg.ParseMode = "Markdown"
 		msg.ReplyMarkup = keyboard
-		SafeSendMessage(bot, msg)
+		h.SafeSendMessage(msg)
 	} else {
 		// Если тикет закрыт
 		keyboard := tgbotapi.NewReplyKeyboard(
 			tgbotapi.NewKeyboardButtonRow(
-				tgbotapi.NewKeyboardButton("🖼 Просмотреть фото"),
+				tgbotapi.NewKeyboardButton(buttonViewAttachments),
 			),
 			tgbotapi.NewKeyboardButtonRow(
 				tgbotapi.NewKeyboardButton("⬅️ Назад"),
@@ -530,12 +309,20 @@ func showTicketConversation(bot *tgbotapi.BotAPI, chatID int64, ticketID int) {
 
 		msg := tgbotapi.NewMessage(chatID,
 			"🔒 *Тикет закрыт и не может быть обновлен.*\n\n"+
-				"🖼 Вы можете просмотреть прикрепленные фотографии\n"+
+				"📎 Вы можете просмотреть вложения тикета\n"+
 				"⬅️ Или вернуться в главное меню")
 		msg.ParseMode = "Markdown"
 		msg.ReplyMarkup = keyboard
-		SafeSendMessage(bot, msg)
+		h.SafeSendMessage(msg)
+	}
+}
+
+// ticketCardKeyboard возвращает inline-клавиатуру карточки тикета в зависимости от его статуса
+func ticketCardKeyboard(ticket *database.Ticket) tgbotapi.InlineKeyboardMarkup {
+	if ticket.Status.IsFinal() {
+		return GetClosedTicketInlineKeyboard(ticket.ID)
 	}
+	return GetTicketInlineKeyboard(ticket.ID)
 }
 
 // Более эстетичный разделитель сообщений
@@ -552,27 +339,46 @@ func formatMessageText(text string) string {
 	return "`\n" + text + "`"
 }
 
-// getCategoryName возвращает название категории
-func getCategoryName(category string) string {
-	switch category {
-	case "Вопрос":
-		return "Вопрос"
-	case "Важное":
-		return "Важно,Срочно"
-	case "Финансы":
-		return "Финансы"
-	default:
-		return category
+// getCategoryName возвращает название категории с эмодзи
+func (h *Handler) getCategoryName(code string) string {
+	return h.findCategory(code).Label()
+}
+
+// findCategory возвращает категорию из справочника. Если ее нет или справочник недоступен,
+// возвращает категорию с названием, равным коду.
+func (h *Handler) findCategory(code string) database.Category {
+	category, err := h.deps.Categories.GetCategory(code)
+	if err != nil {
+		if !errors.Is(err, database.ErrCategoryNotFound) {
+			logger.Error.Printf("Ошибка при получении категории %q: %v", code, err)
+		}
+		return database.Category{Code: code, Name: code, DefaultPriority: database.PriorityNormal}
+	}
+	return *category
+}
+
+// activeCategories возвращает категории, доступные при создании тикета.
+// Если справочник недоступен, возвращает категории по умолчанию.
+func (h *Handler) activeCategories() []database.Category {
+	categories, err := h.deps.Categories.ListCategories(true)
+	if err != nil {
+		logger.Error.Printf("Ошибка при получении категорий тикетов: %v", err)
+		return database.DefaultCategories()
 	}
+	return categories
 }
 
 // HandleCloseTicket обрабатывает закрытие тикета
-func HandleCloseTicket(bot *tgbotapi.BotAPI, chatID int64, userID int64, ticketID int) {
+func (h *Handler) HandleCloseTicket(chatID int64, userID int64, ticketID int) {
 	// Закрываем тикет в базе данных
-	err := database.CloseTicket(ticketID, userID)
+	err := h.deps.Tickets.CloseTicket(ticketID, userID)
+	if errors.Is(err, database.ErrStatusTransition) {
+		h.SendErrorMessage(chatID, fmt.Sprintf("Тикет #%d уже закрыт или отменён.", ticketID))
+		return
+	}
 	if err != nil {
-		logger.Error.Printf("Ошибка при закрытии тикета %d: %v", ticketID, err)
-		SendErrorMessage(bot, chatID, "Не удалось закрыть тикет. Пожалуйста, попробуйте позже.")
+		logger.Error.With(logger.TicketID(ticketID)).Printf("Ошибка при закрытии тикета %d: %v", ticketID, err)
+		h.SendErrorMessage(chatID, "Не удалось закрыть тикет. Пожалуйста, попробуйте позже.")
 		return
 	}
 
@@ -580,21 +386,23 @@ func HandleCloseTicket(bot *tgbotapi.BotAPI, chatID int64, userID int64, ticketI
 	msg := tgbotapi.NewMessage(chatID, fmt.Sprintf("🔒 *Тикет #%d успешно закрыт*\n\nСпасибо за обращение! Если у вас появятся новые вопросы, вы всегда можете создать новый тикет.", ticketID))
 	msg.ParseMode = "Markdown"
 	msg.ReplyMarkup = GetMainMenuKeyboard()
-	SafeSendMessage(bot, msg)
+	h.SafeSendMessage(msg)
 
-	// Обновляем состояние пользователя
-	userStates[userID] = &UserState{State: "main_menu"}
+	// Пользователь возвращается в главное меню
+	h.clearUserState(userID)
 }
 
 // Добавляем новую функцию для отправки случайных советов
-func SendRandomTip(bot *tgbotapi.BotAPI, chatID int64) {
+func (h *Handler) SendRandomTip(chatID int64) {
 	tips := []string{
-		"💡 Совет: Прикрепляйте фотографии к тикетам для более быстрого решения проблемы.",
+		"💡 Совет: Прикрепляйте к тикетам скриншоты, документы и голосовые сообщения для более быстрого решения проблемы.",
 		"💡 Совет: Подробно описывайте проблему в тикете для более эффективной помощи.",
-		"💡 Совет: Используйте категорию 'Важно,Срочно' только для действительно срочных вопросов.",
 		"💡 Совет: Проверяйте статус ваших тикетов регулярно для получения обновлений.",
 		"💡 Совет: Если проблема решена, не забудьте закрыть тикет.",
 	}
+	if tip := h.urgentCategoryTip(); tip != "" {
+		tips = append(tips, tip)
+	}
 
 	// Выбираем случайный совет
 	rand.Seed(time.Now().UnixNano())
@@ -602,121 +410,34 @@ func SendRandomTip(bot *tgbotapi.BotAPI, chatID int64) {
 
 	// Отправляем совет
 	msg := tgbotapi.NewMessage(chatID, randomTip)
-	SafeSendMessage(bot, msg)
+	h.SafeSendMessage(msg)
 }
 
-// showTicketPhotos отображает все фотографии тикета
-func showTicketPhotos(bot *tgbotapi.BotAPI, chatID int64, ticketID int) {
-	// Получаем все фотографии тикета
-	photos, err := database.GetTicketPhotos(ticketID)
-	if err != nil {
-		logger.Error.Printf("Ошибка при получении фотографий тикета %d: %v", ticketID, err)
-		SendErrorMessage(bot, chatID, "Не удалось загрузить фотографии тикета")
-		return
-	}
-
-	if len(photos) == 0 {
-		msg := tgbotapi.NewMessage(chatID, "📷 В этом тикете нет прикрепленных фотографий.")
-		SafeSendMessage(bot, msg)
-		return
-	}
-
-	// Отправляем сообщение с количеством фотографий
-	msg := tgbotapi.NewMessage(chatID,
-		fmt.Sprintf("🖼 *Фотографии к тикету #%d*\n\nНайдено фотографий: %d", ticketID, len(photos)))
-	msg.ParseMode = "Markdown"
-	SafeSendMessage(bot, msg)
-
-	// Отправляем каждую фотографию (максимум 10)
-	maxPhotos := 10
-	if len(photos) > maxPhotos {
-		photos = photos[len(photos)-maxPhotos:]
-		warningMsg := tgbotapi.NewMessage(chatID,
-			fmt.Sprintf("⚠️ Показаны только последние %d из %d фотографий", maxPhotos, len(photos)))
-		SafeSendMessage(bot, warningMsg)
-	}
-
-	for i, photo := range photos {
-		// Проверяем, существует ли файл
-		_, err := os.Stat(photo.FilePath)
-		if err != nil {
-			// Если файл не найден, отправляем сообщение о недоступности
-			errorMsg := tgbotapi.NewMessage(chatID,
-				fmt.Sprintf("⚠️ Фото #%d недоступно: файл не найден", i+1))
-			SafeSendMessage(bot, errorMsg)
-			continue
-		}
-
-		// Открываем файл
-		file, err := os.Open(photo.FilePath)
-		if err != nil {
-			logger.Error.Printf("Ошибка при открытии файла %s: %v", photo.FilePath, err)
-			errorMsg := tgbotapi.NewMessage(chatID,
-				fmt.Sprintf("⚠️ Фото #%d недоступно: ошибка чтения файла", i+1))
-			SafeSendMessage(bot, errorMsg)
-			continue
-		}
-		defer file.Close()
-
-		// Определяем расширение файла из пути
-		ext := filepath.Ext(photo.FilePath)
-		if ext == "" {
-			ext = ".jpg" // По умолчанию используем .jpg
-		}
-
-		// Создаем новую фотографию из файла
-		photoMsg := tgbotapi.NewPhoto(chatID, tgbotapi.FileReader{
-			Name:   fmt.Sprintf("photo_%d%s", i+1, ext),
-			Reader: file,
-		})
-
-		var senderEmoji, sender string
-		if photo.SenderType == "user" {
-			senderEmoji = "👤"
-			sender = "Вы"
-		} else {
-			senderEmoji = "👨‍💼"
-			supportName, err := database.GetUserNameByID(photo.SenderID)
-			if err != nil {
-				supportName = "Поддержка"
-			}
-			sender = supportName
-		}
-
-		photoMsg.Caption = fmt.Sprintf("📷 *Фото #%d*\n👤 Отправитель: %s %s\n🕒 Дата: %s",
-			i+1, senderEmoji, sender, photo.CreatedAt.Format("02.01.2006 15:04"))
-		photoMsg.ParseMode = "Markdown"
-
-		// Отправляем фото
-		_, err = bot.Send(photoMsg)
-		if err != nil {
-			logger.Error.Printf("Ошибка при отправке фото %s: %v", photo.FilePath, err)
-			errorMsg := tgbotapi.NewMessage(chatID,
-				fmt.Sprintf("⚠️ Не удалось отправить фото #%d: %v", i+1, err))
-			SafeSendMessage(bot, errorMsg)
+// urgentCategoryTip возвращает совет о срочных категориях из справочника или "", если их нет
+func (h *Handler) urgentCategoryTip() string {
+	var names []string
+	for _, c := range h.activeCategories() {
+		if c.DefaultPriority == database.PriorityUrgent {
+			names = append(names, "'"+c.Name+"'")
 		}
-
-		// Задержка между отправкой фотографий
-		time.Sleep(300 * time.Millisecond)
 	}
-
-	// Отправляем кнопку "Назад"
-	backMsg := tgbotapi.NewMessage(chatID, "⬅️ Для возврата к диалогу нажмите 'Назад'")
-	backMsg.ReplyMarkup = tgbotapi.NewReplyKeyboard(
-		tgbotapi.NewKeyboardButtonRow(
-			tgbotapi.NewKeyboardButton("⬅️ Назад"),
-		),
-	)
-	SafeSendMessage(bot, backMsg)
+	switch len(names) {
+	case 0:
+		return ""
+	case 1:
+		return fmt.Sprintf("💡 Совет: Используйте категорию %s только для действительно срочных вопросов.", names[0])
+	default:
+		return fmt.Sprintf("💡 Совет: Используйте категории %s только для действительно срочных вопросов.", strings.Join(names, ", "))
+	}
 }
 
 // Добавляем новую функцию для генерации QR-кода с информацией о тикете
-func generateTicketQR(bot *tgbotapi.BotAPI, chatID int64, ticketID int) {
+func (h *Handler) generateTicketQR(chatID int64, ticketID int) {
 	// Получаем информацию о тикете
-	ticket, err := database.GetTicketByID(ticketID)
+	ticket, err := h.deps.Tickets.GetTicketByID(ticketID)
 	if err != nil {
-		logger.Error.Printf("Ошибка при получении тикета %d: %v", ticketID, err)
-		SendErrorMessage(bot, chatID, "Не удалось загрузить информацию о тикете")
+		logger.Error.With(logger.TicketID(ticketID)).Printf("Ошибка при получении тикета %d: %v", ticketID, err)
+		h.SendErrorMessage(chatID, "Не удалось загрузить информацию о тикете")
 		return
 	}
 
@@ -724,66 +445,50 @@ func generateTicketQR(bot *tgbotapi.BotAPI, chatID int64, ticketID int) {
 	qrText := fmt.Sprintf("Тикет #%d\nТема: %s\nСтатус: %s\nСоздан: %s",
 		ticket.ID, ticket.Title, ticket.Status, ticket.CreatedAt.Format("02.01.2006 15:04"))
 
-	// Генерируем QR-код
-	// Используем helper для получения/создания директории ../uploads
-	qrDirBase := ensureUploadsDir()
-
-	// Путь к файлу QR-кода
-	// ensureUploadsDir обрабатывает создание базовой директории.
-	// Если произошла ошибка в ensureUploadsDir и она вернула "uploads",
-	// QR-код будет сохранен в локальной директории "uploads".
-	qrFilePath := filepath.Join(qrDirBase, fmt.Sprintf("qr_ticket_%d.png", ticketID))
-	err = qrcode.WriteFile(qrText, qrcode.Medium, 256, qrFilePath)
+	// Генерируем QR-код в памяти, не сохраняя его на диск
+	png, err := qrcode.Encode(qrText, qrcode.Medium, 256)
 	if err != nil {
 		logger.Error.Printf("Ошибка при генерации QR-кода: %v", err)
-		SendErrorMessage(bot, chatID, "Не удалось сгенерировать QR-код")
+		h.SendErrorMessage(chatID, "Не удалось сгенерировать QR-код")
 		return
 	}
 
 	// Отправляем QR-код пользователю
-	file, err := os.Open(qrFilePath)
-	if err != nil {
-		logger.Error.Printf("Ошибка при открытии файла QR-кода: %v", err)
-		SendErrorMessage(bot, chatID, "Не удалось отправить QR-код")
-		return
-	}
-	defer file.Close()
-
-	photoMsg := tgbotapi.NewPhoto(chatID, tgbotapi.FileReader{
-		Name:   fmt.Sprintf("qr_ticket_%d.png", ticketID),
-		Reader: file,
+	photoMsg := tgbotapi.NewPhoto(chatID, tgbotapi.FileBytes{
+		Name:  fmt.Sprintf("qr_ticket_%d.png", ticketID),
+		Bytes: png,
 	})
 	photoMsg.Caption = "🔍 QR-код с информацией о вашем тикете"
 
-	_, err = bot.Send(photoMsg)
+	_, err = h.dispatcher.Send(photoMsg)
 	if err != nil {
 		logger.Error.Printf("Ошибка при отправке QR-кода: %v", err)
-		SendErrorMessage(bot, chatID, "Не удалось отправить QR-код")
+		h.SendErrorMessage(chatID, "Не удалось отправить QR-код")
 	}
 }
 
 // Добавляем новую функцию для отображения статуса тикета
-func showTicketStatus(bot *tgbotapi.BotAPI, chatID int64, ticketID int) {
+func (h *Handler) showTicketStatus(chatID int64, ticketID int) {
 	// Получаем информацию о тикете
-	ticket, err := database.GetTicketByID(ticketID)
+	ticket, err := h.deps.Tickets.GetTicketByID(ticketID)
 	if err != nil {
-		logger.Error.Printf("Ошибка при получении тикета %d: %v", ticketID, err)
-		SendErrorMessage(bot, chatID, "Не удалось загрузить информацию о тикете")
+		logger.Error.With(logger.TicketID(ticketID)).Printf("Ошибка при получении тикета %d: %v", ticketID, err)
+		h.SendErrorMessage(chatID, "Не удалось загрузить информацию о тикете")
 		return
 	}
 
 	// Получаем количество сообщений
-	messageCount, err := database.GetTicketMessageCount(ticketID)
+	messageCount, err := h.deps.Messages.GetTicketMessageCount(ticketID)
 	if err != nil {
 		logger.Error.Printf("Ошибка при получении количества сообщений: %v", err)
 		messageCount = 0
 	}
 
-	// Получаем количество фотографий
-	photos, err := database.GetTicketPhotos(ticketID)
+	// Получаем количество вложений
+	attachments, err := h.deps.Attachments.GetTicketAttachments(ticketID)
 	if err != nil {
-		logger.Error.Printf("Ошибка при получении фотографий: %v", err)
-		photos = nil
+		logger.Error.Printf("Ошибка при получении вложений: %v", err)
+		attachments = nil
 	}
 
 	// Формируем красивое сообщение о статусе
@@ -793,17 +498,17 @@ func showTicketStatus(bot *tgbotapi.BotAPI, chatID int64, ticketID int) {
 		"📊 *Текущий статус:* %s %s\n"+
 		"📅 *Создан:* %s\n"+
 		"💬 *Сообщений:* %d\n"+
-		"🖼 *Фотографий:* %d\n\n"+
+		"📎 *Вложений:* %d\n\n"+
 		"⏱ *Время последнего обновления:* %s",
 		ticket.ID, ticket.Title,
-		getCategoryName(ticket.Category),
-		getStatusEmoji(ticket.Status), ticket.Status,
+		h.getCategoryName(ticket.Category),
+		ticket.Status.Emoji(), ticket.Status.Title(),
 		ticket.CreatedAt.Format("02.01.2006 15:04"),
 		messageCount,
-		len(photos),
+		len(attachments),
 		time.Now().Format("02.01.2006 15:04:05"))
 
 	msg := tgbotapi.NewMessage(chatID, statusText)
 	msg.ParseMode = "Markdown"
-	SafeSendMessage(bot, msg)
+	h.SafeSendMessage(msg)
 }
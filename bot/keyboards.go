@@ -3,6 +3,8 @@ package bot
 import (
 	fmt "fmt"
 
+	"supportTicketBotGo/database"
+
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
 
@@ -58,36 +60,104 @@ func GetConfirmKeyboard() tgbotapi.ReplyKeyboardMarkup {
 	return keyboard
 }
 
-// Создаем клавиатуру категорий тикетов с современными эмодзи
-func GetCategoryKeyboard() tgbotapi.ReplyKeyboardMarkup {
-	keyboard := tgbotapi.NewReplyKeyboard(
+// Создаем клавиатуру категорий тикетов: по кнопке на категорию и кнопка отмены
+func GetCategoryKeyboard(categories []database.Category) tgbotapi.ReplyKeyboardMarkup {
+	rows := make([][]tgbotapi.KeyboardButton, 0, len(categories)+1)
+	for _, c := range categories {
+		rows = append(rows, tgbotapi.NewKeyboardButtonRow(tgbotapi.NewKeyboardButton(c.Label())))
+	}
+	rows = append(rows, tgbotapi.NewKeyboardButtonRow(tgbotapi.NewKeyboardButton("❌ Отмена")))
+
+	keyboard := tgbotapi.NewReplyKeyboard(rows...)
+	keyboard.OneTimeKeyboard = true
+	return keyboard
+}
+
+// Создаем inline клавиатуру для тикета с современными эмодзи
+func GetTicketInlineKeyboard(ticketID int) tgbotapi.InlineKeyboardMarkup {
+	return tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("📎 Вложения", fmt.Sprintf("photos_%d", ticketID)),
+			tgbotapi.NewInlineKeyboardButtonData("📈 Статус", fmt.Sprintf("status_%d", ticketID)),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("💬 Ответить", fmt.Sprintf("reply_%d", ticketID)),
+			tgbotapi.NewInlineKeyboardButtonData("🔒 Закрыть", fmt.Sprintf("close_%d", ticketID)),
+		),
+	)
+}
+
+// Создаем inline клавиатуру для закрытого тикета (только просмотр)
+func GetClosedTicketInlineKeyboard(ticketID int) tgbotapi.InlineKeyboardMarkup {
+	return tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("📎 Вложения", fmt.Sprintf("photos_%d", ticketID)),
+			tgbotapi.NewInlineKeyboardButtonData("📈 Статус", fmt.Sprintf("status_%d", ticketID)),
+		),
+	)
+}
+
+// Создаем inline клавиатуру для уведомления о событии тикета
+func GetTicketNotificationKeyboard(ticketID int, closed bool) tgbotapi.InlineKeyboardMarkup {
+	row := tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("📂 Открыть тикет", fmt.Sprintf("open_%d", ticketID)),
+	)
+	if !closed {
+		row = append(row, tgbotapi.NewInlineKeyboardButtonData("✏️ Ответить", fmt.Sprintf("reply_%d", ticketID)))
+	}
+	return tgbotapi.NewInlineKeyboardMarkup(row)
+}
+
+// Создаем клавиатуру диалога по активному тикету
+func GetTicketReplyKeyboard() tgbotapi.ReplyKeyboardMarkup {
+	return tgbotapi.NewReplyKeyboard(
 		tgbotapi.NewKeyboardButtonRow(
-			tgbotapi.NewKeyboardButton("💭 Вопрос"),
+			tgbotapi.NewKeyboardButton(buttonViewAttachments),
+			tgbotapi.NewKeyboardButton("❌ Закрыть тикет"),
 		),
 		tgbotapi.NewKeyboardButtonRow(
-			tgbotapi.NewKeyboardButton("🚨 Важно,Срочно"),
+			tgbotapi.NewKeyboardButton("⬅️ Назад"),
 		),
+	)
+}
+
+// Создаем меню агента поддержки
+func GetAgentMenuKeyboard() tgbotapi.ReplyKeyboardMarkup {
+	keyboard := tgbotapi.NewReplyKeyboard(
 		tgbotapi.NewKeyboardButtonRow(
-			tgbotapi.NewKeyboardButton("💰 Финансы"),
+			tgbotapi.NewKeyboardButton("📥 Очередь тикетов"),
+			tgbotapi.NewKeyboardButton("🧑‍💻 Мои тикеты"),
 		),
 		tgbotapi.NewKeyboardButtonRow(
-			tgbotapi.NewKeyboardButton("❌ Отмена"),
+			tgbotapi.NewKeyboardButton("🚪 Выйти из режима агента"),
 		),
 	)
-	keyboard.OneTimeKeyboard = true
+	keyboard.ResizeKeyboard = true
 	return keyboard
 }
 
-// Создаем inline клавиатуру для тикета с современными эмодзи
-func GetTicketInlineKeyboard(ticketID int) tgbotapi.InlineKeyboardMarkup {
+// Создаем inline клавиатуру действий агента с тикетом
+func GetAgentTicketKeyboard(ticketID int) tgbotapi.InlineKeyboardMarkup {
 	return tgbotapi.NewInlineKeyboardMarkup(
 		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("📷 Фото", fmt.Sprintf("photos_%d", ticketID)),
-			tgbotapi.NewInlineKeyboardButtonData("📈 Статус", fmt.Sprintf("status_%d", ticketID)),
+			tgbotapi.NewInlineKeyboardButtonData("🙋 Взять в работу", fmt.Sprintf("agent_take_%d", ticketID)),
+			tgbotapi.NewInlineKeyboardButtonData("💬 Ответить", fmt.Sprintf("agent_reply_%d", ticketID)),
 		),
 		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("💬 Ответить", fmt.Sprintf("reply_%d", ticketID)),
-			tgbotapi.NewInlineKeyboardButtonData("🔒 Закрыть", fmt.Sprintf("close_%d", ticketID)),
+			tgbotapi.NewInlineKeyboardButtonData("📈 Изменить статус", fmt.Sprintf("agent_status_%d", ticketID)),
 		),
 	)
 }
+
+// Создаем inline клавиатуру выбора статуса тикета для агента (только разрешенные переходы)
+func GetAgentStatusKeyboard(ticketID int, current database.TicketStatus) tgbotapi.InlineKeyboardMarkup {
+	next := current.Next()
+	rows := make([][]tgbotapi.InlineKeyboardButton, 0, len(next))
+	for _, status := range next {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(status.Label(),
+				fmt.Sprintf("agent_set_%s_%d", status.Code(), ticketID)),
+		))
+	}
+	return tgbotapi.NewInlineKeyboardMarkup(rows...)
+}
@@ -0,0 +1,220 @@
+package bot
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"supportTicketBotGo/database"
+	"supportTicketBotGo/logger"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/lib/pq"
+)
+
+// Параметры доставки уведомлений
+const (
+	notifierBatchSize    = 50
+	notifierPollInterval = 30 * time.Second // страховочный опрос на случай потери NOTIFY
+	notifierStaleAfter   = 5 * time.Minute
+	notifierMaxAttempts  = 5
+	notifierRetryDelay   = 30 * time.Second // задержка перед второй попыткой, дальше удваивается
+	notifierMaxDelay     = 10 * time.Minute
+)
+
+// Notifier доставляет пользователям уведомления об ответах поддержки и смене статуса тикета.
+// Источник событий - таблица ticket_events, которую заполняют триггеры БД.
+// Обработка запускается по хукам из database (записи самого бота),
+// по LISTEN/NOTIFY (записи внешних инструментов) и по таймеру.
+type Notifier struct {
+	deps       Deps
+	dispatcher *Dispatcher
+	listener   *pq.Listener
+	wake       chan struct{}
+	stop       chan struct{}
+	done       chan struct{}
+	stopOnce   sync.Once
+}
+
+// NewNotifier создает обработчик уведомлений и подписывается на канал ticket_events
+func NewNotifier(deps Deps, dispatcher *Dispatcher, connStr string) (*Notifier, error) {
+	listener := pq.NewListener(connStr, 10*time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			logger.Warning.Printf("Ошибка соединения LISTEN для уведомлений: %v", err)
+		}
+	})
+	if err := listener.Listen(database.TicketEventsChannel); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("ошибка подписки на канал %s: %v", database.TicketEventsChannel, err)
+	}
+
+	return &Notifier{
+		deps:       deps,
+		dispatcher: dispatcher,
+		listener:   listener,
+		wake:       make(chan struct{}, 1),
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}, nil
+}
+
+// Start запускает обработку событий в отдельной горутине
+func (n *Notifier) Start() {
+	go n.run()
+}
+
+// Wake сообщает обработчику о появлении новых событий. Не блокирует вызывающего.
+func (n *Notifier) Wake() {
+	select {
+	case n.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Stop останавливает обработку и закрывает соединение LISTEN
+func (n *Notifier) Stop() {
+	n.stopOnce.Do(func() {
+		close(n.stop)
+		<-n.done
+		n.listener.Close()
+	})
+}
+
+func (n *Notifier) run() {
+	defer close(n.done)
+
+	ticker := time.NewTicker(notifierPollInterval)
+	defer ticker.Stop()
+
+	// Доставляем события, накопившиеся за время простоя
+	n.processPending()
+
+	for {
+		select {
+		case <-n.stop:
+			return
+		case <-n.wake:
+		case <-n.listener.Notify:
+		case <-ticker.C:
+		}
+		n.processPending()
+	}
+}
+
+// processPending доставляет все ожидающие события
+func (n *Notifier) processPending() {
+	for {
+		events, err := database.ClaimTicketEvents(notifierBatchSize, notifierStaleAfter)
+		if err != nil {
+			logger.Error.Printf("Ошибка при получении событий тикетов: %v", err)
+			return
+		}
+
+		for _, event := range events {
+			n.deliver(event)
+		}
+
+		if len(events) < notifierBatchSize {
+			return
+		}
+	}
+}
+
+// deliver отправляет уведомление об одном событии и записывает результат доставки
+func (n *Notifier) deliver(event database.TicketEvent) {
+	ticket, err := n.deps.Tickets.GetTicketByID(event.TicketID)
+	if err != nil {
+		n.fail(event, fmt.Errorf("ошибка при получении тикета: %v", err))
+		return
+	}
+
+	var text string
+	switch event.Kind {
+	case database.EventSupportMessage:
+		if !event.MessageID.Valid {
+			n.skip(event)
+			return
+		}
+		message, err := n.deps.Messages.GetTicketMessageByID(int(event.MessageID.Int64))
+		if errors.Is(err, sql.ErrNoRows) {
+			n.skip(event)
+			return
+		}
+		if err != nil {
+			n.fail(event, fmt.Errorf("ошибка при получении сообщения: %v", err))
+			return
+		}
+		text = fmt.Sprintf("📩 Новый ответ поддержки по тикету #%d\n📝 %s\n\n%s",
+			ticket.ID, ticket.Title, truncateString(message.Message, 3000))
+
+	case database.EventStatusChanged:
+		oldStatus := database.TicketStatus(event.OldStatus.String)
+		newStatus := database.TicketStatus(event.NewStatus.String)
+		text = fmt.Sprintf("📈 Статус тикета #%d изменен\n📝 %s\n\n%s → %s",
+			ticket.ID, ticket.Title, oldStatus.Label(), newStatus.Label())
+		if description := newStatus.Description(); description != "" {
+			text += "\n" + description
+		}
+
+	default:
+		n.skip(event)
+		return
+	}
+
+	msg := tgbotapi.NewMessage(ticket.UserID, text)
+	msg.ReplyMarkup = GetTicketNotificationKeyboard(ticket.ID, ticket.Status.IsFinal())
+	if _, err := n.dispatcher.Send(msg); err != nil {
+		if isBotBlocked(err) {
+			n.blocked(event, ticket.UserID, err)
+			return
+		}
+		n.fail(event, err)
+		return
+	}
+
+	if err := database.MarkTicketEventDelivered(event.ID); err != nil {
+		logger.Error.Printf("Ошибка при отметке доставки события %d: %v", event.ID, err)
+	}
+}
+
+func (n *Notifier) skip(event database.TicketEvent) {
+	if err := database.MarkTicketEventSkipped(event.ID); err != nil {
+		logger.Error.Printf("Ошибка при пропуске события %d: %v", event.ID, err)
+	}
+}
+
+func (n *Notifier) fail(event database.TicketEvent, deliveryErr error) {
+	logger.Warning.Printf("Не удалось доставить уведомление о событии %d тикета %d (попытка %d): %v",
+		event.ID, event.TicketID, event.Attempts, deliveryErr)
+	err := database.MarkTicketEventFailed(event.ID, deliveryErr, notifierMaxAttempts, notifierBackoff(event.Attempts))
+	if err != nil {
+		logger.Error.Printf("Ошибка при сохранении результата доставки события %d: %v", event.ID, err)
+	}
+}
+
+// blocked завершает доставку без повторов: пользователь заблокировал бота.
+// Отметка в users.bot_blocked_at исключает его из рассылок до следующего /start.
+func (n *Notifier) blocked(event database.TicketEvent, userID int64, deliveryErr error) {
+	logger.Info.With(logger.UserID(userID)).Printf("Пользователь %d заблокировал бота, уведомление о событии %d не доставлено",
+		userID, event.ID)
+	if err := database.MarkTicketEventFailed(event.ID, deliveryErr, 0, 0); err != nil {
+		logger.Error.Printf("Ошибка при сохранении результата доставки события %d: %v", event.ID, err)
+	}
+	if err := n.deps.Users.SetUserBlocked(userID, true); err != nil {
+		logger.Error.Printf("Ошибка при отметке блокировки бота пользователем %d: %v", userID, err)
+	}
+}
+
+// notifierBackoff возвращает задержку перед следующей попыткой после attempts неудачных
+func notifierBackoff(attempts int) time.Duration {
+	delay := notifierRetryDelay
+	for i := 1; i < attempts && delay < notifierMaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > notifierMaxDelay {
+		delay = notifierMaxDelay
+	}
+	return delay
+}
@@ -0,0 +1,379 @@
+package bot
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"supportTicketBotGo/database"
+	"supportTicketBotGo/storage"
+	"supportTicketBotGo/telegramtest"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// scenario - пользователь, который общается с ботом через поддельный сервер Bot API.
+// Обработчики работают на MemoryStore, MemoryStateStore и MemoryStorage.
+type scenario struct {
+	t          *testing.T
+	server     *telegramtest.Server
+	handler    *Handler
+	dispatcher *Dispatcher
+	store      *database.MemoryStore
+	files      *storage.MemoryStorage
+	userID     int64
+}
+
+func newScenario(t *testing.T, userID int64) *scenario {
+	t.Helper()
+	server := telegramtest.NewServer()
+	t.Cleanup(server.Close)
+	botAPI, err := server.Bot()
+	if err != nil {
+		t.Fatalf("подключение к поддельному серверу: %v", err)
+	}
+
+	// Ограничения Telegram в тестах только замедляют отправку
+	dispatcher := NewDispatcher(botAPI, RateLimits{GlobalPerSecond: 1000, ChatPerSecond: 1000, ChatBurst: 1000, GroupPerMinute: 1000})
+	t.Cleanup(func() { dispatcher.Stop(5 * time.Second) })
+
+	store, files := database.NewMemoryStore(), storage.NewMemoryStorage()
+	handler := NewHandler(botAPI, Deps{
+		Users: store, Tickets: store, Messages: store, Attachments: store, Categories: store,
+		States: NewMemoryStateStore(DefaultStateTTL), Storage: files,
+	}, dispatcher)
+
+	return &scenario{t: t, server: server, handler: handler, dispatcher: dispatcher, store: store, files: files, userID: userID}
+}
+
+// step выполняет действие пользователя и возвращает вызовы Bot API, которые оно вызвало
+func (s *scenario) step(action func()) []telegramtest.Call {
+	s.server.Reset()
+	action()
+	s.dispatcher.Flush()
+	return s.server.Calls()
+}
+
+func (s *scenario) start() []telegramtest.Call {
+	return s.step(func() { s.handler.HandleStart(telegramtest.TextMessage(s.userID, "/start")) })
+}
+
+func (s *scenario) send(message *tgbotapi.Message) []telegramtest.Call {
+	return s.step(func() { s.handler.HandleMessage(message) })
+}
+
+func (s *scenario) text(text string) []telegramtest.Call {
+	return s.send(telegramtest.TextMessage(s.userID, text))
+}
+
+func (s *scenario) press(data string) []telegramtest.Call {
+	return s.step(func() { s.handler.HandleCallbackQuery(telegramtest.CallbackQuery(s.userID, data)) })
+}
+
+// ticket возвращает тикет из хранилища
+func (s *scenario) ticket(id int) *database.Ticket {
+	s.t.Helper()
+	ticket, err := s.store.GetTicketByID(id)
+	if err != nil {
+		s.t.Fatalf("GetTicketByID(%d): %v", id, err)
+	}
+	return ticket
+}
+
+// lastMessage возвращает последний sendMessage среди вызовов и проверяет, что он содержит want
+func lastMessage(t *testing.T, calls []telegramtest.Call, want string) telegramtest.Call {
+	t.Helper()
+	for i := len(calls) - 1; i >= 0; i-- {
+		if calls[i].Method == "sendMessage" {
+			if !strings.Contains(calls[i].Text(), want) {
+				t.Fatalf("последнее сообщение %q, ожидалось содержащее %q", calls[i].Text(), want)
+			}
+			return calls[i]
+		}
+	}
+	t.Fatalf("бот ничего не отправил, ожидалось сообщение с %q", want)
+	return telegramtest.Call{}
+}
+
+// findMessage возвращает первый sendMessage среди вызовов, содержащий want
+func findMessage(t *testing.T, calls []telegramtest.Call, want string) telegramtest.Call {
+	t.Helper()
+	for _, call := range callsTo(calls, "sendMessage") {
+		if strings.Contains(call.Text(), want) {
+			return call
+		}
+	}
+	t.Fatalf("среди %d сообщений нет содержащего %q", len(callsTo(calls, "sendMessage")), want)
+	return telegramtest.Call{}
+}
+
+// hasButton проверяет, что у сообщения есть кнопка с текстом text
+func hasButton(call telegramtest.Call, text string) bool {
+	for _, button := range call.Buttons() {
+		if button == text {
+			return true
+		}
+	}
+	return false
+}
+
+// callsTo отбирает вызовы метода
+func callsTo(calls []telegramtest.Call, method string) []telegramtest.Call {
+	var result []telegramtest.Call
+	for _, call := range calls {
+		if call.Method == method {
+			result = append(result, call)
+		}
+	}
+	return result
+}
+
+// register проходит регистрацию: /start, ФИО и контакт
+func (s *scenario) register() {
+	s.t.Helper()
+	calls := s.start()
+	lastMessage(s.t, calls, "Пожалуйста, введите ваше полное имя")
+
+	calls = s.text("Петров Иван Сергеевич")
+	reply := lastMessage(s.t, calls, "поделитесь своим контактом")
+	if len(reply.Buttons()) == 0 {
+		s.t.Fatal("нет кнопки отправки контакта")
+	}
+
+	calls = s.send(telegramtest.ContactMessage(s.userID, "+79991234567"))
+	reply = lastMessage(s.t, calls, "Вы успешно зарегистрированы")
+	if !hasButton(reply, "✨ Создать тикет") {
+		s.t.Fatalf("после регистрации нет главного меню: %q", reply.Buttons())
+	}
+}
+
+// createTicket создает тикет в категории с кнопкой categoryButton и возвращает его ID
+func (s *scenario) createTicket(categoryButton, description string) int {
+	s.t.Helper()
+	calls := s.text("✨ Создать тикет")
+	reply := lastMessage(s.t, calls, "Выберите категорию")
+	if !hasButton(reply, categoryButton) {
+		s.t.Fatalf("нет кнопки %q среди %q", categoryButton, reply.Buttons())
+	}
+
+	lastMessage(s.t, s.text(categoryButton), "введите описание")
+	lastMessage(s.t, s.text(description), "подтвердите создание тикета")
+
+	calls = s.text("✅ Да")
+	lastMessage(s.t, calls, "успешно создан")
+
+	tickets, err := s.store.GetActiveTicketsByUserID(s.userID)
+	if err != nil || len(tickets) == 0 {
+		s.t.Fatalf("тикет не создан: %v", err)
+	}
+	return tickets[0].ID
+}
+
+func TestScenarioFinanceTicketWithPhotos(t *testing.T) {
+	t.Parallel()
+	s := newScenario(t, 1001)
+	s.register()
+
+	user, err := s.store.GetUserByID(s.userID)
+	if err != nil || !user.IsRegistered || user.FullName != "Петров Иван Сергеевич" || user.Phone != "+79991234567" {
+		t.Fatalf("пользователь после регистрации: %+v, %v", user, err)
+	}
+
+	// Создание тикета в категории "Финансы"
+	ticketID := s.createTicket("💰 Финансы", "Не прошла оплата подписки за май")
+	ticket := s.ticket(ticketID)
+	if ticket.Category != "финансы" || ticket.Status != database.StatusCreated ||
+		ticket.Title != "Финансы: Не прошла оплата подписки..." {
+		t.Fatalf("созданный тикет: %+v", ticket)
+	}
+	if count, _ := s.store.GetTicketMessageCount(ticketID); count != 1 {
+		t.Fatalf("сообщений в новом тикете: %d", count)
+	}
+
+	// Открытие тикета кнопкой уведомления
+	calls := s.press("open_" + strconv.Itoa(ticketID))
+	if len(callsTo(calls, "answerCallbackQuery")) != 1 {
+		t.Fatal("callback-запрос не подтвержден")
+	}
+	reply := lastMessage(t, calls, "Чтобы ответить")
+	if !hasButton(reply, "❌ Закрыть тикет") {
+		t.Fatalf("нет клавиатуры диалога по тикету: %q", reply.Buttons())
+	}
+
+	// Две фотографии к тикету
+	photos := []tgbotapi.PhotoSize{
+		s.server.AddFile("receipt-1", "image/jpeg", []byte("\xff\xd8\xff первый чек")),
+		s.server.AddFile("receipt-2", "image/jpeg", []byte("\xff\xd8\xff второй чек")),
+	}
+	for _, photo := range photos {
+		calls = s.send(telegramtest.PhotoMessage(s.userID, photo, ""))
+		findMessage(t, calls, "Файл успешно прикреплен")
+	}
+
+	attachments, _ := s.store.GetTicketAttachments(ticketID)
+	if len(attachments) != 2 {
+		t.Fatalf("вложений: %d, ожидалось 2", len(attachments))
+	}
+	for i, attachment := range attachments {
+		if attachment.Kind != database.AttachmentPhoto || attachment.FileID != photos[i].FileID || attachment.SenderType != "user" {
+			t.Fatalf("вложение %d: %+v", i, attachment)
+		}
+		file, err := s.files.Get(attachment.StorageKey)
+		if err != nil {
+			t.Fatalf("файл вложения %s не сохранен: %v", attachment.StorageKey, err)
+		}
+		data, _ := io.ReadAll(file)
+		file.Close()
+		if !bytes.HasSuffix(data, []byte("чек")) {
+			t.Fatalf("содержимое вложения %s: %q", attachment.StorageKey, data)
+		}
+	}
+	if status := s.ticket(ticketID).Status; status != database.StatusWaitingSupport {
+		t.Fatalf("статус после вложения: %s", status)
+	}
+
+	// Вложения уходят одним альбомом по file_id
+	calls = s.press("photos_" + strconv.Itoa(ticketID))
+	groups := callsTo(calls, "sendMediaGroup")
+	if len(groups) != 1 {
+		t.Fatalf("вызовов sendMediaGroup: %d, ожидался 1", len(groups))
+	}
+	var media []struct {
+		Type    string `json:"type"`
+		Media   string `json:"media"`
+		Caption string `json:"caption"`
+	}
+	if err := json.Unmarshal([]byte(groups[0].Params["media"]), &media); err != nil {
+		t.Fatalf("media альбома: %v", err)
+	}
+	if len(media) != 2 || media[0].Media != "receipt-1" || media[1].Media != "receipt-2" || media[0].Type != "photo" {
+		t.Fatalf("альбом: %+v", media)
+	}
+	if !strings.Contains(media[0].Caption, "Фото #1") {
+		t.Fatalf("подпись первого фото: %q", media[0].Caption)
+	}
+
+	// Закрытие тикета inline-кнопкой
+	calls = s.press("close_" + strconv.Itoa(ticketID))
+	reply = lastMessage(t, calls, "успешно закрыт")
+	if !hasButton(reply, "✨ Создать тикет") {
+		t.Fatalf("после закрытия нет главного меню: %q", reply.Buttons())
+	}
+	closed := s.ticket(ticketID)
+	if closed.Status != database.StatusClosed || !closed.ClosedAt.Valid {
+		t.Fatalf("закрытый тикет: %+v", closed)
+	}
+	if _, ok := s.handler.getUserState(s.userID); ok {
+		t.Fatal("после закрытия тикета осталось состояние диалога")
+	}
+
+	// Повторное нажатие на кнопку закрытия
+	calls = s.press("close_" + strconv.Itoa(ticketID))
+	answers := callsTo(calls, "answerCallbackQuery")
+	if len(answers) != 1 || answers[0].Params["text"] != "🔒 Тикет уже закрыт" {
+		t.Fatalf("ответ на повторное закрытие: %+v", answers)
+	}
+	if len(callsTo(calls, "sendMessage")) != 0 {
+		t.Fatal("повторное закрытие отправило сообщение")
+	}
+}
+
+func TestScenarioForeignTicketIsHidden(t *testing.T) {
+	t.Parallel()
+	owner := newScenario(t, 2001)
+	owner.register()
+	ticketID := owner.createTicket("💭 Вопрос", "Как изменить номер телефона?")
+
+	// Другой пользователь подбирает callback data чужого тикета
+	stranger := *owner
+	stranger.userID = 2002
+	calls := stranger.press("close_" + strconv.Itoa(ticketID))
+	answers := callsTo(calls, "answerCallbackQuery")
+	if len(answers) != 1 || !strings.Contains(answers[0].Params["text"], "нет доступа") {
+		t.Fatalf("ответ на чужой тикет: %+v", answers)
+	}
+	if status := owner.ticket(ticketID).Status; status != database.StatusCreated {
+		t.Fatalf("чужой тикет изменен: %s", status)
+	}
+}
+
+// failingAttachments - репозиторий вложений, который не может сохранить запись
+type failingAttachments struct {
+	database.AttachmentRepository
+}
+
+func (failingAttachments) AddTicketAttachment(*database.TicketAttachment) (int, error) {
+	return 0, errors.New("база недоступна")
+}
+
+func TestScenarioAttachmentSaveFailure(t *testing.T) {
+	t.Parallel()
+	s := newScenario(t, 3001)
+	s.register()
+	ticketID := s.createTicket("💭 Вопрос", "Не открывается личный кабинет")
+	s.press("open_" + strconv.Itoa(ticketID))
+
+	s.handler.deps.Attachments = failingAttachments{s.store}
+	photo := s.server.AddFile("screen-1", "image/png", []byte("\x89PNG скриншот"))
+	calls := s.send(telegramtest.PhotoMessage(s.userID, photo, ""))
+	lastMessage(t, calls, "ошибка при сохранении файла")
+
+	if attachments, _ := s.store.GetTicketAttachments(ticketID); len(attachments) != 0 {
+		t.Fatalf("записано вложений: %d", len(attachments))
+	}
+	if keys := s.files.Keys(); len(keys) != 0 {
+		t.Fatalf("в хранилище остались файлы: %q", keys)
+	}
+	if status := s.ticket(ticketID).Status; status != database.StatusCreated {
+		t.Fatalf("статус тикета изменился: %s", status)
+	}
+}
+
+func TestNewHandlerRequiresDeps(t *testing.T) {
+	t.Parallel()
+	defer func() {
+		if recover() == nil {
+			t.Fatal("NewHandler без хранилища файлов не паникует")
+		}
+	}()
+	deps := NewMemoryDeps()
+	deps.Storage = nil
+	NewHandler(nil, deps, nil)
+}
+
+func TestScenarioRevokedAgentCannotReply(t *testing.T) {
+	t.Parallel()
+	owner := newScenario(t, 4001)
+	owner.register()
+	ticketID := owner.createTicket("💭 Вопрос", "Не приходит код подтверждения")
+
+	agent := *owner
+	agent.userID = 4002
+	agent.register()
+	if err := agent.store.SetUserRole(agent.userID, database.RoleAgent); err != nil {
+		t.Fatalf("SetUserRole: %v", err)
+	}
+	agent.press("agent_reply_" + strconv.Itoa(ticketID))
+	lastMessage(t, agent.text("Код отправлен повторно"), "Ответ добавлен")
+
+	// Роль снята, пока агент находится в режиме ответа
+	if err := agent.store.SetUserRole(agent.userID, database.RoleUser); err != nil {
+		t.Fatalf("SetUserRole: %v", err)
+	}
+	lastMessage(t, agent.text("Ответ после снятия роли"), "только сотрудники поддержки")
+
+	messages, _ := agent.store.GetTicketMessages(ticketID)
+	for _, m := range messages {
+		if m.Message == "Ответ после снятия роли" {
+			t.Fatal("ответ бывшего агента добавлен в тикет")
+		}
+	}
+	if state, ok := agent.handler.getUserState(agent.userID); ok {
+		t.Fatalf("диалог ответа не завершен: %+v", state)
+	}
+}
@@ -0,0 +1,169 @@
+package bot
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"supportTicketBotGo/database"
+	"supportTicketBotGo/logger"
+)
+
+// DefaultStateTTL - время жизни незавершенного диалога по умолчанию
+const DefaultStateTTL = 24 * time.Hour
+
+// StateStore хранит состояния диалогов пользователей.
+// Реализации должны быть безопасны для конкурентного использования:
+// каждое обновление обрабатывается в отдельной горутине.
+type StateStore interface {
+	// Get возвращает копию состояния пользователя или nil, если состояния нет или оно устарело
+	Get(userID int64) (*UserState, error)
+	// Set сохраняет состояние пользователя и продлевает его время жизни
+	Set(userID int64, state *UserState) error
+	// Delete удаляет состояние пользователя
+	Delete(userID int64) error
+}
+
+// getUserState возвращает состояние пользователя; ошибки хранилища логируются
+// и трактуются как отсутствие состояния
+func (h *Handler) getUserState(userID int64) (*UserState, bool) {
+	state, err := h.deps.States.Get(userID)
+	if err != nil {
+		logger.Error.Printf("Ошибка при получении состояния пользователя %d: %v", userID, err)
+		return nil, false
+	}
+	return state, state != nil
+}
+
+// setUserState сохраняет состояние пользователя
+func (h *Handler) setUserState(userID int64, state *UserState) {
+	if err := h.deps.States.Set(userID, state); err != nil {
+		logger.Error.Printf("Ошибка при сохранении состояния пользователя %d: %v", userID, err)
+	}
+}
+
+// clearUserState удаляет состояние пользователя
+func (h *Handler) clearUserState(userID int64) {
+	if err := h.deps.States.Delete(userID); err != nil {
+		logger.Error.Printf("Ошибка при удалении состояния пользователя %d: %v", userID, err)
+	}
+}
+
+// --- Хранилище в памяти ---
+
+type memoryStateEntry struct {
+	state     UserState
+	expiresAt time.Time
+}
+
+// MemoryStateStore хранит состояния в памяти процесса с ограниченным временем жизни.
+// Подходит для одного экземпляра бота; при перезапуске состояния теряются.
+type MemoryStateStore struct {
+	mu        sync.Mutex
+	ttl       time.Duration
+	entries   map[int64]memoryStateEntry
+	lastSweep time.Time
+}
+
+// NewMemoryStateStore создает хранилище состояний в памяти
+func NewMemoryStateStore(ttl time.Duration) *MemoryStateStore {
+	return &MemoryStateStore{
+		ttl:       ttl,
+		entries:   make(map[int64]memoryStateEntry),
+		lastSweep: time.Now(),
+	}
+}
+
+// Get возвращает копию состояния пользователя
+func (s *MemoryStateStore) Get(userID int64) (*UserState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.entries[userID]
+	if !ok {
+		return nil, nil
+	}
+	if time.Now().After(entry.expiresAt) {
+		delete(s.entries, userID)
+		return nil, nil
+	}
+
+	state := entry.state
+	return &state, nil
+}
+
+// Set сохраняет копию состояния пользователя
+func (s *MemoryStateStore) Set(userID int64, state *UserState) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.entries[userID] = memoryStateEntry{state: *state, expiresAt: now.Add(s.ttl)}
+
+	// Периодически удаляем устаревшие записи, чтобы карта не росла бесконечно
+	if now.Sub(s.lastSweep) > s.ttl {
+		for id, entry := range s.entries {
+			if now.After(entry.expiresAt) {
+				delete(s.entries, id)
+			}
+		}
+		s.lastSweep = now
+	}
+	return nil
+}
+
+// Delete удаляет состояние пользователя
+func (s *MemoryStateStore) Delete(userID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.entries, userID)
+	return nil
+}
+
+// --- Хранилище в PostgreSQL ---
+
+// PostgresStateStore хранит состояния в таблице user_states.
+// Состояния переживают перезапуск и доступны всем репликам бота.
+type PostgresStateStore struct {
+	ttl time.Duration
+}
+
+// NewPostgresStateStore создает хранилище состояний в PostgreSQL и удаляет устаревшие записи
+func NewPostgresStateStore(ttl time.Duration) *PostgresStateStore {
+	removed, err := database.DeleteExpiredUserStates(ttl)
+	if err != nil {
+		logger.Error.Printf("Ошибка при удалении устаревших состояний пользователей: %v", err)
+	} else if removed > 0 {
+		logger.Info.Printf("Удалено устаревших состояний пользователей: %d", removed)
+	}
+	return &PostgresStateStore{ttl: ttl}
+}
+
+// Get загружает состояние пользователя из базы данных
+func (s *PostgresStateStore) Get(userID int64) (*UserState, error) {
+	data, err := database.GetUserState(userID, s.ttl)
+	if err != nil || data == nil {
+		return nil, err
+	}
+
+	state := &UserState{}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// Set сохраняет состояние пользователя в базу данных
+func (s *PostgresStateStore) Set(userID int64, state *UserState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return database.SaveUserState(userID, data)
+}
+
+// Delete удаляет состояние пользователя из базы данных
+func (s *PostgresStateStore) Delete(userID int64) error {
+	return database.DeleteUserState(userID)
+}
@@ -0,0 +1,155 @@
+package bot
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"supportTicketBotGo/logger"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Параметры пула обработчиков по умолчанию
+const (
+	DefaultUpdateWorkers   = 16
+	DefaultUpdateQueueSize = 100 // обновлений в очереди одного обработчика
+	// updatePoolWarnInterval - как часто предупреждать в логе о переполненных очередях
+	updatePoolWarnInterval = time.Minute
+)
+
+// UpdatePoolStats - состояние пула обработчиков обновлений
+type UpdatePoolStats struct {
+	Workers       int    `json:"workers"`
+	QueueSize     int    `json:"queue_size"`      // емкость очереди одного обработчика
+	Queued        int    `json:"queued"`          // обновлений в очередях сейчас
+	MaxQueueDepth int    `json:"max_queue_depth"` // самая длинная очередь сейчас
+	Busy          int    `json:"busy"`            // обработчиков, занятых обновлением
+	Processed     uint64 `json:"processed"`       // обработано обновлений с запуска
+	Throttled     uint64 `json:"throttled"`       // сколько раз прием ждал освобождения очереди
+}
+
+// UpdatePool обрабатывает входящие обновления фиксированным числом обработчиков.
+// Обновления одного пользователя всегда попадают к одному обработчику и обрабатываются
+// по порядку, разные пользователи обрабатываются параллельно. Когда очередь обработчика
+// заполнена, Submit ждет: прием обновлений замедляется вместо роста числа горутин.
+type UpdatePool struct {
+	queues    []chan tgbotapi.Update
+	handle    func(tgbotapi.Update)
+	queueSize int
+	wg        sync.WaitGroup
+	closeOnce sync.Once
+
+	busy      atomic.Int64
+	processed atomic.Uint64
+	throttled atomic.Uint64
+	lastWarn  atomic.Int64 // время последнего предупреждения о переполнении, UnixNano
+}
+
+// NewUpdatePool создает пул и запускает обработчики.
+// Нулевые workers и queueSize заменяются значениями по умолчанию.
+func NewUpdatePool(workers, queueSize int, handle func(tgbotapi.Update)) *UpdatePool {
+	if workers <= 0 {
+		workers = DefaultUpdateWorkers
+	}
+	if queueSize <= 0 {
+		queueSize = DefaultUpdateQueueSize
+	}
+	p := &UpdatePool{
+		queues:    make([]chan tgbotapi.Update, workers),
+		handle:    handle,
+		queueSize: queueSize,
+	}
+	for i := range p.queues {
+		p.queues[i] = make(chan tgbotapi.Update, queueSize)
+		p.wg.Add(1)
+		go p.work(p.queues[i])
+	}
+	return p
+}
+
+// Submit ставит обновление в очередь обработчика его пользователя.
+// Если очередь заполнена, ждет освободившегося места. После Close вызывать нельзя.
+func (p *UpdatePool) Submit(update tgbotapi.Update) {
+	queue := p.queues[p.shard(update)]
+	select {
+	case queue <- update:
+		return
+	default:
+	}
+
+	p.throttled.Add(1)
+	now := time.Now().UnixNano()
+	last := p.lastWarn.Load()
+	if now-last >= int64(updatePoolWarnInterval) && p.lastWarn.CompareAndSwap(last, now) {
+		stats := p.Stats()
+		logger.Warning.Printf("Очередь обработчика обновлений заполнена (%d), прием обновлений замедлен. В очередях: %d, занято обработчиков: %d из %d",
+			p.queueSize, stats.Queued, stats.Busy, stats.Workers)
+	}
+	queue <- update
+}
+
+// Close прекращает прием обновлений; уже принятые будут обработаны
+func (p *UpdatePool) Close() {
+	p.closeOnce.Do(func() {
+		for _, queue := range p.queues {
+			close(queue)
+		}
+	})
+}
+
+// Wait ждет обработки всех принятых обновлений после Close не дольше timeout.
+// Возвращает false, если время вышло.
+func (p *UpdatePool) Wait(timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// Stats возвращает текущее состояние пула
+func (p *UpdatePool) Stats() UpdatePoolStats {
+	stats := UpdatePoolStats{
+		Workers:   len(p.queues),
+		QueueSize: p.queueSize,
+		Busy:      int(p.busy.Load()),
+		Processed: p.processed.Load(),
+		Throttled: p.throttled.Load(),
+	}
+	for _, queue := range p.queues {
+		depth := len(queue)
+		stats.Queued += depth
+		if depth > stats.MaxQueueDepth {
+			stats.MaxQueueDepth = depth
+		}
+	}
+	return stats
+}
+
+func (p *UpdatePool) work(queue <-chan tgbotapi.Update) {
+	defer p.wg.Done()
+	for update := range queue {
+		p.busy.Add(1)
+		p.handle(update)
+		p.busy.Add(-1)
+		p.processed.Add(1)
+	}
+}
+
+// shard выбирает обработчик по ID пользователя, а для обновлений без отправителя - по ID чата
+func (p *UpdatePool) shard(update tgbotapi.Update) int {
+	var key int64
+	if user := update.SentFrom(); user != nil {
+		key = user.ID
+	} else if chat := update.FromChat(); chat != nil {
+		key = chat.ID
+	}
+	return int(uint64(key) % uint64(len(p.queues)))
+}
@@ -0,0 +1,183 @@
+package bot
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"supportTicketBotGo/telegramtest"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// userUpdate - обновление с сообщением пользователя userID
+func userUpdate(updateID int, userID int64) tgbotapi.Update {
+	return tgbotapi.Update{UpdateID: updateID, Message: telegramtest.TextMessage(userID, "текст")}
+}
+
+func TestUpdatePoolKeepsOrderPerUser(t *testing.T) {
+	t.Parallel()
+	var mu sync.Mutex
+	handled := make(map[int64][]int)
+	running := make(map[int64]bool)
+	pool := NewUpdatePool(4, 5, func(update tgbotapi.Update) {
+		userID := update.SentFrom().ID
+		mu.Lock()
+		if running[userID] {
+			t.Errorf("обновления пользователя %d обрабатываются параллельно", userID)
+		}
+		running[userID] = true
+		mu.Unlock()
+
+		time.Sleep(time.Millisecond)
+
+		mu.Lock()
+		running[userID] = false
+		handled[userID] = append(handled[userID], update.UpdateID)
+		mu.Unlock()
+	})
+
+	const users, perUser = 10, 20
+	for i := 0; i < perUser; i++ {
+		for userID := int64(1); userID <= users; userID++ {
+			pool.Submit(userUpdate(i, userID))
+		}
+	}
+	pool.Close()
+	if !pool.Wait(5 * time.Second) {
+		t.Fatal("обновления не обработаны")
+	}
+
+	for userID := int64(1); userID <= users; userID++ {
+		ids := handled[userID]
+		if len(ids) != perUser {
+			t.Fatalf("пользователь %d: обработано %d обновлений, ожидалось %d", userID, len(ids), perUser)
+		}
+		for i, id := range ids {
+			if id != i {
+				t.Fatalf("пользователь %d: порядок обработки %v", userID, ids)
+			}
+		}
+	}
+	if stats := pool.Stats(); stats.Processed != users*perUser || stats.Queued != 0 || stats.Busy != 0 {
+		t.Fatalf("статистика после обработки: %+v", stats)
+	}
+}
+
+func TestUpdatePoolProcessesUsersInParallel(t *testing.T) {
+	t.Parallel()
+	release := make(chan struct{})
+	done := make(chan int64, 1)
+	pool := NewUpdatePool(2, 1, func(update tgbotapi.Update) {
+		if update.SentFrom().ID == 1 {
+			<-release
+			return
+		}
+		done <- update.SentFrom().ID
+	})
+	defer func() {
+		close(release)
+		pool.Close()
+		pool.Wait(time.Second)
+	}()
+
+	pool.Submit(userUpdate(1, 1))
+	pool.Submit(userUpdate(2, 2)) // другой обработчик: 2 % 2 != 1 % 2
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("обновление второго пользователя ждет обработки первого")
+	}
+}
+
+func TestUpdatePoolBackpressure(t *testing.T) {
+	t.Parallel()
+	started := make(chan struct{}, 10)
+	release := make(chan struct{})
+	pool := NewUpdatePool(1, 2, func(update tgbotapi.Update) {
+		started <- struct{}{}
+		<-release
+	})
+
+	pool.Submit(userUpdate(1, 1))
+	<-started // обработчик занят первым обновлением
+	pool.Submit(userUpdate(2, 1))
+	pool.Submit(userUpdate(3, 1))
+
+	// Очередь заполнена: следующий Submit ждет места
+	submitted := make(chan struct{})
+	go func() {
+		pool.Submit(userUpdate(4, 1))
+		close(submitted)
+	}()
+	select {
+	case <-submitted:
+		t.Fatal("Submit не ждет при заполненной очереди")
+	case <-time.After(50 * time.Millisecond):
+	}
+	stats := pool.Stats()
+	if stats.Queued != 2 || stats.MaxQueueDepth != 2 || stats.Busy != 1 || stats.Throttled != 1 {
+		t.Fatalf("статистика при заполненной очереди: %+v", stats)
+	}
+
+	close(release)
+	select {
+	case <-submitted:
+	case <-time.After(time.Second):
+		t.Fatal("Submit не продолжился после освобождения очереди")
+	}
+	pool.Close()
+	if !pool.Wait(time.Second) || pool.Stats().Processed != 4 {
+		t.Fatalf("после Close обработано %d обновлений, ожидалось 4", pool.Stats().Processed)
+	}
+}
+
+func TestUpdatePoolWaitDeadline(t *testing.T) {
+	t.Parallel()
+	release := make(chan struct{})
+	pool := NewUpdatePool(2, 10, func(update tgbotapi.Update) {
+		<-release
+	})
+	for i := 0; i < 5; i++ {
+		pool.Submit(userUpdate(i, int64(i)))
+	}
+
+	pool.Close()
+	pool.Close() // повторный Close безопасен
+	start := time.Now()
+	if pool.Wait(50 * time.Millisecond) {
+		t.Fatal("Wait завершился до обработки обновлений")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("Wait не соблюдает тайм-аут: %v", elapsed)
+	}
+
+	// Принятые до Close обновления обрабатываются полностью
+	close(release)
+	if !pool.Wait(time.Second) {
+		t.Fatal("Wait не дождался обработки")
+	}
+	if processed := pool.Stats().Processed; processed != 5 {
+		t.Fatalf("обработано %d обновлений, ожидалось 5", processed)
+	}
+}
+
+func TestUpdatePoolShard(t *testing.T) {
+	t.Parallel()
+	pool := NewUpdatePool(4, 1, func(tgbotapi.Update) {})
+	defer pool.Close()
+
+	message := pool.shard(userUpdate(1, 7))
+	callback := pool.shard(tgbotapi.Update{CallbackQuery: telegramtest.CallbackQuery(7, "open_1")})
+	if message != callback {
+		t.Fatalf("сообщение и callback пользователя в разных обработчиках: %d и %d", message, callback)
+	}
+	// Обновления без отправителя распределяются по чату; отрицательные ID не дают отрицательный номер
+	channel := tgbotapi.Update{ChannelPost: &tgbotapi.Message{Chat: &tgbotapi.Chat{ID: -1001234567890}}}
+	if shard := pool.shard(channel); shard < 0 || shard >= 4 {
+		t.Fatalf("обработчик для канала: %d", shard)
+	}
+	if shard := pool.shard(tgbotapi.Update{}); shard != 0 {
+		t.Fatalf("обработчик для пустого обновления: %d", shard)
+	}
+}
@@ -0,0 +1,433 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"supportTicketBotGo/bot"
+	"supportTicketBotGo/config"
+	"supportTicketBotGo/database"
+	"supportTicketBotGo/logger"
+)
+
+const broadcastUsage = `Использование: supportbot [-config config.json] broadcast <команда>
+
+Команды:
+  create -text ТЕКСТ | -text-file ФАЙЛ [-parse-mode Markdown|MarkdownV2|HTML]
+         [-open-tickets] [-category КАТЕГОРИЯ] [-registered-after ГГГГ-ММ-ДД] [-start]
+                      создать рассылку (без -start она остается черновиком)
+  list                последние рассылки
+  show ID             статус и статистика доставки рассылки
+  start ID            запустить черновик
+  pause ID            приостановить отправку
+  resume ID           продолжить отправку
+  cancel ID           отменить рассылку
+
+Сообщения отправляет запущенный бот: он подхватывает рассылку в течение 10 секунд.`
+
+// broadcastActions - команды смены статуса рассылки и статусы, в которые они переводят
+var broadcastActions = map[string]string{
+	"start":  database.BroadcastRunning,
+	"pause":  database.BroadcastPaused,
+	"resume": database.BroadcastRunning,
+	"cancel": database.BroadcastCancelled,
+}
+
+// broadcastAudienceJSON - аудитория рассылки в запросах и ответах HTTP API
+type broadcastAudienceJSON struct {
+	OpenTickets     bool   `json:"open_tickets"`
+	Category        string `json:"category,omitempty"`
+	RegisteredAfter string `json:"registered_after,omitempty"` // ГГГГ-ММ-ДД или RFC 3339
+}
+
+// broadcastJSON - рассылка в ответах HTTP API
+type broadcastJSON struct {
+	ID         int64                 `json:"id"`
+	Text       string                `json:"text"`
+	ParseMode  string                `json:"parse_mode,omitempty"`
+	Audience   broadcastAudienceJSON `json:"audience"`
+	Status     string                `json:"status"`
+	CreatedBy  string                `json:"created_by,omitempty"`
+	CreatedAt  time.Time             `json:"created_at"`
+	StartedAt  *time.Time            `json:"started_at,omitempty"`
+	FinishedAt *time.Time            `json:"finished_at,omitempty"`
+	Recipients struct {
+		Total   int `json:"total"`
+		Pending int `json:"pending"`
+		Sent    int `json:"sent"`
+		Blocked int `json:"blocked"`
+		Failed  int `json:"failed"`
+	} `json:"recipients"`
+}
+
+// createBroadcastRequest - тело запроса POST /admin/broadcasts
+type createBroadcastRequest struct {
+	Text      string                `json:"text"`
+	ParseMode string                `json:"parse_mode"`
+	Audience  broadcastAudienceJSON `json:"audience"`
+	CreatedBy string                `json:"created_by"`
+	Start     bool                  `json:"start"`
+}
+
+func newBroadcastJSON(b *database.Broadcast) broadcastJSON {
+	result := broadcastJSON{
+		ID:        b.ID,
+		Text:      b.Text,
+		ParseMode: b.ParseMode,
+		Audience: broadcastAudienceJSON{
+			OpenTickets: b.Audience.OpenTickets,
+			Category:    b.Audience.Category,
+		},
+		Status:    b.Status,
+		CreatedBy: b.CreatedBy,
+		CreatedAt: b.CreatedAt,
+	}
+	if b.Audience.RegisteredAfter != nil {
+		result.Audience.RegisteredAfter = b.Audience.RegisteredAfter.Format(time.RFC3339)
+	}
+	if b.StartedAt.Valid {
+		result.StartedAt = &b.StartedAt.Time
+	}
+	if b.FinishedAt.Valid {
+		result.FinishedAt = &b.FinishedAt.Time
+	}
+	result.Recipients.Total = b.Stats.Total
+	result.Recipients.Pending = b.Stats.Pending
+	result.Recipients.Sent = b.Stats.Sent
+	result.Recipients.Blocked = b.Stats.Blocked
+	result.Recipients.Failed = b.Stats.Failed
+	return result
+}
+
+// parseAudience разбирает аудиторию рассылки
+func parseAudience(openTickets bool, category, registeredAfter string) (database.BroadcastAudience, error) {
+	audience := database.BroadcastAudience{OpenTickets: openTickets, Category: category}
+	if category != "" {
+		// Ошибку соединения вернет создание рассылки, здесь проверяем только код категории
+		if _, err := database.GetCategory(category); errors.Is(err, database.ErrCategoryNotFound) {
+			return audience, err
+		}
+	}
+	if registeredAfter == "" {
+		return audience, nil
+	}
+	after, err := time.ParseInLocation("2006-01-02", registeredAfter, time.Local)
+	if err != nil {
+		after, err = time.Parse(time.RFC3339, registeredAfter)
+	}
+	if err != nil {
+		return audience, fmt.Errorf("некорректная дата registered_after: %s", registeredAfter)
+	}
+	audience.RegisteredAfter = &after
+	return audience, nil
+}
+
+// registerAdminHandlers добавляет эндпоинты администрирования в mux
+func registerAdminHandlers(mux *http.ServeMux, broadcaster *bot.Broadcaster, updatePool *bot.UpdatePool) {
+	handler := adminAuth(broadcastsHandler(broadcaster))
+	mux.Handle("/admin/broadcasts", handler)
+	mux.Handle("/admin/broadcasts/", handler)
+	mux.Handle("/admin/updates", adminAuth(updatesStatsHandler(updatePool)))
+	mux.Handle("/admin/categories", adminAuth(categoriesHandler()))
+	mux.Handle("/admin/categories/", adminAuth(categoriesHandler()))
+}
+
+// updatesStatsHandler отдает состояние пула обработчиков обновлений:
+//
+//	GET /admin/updates - число обработчиков, глубина очередей, обработано обновлений
+func updatesStatsHandler(updatePool *bot.UpdatePool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		writeJSON(w, http.StatusOK, updatePool.Stats())
+	}
+}
+
+// adminAuth пропускает только запросы с заголовком "Authorization: Bearer <admin_token>".
+// Если admin_token не задан, эндпоинты администрирования отключены.
+func adminAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := config.Get().AdminToken
+		if token == "" {
+			http.NotFound(w, r)
+			return
+		}
+		provided := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+			logger.Warning.Printf("Попытка доступа к %s с неверным токеном", r.URL.Path)
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// broadcastsHandler обрабатывает запросы к рассылкам:
+//
+//	GET  /admin/broadcasts                 - последние рассылки
+//	POST /admin/broadcasts                 - создать рассылку
+//	GET  /admin/broadcasts/{id}            - рассылка со статистикой доставки
+//	POST /admin/broadcasts/{id}/{действие} - start, pause, resume или cancel
+func broadcastsHandler(broadcaster *bot.Broadcaster) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/admin/broadcasts"), "/"), "/")
+		if parts[0] == "" {
+			parts = nil
+		}
+
+		switch {
+		case len(parts) == 0 && r.Method == http.MethodGet:
+			broadcasts, err := database.ListBroadcasts(50)
+			if err != nil {
+				logger.Error.Printf("Ошибка при получении рассылок: %v", err)
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+			result := make([]broadcastJSON, 0, len(broadcasts))
+			for i := range broadcasts {
+				result = append(result, newBroadcastJSON(&broadcasts[i]))
+			}
+			writeJSON(w, http.StatusOK, result)
+
+		case len(parts) == 0 && r.Method == http.MethodPost:
+			var req createBroadcastRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, "Invalid JSON: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			audience, err := parseAudience(req.Audience.OpenTickets, req.Audience.Category, req.Audience.RegisteredAfter)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			createdBy := req.CreatedBy
+			if createdBy == "" {
+				createdBy = "api"
+			}
+			broadcast, err := createBroadcast(req.Text, req.ParseMode, audience, createdBy, req.Start)
+			if err != nil {
+				writeBroadcastError(w, err)
+				return
+			}
+			if req.Start {
+				broadcaster.Wake()
+			}
+			writeJSON(w, http.StatusCreated, newBroadcastJSON(broadcast))
+
+		case len(parts) == 1 && r.Method == http.MethodGet:
+			id, err := strconv.ParseInt(parts[0], 10, 64)
+			if err != nil {
+				http.Error(w, "Invalid broadcast id", http.StatusBadRequest)
+				return
+			}
+			broadcast, err := database.GetBroadcast(id)
+			if err != nil {
+				writeBroadcastError(w, err)
+				return
+			}
+			writeJSON(w, http.StatusOK, newBroadcastJSON(broadcast))
+
+		case len(parts) == 2 && r.Method == http.MethodPost:
+			id, err := strconv.ParseInt(parts[0], 10, 64)
+			if err != nil {
+				http.Error(w, "Invalid broadcast id", http.StatusBadRequest)
+				return
+			}
+			status, ok := broadcastActions[parts[1]]
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			if err := database.SetBroadcastStatus(id, status); err != nil {
+				writeBroadcastError(w, err)
+				return
+			}
+			logger.Info.Printf("Рассылка %d: %s через HTTP API", id, parts[1])
+			if status == database.BroadcastRunning {
+				broadcaster.Wake()
+			}
+			broadcast, err := database.GetBroadcast(id)
+			if err != nil {
+				writeBroadcastError(w, err)
+				return
+			}
+			writeJSON(w, http.StatusOK, newBroadcastJSON(broadcast))
+
+		default:
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// createBroadcast создает рассылку и при необходимости сразу запускает ее
+func createBroadcast(text, parseMode string, audience database.BroadcastAudience, createdBy string, start bool) (*database.Broadcast, error) {
+	broadcast, err := database.CreateBroadcast(text, parseMode, audience, createdBy)
+	if err != nil {
+		return nil, err
+	}
+	logger.Info.Printf("Создана рассылка %d (%s), получателей: %d", broadcast.ID, createdBy, broadcast.Stats.Total)
+	if !start {
+		return broadcast, nil
+	}
+	if err := database.SetBroadcastStatus(broadcast.ID, database.BroadcastRunning); err != nil {
+		return nil, err
+	}
+	return database.GetBroadcast(broadcast.ID)
+}
+
+// writeBroadcastError отвечает кодом HTTP, соответствующим ошибке рассылки
+func writeBroadcastError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, database.ErrBroadcastNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, database.ErrBroadcastTransition):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, database.ErrInvalidBroadcast):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		logger.Error.Printf("Ошибка при работе с рассылкой: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logger.Error.Printf("Ошибка при записи ответа: %v", err)
+	}
+}
+
+// runBroadcastCommand выполняет подкоманду broadcast и возвращает код завершения процесса
+func runBroadcastCommand(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, broadcastUsage)
+		return 2
+	}
+
+	if err := database.OpenDB(); err != nil {
+		fmt.Fprintf(os.Stderr, "Ошибка подключения к базе данных: %v\n", err)
+		return 1
+	}
+	defer database.DB.Close()
+
+	switch command := args[0]; command {
+	case "create":
+		return runBroadcastCreate(args[1:])
+
+	case "list":
+		broadcasts, err := database.ListBroadcasts(50)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Ошибка получения рассылок: %v\n", err)
+			return 1
+		}
+		for i := range broadcasts {
+			printBroadcastSummary(&broadcasts[i])
+		}
+		return 0
+
+	case "show", "start", "pause", "resume", "cancel":
+		if len(args) != 2 {
+			fmt.Fprintln(os.Stderr, broadcastUsage)
+			return 2
+		}
+		id, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Некорректный ID рассылки: %s\n", args[1])
+			return 2
+		}
+		if status, ok := broadcastActions[command]; ok {
+			if err := database.SetBroadcastStatus(id, status); err != nil {
+				fmt.Fprintf(os.Stderr, "Ошибка: %v\n", err)
+				return 1
+			}
+		}
+		broadcast, err := database.GetBroadcast(id)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Ошибка: %v\n", err)
+			return 1
+		}
+		printBroadcast(broadcast)
+		return 0
+
+	default:
+		fmt.Fprintln(os.Stderr, broadcastUsage)
+		return 2
+	}
+}
+
+// runBroadcastCreate создает рассылку по флагам командной строки
+func runBroadcastCreate(args []string) int {
+	flags := flag.NewFlagSet("broadcast create", flag.ContinueOnError)
+	flags.Usage = func() { fmt.Fprintln(os.Stderr, broadcastUsage) }
+	text := flags.String("text", "", "текст сообщения")
+	textFile := flags.String("text-file", "", "файл с текстом сообщения")
+	parseMode := flags.String("parse-mode", "", "режим разметки: Markdown, MarkdownV2 или HTML")
+	openTickets := flags.Bool("open-tickets", false, "только пользователям с незакрытыми тикетами")
+	category := flags.String("category", "", "только пользователям с тикетами этой категории")
+	registeredAfter := flags.String("registered-after", "", "только зарегистрированным после даты (ГГГГ-ММ-ДД)")
+	start := flags.Bool("start", false, "сразу запустить рассылку")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if *textFile != "" {
+		data, err := os.ReadFile(*textFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Ошибка чтения файла с текстом: %v\n", err)
+			return 1
+		}
+		*text = strings.TrimSpace(string(data))
+	}
+
+	audience, err := parseAudience(*openTickets, *category, *registeredAfter)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	createdBy := "cli"
+	if user := os.Getenv("USER"); user != "" {
+		createdBy += ":" + user
+	}
+	broadcast, err := createBroadcast(*text, *parseMode, audience, createdBy, *start)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Ошибка создания рассылки: %v\n", err)
+		return 1
+	}
+	printBroadcast(broadcast)
+	return 0
+}
+
+func printBroadcastSummary(b *database.Broadcast) {
+	fmt.Printf("#%d  %-9s  %s  получателей: %d, отправлено: %d  %s\n",
+		b.ID, b.Status, b.CreatedAt.Format("02.01.2006 15:04"), b.Stats.Total, b.Stats.Sent, truncateText(b.Text, 40))
+}
+
+func printBroadcast(b *database.Broadcast) {
+	fmt.Printf("Рассылка #%d: %s\n", b.ID, b.Status)
+	fmt.Printf("Создана: %s (%s)\n", b.CreatedAt.Format("02.01.2006 15:04"), b.CreatedBy)
+	fmt.Printf("Получателей: %d, ожидают: %d, отправлено: %d, заблокировали бота: %d, ошибок: %d\n",
+		b.Stats.Total, b.Stats.Pending, b.Stats.Sent, b.Stats.Blocked, b.Stats.Failed)
+	fmt.Printf("Текст:\n%s\n", b.Text)
+}
+
+// truncateText сокращает текст до limit символов для вывода в одну строку
+func truncateText(text string, limit int) string {
+	text = strings.ReplaceAll(text, "\n", " ")
+	runes := []rune(text)
+	if len(runes) <= limit {
+		return text
+	}
+	return string(runes[:limit]) + "…"
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"supportTicketBotGo/database"
+	"supportTicketBotGo/logger"
+)
+
+const categoriesUsage = `Использование: supportbot [-config config.json] categories <команда>
+
+Команды:
+  list                все категории тикетов, включая неактивные
+  set КОД [-name НАЗВАНИЕ] [-emoji ЭМОДЗИ] [-prefix ПРЕФИКС] [-priority low|normal|high|urgent]
+          [-group ГРУППА] [-order N] [-active=true|false]
+                      создать категорию или изменить указанные поля существующей
+  enable КОД          показывать категорию при создании тикета
+  disable КОД         скрыть категорию; ее тикеты сохраняются
+
+Запущенный бот видит изменения сразу: категории читаются из базы при каждом показе.`
+
+// categoryJSON - категория тикета в запросах и ответах HTTP API
+type categoryJSON struct {
+	Code            string `json:"code"`
+	Name            string `json:"name"`
+	Emoji           string `json:"emoji"`
+	TitlePrefix     string `json:"title_prefix"`
+	DefaultPriority string `json:"default_priority"`
+	RoutingGroup    string `json:"routing_group"`
+	Active          bool   `json:"active"`
+	SortOrder       int    `json:"sort_order"`
+}
+
+func newCategoryJSON(c *database.Category) categoryJSON {
+	return categoryJSON{
+		Code:            c.Code,
+		Name:            c.Name,
+		Emoji:           c.Emoji,
+		TitlePrefix:     c.TitlePrefix,
+		DefaultPriority: string(c.DefaultPriority),
+		RoutingGroup:    c.RoutingGroup,
+		Active:          c.Active,
+		SortOrder:       c.SortOrder,
+	}
+}
+
+func (c categoryJSON) category() database.Category {
+	return database.Category{
+		Code:            c.Code,
+		Name:            c.Name,
+		Emoji:           c.Emoji,
+		TitlePrefix:     c.TitlePrefix,
+		DefaultPriority: database.Priority(c.DefaultPriority),
+		RoutingGroup:    c.RoutingGroup,
+		Active:          c.Active,
+		SortOrder:       c.SortOrder,
+	}
+}
+
+// categoryOrNew возвращает категорию для изменения: существующую или новую активную с этим кодом
+func categoryOrNew(code string) (*database.Category, error) {
+	// Коды хранятся в нижнем регистре (см. Category.Validate)
+	code = strings.ToLower(strings.TrimSpace(code))
+	category, err := database.GetCategory(code)
+	if errors.Is(err, database.ErrCategoryNotFound) {
+		return &database.Category{Code: code, DefaultPriority: database.PriorityNormal, Active: true}, nil
+	}
+	return category, err
+}
+
+// categoriesHandler обрабатывает запросы к справочнику категорий:
+//
+//	GET /admin/categories        - все категории, включая неактивные
+//	PUT /admin/categories/{код}  - создать категорию или изменить поля, указанные в теле запроса
+func categoriesHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		code := strings.Trim(strings.TrimPrefix(r.URL.Path, "/admin/categories"), "/")
+
+		switch {
+		case code == "" && r.Method == http.MethodGet:
+			categories, err := database.ListCategories(false)
+			if err != nil {
+				writeCategoryError(w, err)
+				return
+			}
+			result := make([]categoryJSON, 0, len(categories))
+			for i := range categories {
+				result = append(result, newCategoryJSON(&categories[i]))
+			}
+			writeJSON(w, http.StatusOK, result)
+
+		case code != "" && r.Method == http.MethodPut:
+			category, err := categoryOrNew(code)
+			if err != nil {
+				writeCategoryError(w, err)
+				return
+			}
+			// Поля, которых нет в теле запроса, сохраняют прежние значения
+			req := newCategoryJSON(category)
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, "Invalid JSON: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			updated := req.category()
+			updated.Code = category.Code
+			if err := database.SaveCategory(&updated); err != nil {
+				writeCategoryError(w, err)
+				return
+			}
+			logger.Info.Printf("Категория %q сохранена через HTTP API", updated.Code)
+			writeJSON(w, http.StatusOK, newCategoryJSON(&updated))
+
+		default:
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// writeCategoryError отвечает кодом HTTP, соответствующим ошибке справочника категорий
+func writeCategoryError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, database.ErrCategoryNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, database.ErrInvalidCategory):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		logger.Error.Printf("Ошибка при работе с категориями: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
+
+// runCategoriesCommand выполняет подкоманду categories и возвращает код завершения процесса
+func runCategoriesCommand(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, categoriesUsage)
+		return 2
+	}
+
+	if err := database.OpenDB(); err != nil {
+		fmt.Fprintf(os.Stderr, "Ошибка подключения к базе данных: %v\n", err)
+		return 1
+	}
+	defer database.DB.Close()
+
+	switch args[0] {
+	case "list":
+		return runCategoriesList()
+	case "set":
+		return runCategoriesSet(args[1:])
+	case "enable", "disable":
+		if len(args) != 2 {
+			fmt.Fprintln(os.Stderr, categoriesUsage)
+			return 2
+		}
+		return saveCategoryFromCLI(args[1], func(c *database.Category) { c.Active = args[0] == "enable" })
+	default:
+		fmt.Fprintln(os.Stderr, categoriesUsage)
+		return 2
+	}
+}
+
+func runCategoriesList() int {
+	categories, err := database.ListCategories(false)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Ошибка получения категорий: %v\n", err)
+		return 1
+	}
+	for _, c := range categories {
+		state := "активна"
+		if !c.Active {
+			state = "скрыта"
+		}
+		fmt.Printf("%-16s %-24s приоритет: %-7s порядок: %-4d %s", c.Code, c.Label(), c.DefaultPriority, c.SortOrder, state)
+		if c.RoutingGroup != "" {
+			fmt.Printf("  группа: %s", c.RoutingGroup)
+		}
+		fmt.Printf("\n    заголовок: «%s: ...»\n", c.Prefix())
+	}
+	return 0
+}
+
+func runCategoriesSet(args []string) int {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		fmt.Fprintln(os.Stderr, categoriesUsage)
+		return 2
+	}
+	code := args[0]
+
+	flags := flag.NewFlagSet("categories set", flag.ContinueOnError)
+	flags.Usage = func() { fmt.Fprintln(os.Stderr, categoriesUsage) }
+	name := flags.String("name", "", "название на кнопке")
+	emoji := flags.String("emoji", "", "эмодзи перед названием")
+	prefix := flags.String("prefix", "", "начало заголовка тикета")
+	priority := flags.String("priority", "", "приоритет тикетов: low, normal, high, urgent")
+	group := flags.String("group", "", "группа поддержки для интеграций")
+	order := flags.Int("order", 0, "порядок кнопки на клавиатуре")
+	active := flags.Bool("active", true, "показывать категорию при создании тикета")
+	if err := flags.Parse(args[1:]); err != nil {
+		return 2
+	}
+
+	// Меняем только поля, указанные во флагах
+	return saveCategoryFromCLI(code, func(c *database.Category) {
+		flags.Visit(func(f *flag.Flag) {
+			switch f.Name {
+			case "name":
+				c.Name = *name
+			case "emoji":
+				c.Emoji = *emoji
+			case "prefix":
+				c.TitlePrefix = *prefix
+			case "priority":
+				c.DefaultPriority = database.Priority(*priority)
+			case "group":
+				c.RoutingGroup = *group
+			case "order":
+				c.SortOrder = *order
+			case "active":
+				c.Active = *active
+			}
+		})
+	})
+}
+
+// saveCategoryFromCLI изменяет категорию (или создает новую) функцией change и сохраняет ее
+func saveCategoryFromCLI(code string, change func(c *database.Category)) int {
+	category, err := categoryOrNew(code)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Ошибка: %v\n", err)
+		return 1
+	}
+	change(category)
+	if err := database.SaveCategory(category); err != nil {
+		fmt.Fprintf(os.Stderr, "Ошибка: %v\n", err)
+		if errors.Is(err, database.ErrInvalidCategory) {
+			return 2
+		}
+		return 1
+	}
+	fmt.Printf("Категория %s сохранена: %s\n", category.Code, category.Label())
+	return 0
+}
@@ -1,42 +1,100 @@
 package config
 
-import (
-	"encoding/json"
-	"os"
-)
-
-// Config содержит все настройки приложения
+// Config содержит все настройки приложения.
+// Поля с тегом reload:"live" можно менять без перезапуска (см. Reload), секреты помечены тегом secret:"true".
 type Config struct {
-	TelegramToken string `json:"telegram_token"`
+	TelegramToken string `json:"telegram_token" secret:"true"`
 	Database      struct {
 		Host     string `json:"host"`
 		Port     int    `json:"port"`
 		User     string `json:"user"`
-		Password string `json:"password"`
+		Password string `json:"password" secret:"true"`
 		DBName   string `json:"dbname"`
 		SSLMode  string `json:"sslmode"`
+		// AutoMigrate применяет недостающие миграции схемы при запуске бота
+		AutoMigrate bool `json:"auto_migrate"`
 	} `json:"database"`
-	LogFile            string `json:"log_file"`
-	SecureWebhookToken string `json:"secure_webhook_token"`
-    SuperConnectToken string `json:"super_connect_token"`
+	LogFile string `json:"log_file"`
+	// Log задает уровень, формат и ротацию журнала, 0 и пустые строки - значения по умолчанию
+	Log struct {
+		Level            string `json:"level" reload:"live"`            // debug, info (по умолчанию), warn или error
+		Format           string `json:"format"`                         // text (по умолчанию) или json
+		MaxSizeMB        int    `json:"max_size_mb"`                    // размер файла для ротации (100)
+		RotateEveryHours int    `json:"rotate_every_hours"`             // ротация по времени (24)
+		MaxBackups       int    `json:"max_backups"`                    // сколько старых файлов хранить (7)
+		MaxAgeDays       int    `json:"max_age_days"`                   // сколько дней хранить старые файлы (30)
+		LogMessageText   bool   `json:"log_message_text" reload:"live"` // писать тексты сообщений пользователей (false)
+	} `json:"log"`
+	SecureWebhookToken string `json:"secure_webhook_token" secret:"true"`
+	SuperConnectToken  string `json:"super_connect_token" secret:"true"`
+	// AdminToken открывает доступ к эндпоинтам /admin/ (заголовок "Authorization: Bearer <токен>");
+	// пустое значение отключает их
+	AdminToken string `json:"admin_token" secret:"true"`
+	// APIToken открывает доступ к REST API /api/v1/ (заголовок "Authorization: Bearer <токен>");
+	// пустое значение отключает его
+	APIToken string `json:"api_token" secret:"true"`
+	// StateStore задает хранилище состояний диалогов пользователей
+	StateStore struct {
+		Backend    string `json:"backend"`     // "memory" (по умолчанию) или "postgres"
+		TTLMinutes int    `json:"ttl_minutes"` // время жизни незавершенного диалога, 0 - значение по умолчанию
+	} `json:"state_store"`
+	// RateLimit задает ограничения скорости отправки сообщений, 0 - значение по умолчанию
+	RateLimit struct {
+		GlobalPerSecond float64 `json:"global_per_second" reload:"live"` // всего сообщений в секунду (30)
+		ChatPerSecond   float64 `json:"chat_per_second" reload:"live"`   // сообщений в секунду в личный чат (1)
+		ChatBurst       int     `json:"chat_burst" reload:"live"`        // сообщений в чат подряд без ожидания (20)
+		GroupPerMinute  float64 `json:"group_per_minute" reload:"live"`  // сообщений в минуту в группу (20)
+		MaxAttempts     int     `json:"max_attempts" reload:"live"`      // попыток при сетевых ошибках и ошибках 5xx (5)
+	} `json:"rate_limit"`
+	// Webhooks задает подписчиков исходящих вебхуков о событиях тикетов и пользователей
+	Webhooks struct {
+		Subscribers []struct {
+			URL    string   `json:"url"`
+			Secret string   `json:"secret" secret:"true"` // ключ подписи HMAC-SHA256
+			Events []string `json:"events"`               // пустой список - все события
+		} `json:"subscribers"`
+		MaxAttempts    int `json:"max_attempts"`    // попыток доставки до перевода в dead (10)
+		TimeoutSeconds int `json:"timeout_seconds"` // время ожидания ответа подписчика (10)
+	} `json:"webhooks"`
+	// Broadcast задает параметры рассылок
+	Broadcast struct {
+		RatePerSecond float64 `json:"rate_per_second" reload:"live"` // сообщений рассылки в секунду (20)
+	} `json:"broadcast"`
+	// Updates задает обработку входящих обновлений, 0 - значение по умолчанию
+	Updates struct {
+		Workers   int `json:"workers"`    // число обработчиков (16)
+		QueueSize int `json:"queue_size"` // обновлений в очереди одного обработчика (100)
+	} `json:"updates"`
+	// Storage задает хранилище вложений тикетов и аватаров
+	Storage struct {
+		Backend string `json:"backend"` // "local" (по умолчанию), "s3" или "database"
+		Local   struct {
+			Dir     string `json:"dir"`      // каталог с файлами, по умолчанию "uploads"
+			BaseURL string `json:"base_url"` // публичный адрес каталога, если его раздает веб-сервер
+		} `json:"local"`
+		S3 struct {
+			Endpoint         string `json:"endpoint"`
+			Region           string `json:"region"`
+			Bucket           string `json:"bucket"`
+			AccessKey        string `json:"access_key" secret:"true"`
+			SecretKey        string `json:"secret_key" secret:"true"`
+			PathStyle        bool   `json:"path_style"`         // адресация endpoint/bucket/key (MinIO)
+			URLExpiryMinutes int    `json:"url_expiry_minutes"` // время жизни ссылок на объекты
+		} `json:"s3"`
+	} `json:"storage"`
 }
 
-// Глобальная переменная конфигурации
-var AppConfig Config
-
-// LoadConfig загружает конфигурацию из файла
-func LoadConfig(filePath string) error {
-	file, err := os.Open(filePath)
-	if err != nil {
-		return err
-	}
-	defer file.Close()
-
-	decoder := json.NewDecoder(file)
-	err = decoder.Decode(&AppConfig)
-	if err != nil {
-		return err
-	}
-
-	return nil
+// Defaults возвращает конфигурацию по умолчанию - первый слой перед файлом,
+// переменными окружения и флагами (см. Load)
+func Defaults() Config {
+	var c Config
+	c.Database.Host = "localhost"
+	c.Database.Port = 5432
+	c.Database.SSLMode = "disable"
+	c.Log.Level = "info"
+	c.Log.Format = "text"
+	c.StateStore.Backend = "memory"
+	c.Storage.Backend = "local"
+	c.Storage.Local.Dir = "uploads"
+	return c
 }
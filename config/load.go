@@ -0,0 +1,349 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"gopkg.in/yaml.v3"
+)
+
+// EnvPrefix - префикс переменных окружения с настройками: SUPPORTBOT_DATABASE_PASSWORD задает database.password.
+// Переменная с суффиксом _FILE (SUPPORTBOT_DATABASE_PASSWORD_FILE) указывает файл со значением -
+// так передаются секреты Docker и Kubernetes.
+const EnvPrefix = "SUPPORTBOT_"
+
+// Overrides - значения из флагов командной строки вида путь=значение (database.host=db).
+// Реализует flag.Value, флаг можно указывать несколько раз.
+type Overrides []string
+
+func (o *Overrides) String() string {
+	return strings.Join(*o, ",")
+}
+
+func (o *Overrides) Set(value string) error {
+	if !strings.Contains(value, "=") {
+		return fmt.Errorf("ожидается путь=значение, например database.host=localhost")
+	}
+	*o = append(*o, value)
+	return nil
+}
+
+// Load собирает конфигурацию по слоям: значения по умолчанию, файл (JSON или YAML по расширению
+// .yaml/.yml), переменные окружения и флаги overrides. Пустой path - без файла.
+func Load(path string, overrides []string) (*Config, error) {
+	return load(path, overrides, os.LookupEnv)
+}
+
+// load - Load с переменными окружения из lookup
+func load(path string, overrides []string, lookup func(string) (string, bool)) (*Config, error) {
+	c := Defaults()
+	if path != "" {
+		if err := c.loadFile(path); err != nil {
+			return nil, err
+		}
+	}
+	if err := c.applyEnv(lookup); err != nil {
+		return nil, err
+	}
+	for _, o := range overrides {
+		key, value, _ := strings.Cut(o, "=")
+		if err := c.Set(key, value); err != nil {
+			return nil, fmt.Errorf("флаг -set %s: %w", key, err)
+		}
+	}
+	return &c, nil
+}
+
+// current - действующий снимок конфигурации; подменяется целиком при перезагрузке
+var current atomic.Pointer[Config]
+
+// Get возвращает действующий снимок конфигурации. Снимок не изменяется:
+// значения, которые нужны согласованными между собой, нужно брать из одного снимка.
+func Get() *Config {
+	if c := current.Load(); c != nil {
+		return c
+	}
+	c := Defaults()
+	return &c
+}
+
+// LoadConfig загружает конфигурацию из файла, переменных окружения и флагов и делает ее действующей
+func LoadConfig(path string, overrides []string) error {
+	c, err := Load(path, overrides)
+	if err != nil {
+		return err
+	}
+	current.Store(c)
+	return nil
+}
+
+// Change - изменение настройки при перезагрузке; значения секретов скрыты
+type Change struct {
+	Path string
+	Old  string
+	New  string
+}
+
+// reloadMu не дает двум перезагрузкам сравнивать изменения с одним и тем же снимком
+var reloadMu sync.Mutex
+
+// Reload заново собирает конфигурацию теми же слоями, что и LoadConfig, и проверяет ее.
+// Если изменились только настройки с тегом reload:"live", новый снимок становится действующим
+// и возвращается список изменений. Иначе действующая конфигурация не меняется.
+func Reload(path string, overrides []string, webhookMode bool) ([]Change, error) {
+	return reload(path, overrides, webhookMode, os.LookupEnv)
+}
+
+// reload - Reload с переменными окружения из lookup
+func reload(path string, overrides []string, webhookMode bool, lookup func(string) (string, bool)) ([]Change, error) {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	next, err := load(path, overrides, lookup)
+	if err != nil {
+		return nil, err
+	}
+	if err := next.Validate(webhookMode); err != nil {
+		return nil, err
+	}
+
+	changes, restartOnly := diff(Get(), next)
+	if len(restartOnly) > 0 {
+		return nil, fmt.Errorf("эти настройки меняются только перезапуском: %s", strings.Join(restartOnly, ", "))
+	}
+	if len(changes) > 0 {
+		current.Store(next)
+	}
+	return changes, nil
+}
+
+// diff сравнивает снимки и возвращает изменения, а также пути измененных настроек без тега reload:"live"
+func diff(old, next *Config) (changes []Change, restartOnly []string) {
+	oldFields := make(map[string]field)
+	for _, f := range old.fields() {
+		oldFields[f.path] = f
+	}
+	seen := make(map[string]bool)
+	compare := func(path string, before, after *field) {
+		var oldValue, newValue string
+		if before != nil {
+			oldValue = before.display()
+		}
+		if after != nil {
+			newValue = after.display()
+		}
+		if before != nil && after != nil && reflect.DeepEqual(before.value.Interface(), after.value.Interface()) {
+			return
+		}
+		changes = append(changes, Change{Path: path, Old: oldValue, New: newValue})
+		if before == nil || after == nil || !after.live {
+			restartOnly = append(restartOnly, path)
+		}
+	}
+
+	for _, f := range next.fields() {
+		f := f
+		seen[f.path] = true
+		if before, ok := oldFields[f.path]; ok {
+			compare(f.path, &before, &f)
+		} else {
+			compare(f.path, nil, &f)
+		}
+	}
+	for path, f := range oldFields {
+		if !seen[path] {
+			f := f
+			compare(path, &f, nil)
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	sort.Strings(restartOnly)
+	return changes, restartOnly
+}
+
+// loadFile накладывает на конфигурацию значения из файла
+func (c *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		// YAML приводится к JSON, чтобы имена полей задавались одними тегами json
+		var doc interface{}
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		if doc == nil {
+			return nil
+		}
+		if data, err = json.Marshal(doc); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	}
+
+	if err := json.NewDecoder(bytes.NewReader(data)).Decode(c); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+// applyEnv накладывает на конфигурацию значения переменных окружения
+func (c *Config) applyEnv(lookup func(string) (string, bool)) error {
+	var errs []string
+	for _, f := range c.fields() {
+		if f.inList {
+			continue
+		}
+		name := EnvName(f.path)
+		value, ok := lookup(name)
+		file, fromFile := lookup(name + "_FILE")
+		if ok && fromFile {
+			errs = append(errs, fmt.Sprintf("заданы и %s, и %s_FILE", name, name))
+			continue
+		}
+		if fromFile {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("%s_FILE: %v", name, err))
+				continue
+			}
+			value, ok = strings.TrimRight(string(data), "\r\n"), true
+		}
+		if !ok {
+			continue
+		}
+		if err := setValue(f.value, value); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", name, err))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("ошибки в переменных окружения: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// Set задает значение поля по пути из тегов json через точку, например "storage.s3.bucket"
+func (c *Config) Set(path, value string) error {
+	for _, f := range c.fields() {
+		if f.path == path && !f.inList {
+			return setValue(f.value, value)
+		}
+	}
+	return fmt.Errorf("неизвестная настройка %q", path)
+}
+
+// Redacted возвращает копию конфигурации, в которой заданные секреты заменены на "***"
+func (c Config) Redacted() Config {
+	// Списки копируются, чтобы не изменить исходную конфигурацию
+	subscribers := c.Webhooks.Subscribers
+	c.Webhooks.Subscribers = append(subscribers[:0:0], subscribers...)
+	for _, f := range c.fields() {
+		if f.secret && f.value.String() != "" {
+			f.value.SetString("***")
+		}
+	}
+	return c
+}
+
+// EnvName возвращает имя переменной окружения для пути настройки
+func EnvName(path string) string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(path, ".", "_"))
+}
+
+// field - поле конфигурации со значением простого типа
+type field struct {
+	path   string // теги json через точку; элементы списков - с номером: webhooks.subscribers.0.url
+	value  reflect.Value
+	secret bool // тег secret:"true"
+	live   bool // тег reload:"live"
+	inList bool // поле элемента списка: не задается через окружение и флаги
+}
+
+// fields возвращает все поля конфигурации простых типов
+func (c *Config) fields() []field {
+	var result []field
+	collectFields(reflect.ValueOf(c).Elem(), "", false, &result)
+	return result
+}
+
+func collectFields(v reflect.Value, prefix string, inList bool, result *[]field) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		name, _, _ := strings.Cut(sf.Tag.Get("json"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		path := prefix + name
+		fv := v.Field(i)
+
+		switch fv.Kind() {
+		case reflect.Struct:
+			collectFields(fv, path+".", inList, result)
+		case reflect.Slice:
+			if fv.Type().Elem().Kind() == reflect.Struct {
+				for j := 0; j < fv.Len(); j++ {
+					collectFields(fv.Index(j), path+"."+strconv.Itoa(j)+".", true, result)
+				}
+				continue
+			}
+			fallthrough
+		default:
+			*result = append(*result, field{
+				path:   path,
+				value:  fv,
+				secret: sf.Tag.Get("secret") == "true",
+				live:   sf.Tag.Get("reload") == "live",
+				inList: inList,
+			})
+		}
+	}
+}
+
+// display возвращает значение поля для журнала; секреты скрываются
+func (f field) display() string {
+	if f.secret {
+		return "***"
+	}
+	return fmt.Sprint(f.value.Interface())
+}
+
+// setValue разбирает строку в значение поля
+func setValue(v reflect.Value, raw string) error {
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(raw)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("ожидается true или false, получено %q", raw)
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return fmt.Errorf("ожидается целое число, получено %q", raw)
+		}
+		v.SetInt(n)
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return fmt.Errorf("ожидается число, получено %q", raw)
+		}
+		v.SetFloat(f)
+	default:
+		return fmt.Errorf("тип %s не поддерживается", v.Type())
+	}
+	return nil
+}
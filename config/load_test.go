@@ -0,0 +1,250 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// envMap - переменные окружения для load без изменения окружения процесса
+type envMap map[string]string
+
+func (e envMap) lookup(name string) (string, bool) {
+	value, ok := e[name]
+	return value, ok
+}
+
+// writeFile создает во временном каталоге теста файл с содержимым data
+func writeFile(t *testing.T, name, data string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	return path
+}
+
+func TestLoadLayers(t *testing.T) {
+	path := writeFile(t, "config.json", `{
+		"database": {"host": "file-host", "port": 6000, "user": "file-user", "dbname": "file-db"},
+		"log": {"level": "debug"}
+	}`)
+	env := envMap{
+		"SUPPORTBOT_DATABASE_HOST": "env-host",
+		"SUPPORTBOT_DATABASE_USER": "env-user",
+		"SUPPORTBOT_LOG_FORMAT":    "json",
+	}
+
+	c, err := load(path, []string{"database.host=flag-host", "log.level=warn"}, env.lookup)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	tests := []struct {
+		name      string
+		got, want interface{}
+	}{
+		{"database.host (флаг поверх окружения)", c.Database.Host, "flag-host"},
+		{"database.user (окружение поверх файла)", c.Database.User, "env-user"},
+		{"database.port (файл поверх умолчаний)", c.Database.Port, 6000},
+		{"database.dbname (файл)", c.Database.DBName, "file-db"},
+		{"database.sslmode (умолчание)", c.Database.SSLMode, "disable"},
+		{"log.level (флаг поверх файла)", c.Log.Level, "warn"},
+		{"log.format (окружение поверх умолчаний)", c.Log.Format, "json"},
+		{"storage.local.dir (умолчание)", c.Storage.Local.Dir, "uploads"},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s = %v, ожидалось %v", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+func TestLoadWithoutFile(t *testing.T) {
+	c, err := load("", nil, envMap{}.lookup)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if want := Defaults(); !reflect.DeepEqual(*c, want) {
+		t.Fatalf("load без слоев = %+v, ожидалось %+v", *c, want)
+	}
+}
+
+func TestLoadEnvFile(t *testing.T) {
+	secret := writeFile(t, "db_password", "s3cr3t\r\n")
+	c, err := load("", nil, envMap{"SUPPORTBOT_DATABASE_PASSWORD_FILE": secret}.lookup)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if c.Database.Password != "s3cr3t" {
+		t.Fatalf("database.password = %q, ожидалось значение из файла без перевода строки", c.Database.Password)
+	}
+}
+
+func TestLoadEnvErrors(t *testing.T) {
+	secret := writeFile(t, "token", "123:abc")
+	tests := []struct {
+		name string
+		env  envMap
+		want string
+	}{
+		{
+			"заданы оба способа",
+			envMap{"SUPPORTBOT_TELEGRAM_TOKEN": "123:abc", "SUPPORTBOT_TELEGRAM_TOKEN_FILE": secret},
+			"заданы и SUPPORTBOT_TELEGRAM_TOKEN, и SUPPORTBOT_TELEGRAM_TOKEN_FILE",
+		},
+		{
+			"нет файла",
+			envMap{"SUPPORTBOT_TELEGRAM_TOKEN_FILE": filepath.Join(t.TempDir(), "missing")},
+			"SUPPORTBOT_TELEGRAM_TOKEN_FILE:",
+		},
+		{
+			"не число",
+			envMap{"SUPPORTBOT_DATABASE_PORT": "db"},
+			`SUPPORTBOT_DATABASE_PORT: ожидается целое число, получено "db"`,
+		},
+	}
+	for _, tt := range tests {
+		_, err := load("", nil, tt.env.lookup)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: ошибка %v, ожидалась с %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestLoadOverrideErrors(t *testing.T) {
+	if _, err := load("", []string{"database.hots=db"}, envMap{}.lookup); err == nil || !strings.Contains(err.Error(), "неизвестная настройка") {
+		t.Fatalf("неизвестная настройка: %v", err)
+	}
+	// Элементы списков задаются только в файле
+	if _, err := load("", []string{"webhooks.subscribers.0.url=https://example.com"}, envMap{}.lookup); err == nil {
+		t.Fatal("элемент списка задан флагом")
+	}
+}
+
+func TestLoadYAML(t *testing.T) {
+	yamlPath := writeFile(t, "config.yaml", `
+telegram_token: "123:abc"
+database:
+  host: db
+  port: 6432
+  auto_migrate: true
+rate_limit:
+  chat_per_second: 0.5
+webhooks:
+  subscribers:
+    - url: https://example.com/hook
+      secret: s3cr3t
+      events: [ticket.created]
+`)
+	jsonPath := writeFile(t, "config.json", `{
+		"telegram_token": "123:abc",
+		"database": {"host": "db", "port": 6432, "auto_migrate": true},
+		"rate_limit": {"chat_per_second": 0.5},
+		"webhooks": {"subscribers": [{"url": "https://example.com/hook", "secret": "s3cr3t", "events": ["ticket.created"]}]}
+	}`)
+
+	fromYAML, err := load(yamlPath, nil, envMap{}.lookup)
+	if err != nil {
+		t.Fatalf("load yaml: %v", err)
+	}
+	fromJSON, err := load(jsonPath, nil, envMap{}.lookup)
+	if err != nil {
+		t.Fatalf("load json: %v", err)
+	}
+	if !reflect.DeepEqual(fromYAML, fromJSON) {
+		t.Fatalf("YAML и JSON дали разные конфигурации:\n%+v\n%+v", *fromYAML, *fromJSON)
+	}
+
+	// Пустой YAML-файл оставляет значения по умолчанию
+	empty, err := load(writeFile(t, "empty.yml", "# пусто\n"), nil, envMap{}.lookup)
+	if err != nil || empty.Database.Host != "localhost" {
+		t.Fatalf("пустой YAML: %+v, %v", empty, err)
+	}
+
+	if _, err := load(writeFile(t, "broken.yaml", "database: [\n"), nil, envMap{}.lookup); err == nil {
+		t.Fatal("некорректный YAML загружен без ошибки")
+	}
+}
+
+func TestRedacted(t *testing.T) {
+	c := Defaults()
+	c.TelegramToken = "123:abc"
+	c.Database.Password = "db-pass"
+	c.Webhooks.Subscribers = make([]struct {
+		URL    string   `json:"url"`
+		Secret string   `json:"secret" secret:"true"`
+		Events []string `json:"events"`
+	}, 1)
+	c.Webhooks.Subscribers[0].URL, c.Webhooks.Subscribers[0].Secret = "https://example.com/hook", "hook-secret"
+
+	r := c.Redacted()
+	if r.TelegramToken != "***" || r.Database.Password != "***" || r.Webhooks.Subscribers[0].Secret != "***" {
+		t.Fatalf("секреты не скрыты: %+v", r)
+	}
+	if r.APIToken != "" {
+		t.Fatalf("пустой секрет заменен: %q", r.APIToken)
+	}
+	if r.Webhooks.Subscribers[0].URL != "https://example.com/hook" {
+		t.Fatalf("url подписчика: %q", r.Webhooks.Subscribers[0].URL)
+	}
+
+	if c.TelegramToken != "123:abc" || c.Database.Password != "db-pass" || c.Webhooks.Subscribers[0].Secret != "hook-secret" {
+		t.Fatalf("Redacted изменил исходную конфигурацию: %+v", c)
+	}
+}
+
+func TestValidateReportsAllProblems(t *testing.T) {
+	c := Defaults()
+	c.TelegramToken = "no-colon"
+	c.Database.Port = 70000
+	c.Log.Level = "verbose"
+	c.RateLimit.ChatPerSecond = -1
+	c.Storage.Backend = "s3"
+	c.Webhooks.Subscribers = make([]struct {
+		URL    string   `json:"url"`
+		Secret string   `json:"secret" secret:"true"`
+		Events []string `json:"events"`
+	}, 1)
+	c.Webhooks.Subscribers[0].URL = "ftp://example.com"
+
+	err := c.Validate(true)
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("Validate() = %v, ожидалась *ValidationError", err)
+	}
+	want := []string{
+		"telegram_token: ожидается токен",
+		"secure_webhook_token: не задано",
+		"database.user: не задано (в файле или в переменной SUPPORTBOT_DATABASE_USER)",
+		"database.dbname: не задано",
+		"database.port: ожидается число от 1 до 65535, получено 70000",
+		`log.level: недопустимое значение "verbose"`,
+		"rate_limit.chat_per_second: не может быть отрицательным",
+		`webhooks.subscribers.0.url: ожидается адрес http(s)://..., получено "ftp://example.com"`,
+		"webhooks.subscribers.0.secret: не задано",
+		"storage.s3.endpoint: не задано",
+		"storage.s3.bucket: не задано",
+	}
+	for _, problem := range want {
+		found := false
+		for _, got := range verr.Problems {
+			if strings.HasPrefix(got, problem) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			t.Errorf("нет ошибки %q в %q", problem, verr.Problems)
+		}
+	}
+
+	valid := Defaults()
+	valid.TelegramToken = "123:abc"
+	valid.Database.User, valid.Database.DBName = "bot", "support"
+	if err := valid.Validate(false); err != nil {
+		t.Fatalf("корректная конфигурация: %v", err)
+	}
+}
@@ -0,0 +1,155 @@
+package config
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const reloadBase = `{
+	"telegram_token": "123:old",
+	"database": {"host": "db", "user": "bot", "dbname": "support", "password": "old-pass"},
+	"log": {"level": "info"}
+}`
+
+// useConfig делает c действующей конфигурацией до конца теста
+func useConfig(t *testing.T, c *Config) {
+	t.Helper()
+	previous := current.Load()
+	current.Store(c)
+	t.Cleanup(func() { current.Store(previous) })
+}
+
+func TestDiff(t *testing.T) {
+	old := Defaults()
+	old.TelegramToken = "123:old"
+	old.Database.Password = "old-pass"
+
+	next := old
+	next.TelegramToken = "123:new"
+	next.Database.Password = "new-pass"
+	next.Database.Host = "db2"
+	next.Log.Level = "debug"
+	next.RateLimit.ChatPerSecond = 0.5
+	next.Webhooks.Subscribers = make([]struct {
+		URL    string   `json:"url"`
+		Secret string   `json:"secret" secret:"true"`
+		Events []string `json:"events"`
+	}, 1)
+	next.Webhooks.Subscribers[0].URL, next.Webhooks.Subscribers[0].Secret = "https://example.com/hook", "hook-secret"
+
+	changes, restartOnly := diff(&old, &next)
+	wantChanges := []Change{
+		{Path: "database.host", Old: "localhost", New: "db2"},
+		{Path: "database.password", Old: "***", New: "***"},
+		{Path: "log.level", Old: "info", New: "debug"},
+		{Path: "rate_limit.chat_per_second", Old: "0", New: "0.5"},
+		{Path: "telegram_token", Old: "***", New: "***"},
+		{Path: "webhooks.subscribers.0.events", Old: "", New: "[]"},
+		{Path: "webhooks.subscribers.0.secret", Old: "", New: "***"},
+		{Path: "webhooks.subscribers.0.url", Old: "", New: "https://example.com/hook"},
+	}
+	if !reflect.DeepEqual(changes, wantChanges) {
+		t.Errorf("изменения:\n%+v\nожидалось:\n%+v", changes, wantChanges)
+	}
+	wantRestart := []string{
+		"database.host", "database.password", "telegram_token",
+		"webhooks.subscribers.0.events", "webhooks.subscribers.0.secret", "webhooks.subscribers.0.url",
+	}
+	if !reflect.DeepEqual(restartOnly, wantRestart) {
+		t.Errorf("только перезапуском: %q, ожидалось %q", restartOnly, wantRestart)
+	}
+
+	if changes, restartOnly := diff(&old, &old); len(changes) != 0 || len(restartOnly) != 0 {
+		t.Errorf("diff одинаковых снимков: %+v, %q", changes, restartOnly)
+	}
+}
+
+func TestReloadLiveSettings(t *testing.T) {
+	path := writeFile(t, "config.json", reloadBase)
+	initial, err := load(path, nil, envMap{}.lookup)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	useConfig(t, initial)
+
+	// Без изменений снимок не подменяется
+	changes, err := reload(path, nil, false, envMap{}.lookup)
+	if err != nil || len(changes) != 0 || Get() != initial {
+		t.Fatalf("перезагрузка без изменений: %+v, %v", changes, err)
+	}
+
+	changes, err = reload(path, nil, false, envMap{"SUPPORTBOT_LOG_LEVEL": "debug", "SUPPORTBOT_BROADCAST_RATE_PER_SECOND": "5"}.lookup)
+	if err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	want := []Change{
+		{Path: "broadcast.rate_per_second", Old: "0", New: "5"},
+		{Path: "log.level", Old: "info", New: "debug"},
+	}
+	if !reflect.DeepEqual(changes, want) {
+		t.Fatalf("изменения %+v, ожидалось %+v", changes, want)
+	}
+	if got := Get(); got.Log.Level != "debug" || got.Broadcast.RatePerSecond != 5 {
+		t.Fatalf("действующая конфигурация: %+v", got)
+	}
+	if initial.Log.Level != "info" {
+		t.Fatalf("перезагрузка изменила прежний снимок: %+v", initial)
+	}
+}
+
+func TestReloadRejectsRestartOnlyChanges(t *testing.T) {
+	tests := []struct {
+		name     string
+		file     string
+		env      envMap
+		wantPath string
+	}{
+		{"database.host", strings.Replace(reloadBase, `"host": "db"`, `"host": "db2"`, 1), nil, "database.host"},
+		{"database.password", reloadBase, envMap{"SUPPORTBOT_DATABASE_PASSWORD": "new-pass"}, "database.password"},
+		{"telegram_token", strings.Replace(reloadBase, "123:old", "123:new", 1), nil, "telegram_token"},
+	}
+	for _, tt := range tests {
+		path := writeFile(t, "config.json", reloadBase)
+		initial, err := load(path, nil, envMap{}.lookup)
+		if err != nil {
+			t.Fatalf("load: %v", err)
+		}
+		useConfig(t, initial)
+
+		// Вместе с ними меняется и live-настройка: она тоже не должна примениться
+		if err := os.WriteFile(path, []byte(strings.Replace(tt.file, `"level": "info"`, `"level": "debug"`, 1)), 0o600); err != nil {
+			t.Fatalf("WriteFile: %v", err)
+		}
+		changes, err := reload(path, nil, false, tt.env.lookup)
+		if err == nil || !strings.Contains(err.Error(), tt.wantPath) || changes != nil {
+			t.Errorf("%s: %+v, %v, ожидалась ошибка с %s", tt.name, changes, err, tt.wantPath)
+		}
+		if err != nil && (strings.Contains(err.Error(), "123:new") || strings.Contains(err.Error(), "new-pass")) {
+			t.Errorf("%s: секрет в тексте ошибки: %v", tt.name, err)
+		}
+		if got := Get(); got != initial || got.Log.Level != "info" {
+			t.Errorf("%s: действующая конфигурация изменилась: %+v", tt.name, got)
+		}
+	}
+}
+
+func TestReloadRejectsInvalidConfig(t *testing.T) {
+	path := writeFile(t, "config.json", reloadBase)
+	initial, err := load(path, nil, envMap{}.lookup)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	useConfig(t, initial)
+
+	if _, err := reload(path, nil, false, envMap{"SUPPORTBOT_LOG_LEVEL": "verbose"}.lookup); err == nil {
+		t.Fatal("некорректная конфигурация применена")
+	}
+	if _, err := reload(path, nil, false, envMap{"SUPPORTBOT_RATE_LIMIT_CHAT_BURST": "many"}.lookup); err == nil {
+		t.Fatal("ошибка окружения не возвращена")
+	}
+	if Get() != initial {
+		t.Fatalf("действующая конфигурация изменилась: %+v", Get())
+	}
+}
@@ -0,0 +1,129 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// ValidationError перечисляет все ошибки конфигурации
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "некорректная конфигурация:\n  - " + strings.Join(e.Problems, "\n  - ")
+}
+
+// Validate проверяет конфигурацию и возвращает *ValidationError со всеми найденными ошибками.
+// webhookMode - бот получает обновления через webhook (флаг -webhook).
+func (c *Config) Validate(webhookMode bool) error {
+	var v validator
+
+	v.require("telegram_token", c.TelegramToken)
+	if c.TelegramToken != "" && !strings.Contains(c.TelegramToken, ":") {
+		v.add("telegram_token: ожидается токен от @BotFather вида 123456:ABC...")
+	}
+	if webhookMode {
+		v.require("secure_webhook_token", c.SecureWebhookToken)
+	}
+
+	v.require("database.host", c.Database.Host)
+	v.require("database.user", c.Database.User)
+	v.require("database.dbname", c.Database.DBName)
+	if c.Database.Port < 1 || c.Database.Port > 65535 {
+		v.add("database.port: ожидается число от 1 до 65535, получено %d", c.Database.Port)
+	}
+	v.oneOf("database.sslmode", c.Database.SSLMode, "disable", "allow", "prefer", "require", "verify-ca", "verify-full")
+
+	// Пустые значения заменяются значениями по умолчанию там, где они используются
+	v.oneOf("log.level", strings.ToLower(c.Log.Level), "", "debug", "info", "warn", "warning", "error")
+	v.oneOf("log.format", strings.ToLower(c.Log.Format), "", "text", "json")
+	v.nonNegative("log.max_size_mb", float64(c.Log.MaxSizeMB))
+	v.nonNegative("log.rotate_every_hours", float64(c.Log.RotateEveryHours))
+	v.nonNegative("log.max_backups", float64(c.Log.MaxBackups))
+	v.nonNegative("log.max_age_days", float64(c.Log.MaxAgeDays))
+
+	v.oneOf("state_store.backend", c.StateStore.Backend, "", "memory", "postgres")
+	v.nonNegative("state_store.ttl_minutes", float64(c.StateStore.TTLMinutes))
+
+	v.nonNegative("rate_limit.global_per_second", c.RateLimit.GlobalPerSecond)
+	v.nonNegative("rate_limit.chat_per_second", c.RateLimit.ChatPerSecond)
+	v.nonNegative("rate_limit.chat_burst", float64(c.RateLimit.ChatBurst))
+	v.nonNegative("rate_limit.group_per_minute", c.RateLimit.GroupPerMinute)
+	v.nonNegative("rate_limit.max_attempts", float64(c.RateLimit.MaxAttempts))
+
+	for i, s := range c.Webhooks.Subscribers {
+		v.httpURL(fmt.Sprintf("webhooks.subscribers.%d.url", i), s.URL)
+		// Без ключа подписчик не может проверить, что запрос отправил бот
+		if strings.TrimSpace(s.Secret) == "" {
+			v.add("webhooks.subscribers.%d.secret: не задано", i)
+		}
+	}
+	v.nonNegative("webhooks.max_attempts", float64(c.Webhooks.MaxAttempts))
+	v.nonNegative("webhooks.timeout_seconds", float64(c.Webhooks.TimeoutSeconds))
+
+	v.nonNegative("broadcast.rate_per_second", c.Broadcast.RatePerSecond)
+	v.nonNegative("updates.workers", float64(c.Updates.Workers))
+	v.nonNegative("updates.queue_size", float64(c.Updates.QueueSize))
+
+	v.oneOf("storage.backend", c.Storage.Backend, "", "local", "s3", "database")
+	switch c.Storage.Backend {
+	case "s3":
+		v.httpURL("storage.s3.endpoint", c.Storage.S3.Endpoint)
+		v.require("storage.s3.bucket", c.Storage.S3.Bucket)
+		v.require("storage.s3.access_key", c.Storage.S3.AccessKey)
+		v.require("storage.s3.secret_key", c.Storage.S3.SecretKey)
+		v.nonNegative("storage.s3.url_expiry_minutes", float64(c.Storage.S3.URLExpiryMinutes))
+	}
+
+	if len(v.problems) > 0 {
+		return &ValidationError{Problems: v.problems}
+	}
+	return nil
+}
+
+// validator накапливает ошибки проверки
+type validator struct {
+	problems []string
+}
+
+func (v *validator) add(format string, args ...interface{}) {
+	v.problems = append(v.problems, fmt.Sprintf(format, args...))
+}
+
+func (v *validator) require(path, value string) {
+	if strings.TrimSpace(value) == "" {
+		v.add("%s: не задано (в файле или в переменной %s)", path, EnvName(path))
+	}
+}
+
+// oneOf проверяет, что значение входит в allowed; пустая строка первой в allowed разрешает пустое значение
+func (v *validator) oneOf(path, value string, allowed ...string) {
+	for _, a := range allowed {
+		if value == a {
+			return
+		}
+	}
+	if allowed[0] == "" {
+		allowed = allowed[1:]
+	}
+	v.add("%s: недопустимое значение %q (допустимо: %s)", path, value, strings.Join(allowed, ", "))
+}
+
+func (v *validator) nonNegative(path string, value float64) {
+	if value < 0 {
+		v.add("%s: не может быть отрицательным", path)
+	}
+}
+
+func (v *validator) httpURL(path, value string) {
+	if value == "" {
+		v.add("%s: не задано", path)
+		return
+	}
+	u, err := url.Parse(value)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		v.add("%s: ожидается адрес http(s)://..., получено %q", path, value)
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"supportTicketBotGo/config"
+)
+
+const configUsage = `Использование: supportbot [-config config.json] [-set путь=значение] config <команда>
+
+Команды:
+  print [--redacted]  итоговая конфигурация после значений по умолчанию, файла,
+                      переменных окружения и флагов -set; --redacted скрывает секреты
+  check               проверить конфигурацию и вывести все ошибки`
+
+// configFile возвращает путь к файлу конфигурации. Если флаг -config не указан и файла
+// по умолчанию нет, конфигурация собирается из переменных окружения и флагов.
+func configFile(path string) string {
+	explicit := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "config" {
+			explicit = true
+		}
+	})
+	if _, err := os.Stat(path); !explicit && os.IsNotExist(err) {
+		return ""
+	}
+	return path
+}
+
+// runConfigCommand выполняет подкоманду config и возвращает код завершения процесса
+func runConfigCommand(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, configUsage)
+		return 2
+	}
+
+	switch args[0] {
+	case "print":
+		flags := flag.NewFlagSet("config print", flag.ContinueOnError)
+		flags.Usage = func() { fmt.Fprintln(os.Stderr, configUsage) }
+		redacted := flags.Bool("redacted", false, "скрыть секреты")
+		if err := flags.Parse(args[1:]); err != nil {
+			return 2
+		}
+
+		cfg := *config.Get()
+		if *redacted {
+			cfg = cfg.Redacted()
+		}
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.SetEscapeHTML(false)
+		if err := encoder.Encode(cfg); err != nil {
+			fmt.Fprintf(os.Stderr, "Ошибка: %v\n", err)
+			return 1
+		}
+		return 0
+	case "check":
+		// Режим webhook проверяется при запуске с флагом -webhook
+		if err := config.Get().Validate(false); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		fmt.Println("Конфигурация корректна")
+		return 0
+	default:
+		fmt.Fprintln(os.Stderr, configUsage)
+		return 2
+	}
+}
@@ -0,0 +1,159 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"supportTicketBotGo/metrics"
+)
+
+// Роли пользователей
+const (
+	RoleUser  = "user"  // обычный пользователь, создающий тикеты
+	RoleAgent = "agent" // сотрудник поддержки, отвечающий на тикеты
+)
+
+// Функции для работы с агентами поддержки
+
+// GetUserRole возвращает роль пользователя
+func GetUserRole(userID int64) (string, error) {
+	defer metrics.ObserveQuery("getUserRole", time.Now())
+	var role string
+	err := DB.QueryRow("SELECT role FROM users WHERE id = $1", userID).Scan(&role)
+	if err == sql.ErrNoRows {
+		return RoleUser, nil
+	}
+	return role, err
+}
+
+// IsAgent проверяет, является ли пользователь агентом поддержки
+func IsAgent(userID int64) (bool, error) {
+	role, err := GetUserRole(userID)
+	if err != nil {
+		return false, err
+	}
+	return role == RoleAgent, nil
+}
+
+// SetUserRole устанавливает роль пользователя
+func SetUserRole(userID int64, role string) error {
+	defer metrics.ObserveQuery("setUserRole", time.Now())
+	if role != RoleUser && role != RoleAgent {
+		return fmt.Errorf("неизвестная роль: %s", role)
+	}
+
+	result, err := DB.Exec("UPDATE users SET role = $1 WHERE id = $2", role, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("пользователь %d не найден", userID)
+	}
+	return nil
+}
+
+// GetTicketQueue возвращает открытые тикеты, которые еще не взяты в работу:
+// сначала по приоритету категории, при равном приоритете - начиная с самых старых
+func GetTicketQueue(limit int) ([]Ticket, error) {
+	defer metrics.ObserveQuery("getTicketQueue", time.Now())
+	rows, err := DB.Query(
+		`SELECT t.id, t.user_id, t.title, t.description, t.status, t.category, t.created_at, t.closed_at, t.assigned_to
+		FROM tickets t LEFT JOIN ticket_categories c ON c.code = t.category
+		WHERE t.assigned_to IS NULL AND t.status NOT IN ('закрыт', 'отменён')
+		ORDER BY CASE c.default_priority WHEN 'urgent' THEN 3 WHEN 'high' THEN 2 WHEN 'low' THEN 0 ELSE 1 END DESC,
+			t.created_at ASC
+		LIMIT $1`,
+		limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanTickets(rows)
+}
+
+// GetAgentTickets возвращает незакрытые тикеты, назначенные агенту
+func GetAgentTickets(agentID int64) ([]Ticket, error) {
+	defer metrics.ObserveQuery("getAgentTickets", time.Now())
+	rows, err := DB.Query(
+		`SELECT id, user_id, title, description, status, category, created_at, closed_at, assigned_to
+		FROM tickets WHERE assigned_to = $1 AND status NOT IN ('закрыт', 'отменён')
+		ORDER BY created_at ASC`,
+		agentID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanTickets(rows)
+}
+
+// AssignTicket назначает тикет агенту, если его еще никто не взял.
+// Новый тикет переходит в статус "назначен", у остальных статус сохраняется.
+func AssignTicket(ticketID int, agentID int64) error {
+	defer metrics.ObserveQuery("assignTicket", time.Now())
+	tx, err := DB.Begin()
+	if err != nil {
+		return fmt.Errorf("ошибка при начале транзакции: %v", err)
+	}
+	defer tx.Rollback()
+
+	var current TicketStatus
+	err = tx.QueryRow(
+		`SELECT status FROM tickets
+		WHERE id = $1 AND assigned_to IS NULL AND status NOT IN ('закрыт', 'отменён')
+		FOR UPDATE`,
+		ticketID,
+	).Scan(&current)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("тикет #%d уже взят в работу, закрыт или не существует", ticketID)
+	}
+	if err != nil {
+		return err
+	}
+
+	status := current
+	if current == StatusCreated {
+		status = StatusAssigned
+	}
+	_, err = tx.Exec("UPDATE tickets SET assigned_to = $1, status = $2 WHERE id = $3", agentID, status, ticketID)
+	if err != nil {
+		return err
+	}
+	if status != current {
+		if err := emitStatusWebhooks(tx, ticketID, current, status, "support"); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	fireTicketEventHooks()
+	fireWebhookHooks()
+	return nil
+}
+
+// scanTickets читает тикеты из результата запроса
+func scanTickets(rows *sql.Rows) ([]Ticket, error) {
+	var tickets []Ticket
+	for rows.Next() {
+		var t Ticket
+		if err := rows.Scan(
+			&t.ID, &t.UserID, &t.Title, &t.Description, &t.Status,
+			&t.Category, &t.CreatedAt, &t.ClosedAt, &t.AssignedTo,
+		); err != nil {
+			return nil, err
+		}
+		tickets = append(tickets, t)
+	}
+	return tickets, rows.Err()
+}
@@ -0,0 +1,205 @@
+package database
+
+import (
+	"fmt"
+	"time"
+
+	"supportTicketBotGo/metrics"
+)
+
+// AttachmentKind - тип вложения тикета, соответствует типу сообщения Telegram
+type AttachmentKind string
+
+// Типы вложений
+const (
+	AttachmentPhoto     AttachmentKind = "photo"
+	AttachmentDocument  AttachmentKind = "document"
+	AttachmentVoice     AttachmentKind = "voice"
+	AttachmentVideo     AttachmentKind = "video"
+	AttachmentVideoNote AttachmentKind = "video_note"
+	AttachmentAudio     AttachmentKind = "audio"
+)
+
+// attachmentTitles - подписи типов вложений для пользователей
+var attachmentTitles = map[AttachmentKind]string{
+	AttachmentPhoto:     "📷 Фото",
+	AttachmentDocument:  "📄 Документ",
+	AttachmentVoice:     "🎤 Голосовое сообщение",
+	AttachmentVideo:     "🎬 Видео",
+	AttachmentVideoNote: "📹 Видеосообщение",
+	AttachmentAudio:     "🎵 Аудио",
+}
+
+// attachmentNouns - как вложение называется в сообщении тикета ("прикрепил ...")
+var attachmentNouns = map[AttachmentKind]string{
+	AttachmentPhoto:     "фото",
+	AttachmentDocument:  "документ",
+	AttachmentVoice:     "голосовое сообщение",
+	AttachmentVideo:     "видео",
+	AttachmentVideoNote: "видеосообщение",
+	AttachmentAudio:     "аудио",
+}
+
+// Valid сообщает, является ли тип вложения известным
+func (k AttachmentKind) Valid() bool {
+	_, ok := attachmentTitles[k]
+	return ok
+}
+
+// Title возвращает подпись типа вложения с эмодзи
+func (k AttachmentKind) Title() string {
+	if title, ok := attachmentTitles[k]; ok {
+		return title
+	}
+	return "📎 Вложение"
+}
+
+// Noun возвращает название вложения для текста сообщения тикета ("прикрепил документ ...")
+func (k AttachmentKind) Noun() string {
+	if noun, ok := attachmentNouns[k]; ok {
+		return noun
+	}
+	return "файл"
+}
+
+// TicketAttachment представляет файл, прикрепленный к тикету
+type TicketAttachment struct {
+	ID         int
+	TicketID   int
+	Kind       AttachmentKind
+	SenderType string
+	SenderID   int64
+	StorageKey string // ключ объекта в хранилище файлов (storage.Storage)
+	FileID     string
+	MimeType   string
+	FileSize   int64
+	FileName   string // исходное имя файла (есть только у документов и аудио)
+	MessageID  int
+	CreatedAt  time.Time
+}
+
+// AddTicketAttachment добавляет информацию о вложении в базу данных
+func AddTicketAttachment(attachment *TicketAttachment) (int, error) {
+	defer metrics.ObserveQuery("addTicketAttachment", time.Now())
+	if !attachment.Kind.Valid() {
+		return 0, fmt.Errorf("неизвестный тип вложения: %s", attachment.Kind)
+	}
+
+	tx, err := DB.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("ошибка при начале транзакции: %v", err)
+	}
+	defer tx.Rollback()
+
+	createdAt := time.Now()
+	var attachmentID int
+	err = tx.QueryRow(
+		`INSERT INTO ticket_attachments (ticket_id, kind, sender_type, sender_id, storage_key, file_id,
+			mime_type, file_size, file_name, message_id, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11) RETURNING id`,
+		attachment.TicketID, attachment.Kind, attachment.SenderType, attachment.SenderID,
+		attachment.StorageKey, attachment.FileID, attachment.MimeType, attachment.FileSize,
+		attachment.FileName, attachment.MessageID, createdAt,
+	).Scan(&attachmentID)
+	if isForeignKeyViolation(err, "ticket_attachments_ticket_id_fkey") {
+		return 0, fmt.Errorf("%w: #%d", ErrTicketNotFound, attachment.TicketID)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	err = emitWebhookEvent(tx, WebhookAttachmentAdded, webhookAttachmentData{
+		TicketID:   attachment.TicketID,
+		ID:         attachmentID,
+		Kind:       string(attachment.Kind),
+		SenderType: attachment.SenderType,
+		SenderID:   attachment.SenderID,
+		MimeType:   attachment.MimeType,
+		FileSize:   attachment.FileSize,
+		FileName:   attachment.FileName,
+		MessageID:  attachment.MessageID,
+		CreatedAt:  createdAt,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	fireWebhookHooks()
+	return attachmentID, nil
+}
+
+// GetTicketAttachments получает все вложения тикета в порядке добавления
+func GetTicketAttachments(ticketID int) ([]TicketAttachment, error) {
+	defer metrics.ObserveQuery("getTicketAttachments", time.Now())
+	rows, err := DB.Query(
+		`SELECT id, ticket_id, kind, sender_type, sender_id, storage_key, file_id,
+			mime_type, file_size, file_name, COALESCE(message_id, 0), created_at
+		FROM ticket_attachments
+		WHERE ticket_id = $1
+		ORDER BY created_at ASC, id ASC`,
+		ticketID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var attachments []TicketAttachment
+	for rows.Next() {
+		var a TicketAttachment
+		if err := rows.Scan(
+			&a.ID, &a.TicketID, &a.Kind, &a.SenderType, &a.SenderID, &a.StorageKey, &a.FileID,
+			&a.MimeType, &a.FileSize, &a.FileName, &a.MessageID, &a.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		attachments = append(attachments, a)
+	}
+
+	return attachments, rows.Err()
+}
+
+// UpdateTicketAttachmentFileID сохраняет новый file_id вложения, выданный Telegram
+// после повторной загрузки файла
+func UpdateTicketAttachmentFileID(attachmentID int, fileID string) error {
+	defer metrics.ObserveQuery("updateTicketAttachmentFileID", time.Now())
+	_, err := DB.Exec("UPDATE ticket_attachments SET file_id = $1 WHERE id = $2", fileID, attachmentID)
+	return err
+}
+
+// GetAttachmentsWithLegacyPaths возвращает вложения, у которых вместо ключа хранилища
+// записан путь к файлу (так сохраняли вложения версии бота до появления хранилища)
+func GetAttachmentsWithLegacyPaths() ([]TicketAttachment, error) {
+	defer metrics.ObserveQuery("getAttachmentsWithLegacyPaths", time.Now())
+	rows, err := DB.Query(
+		`SELECT id, ticket_id, kind, storage_key, mime_type
+		FROM ticket_attachments
+		WHERE storage_key NOT LIKE 'attachments/%'
+		ORDER BY id`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var attachments []TicketAttachment
+	for rows.Next() {
+		var a TicketAttachment
+		if err := rows.Scan(&a.ID, &a.TicketID, &a.Kind, &a.StorageKey, &a.MimeType); err != nil {
+			return nil, err
+		}
+		attachments = append(attachments, a)
+	}
+
+	return attachments, rows.Err()
+}
+
+// UpdateAttachmentStorageKey сохраняет новый ключ хранилища для вложения
+func UpdateAttachmentStorageKey(attachmentID int, key string) error {
+	defer metrics.ObserveQuery("updateAttachmentStorageKey", time.Now())
+	_, err := DB.Exec("UPDATE ticket_attachments SET storage_key = $1 WHERE id = $2", key, attachmentID)
+	return err
+}
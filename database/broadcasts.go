@@ -0,0 +1,364 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+	"unicode/utf8"
+
+	"github.com/lib/pq"
+)
+
+// Статусы рассылок
+const (
+	BroadcastDraft     = "draft"     // создана, но не запущена
+	BroadcastRunning   = "running"   // сообщения отправляются
+	BroadcastPaused    = "paused"    // отправка приостановлена оператором
+	BroadcastCompleted = "completed" // все получатели обработаны
+	BroadcastCancelled = "cancelled" // отменена, неотправленные сообщения не будут доставлены
+)
+
+// Статусы доставки рассылки получателю
+const (
+	RecipientPending = "pending" // ожидает отправки
+	RecipientSending = "sending" // захвачен обработчиком
+	RecipientSent    = "sent"    // сообщение доставлено
+	RecipientBlocked = "blocked" // пользователь заблокировал бота (ответ 403)
+	RecipientFailed  = "failed"  // доставка не удалась
+)
+
+// maxBroadcastLength - ограничение Telegram на длину текста сообщения
+const maxBroadcastLength = 4096
+
+// Ошибки рассылок
+var (
+	ErrBroadcastNotFound   = errors.New("рассылка не найдена")
+	ErrBroadcastTransition = errors.New("недопустимая смена статуса рассылки")
+	ErrInvalidBroadcast    = errors.New("некорректная рассылка")
+)
+
+// broadcastTransitions - из каких статусов разрешен переход в каждый статус рассылки
+var broadcastTransitions = map[string][]string{
+	BroadcastRunning:   {BroadcastDraft, BroadcastPaused},
+	BroadcastPaused:    {BroadcastRunning},
+	BroadcastCancelled: {BroadcastDraft, BroadcastRunning, BroadcastPaused},
+}
+
+// BroadcastAudience - условия выбора получателей рассылки. Условия объединяются через И,
+// пустая аудитория - все зарегистрированные пользователи, не заблокировавшие бота.
+type BroadcastAudience struct {
+	OpenTickets     bool       // только пользователи с незакрытыми тикетами
+	Category        string     // только пользователи с тикетами этой категории
+	RegisteredAfter *time.Time // только зарегистрированные после этого момента
+}
+
+// BroadcastStats - число получателей рассылки по статусам доставки
+type BroadcastStats struct {
+	Total   int
+	Pending int // включая захваченных обработчиком
+	Sent    int
+	Blocked int
+	Failed  int
+}
+
+// Broadcast - рассылка сообщения пользователям
+type Broadcast struct {
+	ID         int64
+	Text       string
+	ParseMode  string // "", "Markdown", "MarkdownV2" или "HTML"
+	Audience   BroadcastAudience
+	Status     string
+	CreatedBy  string
+	CreatedAt  time.Time
+	StartedAt  sql.NullTime
+	FinishedAt sql.NullTime
+	Stats      BroadcastStats
+}
+
+// BroadcastRecipient - получатель рассылки, захваченный для отправки
+type BroadcastRecipient struct {
+	BroadcastID int64
+	UserID      int64
+	Attempts    int
+}
+
+// broadcastSelect выбирает рассылку вместе со статистикой доставки
+const broadcastSelect = `SELECT b.id, b.text, b.parse_mode, b.audience_open_tickets, b.audience_category,
+	b.audience_registered_after, b.status, b.created_by, b.created_at, b.started_at, b.finished_at,
+	COUNT(r.user_id),
+	COUNT(r.user_id) FILTER (WHERE r.status IN ('pending', 'sending')),
+	COUNT(r.user_id) FILTER (WHERE r.status = 'sent'),
+	COUNT(r.user_id) FILTER (WHERE r.status = 'blocked'),
+	COUNT(r.user_id) FILTER (WHERE r.status = 'failed')
+FROM broadcasts b
+LEFT JOIN broadcast_recipients r ON r.broadcast_id = b.id`
+
+// CreateBroadcast сохраняет рассылку в статусе "draft" и фиксирует список получателей
+func CreateBroadcast(text, parseMode string, audience BroadcastAudience, createdBy string) (*Broadcast, error) {
+	if err := validateBroadcast(text, parseMode); err != nil {
+		return nil, err
+	}
+
+	tx, err := DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var registeredAfter sql.NullTime
+	if audience.RegisteredAfter != nil {
+		registeredAfter = sql.NullTime{Time: *audience.RegisteredAfter, Valid: true}
+	}
+
+	var broadcastID int64
+	err = tx.QueryRow(
+		`INSERT INTO broadcasts (text, parse_mode, audience_open_tickets, audience_category,
+			audience_registered_after, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`,
+		text, parseMode, audience.OpenTickets, audience.Category, registeredAfter, createdBy,
+	).Scan(&broadcastID)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(
+		`INSERT INTO broadcast_recipients (broadcast_id, user_id)
+		SELECT $1::bigint, u.id FROM users u
+		WHERE u.is_registered AND u.bot_blocked_at IS NULL
+			AND ($2::timestamptz IS NULL OR u.registered_at > $2::timestamptz)
+			AND (NOT $3::boolean AND $4::text = '' OR EXISTS (
+				SELECT 1 FROM tickets t
+				WHERE t.user_id = u.id
+					AND (NOT $3::boolean OR t.status NOT IN ('закрыт', 'отменён'))
+					AND ($4::text = '' OR t.category = $4::text)
+			))`,
+		broadcastID, registeredAfter, audience.OpenTickets, audience.Category,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return GetBroadcast(broadcastID)
+}
+
+// validateBroadcast проверяет текст и режим разметки рассылки
+func validateBroadcast(text, parseMode string) error {
+	if text == "" {
+		return fmt.Errorf("%w: пустой текст", ErrInvalidBroadcast)
+	}
+	if utf8.RuneCountInString(text) > maxBroadcastLength {
+		return fmt.Errorf("%w: текст длиннее %d символов", ErrInvalidBroadcast, maxBroadcastLength)
+	}
+	switch parseMode {
+	case "", "Markdown", "MarkdownV2", "HTML":
+		return nil
+	default:
+		return fmt.Errorf("%w: неизвестный режим разметки %q", ErrInvalidBroadcast, parseMode)
+	}
+}
+
+// GetBroadcast получает рассылку со статистикой доставки
+func GetBroadcast(broadcastID int64) (*Broadcast, error) {
+	rows, err := DB.Query(broadcastSelect+" WHERE b.id = $1 GROUP BY b.id", broadcastID)
+	if err != nil {
+		return nil, err
+	}
+	broadcasts, err := scanBroadcasts(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(broadcasts) == 0 {
+		return nil, ErrBroadcastNotFound
+	}
+	return &broadcasts[0], nil
+}
+
+// ListBroadcasts возвращает последние limit рассылок, новые первыми
+func ListBroadcasts(limit int) ([]Broadcast, error) {
+	rows, err := DB.Query(broadcastSelect+" GROUP BY b.id ORDER BY b.id DESC LIMIT $1", limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanBroadcasts(rows)
+}
+
+func scanBroadcasts(rows *sql.Rows) ([]Broadcast, error) {
+	defer rows.Close()
+
+	var broadcasts []Broadcast
+	for rows.Next() {
+		var b Broadcast
+		var registeredAfter sql.NullTime
+		if err := rows.Scan(
+			&b.ID, &b.Text, &b.ParseMode, &b.Audience.OpenTickets, &b.Audience.Category,
+			&registeredAfter, &b.Status, &b.CreatedBy, &b.CreatedAt, &b.StartedAt, &b.FinishedAt,
+			&b.Stats.Total, &b.Stats.Pending, &b.Stats.Sent, &b.Stats.Blocked, &b.Stats.Failed,
+		); err != nil {
+			return nil, err
+		}
+		if registeredAfter.Valid {
+			b.Audience.RegisteredAfter = &registeredAfter.Time
+		}
+		broadcasts = append(broadcasts, b)
+	}
+	return broadcasts, rows.Err()
+}
+
+// SetBroadcastStatus переводит рассылку в статус status ("running", "paused" или "cancelled"),
+// если переход разрешен из текущего статуса
+func SetBroadcastStatus(broadcastID int64, status string) error {
+	from, ok := broadcastTransitions[status]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrBroadcastTransition, status)
+	}
+
+	result, err := DB.Exec(
+		`UPDATE broadcasts SET status = $2::text,
+			started_at = CASE WHEN $2::text = 'running' THEN COALESCE(started_at, NOW()) ELSE started_at END,
+			finished_at = CASE WHEN $2::text = 'cancelled' THEN NOW() ELSE finished_at END
+		WHERE id = $1 AND status = ANY($3::text[])`,
+		broadcastID, status, pq.Array(from),
+	)
+	if err != nil {
+		return err
+	}
+	if affected, _ := result.RowsAffected(); affected > 0 {
+		return nil
+	}
+
+	var current string
+	err = DB.QueryRow("SELECT status FROM broadcasts WHERE id = $1", broadcastID).Scan(&current)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrBroadcastNotFound
+	}
+	if err != nil {
+		return err
+	}
+	return fmt.Errorf("%w: %s → %s", ErrBroadcastTransition, current, status)
+}
+
+// ClaimBroadcastRecipients захватывает до limit получателей запущенных рассылок.
+// Получатели, зависшие в статусе "sending" дольше staleAfter, захватываются повторно.
+func ClaimBroadcastRecipients(limit int, staleAfter time.Duration) ([]BroadcastRecipient, error) {
+	rows, err := DB.Query(
+		`UPDATE broadcast_recipients SET status = 'sending', attempts = attempts + 1, claimed_at = NOW()
+		WHERE (broadcast_id, user_id) IN (
+			SELECT r.broadcast_id, r.user_id FROM broadcast_recipients r
+			JOIN broadcasts b ON b.id = r.broadcast_id
+			WHERE b.status = 'running'
+				AND (r.status = 'pending' OR (r.status = 'sending' AND r.claimed_at < $2))
+			ORDER BY r.broadcast_id, r.user_id LIMIT $1
+			FOR UPDATE OF r SKIP LOCKED
+		)
+		RETURNING broadcast_id, user_id, attempts`,
+		limit, time.Now().Add(-staleAfter),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var recipients []BroadcastRecipient
+	for rows.Next() {
+		var r BroadcastRecipient
+		if err := rows.Scan(&r.BroadcastID, &r.UserID, &r.Attempts); err != nil {
+			return nil, err
+		}
+		recipients = append(recipients, r)
+	}
+	return recipients, rows.Err()
+}
+
+// MarkBroadcastRecipientSent отмечает, что сообщение рассылки доставлено получателю
+func MarkBroadcastRecipientSent(broadcastID, userID int64) error {
+	_, err := DB.Exec(
+		`UPDATE broadcast_recipients SET status = 'sent', sent_at = NOW(), last_error = NULL
+		WHERE broadcast_id = $1 AND user_id = $2`,
+		broadcastID, userID,
+	)
+	return err
+}
+
+// MarkBroadcastRecipientBlocked отмечает, что получатель заблокировал бота.
+// Пользователь исключается из следующих рассылок, пока снова не напишет боту.
+func MarkBroadcastRecipientBlocked(broadcastID, userID int64) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(
+		"UPDATE broadcast_recipients SET status = 'blocked' WHERE broadcast_id = $1 AND user_id = $2",
+		broadcastID, userID,
+	)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("UPDATE users SET bot_blocked_at = COALESCE(bot_blocked_at, NOW()) WHERE id = $1", userID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// MarkBroadcastRecipientFailed записывает ошибку доставки сообщения рассылки получателю
+func MarkBroadcastRecipientFailed(broadcastID, userID int64, deliveryErr string) error {
+	_, err := DB.Exec(
+		"UPDATE broadcast_recipients SET status = 'failed', last_error = $3 WHERE broadcast_id = $1 AND user_id = $2",
+		broadcastID, userID, deliveryErr,
+	)
+	return err
+}
+
+// ReleaseBroadcastRecipient возвращает захваченного получателя в очередь
+// (рассылку приостановили или обработчик останавливается)
+func ReleaseBroadcastRecipient(broadcastID, userID int64) error {
+	_, err := DB.Exec(
+		`UPDATE broadcast_recipients SET status = 'pending', attempts = GREATEST(attempts - 1, 0), claimed_at = NULL
+		WHERE broadcast_id = $1 AND user_id = $2 AND status = 'sending'`,
+		broadcastID, userID,
+	)
+	return err
+}
+
+// CompleteFinishedBroadcasts переводит в "completed" запущенные рассылки,
+// у которых не осталось необработанных получателей, и возвращает их ID
+func CompleteFinishedBroadcasts() ([]int64, error) {
+	rows, err := DB.Query(
+		`UPDATE broadcasts b SET status = 'completed', finished_at = NOW()
+		WHERE b.status = 'running' AND NOT EXISTS (
+			SELECT 1 FROM broadcast_recipients r
+			WHERE r.broadcast_id = b.id AND r.status IN ('pending', 'sending')
+		)
+		RETURNING b.id`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// SetUserBlocked отмечает, что пользователь заблокировал бота или снова начал с ним работу
+func SetUserBlocked(userID int64, blocked bool) error {
+	if blocked {
+		_, err := DB.Exec("UPDATE users SET bot_blocked_at = COALESCE(bot_blocked_at, NOW()) WHERE id = $1", userID)
+		return err
+	}
+	_, err := DB.Exec("UPDATE users SET bot_blocked_at = NULL WHERE id = $1 AND bot_blocked_at IS NOT NULL", userID)
+	return err
+}
@@ -0,0 +1,188 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"supportTicketBotGo/metrics"
+)
+
+// Priority - приоритет тикета. Категория задает приоритет ее тикетов по умолчанию.
+type Priority string
+
+// Приоритеты тикетов
+const (
+	PriorityLow    Priority = "low"
+	PriorityNormal Priority = "normal"
+	PriorityHigh   Priority = "high"
+	PriorityUrgent Priority = "urgent"
+)
+
+// priorityInfos - эмодзи, название и вес приоритета: очередь агентов начинается с тикетов с большим весом
+var priorityInfos = map[Priority]struct {
+	emoji string
+	title string
+	rank  int
+}{
+	PriorityLow:    {"🟢", "Низкий", 0},
+	PriorityNormal: {"🟡", "Обычный", 1},
+	PriorityHigh:   {"🟠", "Высокий", 2},
+	PriorityUrgent: {"🔴", "Срочный", 3},
+}
+
+// Priorities возвращает все приоритеты от низкого к срочному
+func Priorities() []Priority {
+	return []Priority{PriorityLow, PriorityNormal, PriorityHigh, PriorityUrgent}
+}
+
+// Valid проверяет, что приоритет известен
+func (p Priority) Valid() bool {
+	_, ok := priorityInfos[p]
+	return ok
+}
+
+// Label возвращает эмодзи и название приоритета для сообщений бота
+func (p Priority) Label() string {
+	info, ok := priorityInfos[p]
+	if !ok {
+		return string(p)
+	}
+	return info.emoji + " " + info.title
+}
+
+func (p Priority) rank() int {
+	return priorityInfos[p].rank
+}
+
+// Ошибки справочника категорий
+var (
+	ErrCategoryNotFound = errors.New("категория тикета не найдена")
+	ErrInvalidCategory  = errors.New("некорректная категория тикета")
+)
+
+// Category - категория тикета из справочника ticket_categories
+type Category struct {
+	Code            string   // хранится в tickets.category
+	Name            string   // название на кнопке и в сообщениях
+	Emoji           string   // эмодзи перед названием
+	TitlePrefix     string   // начало автоматического заголовка тикета; пустое - название
+	DefaultPriority Priority // приоритет тикетов категории
+	RoutingGroup    string   // группа поддержки, которой передаются тикеты (для интеграций)
+	Active          bool     // неактивные категории нельзя выбрать при создании тикета
+	SortOrder       int      // порядок кнопок на клавиатуре
+}
+
+// Label возвращает название категории с эмодзи, как на кнопке клавиатуры
+func (c Category) Label() string {
+	if c.Emoji == "" {
+		return c.Name
+	}
+	return c.Emoji + " " + c.Name
+}
+
+// Prefix возвращает начало автоматического заголовка тикета
+func (c Category) Prefix() string {
+	if c.TitlePrefix != "" {
+		return c.TitlePrefix
+	}
+	return c.Name
+}
+
+// Validate приводит код к нижнему регистру и проверяет заполнение полей
+func (c *Category) Validate() error {
+	c.Code = strings.ToLower(strings.TrimSpace(c.Code))
+	c.Name = strings.TrimSpace(c.Name)
+	c.Emoji = strings.TrimSpace(c.Emoji)
+	c.TitlePrefix = strings.TrimSpace(c.TitlePrefix)
+	c.RoutingGroup = strings.TrimSpace(c.RoutingGroup)
+	if c.DefaultPriority == "" {
+		c.DefaultPriority = PriorityNormal
+	}
+
+	switch {
+	case c.Code == "":
+		return fmt.Errorf("%w: не задан код", ErrInvalidCategory)
+	case c.Name == "":
+		return fmt.Errorf("%w: не задано название", ErrInvalidCategory)
+	case len([]rune(c.Label())) > 64:
+		return fmt.Errorf("%w: название с эмодзи длиннее 64 символов", ErrInvalidCategory)
+	case !c.DefaultPriority.Valid():
+		return fmt.Errorf("%w: неизвестный приоритет %q (допустимо: low, normal, high, urgent)", ErrInvalidCategory, c.DefaultPriority)
+	}
+	return nil
+}
+
+// DefaultCategories возвращает категории, с которыми создается справочник (миграция 0011)
+func DefaultCategories() []Category {
+	return []Category{
+		{Code: "вопрос", Name: "Вопрос", Emoji: "💭", TitlePrefix: "Вопрос", DefaultPriority: PriorityNormal, Active: true, SortOrder: 10},
+		{Code: "важно,срочно", Name: "Важно,Срочно", Emoji: "🚨", TitlePrefix: "Срочно", DefaultPriority: PriorityUrgent, Active: true, SortOrder: 20},
+		{Code: "финансы", Name: "Финансы", Emoji: "💰", TitlePrefix: "Финансы", DefaultPriority: PriorityHigh, Active: true, SortOrder: 30},
+	}
+}
+
+const categorySelect = `SELECT code, name, emoji, title_prefix, default_priority, routing_group, active, sort_order
+	FROM ticket_categories`
+
+// ListCategories возвращает категории в порядке кнопок; activeOnly - только доступные для выбора
+func ListCategories(activeOnly bool) ([]Category, error) {
+	defer metrics.ObserveQuery("listCategories", time.Now())
+	rows, err := DB.Query(categorySelect+" WHERE active OR NOT $1 ORDER BY sort_order, name", activeOnly)
+	if err != nil {
+		return nil, err
+	}
+	return scanCategories(rows)
+}
+
+// GetCategory возвращает категорию по коду, в том числе неактивную
+func GetCategory(code string) (*Category, error) {
+	defer metrics.ObserveQuery("getCategory", time.Now())
+	rows, err := DB.Query(categorySelect+" WHERE code = $1", code)
+	if err != nil {
+		return nil, err
+	}
+	categories, err := scanCategories(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(categories) == 0 {
+		return nil, fmt.Errorf("%w: %q", ErrCategoryNotFound, code)
+	}
+	return &categories[0], nil
+}
+
+// SaveCategory создает категорию или обновляет категорию с тем же кодом
+func SaveCategory(c *Category) error {
+	defer metrics.ObserveQuery("saveCategory", time.Now())
+	if err := c.Validate(); err != nil {
+		return err
+	}
+	_, err := DB.Exec(
+		`INSERT INTO ticket_categories (code, name, emoji, title_prefix, default_priority, routing_group, active, sort_order)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (code) DO UPDATE SET name = EXCLUDED.name, emoji = EXCLUDED.emoji,
+			title_prefix = EXCLUDED.title_prefix, default_priority = EXCLUDED.default_priority,
+			routing_group = EXCLUDED.routing_group, active = EXCLUDED.active, sort_order = EXCLUDED.sort_order`,
+		c.Code, c.Name, c.Emoji, c.TitlePrefix, c.DefaultPriority, c.RoutingGroup, c.Active, c.SortOrder,
+	)
+	return err
+}
+
+func scanCategories(rows *sql.Rows) ([]Category, error) {
+	defer rows.Close()
+
+	var categories []Category
+	for rows.Next() {
+		var c Category
+		if err := rows.Scan(
+			&c.Code, &c.Name, &c.Emoji, &c.TitlePrefix, &c.DefaultPriority, &c.RoutingGroup, &c.Active, &c.SortOrder,
+		); err != nil {
+			return nil, err
+		}
+		categories = append(categories, c)
+	}
+	return categories, rows.Err()
+}
@@ -2,14 +2,16 @@ package database
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"sync"
 	"time"
 
 	"supportTicketBotGo/config"
 	"supportTicketBotGo/logger"
+	"supportTicketBotGo/metrics"
 
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 )
 
 var (
@@ -27,32 +29,59 @@ var queries = map[string]string{
 	"getActiveTickets":  "SELECT id, user_id, title, description, status, category, created_at, closed_at FROM tickets WHERE user_id = $1 AND status != 'закрыт' ORDER BY created_at DESC",
 	"getTicketMessages": "SELECT id, ticket_id, sender_type, sender_id, message, created_at FROM ticket_messages WHERE ticket_id = $1 ORDER BY created_at ASC",
 	"addTicketMessage":  "INSERT INTO ticket_messages (ticket_id, sender_type, sender_id, message, created_at) VALUES ($1, $2, $3, $4, NOW()) RETURNING id",
-	"createTicket":      "INSERT INTO tickets (user_id, title, description, status, category, created_at) VALUES ($1, $2, $3, 'open', $4, NOW()) RETURNING id",
-	"closeTicket":       "UPDATE tickets SET status = 'закрыт', closed_at = NOW() WHERE id = $1 AND user_id = $2",
+	"createTicket":      "INSERT INTO tickets (user_id, title, description, status, category, created_at) VALUES ($1, $2, $3, $4, $5, NOW()) RETURNING id",
+	"closeTicket":       "UPDATE tickets SET status = 'закрыт', closed_at = NOW() WHERE id = $1 AND user_id = $2 AND status NOT IN ('закрыт', 'отменён')",
 }
 
+// isForeignKeyViolation проверяет, что запрос нарушил внешний ключ constraint
+func isForeignKeyViolation(err error, constraint string) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23503" && pqErr.Constraint == constraint
+}
+
+// ConnString возвращает строку подключения к PostgreSQL из конфигурации
+func ConnString() string {
+	dbConfig := config.Get().Database
+	return fmt.Sprintf(
+		"host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
+		dbConfig.Host, dbConfig.Port, dbConfig.User,
+		dbConfig.Password, dbConfig.DBName, dbConfig.SSLMode,
+	)
+}
+
+// OpenDB открывает пул соединений с базой данных без подготовки запросов.
+// Используется отдельно командой migrate: на пустой базе подготовить запросы нельзя.
+func OpenDB() error {
+	if DB != nil {
+		return nil
+	}
+
+	db, err := sql.Open("postgres", ConnString())
+	if err != nil {
+		return err
+	}
+
+	// Оптимизированные настройки пула соединений
+	db.SetMaxOpenConns(50) // Увеличиваем количество соединений
+	db.SetMaxIdleConns(25) // Больше idle соединений
+	db.SetConnMaxLifetime(30 * time.Minute)
+	db.SetConnMaxIdleTime(5 * time.Minute)
+
+	if err = db.Ping(); err != nil {
+		db.Close()
+		return err
+	}
+
+	DB = db
+	return nil
+}
+
+// ConnectDBOptimized открывает соединение и подготавливает запросы.
+// Схема БД к этому моменту должна быть актуальной (см. MigrateUp).
 func ConnectDBOptimized() error {
 	var err error
 	once.Do(func() {
-		dbConfig := config.AppConfig.Database
-		connStr := fmt.Sprintf(
-			"host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
-			dbConfig.Host, dbConfig.Port, dbConfig.User,
-			dbConfig.Password, dbConfig.DBName, dbConfig.SSLMode,
-		)
-
-		DB, err = sql.Open("postgres", connStr)
-		if err != nil {
-			return
-		}
-
-		// Оптимизированные настройки пула соединений
-		DB.SetMaxOpenConns(50) // Увеличиваем количество соединений
-		DB.SetMaxIdleConns(25) // Больше idle соединений
-		DB.SetConnMaxLifetime(30 * time.Minute)
-		DB.SetConnMaxIdleTime(5 * time.Minute)
-
-		if err = DB.Ping(); err != nil {
+		if err = OpenDB(); err != nil {
 			return
 		}
 
@@ -135,10 +164,11 @@ type Ticket struct {
 	UserID      int64
 	Title       string
 	Description string
-	Status      string
+	Status      TicketStatus
 	Category    string
 	CreatedAt   time.Time
 	ClosedAt    sql.NullTime
+	AssignedTo  sql.NullInt64 // ID агента поддержки, взявшего тикет в работу
 }
 
 // TicketMessage представляет сообщение в тикете
@@ -151,22 +181,11 @@ type TicketMessage struct {
 	CreatedAt  time.Time
 }
 
-// TicketPhoto представляет фотографию, прикрепленную к тикету
-type TicketPhoto struct {
-	ID         int
-	TicketID   int
-	SenderType string
-	SenderID   int64
-	FilePath   string
-	FileID     string
-	MessageID  int
-	CreatedAt  time.Time
-}
-
 // Функции для работы с пользователями
 
 // CreateUser создает нового пользователя
 func CreateUser(userID int64) error {
+	defer metrics.ObserveQuery("createUser", time.Now())
 	_, err := DB.Exec(
 		"INSERT INTO users (id) VALUES ($1) ON CONFLICT (id) DO NOTHING",
 		userID,
@@ -174,9 +193,25 @@ func CreateUser(userID int64) error {
 	return err
 }
 
-// UpdateUserRegistration обновляет данные регистрации пользователя
+// UpdateUserRegistration обновляет данные регистрации пользователя.
+// Завершение регистрации порождает событие вебхука user.registered.
 func UpdateUserRegistration(user *User) error {
-	_, err := DB.Exec(
+	defer metrics.ObserveQuery("updateUserRegistration", time.Now())
+	tx, err := DB.Begin()
+	if err != nil {
+		return fmt.Errorf("ошибка при начале транзакции: %v", err)
+	}
+	defer tx.Rollback()
+
+	var wasRegistered bool
+	err = tx.QueryRow("SELECT is_registered FROM users WHERE id = $1 FOR UPDATE", user.ID).Scan(&wasRegistered)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	exists := err == nil
+
+	registeredAt := time.Now()
+	_, err = tx.Exec(
 		`UPDATE users SET 
 		full_name = $1, 
 		phone = $2, 
@@ -188,38 +223,92 @@ func UpdateUserRegistration(user *User) error {
 		has_avatar = $8 
 		WHERE id = $9`,
 		user.FullName, user.Phone, user.LocationLat, user.LocationLng,
-		user.BirthDate, user.IsRegistered, time.Now(), user.HasAvatar, user.ID,
+		user.BirthDate, user.IsRegistered, registeredAt, user.HasAvatar, user.ID,
 	)
-	return err
+	if err != nil {
+		return err
+	}
+
+	emitted := false
+	if exists && !wasRegistered && user.IsRegistered {
+		var data webhookUserData
+		data.User.ID = user.ID
+		data.User.FullName = user.FullName
+		data.User.Phone = user.Phone
+		data.User.BirthDate = user.BirthDate
+		data.User.RegisteredAt = registeredAt
+		if err := emitWebhookEvent(tx, WebhookUserRegistered, data); err != nil {
+			return err
+		}
+		emitted = true
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	if emitted {
+		fireWebhookHooks()
+	}
+	return nil
 }
 
-// CloseTicket закрывает тикет пользователя
+// CloseTicket закрывает тикет пользователя. Закрытый или отмененный тикет закрыть нельзя.
 func CloseTicket(ticketID int, userID int64) error {
-	stmt := getStmt("closeTicket")
-	result, err := stmt.Exec(ticketID, userID)
+	defer metrics.ObserveQuery("closeTicket", time.Now())
+	tx, err := DB.Begin()
+	if err != nil {
+		return fmt.Errorf("ошибка при начале транзакции: %v", err)
+	}
+	defer tx.Rollback()
+
+	var oldStatus TicketStatus
+	var category string
+	err = tx.QueryRow(
+		"SELECT status, COALESCE(category, '') FROM tickets WHERE id = $1 AND user_id = $2 FOR UPDATE", ticketID, userID,
+	).Scan(&oldStatus, &category)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("%w: #%d у пользователя %d", ErrTicketNotFound, ticketID, userID)
+	}
+	if err != nil {
+		return fmt.Errorf("ошибка при получении тикета: %v", err)
+	}
+	if !oldStatus.CanTransitionTo(StatusClosed) {
+		return fmt.Errorf("%w: тикет #%d уже %s", ErrStatusTransition, ticketID, oldStatus)
+	}
+
+	result, err := tx.Stmt(getStmt("closeTicket")).Exec(ticketID, userID)
 	if err != nil {
 		return fmt.Errorf("ошибка при выполнении запроса: %v", err)
 	}
 
-	// Проверяем, был ли тикет действительно обновлен
+	// Строка заблокирована FOR UPDATE, поэтому 0 строк здесь - только если статус проверен неверно
 	rowsAffected, err := result.RowsAffected()
 	if err != nil {
 		return fmt.Errorf("ошибка при получении количества обновленных строк: %v", err)
 	}
-
 	if rowsAffected == 0 {
-		return fmt.Errorf("тикет #%d не найден или не принадлежит пользователю %d", ticketID, userID)
+		return fmt.Errorf("%w: тикет #%d уже закрыт или отменён", ErrStatusTransition, ticketID)
 	}
 
-	if rowsAffected == 0 {
-		return fmt.Errorf("тикет не найден или не принадлежит пользователю")
+	// Пользователь закрыл тикет сам - уведомлять его об этом не нужно
+	if err := skipOwnStatusEvent(tx, ticketID); err != nil {
+		return fmt.Errorf("ошибка при обновлении событий тикета: %v", err)
+	}
+	if err := emitStatusWebhooks(tx, ticketID, oldStatus, StatusClosed, "user"); err != nil {
+		return err
 	}
 
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	metrics.TicketClosed(category)
+	fireWebhookHooks()
 	return nil
 }
 
 // GetUserByID получает пользователя по ID
 func GetUserByID(userID int64) (*User, error) {
+	defer metrics.ObserveQuery("getUserByID", time.Now())
 	user := &User{}
 	err := DB.QueryRow(
 		`SELECT id, full_name, phone, location_lat, location_lng, 
@@ -238,6 +327,7 @@ func GetUserByID(userID int64) (*User, error) {
 
 // IsUserRegistered проверяет, зарегистрирован ли пользователь
 func IsUserRegistered(userID int64) (bool, error) {
+	defer metrics.ObserveQuery("isUserRegistered", time.Now())
 	var isRegistered bool
 	err := DB.QueryRow("SELECT is_registered FROM users WHERE id = $1", userID).Scan(&isRegistered)
 	if err != nil {
@@ -251,22 +341,49 @@ func IsUserRegistered(userID int64) (bool, error) {
 
 // Функции для работы с тикетами
 
-// CreateTicket создает новый тикет
+// CreateTicket создает новый тикет. Если статус не указан, тикет создается со статусом "создан".
 func CreateTicket(ticket *Ticket) (int, error) {
+	defer metrics.ObserveQuery("createTicket", time.Now())
+	if ticket.Status == "" {
+		ticket.Status = StatusCreated
+	}
+	if !ticket.Status.Valid() {
+		return 0, fmt.Errorf("%w: %q", ErrUnknownStatus, ticket.Status)
+	}
+
+	tx, err := DB.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("ошибка при начале транзакции: %v", err)
+	}
+	defer tx.Rollback()
+
 	var ticketID int
-	err := DB.QueryRow(
-		`INSERT INTO tickets (user_id, title, description, status, category, created_at) 
-		VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`,
-		ticket.UserID, ticket.Title, ticket.Description, ticket.Status,
-		ticket.Category, time.Now(),
+	err = tx.Stmt(getStmt("createTicket")).QueryRow(
+		ticket.UserID, ticket.Title, ticket.Description, ticket.Status, ticket.Category,
 	).Scan(&ticketID)
-	return ticketID, err
+	if isForeignKeyViolation(err, "tickets_category_fkey") {
+		return 0, fmt.Errorf("%w: %q", ErrCategoryNotFound, ticket.Category)
+	}
+	if err != nil {
+		return 0, err
+	}
+	if err := emitTicketWebhook(tx, WebhookTicketCreated, ticketID, webhookTicketData{}); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	metrics.TicketCreated(ticket.Category)
+	fireWebhookHooks()
+	return ticketID, nil
 }
 
 // GetActiveTicketsByUserID получает активные тикеты пользователя
 func GetActiveTicketsByUserID(userID int64) ([]Ticket, error) {
+	defer metrics.ObserveQuery("getActiveTickets", time.Now())
 	rows, err := DB.Query(
-		`SELECT id, user_id, title, description, status, category, created_at, closed_at 
+		`SELECT id, user_id, title, description, status, category, created_at, closed_at, assigned_to 
 		FROM tickets WHERE user_id = $1 AND status NOT IN ('закрыт', 'отменён') ORDER BY created_at DESC`,
 		userID,
 	)
@@ -280,7 +397,7 @@ func GetActiveTicketsByUserID(userID int64) ([]Ticket, error) {
 		var t Ticket
 		if err := rows.Scan(
 			&t.ID, &t.UserID, &t.Title, &t.Description, &t.Status,
-			&t.Category, &t.CreatedAt, &t.ClosedAt,
+			&t.Category, &t.CreatedAt, &t.ClosedAt, &t.AssignedTo,
 		); err != nil {
 			return nil, err
 		}
@@ -292,8 +409,9 @@ func GetActiveTicketsByUserID(userID int64) ([]Ticket, error) {
 
 // GetTicketHistory получает историю тикетов пользователя
 func GetTicketHistory(userID int64) ([]Ticket, error) {
+	defer metrics.ObserveQuery("getTicketHistory", time.Now())
 	rows, err := DB.Query(
-		`SELECT id, user_id, title, description, status, category, created_at, closed_at 
+		`SELECT id, user_id, title, description, status, category, created_at, closed_at, assigned_to 
 		FROM tickets WHERE user_id = $1 ORDER BY created_at DESC`,
 		userID,
 	)
@@ -307,7 +425,7 @@ func GetTicketHistory(userID int64) ([]Ticket, error) {
 		var t Ticket
 		if err := rows.Scan(
 			&t.ID, &t.UserID, &t.Title, &t.Description, &t.Status,
-			&t.Category, &t.CreatedAt, &t.ClosedAt,
+			&t.Category, &t.CreatedAt, &t.ClosedAt, &t.AssignedTo,
 		); err != nil {
 			return nil, err
 		}
@@ -321,20 +439,87 @@ func GetTicketHistory(userID int64) ([]Ticket, error) {
 
 // AddTicketMessage добавляет новое сообщение в тикет и возвращает его ID
 func AddTicketMessage(message *TicketMessage) (int, error) {
-	var messageID int
-	err := DB.QueryRow(
+	return addTicketMessage(message, true)
+}
+
+// AddSentTicketMessage добавляет в тикет сообщение поддержки, которое уже отправлено пользователю
+// в обход уведомлений (например, через /superconnect): событие для уведомления не создается.
+// Если отправка все же не удалась, уведомление можно вернуть в очередь через RequeueMessageNotification.
+func AddSentTicketMessage(message *TicketMessage) (int, error) {
+	return addTicketMessage(message, false)
+}
+
+// RequeueMessageNotification возвращает в очередь уведомление о сообщении, добавленном
+// через AddSentTicketMessage: его доставит обработчик уведомлений
+func RequeueMessageNotification(messageID int) error {
+	defer metrics.ObserveQuery("requeueMessageNotification", time.Now())
+	_, err := DB.Exec(
+		`UPDATE ticket_events SET status = 'pending', attempts = 0
+		WHERE message_id = $1 AND status = 'skipped'`,
+		messageID,
+	)
+	if err != nil {
+		return err
+	}
+	fireTicketEventHooks()
+	return nil
+}
+
+func addTicketMessage(message *TicketMessage, notify bool) (int, error) {
+	defer metrics.ObserveQuery("addTicketMessage", time.Now())
+	tx, err := DB.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("ошибка при начале транзакции: %v", err)
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRow(
 		`INSERT INTO ticket_messages 
 		(ticket_id, sender_type, sender_id, message, created_at) 
-		VALUES ($1, $2, $3, $4, NOW()) RETURNING id`,
+		VALUES ($1, $2, $3, $4, NOW()) RETURNING id, created_at`,
 		message.TicketID, message.SenderType, message.SenderID, message.Message,
-	).Scan(&messageID)
+	).Scan(&message.ID, &message.CreatedAt)
+	if isForeignKeyViolation(err, "ticket_messages_ticket_id_fkey") {
+		return 0, fmt.Errorf("%w: #%d", ErrTicketNotFound, message.TicketID)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if !notify {
+		_, err = tx.Exec("UPDATE ticket_events SET status = 'skipped' WHERE message_id = $1", message.ID)
+		if err != nil {
+			return 0, fmt.Errorf("ошибка при обновлении событий тикета: %v", err)
+		}
+	}
+
+	err = emitTicketWebhook(tx, WebhookTicketMessageAdded, message.TicketID, webhookTicketData{
+		Message: &webhookMessage{
+			ID:         message.ID,
+			SenderType: message.SenderType,
+			SenderID:   message.SenderID,
+			Text:       message.Message,
+			CreatedAt:  message.CreatedAt,
+		},
+	})
+	if err != nil {
+		return 0, err
+	}
 
-	message.ID = messageID // Устанавливаем ID в структуре
-	return messageID, err
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	fireWebhookHooks()
+	if notify && message.SenderType != "user" {
+		// Ответ поддержки порождает событие для уведомления пользователя
+		fireTicketEventHooks()
+	}
+	return message.ID, nil
 }
 
 // GetTicketMessages получает все сообщения тикета
 func GetTicketMessages(ticketID int) ([]TicketMessage, error) {
+	defer metrics.ObserveQuery("getTicketMessages", time.Now())
 	rows, err := DB.Query(
 		`SELECT id, ticket_id, sender_type, sender_id, message, created_at 
 		FROM ticket_messages WHERE ticket_id = $1 ORDER BY created_at`,
@@ -344,7 +529,41 @@ func GetTicketMessages(ticketID int) ([]TicketMessage, error) {
 		return nil, err
 	}
 	defer rows.Close()
+	return scanTicketMessages(rows)
+}
+
+// ListTicketMessages возвращает страницу сообщений тикета в порядке добавления и общее число сообщений.
+// limit <= 0 - без ограничения.
+func ListTicketMessages(ticketID, limit, offset int) ([]TicketMessage, int, error) {
+	defer metrics.ObserveQuery("listTicketMessages", time.Now())
+	var total int
+	err := DB.QueryRow(`SELECT COUNT(*) FROM ticket_messages WHERE ticket_id = $1`, ticketID).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
 
+	args := []interface{}{ticketID}
+	query := `SELECT id, ticket_id, sender_type, sender_id, message, created_at
+		FROM ticket_messages WHERE ticket_id = $1 ORDER BY created_at, id`
+	if limit > 0 {
+		args = append(args, limit)
+		query += fmt.Sprintf(" LIMIT $%d", len(args))
+	}
+	if offset > 0 {
+		args = append(args, offset)
+		query += fmt.Sprintf(" OFFSET $%d", len(args))
+	}
+
+	rows, err := DB.Query(query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+	messages, err := scanTicketMessages(rows)
+	return messages, total, err
+}
+
+func scanTicketMessages(rows *sql.Rows) ([]TicketMessage, error) {
 	var messages []TicketMessage
 	for rows.Next() {
 		var m TicketMessage
@@ -356,12 +575,12 @@ func GetTicketMessages(ticketID int) ([]TicketMessage, error) {
 		}
 		messages = append(messages, m)
 	}
-
-	return messages, nil
+	return messages, rows.Err()
 }
 
 // GetTicketMessageCount возвращает количество сообщений в тикете
 func GetTicketMessageCount(ticketID int) (int, error) {
+	defer metrics.ObserveQuery("getTicketMessageCount", time.Now())
 	var count int
 	err := DB.QueryRow(
 		`SELECT COUNT(*) FROM ticket_messages WHERE ticket_id = $1`,
@@ -372,14 +591,16 @@ func GetTicketMessageCount(ticketID int) (int, error) {
 
 // GetTicketByID получает тикет по его ID
 func GetTicketByID(ticketID int) (*Ticket, error) {
+	defer metrics.ObserveQuery("getTicketByID", time.Now())
 	ticket := &Ticket{}
 	err := DB.QueryRow(
-		`SELECT id, user_id, title, description, status, category, created_at, closed_at 
+		`SELECT id, user_id, title, description, status, category, created_at, closed_at, assigned_to 
 		FROM tickets WHERE id = $1`,
 		ticketID,
 	).Scan(
 		&ticket.ID, &ticket.UserID, &ticket.Title, &ticket.Description,
 		&ticket.Status, &ticket.Category, &ticket.CreatedAt, &ticket.ClosedAt,
+		&ticket.AssignedTo,
 	)
 	if err != nil {
 		return nil, err
@@ -387,25 +608,89 @@ func GetTicketByID(ticketID int) (*Ticket, error) {
 	return ticket, nil
 }
 
-// UpdateTicketStatus обновляет статус тикета
-func UpdateTicketStatus(ticketID int, status string) error {
-	var err error
-	if status == "закрыт" {
-		_, err = DB.Exec(
-			`UPDATE tickets SET status = $1, closed_at = NOW() WHERE id = $2`,
-			status, ticketID,
-		)
+// UpdateTicketStatus меняет статус тикета с проверкой допустимости перехода.
+// Повторная установка текущего статуса ничего не меняет и не считается ошибкой.
+func UpdateTicketStatus(ticketID int, status TicketStatus) error {
+	defer metrics.ObserveQuery("updateTicketStatus", time.Now())
+	if !status.Valid() {
+		return fmt.Errorf("%w: %q", ErrUnknownStatus, status)
+	}
+
+	tx, err := DB.Begin()
+	if err != nil {
+		return fmt.Errorf("ошибка при начале транзакции: %v", err)
+	}
+	defer tx.Rollback()
+
+	var current TicketStatus
+	var category string
+	err = tx.QueryRow(
+		"SELECT status, COALESCE(category, '') FROM tickets WHERE id = $1 FOR UPDATE", ticketID,
+	).Scan(&current, &category)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("%w: #%d", ErrTicketNotFound, ticketID)
+	}
+	if err != nil {
+		return err
+	}
+
+	if current == status {
+		return nil
+	}
+	if !current.CanTransitionTo(status) {
+		return fmt.Errorf("%w: #%d %q -> %q", ErrStatusTransition, ticketID, current, status)
+	}
+
+	if status == StatusClosed {
+		_, err = tx.Exec(`UPDATE tickets SET status = $1, closed_at = NOW() WHERE id = $2`, status, ticketID)
 	} else {
-		_, err = DB.Exec(
-			`UPDATE tickets SET status = $1 WHERE id = $2`,
-			status, ticketID,
-		)
+		_, err = tx.Exec(`UPDATE tickets SET status = $1 WHERE id = $2`, status, ticketID)
 	}
-	return err
+	if err != nil {
+		return err
+	}
+	if err := emitStatusWebhooks(tx, ticketID, current, status, "support"); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	if status == StatusClosed {
+		metrics.TicketClosed(category)
+	}
+	fireTicketEventHooks()
+	fireWebhookHooks()
+	return nil
+}
+
+// CountOpenTicketsByStatus возвращает число незавершенных тикетов по коду статуса (см. TicketStatus.Code)
+func CountOpenTicketsByStatus() (map[string]int, error) {
+	defer metrics.ObserveQuery("countOpenTicketsByStatus", time.Now())
+	rows, err := DB.Query(
+		"SELECT status, COUNT(*) FROM tickets WHERE status NOT IN ($1, $2) GROUP BY status",
+		StatusClosed, StatusCancelled,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var status TicketStatus
+		var n int
+		if err := rows.Scan(&status, &n); err != nil {
+			return nil, err
+		}
+		counts[status.Code()] = n
+	}
+	return counts, rows.Err()
 }
 
 // GetUserNameByID возвращает имя пользователя по ID
 func GetUserNameByID(userID int64) (string, error) {
+	defer metrics.ObserveQuery("getUserNameByID", time.Now())
 	var fullName string
 	err := DB.QueryRow(
 		`SELECT full_name FROM users WHERE id = $1`,
@@ -426,52 +711,32 @@ func GetUserNameByID(userID int64) (string, error) {
 	return fullName, nil
 }
 
-// AddTicketPhoto добавляет информацию о фотографии в базу данных
-func AddTicketPhoto(photo *TicketPhoto) (int, error) {
-	var photoID int
-	err := DB.QueryRow(
-		`INSERT INTO ticket_photos (ticket_id, sender_type, sender_id, file_path, file_id, message_id, created_at) 
-		VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id`,
-		photo.TicketID, photo.SenderType, photo.SenderID, photo.FilePath, photo.FileID, photo.MessageID, time.Now(),
-	).Scan(&photoID)
-
-	return photoID, err
+// UpdateUserAvatar обновляет статус аватара пользователя
+func UpdateUserAvatar(userID int64, hasAvatar bool) error {
+	defer metrics.ObserveQuery("updateUserAvatar", time.Now())
+	_, err := DB.Exec(
+		"UPDATE users SET has_avatar = $1 WHERE id = $2",
+		hasAvatar, userID,
+	)
+	return err
 }
 
-// GetTicketPhotos получает все фотографии для заданного тикета
-func GetTicketPhotos(ticketID int) ([]TicketPhoto, error) {
-	rows, err := DB.Query(
-		`SELECT id, ticket_id, sender_type, sender_id, file_path, file_id, message_id, created_at 
-		FROM ticket_photos 
-		WHERE ticket_id = $1 
-		ORDER BY created_at ASC`,
-		ticketID,
-	)
+// GetUserIDsWithAvatar возвращает ID пользователей, у которых сохранен аватар
+func GetUserIDsWithAvatar() ([]int64, error) {
+	defer metrics.ObserveQuery("getUserIDsWithAvatar", time.Now())
+	rows, err := DB.Query("SELECT id FROM users WHERE has_avatar ORDER BY id")
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var photos []TicketPhoto
+	var ids []int64
 	for rows.Next() {
-		var p TicketPhoto
-		if err := rows.Scan(
-			&p.ID, &p.TicketID, &p.SenderType, &p.SenderID,
-			&p.FilePath, &p.FileID, &p.MessageID, &p.CreatedAt,
-		); err != nil {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
 			return nil, err
 		}
-		photos = append(photos, p)
+		ids = append(ids, id)
 	}
-
-	return photos, nil
-}
-
-// UpdateUserAvatar обновляет статус аватара пользователя
-func UpdateUserAvatar(userID int64, hasAvatar bool) error {
-	_, err := DB.Exec(
-		"UPDATE users SET has_avatar = $1 WHERE id = $2",
-		hasAvatar, userID,
-	)
-	return err
+	return ids, rows.Err()
 }
@@ -0,0 +1,155 @@
+package database
+
+import (
+	"database/sql"
+	"sync"
+	"time"
+)
+
+// Канал PostgreSQL, в который триггеры публикуют ID новых событий тикетов
+const TicketEventsChannel = "ticket_events"
+
+// Типы событий тикетов
+const (
+	EventSupportMessage = "support_message" // поддержка ответила в тикете
+	EventStatusChanged  = "status_changed"  // статус тикета изменился
+)
+
+// Статусы доставки уведомлений о событиях
+const (
+	EventPending   = "pending"   // ожидает отправки
+	EventSending   = "sending"   // захвачено обработчиком
+	EventDelivered = "delivered" // уведомление доставлено пользователю
+	EventSkipped   = "skipped"   // уведомление не требуется
+	EventFailed    = "failed"    // доставка не удалась после всех попыток
+)
+
+// TicketEvent представляет событие тикета, о котором нужно уведомить пользователя.
+// События создаются триггерами БД, поэтому учитываются и записи внешних инструментов.
+type TicketEvent struct {
+	ID          int64
+	TicketID    int
+	Kind        string
+	MessageID   sql.NullInt64
+	OldStatus   sql.NullString
+	NewStatus   sql.NullString
+	Status      string
+	Attempts    int
+	CreatedAt   time.Time
+	DeliveredAt sql.NullTime
+}
+
+var (
+	ticketEventHooksMu sync.RWMutex
+	ticketEventHooks   []func()
+)
+
+// OnTicketEvent регистрирует функцию, вызываемую после записей бота,
+// которые могли породить событие тикета (ответ поддержки, смена статуса)
+func OnTicketEvent(hook func()) {
+	ticketEventHooksMu.Lock()
+	defer ticketEventHooksMu.Unlock()
+	ticketEventHooks = append(ticketEventHooks, hook)
+}
+
+// fireTicketEventHooks вызывает зарегистрированные обработчики событий тикетов
+func fireTicketEventHooks() {
+	ticketEventHooksMu.RLock()
+	defer ticketEventHooksMu.RUnlock()
+	for _, hook := range ticketEventHooks {
+		hook()
+	}
+}
+
+// ClaimTicketEvents захватывает до limit событий, ожидающих отправки, у которых наступило
+// время следующей попытки. События, зависшие в статусе "sending" дольше staleAfter
+// (например, после падения процесса), захватываются повторно.
+// SKIP LOCKED позволяет нескольким репликам работать параллельно.
+func ClaimTicketEvents(limit int, staleAfter time.Duration) ([]TicketEvent, error) {
+	rows, err := DB.Query(
+		`UPDATE ticket_events SET status = 'sending', attempts = attempts + 1, claimed_at = NOW()
+		WHERE id IN (
+			SELECT id FROM ticket_events
+			WHERE (status = 'pending' AND (next_attempt_at IS NULL OR next_attempt_at <= NOW()))
+				OR (status = 'sending' AND claimed_at < $2)
+			ORDER BY id LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, ticket_id, kind, message_id, old_status, new_status, status, attempts, created_at, delivered_at`,
+		limit, time.Now().Add(-staleAfter),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []TicketEvent
+	for rows.Next() {
+		var e TicketEvent
+		if err := rows.Scan(
+			&e.ID, &e.TicketID, &e.Kind, &e.MessageID, &e.OldStatus, &e.NewStatus,
+			&e.Status, &e.Attempts, &e.CreatedAt, &e.DeliveredAt,
+		); err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+// MarkTicketEventDelivered отмечает, что уведомление о событии доставлено пользователю
+func MarkTicketEventDelivered(eventID int64) error {
+	_, err := DB.Exec(
+		"UPDATE ticket_events SET status = 'delivered', delivered_at = NOW(), last_error = NULL WHERE id = $1",
+		eventID,
+	)
+	return err
+}
+
+// MarkTicketEventSkipped отмечает, что уведомление о событии не требуется
+func MarkTicketEventSkipped(eventID int64) error {
+	_, err := DB.Exec("UPDATE ticket_events SET status = 'skipped' WHERE id = $1", eventID)
+	return err
+}
+
+// MarkTicketEventFailed сохраняет ошибку доставки. Пока не исчерпаны попытки, событие возвращается
+// в очередь и будет захвачено не раньше чем через retryAfter, иначе помечается как неудавшееся.
+// maxAttempts = 0 - повторять доставку бессмысленно (пользователь заблокировал бота).
+func MarkTicketEventFailed(eventID int64, deliveryErr error, maxAttempts int, retryAfter time.Duration) error {
+	_, err := DB.Exec(
+		`UPDATE ticket_events SET
+		status = CASE WHEN attempts >= $3 THEN 'failed' ELSE 'pending' END,
+		last_error = $2,
+		next_attempt_at = $4
+		WHERE id = $1`,
+		eventID, deliveryErr.Error(), maxAttempts, time.Now().Add(retryAfter),
+	)
+	return err
+}
+
+// skipOwnStatusEvent помечает как ненужное событие смены статуса, которое триггер записал
+// в текущей транзакции: о своем собственном действии пользователя уведомлять не нужно.
+// NOW() в PostgreSQL - время начала транзакции, оно же created_at событий, записанных в ней.
+// Более ранние события (например, смена статуса поддержкой) остаются в очереди.
+func skipOwnStatusEvent(tx *sql.Tx, ticketID int) error {
+	_, err := tx.Exec(
+		`UPDATE ticket_events SET status = 'skipped'
+		WHERE ticket_id = $1 AND kind = 'status_changed' AND status = 'pending' AND created_at = NOW()`,
+		ticketID,
+	)
+	return err
+}
+
+// GetTicketMessageByID получает сообщение тикета по его ID
+func GetTicketMessageByID(messageID int) (*TicketMessage, error) {
+	m := &TicketMessage{}
+	err := DB.QueryRow(
+		`SELECT id, ticket_id, sender_type, sender_id, message, created_at
+		FROM ticket_messages WHERE id = $1`,
+		messageID,
+	).Scan(&m.ID, &m.TicketID, &m.SenderType, &m.SenderID, &m.Message, &m.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
@@ -0,0 +1,84 @@
+package database
+
+import (
+	"errors"
+	"time"
+)
+
+// IdempotencyTTL - сколько хранится ключ идемпотентности
+const IdempotencyTTL = 24 * time.Hour
+
+// IdempotencyLease - сколько ключ остается за выполняющимся запросом. Если за это время ответ
+// не сохранен (бот перезапустился посреди запроса), повтор с тем же ключом выполняет запрос заново.
+const IdempotencyLease = 5 * time.Minute
+
+// Ошибки ключей идемпотентности
+var (
+	ErrIdempotencyInProgress = errors.New("запрос с этим ключом идемпотентности еще выполняется")
+	ErrIdempotencyMismatch   = errors.New("ключ идемпотентности уже использован с другими параметрами")
+)
+
+// IdempotentResponse - сохраненный ответ на запрос с ключом идемпотентности
+type IdempotentResponse struct {
+	StatusCode int
+	Body       []byte
+}
+
+// BeginIdempotentRequest резервирует ключ идемпотентности в области scope.
+// Возвращает nil, если ключ новый и запрос нужно выполнить; сохраненный ответ, если запрос
+// с этим ключом уже выполнен; ErrIdempotencyInProgress или ErrIdempotencyMismatch,
+// если он еще выполняется или был с другими параметрами (requestHash).
+// Ключ запроса, который выполняется дольше IdempotencyLease, считается брошенным и резервируется заново.
+func BeginIdempotentRequest(scope, key, requestHash string) (*IdempotentResponse, error) {
+	// Попутно удаляем просроченные ключи, в том числе этот
+	if _, err := DB.Exec("DELETE FROM idempotency_keys WHERE created_at < $1", time.Now().Add(-IdempotencyTTL)); err != nil {
+		return nil, err
+	}
+
+	result, err := DB.Exec(
+		`INSERT INTO idempotency_keys (scope, key, request_hash) VALUES ($1, $2, $3)
+		ON CONFLICT (scope, key) DO UPDATE SET created_at = NOW()
+		WHERE idempotency_keys.status_code IS NULL AND idempotency_keys.created_at < $4
+			AND idempotency_keys.request_hash = EXCLUDED.request_hash`,
+		scope, key, requestHash, time.Now().Add(-IdempotencyLease),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if inserted, err := result.RowsAffected(); err != nil || inserted == 1 {
+		return nil, err
+	}
+
+	var storedHash string
+	var statusCode *int
+	var body []byte
+	err = DB.QueryRow(
+		"SELECT request_hash, status_code, response FROM idempotency_keys WHERE scope = $1 AND key = $2",
+		scope, key,
+	).Scan(&storedHash, &statusCode, &body)
+	if err != nil {
+		return nil, err
+	}
+	if storedHash != requestHash {
+		return nil, ErrIdempotencyMismatch
+	}
+	if statusCode == nil {
+		return nil, ErrIdempotencyInProgress
+	}
+	return &IdempotentResponse{StatusCode: *statusCode, Body: body}, nil
+}
+
+// CompleteIdempotentRequest сохраняет ответ на запрос с ключом идемпотентности
+func CompleteIdempotentRequest(scope, key string, statusCode int, body []byte) error {
+	_, err := DB.Exec(
+		"UPDATE idempotency_keys SET status_code = $3, response = $4 WHERE scope = $1 AND key = $2",
+		scope, key, statusCode, body,
+	)
+	return err
+}
+
+// ReleaseIdempotentRequest освобождает ключ после неудачного запроса, чтобы его можно было повторить
+func ReleaseIdempotentRequest(scope, key string) error {
+	_, err := DB.Exec("DELETE FROM idempotency_keys WHERE scope = $1 AND key = $2", scope, key)
+	return err
+}
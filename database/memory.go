@@ -0,0 +1,470 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryStore реализует все репозитории в памяти процесса.
+// Повторяет поведение PostgresStore (ошибки, сортировку, проверки статусов)
+// и предназначено для тестов и локального запуска без PostgreSQL.
+type MemoryStore struct {
+	mu          sync.RWMutex
+	users       map[int64]*memoryUser
+	tickets     map[int]*Ticket
+	messages    []TicketMessage
+	attachments []TicketAttachment
+	categories  []Category
+
+	lastTicketID     int
+	lastMessageID    int
+	lastAttachmentID int
+}
+
+type memoryUser struct {
+	User
+	role    string
+	blocked bool
+}
+
+// NewMemoryStore создает пустое хранилище в памяти с категориями по умолчанию
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		users:      make(map[int64]*memoryUser),
+		tickets:    make(map[int]*Ticket),
+		categories: DefaultCategories(),
+	}
+}
+
+// Пользователи
+
+func (s *MemoryStore) CreateUser(userID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.users[userID]; !ok {
+		s.users[userID] = &memoryUser{User: User{ID: userID}, role: RoleUser}
+	}
+	return nil
+}
+
+func (s *MemoryStore) GetUserByID(userID int64) (*User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	u, ok := s.users[userID]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	user := u.User
+	return &user, nil
+}
+
+func (s *MemoryStore) IsUserRegistered(userID int64) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	u, ok := s.users[userID]
+	return ok && u.IsRegistered, nil
+}
+
+func (s *MemoryStore) UpdateUserRegistration(user *User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.users[user.ID]
+	if !ok {
+		return nil
+	}
+	u.User = *user
+	u.RegisteredAt = time.Now()
+	return nil
+}
+
+func (s *MemoryStore) UpdateUserAvatar(userID int64, hasAvatar bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if u, ok := s.users[userID]; ok {
+		u.HasAvatar = hasAvatar
+	}
+	return nil
+}
+
+func (s *MemoryStore) GetUserNameByID(userID int64) (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	u, ok := s.users[userID]
+	if !ok {
+		return "", fmt.Errorf("пользователь не найден")
+	}
+	if u.FullName == "" {
+		return "Сотрудник поддержки", nil
+	}
+	return u.FullName, nil
+}
+
+func (s *MemoryStore) GetUserRole(userID int64) (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if u, ok := s.users[userID]; ok {
+		return u.role, nil
+	}
+	return RoleUser, nil
+}
+
+func (s *MemoryStore) IsAgent(userID int64) (bool, error) {
+	role, err := s.GetUserRole(userID)
+	return role == RoleAgent, err
+}
+
+func (s *MemoryStore) SetUserRole(userID int64, role string) error {
+	if role != RoleUser && role != RoleAgent {
+		return fmt.Errorf("неизвестная роль: %s", role)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.users[userID]
+	if !ok {
+		return fmt.Errorf("пользователь %d не найден", userID)
+	}
+	u.role = role
+	return nil
+}
+
+func (s *MemoryStore) SetUserBlocked(userID int64, blocked bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if u, ok := s.users[userID]; ok {
+		u.blocked = blocked
+	}
+	return nil
+}
+
+// Тикеты
+
+func (s *MemoryStore) CreateTicket(ticket *Ticket) (int, error) {
+	if ticket.Status == "" {
+		ticket.Status = StatusCreated
+	}
+	if !ticket.Status.Valid() {
+		return 0, fmt.Errorf("%w: %q", ErrUnknownStatus, ticket.Status)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.users[ticket.UserID]; !ok {
+		return 0, fmt.Errorf("пользователь %d не найден", ticket.UserID)
+	}
+	if s.findCategory(ticket.Category) == nil {
+		return 0, fmt.Errorf("%w: %q", ErrCategoryNotFound, ticket.Category)
+	}
+
+	s.lastTicketID++
+	stored := *ticket
+	stored.ID = s.lastTicketID
+	stored.CreatedAt = time.Now()
+	s.tickets[stored.ID] = &stored
+	return stored.ID, nil
+}
+
+func (s *MemoryStore) GetTicketByID(ticketID int) (*Ticket, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	t, ok := s.tickets[ticketID]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	ticket := *t
+	return &ticket, nil
+}
+
+func (s *MemoryStore) GetActiveTicketsByUserID(userID int64) ([]Ticket, error) {
+	return s.findTickets(func(t *Ticket) bool { return t.UserID == userID && !t.Status.IsFinal() }, false, 0), nil
+}
+
+func (s *MemoryStore) GetTicketHistory(userID int64) ([]Ticket, error) {
+	return s.findTickets(func(t *Ticket) bool { return t.UserID == userID }, false, 0), nil
+}
+
+func (s *MemoryStore) GetTicketQueue(limit int) ([]Ticket, error) {
+	tickets := s.findTickets(func(t *Ticket) bool { return !t.AssignedTo.Valid && !t.Status.IsFinal() }, true, 0)
+
+	s.mu.RLock()
+	rank := func(t Ticket) int {
+		if c := s.findCategory(t.Category); c != nil {
+			return c.DefaultPriority.rank()
+		}
+		return PriorityNormal.rank()
+	}
+	sort.SliceStable(tickets, func(i, j int) bool { return rank(tickets[i]) > rank(tickets[j]) })
+	s.mu.RUnlock()
+
+	if limit > 0 && len(tickets) > limit {
+		tickets = tickets[:limit]
+	}
+	return tickets, nil
+}
+
+func (s *MemoryStore) GetAgentTickets(agentID int64) ([]Ticket, error) {
+	return s.findTickets(func(t *Ticket) bool {
+		return t.AssignedTo.Valid && t.AssignedTo.Int64 == agentID && !t.Status.IsFinal()
+	}, true, 0), nil
+}
+
+func (s *MemoryStore) UpdateTicketStatus(ticketID int, status TicketStatus) error {
+	if !status.Valid() {
+		return fmt.Errorf("%w: %q", ErrUnknownStatus, status)
+	}
+
+	s.mu.Lock()
+	t, ok := s.tickets[ticketID]
+	if !ok {
+		s.mu.Unlock()
+		return fmt.Errorf("%w: #%d", ErrTicketNotFound, ticketID)
+	}
+	if t.Status == status {
+		s.mu.Unlock()
+		return nil
+	}
+	if !t.Status.CanTransitionTo(status) {
+		current := t.Status
+		s.mu.Unlock()
+		return fmt.Errorf("%w: #%d %q -> %q", ErrStatusTransition, ticketID, current, status)
+	}
+	t.Status = status
+	if status == StatusClosed {
+		t.ClosedAt = sql.NullTime{Time: time.Now(), Valid: true}
+	}
+	s.mu.Unlock()
+
+	fireTicketEventHooks()
+	return nil
+}
+
+func (s *MemoryStore) CloseTicket(ticketID int, userID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.tickets[ticketID]
+	if !ok || t.UserID != userID {
+		return fmt.Errorf("%w: #%d у пользователя %d", ErrTicketNotFound, ticketID, userID)
+	}
+	if !t.Status.CanTransitionTo(StatusClosed) {
+		return fmt.Errorf("%w: тикет #%d уже %s", ErrStatusTransition, ticketID, t.Status)
+	}
+	t.Status = StatusClosed
+	t.ClosedAt = sql.NullTime{Time: time.Now(), Valid: true}
+	return nil
+}
+
+func (s *MemoryStore) AssignTicket(ticketID int, agentID int64) error {
+	s.mu.Lock()
+	t, ok := s.tickets[ticketID]
+	if !ok || t.AssignedTo.Valid || t.Status.IsFinal() {
+		s.mu.Unlock()
+		return fmt.Errorf("тикет #%d уже взят в работу, закрыт или не существует", ticketID)
+	}
+	t.AssignedTo = sql.NullInt64{Int64: agentID, Valid: true}
+	if t.Status == StatusCreated {
+		t.Status = StatusAssigned
+	}
+	s.mu.Unlock()
+
+	fireTicketEventHooks()
+	return nil
+}
+
+func (s *MemoryStore) ListTickets(filter TicketFilter) ([]Ticket, int, error) {
+	tickets := s.findTickets(filter.match, false, 0)
+	total := len(tickets)
+	if filter.Offset >= total {
+		return nil, total, nil
+	}
+	tickets = tickets[filter.Offset:]
+	if filter.Limit > 0 && len(tickets) > filter.Limit {
+		tickets = tickets[:filter.Limit]
+	}
+	return tickets, total, nil
+}
+
+// findTickets возвращает копии тикетов, подходящих под условие, отсортированные по дате создания
+func (s *MemoryStore) findTickets(match func(t *Ticket) bool, oldestFirst bool, limit int) []Ticket {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var tickets []Ticket
+	for _, t := range s.tickets {
+		if match(t) {
+			tickets = append(tickets, *t)
+		}
+	}
+	// ID растет вместе с датой создания и различает тикеты, созданные в одну наносекунду
+	sort.Slice(tickets, func(i, j int) bool {
+		if oldestFirst {
+			return tickets[i].ID < tickets[j].ID
+		}
+		return tickets[i].ID > tickets[j].ID
+	})
+	if limit > 0 && len(tickets) > limit {
+		tickets = tickets[:limit]
+	}
+	return tickets
+}
+
+// Категории
+
+func (s *MemoryStore) ListCategories(activeOnly bool) ([]Category, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var categories []Category
+	for _, c := range s.categories {
+		if c.Active || !activeOnly {
+			categories = append(categories, c)
+		}
+	}
+	sort.SliceStable(categories, func(i, j int) bool {
+		if categories[i].SortOrder != categories[j].SortOrder {
+			return categories[i].SortOrder < categories[j].SortOrder
+		}
+		return categories[i].Name < categories[j].Name
+	})
+	return categories, nil
+}
+
+func (s *MemoryStore) GetCategory(code string) (*Category, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	c := s.findCategory(code)
+	if c == nil {
+		return nil, fmt.Errorf("%w: %q", ErrCategoryNotFound, code)
+	}
+	category := *c
+	return &category, nil
+}
+
+// SaveCategory создает категорию или обновляет категорию с тем же кодом
+func (s *MemoryStore) SaveCategory(c *Category) error {
+	if err := c.Validate(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if existing := s.findCategory(c.Code); existing != nil {
+		*existing = *c
+		return nil
+	}
+	s.categories = append(s.categories, *c)
+	return nil
+}
+
+// findCategory ищет категорию по коду; вызывается под s.mu
+func (s *MemoryStore) findCategory(code string) *Category {
+	for i := range s.categories {
+		if s.categories[i].Code == code {
+			return &s.categories[i]
+		}
+	}
+	return nil
+}
+
+// Сообщения
+
+func (s *MemoryStore) AddTicketMessage(message *TicketMessage) (int, error) {
+	s.mu.Lock()
+	if _, ok := s.tickets[message.TicketID]; !ok {
+		s.mu.Unlock()
+		return 0, fmt.Errorf("%w: #%d", ErrTicketNotFound, message.TicketID)
+	}
+	s.lastMessageID++
+	message.ID = s.lastMessageID
+	message.CreatedAt = time.Now()
+	s.messages = append(s.messages, *message)
+	s.mu.Unlock()
+
+	if message.SenderType != "user" {
+		fireTicketEventHooks()
+	}
+	return message.ID, nil
+}
+
+func (s *MemoryStore) GetTicketMessages(ticketID int) ([]TicketMessage, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var messages []TicketMessage
+	for _, m := range s.messages {
+		if m.TicketID == ticketID {
+			messages = append(messages, m)
+		}
+	}
+	return messages, nil
+}
+
+func (s *MemoryStore) ListTicketMessages(ticketID, limit, offset int) ([]TicketMessage, int, error) {
+	messages, _ := s.GetTicketMessages(ticketID)
+	total := len(messages)
+	if offset >= total {
+		return nil, total, nil
+	}
+	messages = messages[offset:]
+	if limit > 0 && len(messages) > limit {
+		messages = messages[:limit]
+	}
+	return messages, total, nil
+}
+
+func (s *MemoryStore) GetTicketMessageCount(ticketID int) (int, error) {
+	messages, err := s.GetTicketMessages(ticketID)
+	return len(messages), err
+}
+
+func (s *MemoryStore) GetTicketMessageByID(messageID int) (*TicketMessage, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, m := range s.messages {
+		if m.ID == messageID {
+			message := m
+			return &message, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+// Вложения
+
+func (s *MemoryStore) AddTicketAttachment(attachment *TicketAttachment) (int, error) {
+	if !attachment.Kind.Valid() {
+		return 0, fmt.Errorf("неизвестный тип вложения: %s", attachment.Kind)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.tickets[attachment.TicketID]; !ok {
+		return 0, fmt.Errorf("%w: #%d", ErrTicketNotFound, attachment.TicketID)
+	}
+	s.lastAttachmentID++
+	stored := *attachment
+	stored.ID = s.lastAttachmentID
+	stored.CreatedAt = time.Now()
+	s.attachments = append(s.attachments, stored)
+	return stored.ID, nil
+}
+
+func (s *MemoryStore) GetTicketAttachments(ticketID int) ([]TicketAttachment, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var attachments []TicketAttachment
+	for _, a := range s.attachments {
+		if a.TicketID == ticketID {
+			attachments = append(attachments, a)
+		}
+	}
+	return attachments, nil
+}
+
+func (s *MemoryStore) UpdateTicketAttachmentFileID(attachmentID int, fileID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.attachments {
+		if s.attachments[i].ID == attachmentID {
+			s.attachments[i].FileID = fileID
+		}
+	}
+	return nil
+}
@@ -0,0 +1,268 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Миграции схемы БД встроены в бинарник. Файлы называются
+// <версия>_<название>.up.sql и <версия>_<название>.down.sql.
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// Ключ advisory lock, под которым выполняются миграции.
+// Не дает нескольким репликам бота применять миграции одновременно.
+const migrationLockKey = 0x5375707042 // "SuppB"
+
+// Migration описывает одну версию схемы
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationState - миграция и отметка о ее применении
+type MigrationState struct {
+	Migration
+	Applied   bool
+	AppliedAt sql.NullTime
+}
+
+// LoadMigrations читает встроенные миграции, отсортированные по версии
+func LoadMigrations() ([]Migration, error) {
+	entries, err := fs.ReadDir(migrationFiles, "migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		fileName := entry.Name()
+		base := strings.TrimSuffix(fileName, ".sql")
+		direction := base[strings.LastIndex(base, ".")+1:]
+		base = strings.TrimSuffix(base, "."+direction)
+		if direction != "up" && direction != "down" {
+			return nil, fmt.Errorf("миграция %s: ожидается суффикс .up.sql или .down.sql", fileName)
+		}
+
+		sep := strings.Index(base, "_")
+		if sep <= 0 {
+			return nil, fmt.Errorf("миграция %s: ожидается имя вида <версия>_<название>", fileName)
+		}
+		version, err := strconv.Atoi(base[:sep])
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("миграция %s: некорректная версия", fileName)
+		}
+
+		content, err := migrationFiles.ReadFile("migrations/" + fileName)
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: base[sep+1:]}
+			byVersion[version] = m
+		} else if m.Name != base[sep+1:] {
+			return nil, fmt.Errorf("миграция %s: версия %d уже занята миграцией %s", fileName, version, m.Name)
+		}
+		if direction == "up" {
+			m.Up = string(content)
+		} else {
+			m.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("миграция %04d_%s: нужны оба файла, up и down", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// MigrateUp применяет все неприменённые миграции и возвращает их список
+func MigrateUp() ([]Migration, error) {
+	var applied []Migration
+	err := withMigrationLock(func(conn *sql.Conn) error {
+		states, err := migrationStates(conn)
+		if err != nil {
+			return err
+		}
+		for _, state := range states {
+			if state.Applied {
+				continue
+			}
+			if err := applyMigration(conn, state.Migration, true); err != nil {
+				return err
+			}
+			applied = append(applied, state.Migration)
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// MigrateDown откатывает последние steps примененных миграций и возвращает их список
+func MigrateDown(steps int) ([]Migration, error) {
+	var reverted []Migration
+	err := withMigrationLock(func(conn *sql.Conn) error {
+		states, err := migrationStates(conn)
+		if err != nil {
+			return err
+		}
+		for i := len(states) - 1; i >= 0 && len(reverted) < steps; i-- {
+			if !states[i].Applied {
+				continue
+			}
+			if err := applyMigration(conn, states[i].Migration, false); err != nil {
+				return err
+			}
+			reverted = append(reverted, states[i].Migration)
+		}
+		return nil
+	})
+	return reverted, err
+}
+
+// GetMigrationStates возвращает все миграции с отметкой о применении
+func GetMigrationStates() ([]MigrationState, error) {
+	var states []MigrationState
+	err := withMigrationLock(func(conn *sql.Conn) error {
+		var err error
+		states, err = migrationStates(conn)
+		return err
+	})
+	return states, err
+}
+
+// PendingMigrations возвращает миграции, которые еще не применены к базе
+func PendingMigrations() ([]Migration, error) {
+	states, err := GetMigrationStates()
+	if err != nil {
+		return nil, err
+	}
+	var pending []Migration
+	for _, state := range states {
+		if !state.Applied {
+			pending = append(pending, state.Migration)
+		}
+	}
+	return pending, nil
+}
+
+// withMigrationLock выполняет fn на отдельном соединении под advisory lock
+func withMigrationLock(fn func(conn *sql.Conn) error) error {
+	ctx := context.Background()
+	conn, err := DB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", migrationLockKey); err != nil {
+		return fmt.Errorf("ошибка при получении блокировки миграций: %v", err)
+	}
+	defer conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", migrationLockKey)
+
+	_, err = conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	)`)
+	if err != nil {
+		return fmt.Errorf("ошибка при создании таблицы schema_migrations: %v", err)
+	}
+
+	return fn(conn)
+}
+
+// migrationStates сопоставляет встроенные миграции с записями schema_migrations
+func migrationStates(conn *sql.Conn) ([]MigrationState, error) {
+	migrations, err := LoadMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := conn.QueryContext(context.Background(), "SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	appliedAt := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var at time.Time
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, err
+		}
+		appliedAt[version] = at
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	states := make([]MigrationState, 0, len(migrations))
+	for _, m := range migrations {
+		state := MigrationState{Migration: m}
+		if at, ok := appliedAt[m.Version]; ok {
+			state.Applied = true
+			state.AppliedAt = sql.NullTime{Time: at, Valid: true}
+			delete(appliedAt, m.Version)
+		}
+		states = append(states, state)
+	}
+
+	// База новее бинарника - старая версия не должна трогать схему
+	if len(appliedAt) > 0 {
+		unknown := make([]int, 0, len(appliedAt))
+		for version := range appliedAt {
+			unknown = append(unknown, version)
+		}
+		sort.Ints(unknown)
+		return nil, fmt.Errorf("в базе применены неизвестные миграции %v, обновите бота", unknown)
+	}
+	return states, nil
+}
+
+// applyMigration применяет (up) или откатывает (down) миграцию в одной транзакции
+func applyMigration(conn *sql.Conn, m Migration, up bool) error {
+	ctx := context.Background()
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	script := m.Up
+	if !up {
+		script = m.Down
+	}
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		return fmt.Errorf("миграция %04d_%s: %v", m.Version, m.Name, err)
+	}
+
+	if up {
+		_, err = tx.ExecContext(ctx, "INSERT INTO schema_migrations (version, name) VALUES ($1, $2)", m.Version, m.Name)
+	} else {
+		_, err = tx.ExecContext(ctx, "DELETE FROM schema_migrations WHERE version = $1", m.Version)
+	}
+	if err != nil {
+		return fmt.Errorf("миграция %04d_%s: ошибка при записи в schema_migrations: %v", m.Version, m.Name, err)
+	}
+
+	return tx.Commit()
+}
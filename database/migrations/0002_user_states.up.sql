@@ -0,0 +1,8 @@
+-- Состояния диалогов пользователей (state_store.backend = "postgres")
+CREATE TABLE IF NOT EXISTS user_states (
+    user_id BIGINT PRIMARY KEY,
+    state JSONB NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_states_updated_at ON user_states(updated_at);
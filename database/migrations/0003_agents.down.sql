@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_tickets_assigned_to;
+ALTER TABLE tickets DROP COLUMN IF EXISTS assigned_to;
+ALTER TABLE users DROP COLUMN IF EXISTS role;
@@ -0,0 +1,4 @@
+-- Роли пользователей и назначение тикетов агентам поддержки
+ALTER TABLE users ADD COLUMN IF NOT EXISTS role TEXT NOT NULL DEFAULT 'user' CHECK (role IN ('user', 'agent'));
+ALTER TABLE tickets ADD COLUMN IF NOT EXISTS assigned_to BIGINT REFERENCES users(id);
+CREATE INDEX IF NOT EXISTS idx_tickets_assigned_to ON tickets(assigned_to);
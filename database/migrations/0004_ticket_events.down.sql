@@ -0,0 +1,5 @@
+DROP TRIGGER IF EXISTS trg_ticket_status_event ON tickets;
+DROP TRIGGER IF EXISTS trg_ticket_message_event ON ticket_messages;
+DROP FUNCTION IF EXISTS ticket_status_event();
+DROP FUNCTION IF EXISTS ticket_message_event();
+DROP TABLE IF EXISTS ticket_events;
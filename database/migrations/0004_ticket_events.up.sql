@@ -0,0 +1,52 @@
+-- События тикетов для уведомлений пользователей (ответы поддержки и смена статуса).
+-- Заполняются триггерами, поэтому учитываются и записи внешних инструментов.
+CREATE TABLE IF NOT EXISTS ticket_events (
+    id BIGSERIAL PRIMARY KEY,
+    ticket_id INTEGER NOT NULL REFERENCES tickets(id) ON DELETE CASCADE,
+    kind TEXT NOT NULL CHECK (kind IN ('support_message', 'status_changed')),
+    message_id INTEGER REFERENCES ticket_messages(id) ON DELETE CASCADE,
+    old_status TEXT,
+    new_status TEXT,
+    status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'sending', 'delivered', 'skipped', 'failed')),
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    claimed_at TIMESTAMPTZ,
+    delivered_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_ticket_events_pending ON ticket_events(id) WHERE status IN ('pending', 'sending');
+
+CREATE OR REPLACE FUNCTION ticket_message_event() RETURNS trigger AS $$
+DECLARE
+    event_id BIGINT;
+BEGIN
+    INSERT INTO ticket_events (ticket_id, kind, message_id)
+    VALUES (NEW.ticket_id, 'support_message', NEW.id)
+    RETURNING id INTO event_id;
+    PERFORM pg_notify('ticket_events', event_id::text);
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS trg_ticket_message_event ON ticket_messages;
+CREATE TRIGGER trg_ticket_message_event AFTER INSERT ON ticket_messages
+    FOR EACH ROW WHEN (NEW.sender_type <> 'user') EXECUTE FUNCTION ticket_message_event();
+
+CREATE OR REPLACE FUNCTION ticket_status_event() RETURNS trigger AS $$
+DECLARE
+    event_id BIGINT;
+BEGIN
+    INSERT INTO ticket_events (ticket_id, kind, old_status, new_status)
+    VALUES (NEW.id, 'status_changed', OLD.status, NEW.status)
+    RETURNING id INTO event_id;
+    PERFORM pg_notify('ticket_events', event_id::text);
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Переход в "ожидает действий поддержки" вызывает сам пользователь, уведомлять о нем не нужно
+DROP TRIGGER IF EXISTS trg_ticket_status_event ON tickets;
+CREATE TRIGGER trg_ticket_status_event AFTER UPDATE OF status ON tickets
+    FOR EACH ROW WHEN (OLD.status IS DISTINCT FROM NEW.status AND NEW.status <> 'ожидает действий поддержки')
+    EXECUTE FUNCTION ticket_status_event();
@@ -0,0 +1,2 @@
+-- Исходные значения статусов не сохраняются, откатывается только ограничение
+ALTER TABLE tickets DROP CONSTRAINT IF EXISTS tickets_status_check;
@@ -0,0 +1,37 @@
+-- Нормализация статусов тикетов: старые версии бота писали значения вне списка
+-- ('open', 'ожидает ответа', 'Ожидает действий поддержки' и т.п.). Приводим их
+-- к каноническому списку (см. database/status.go) без уведомления пользователей.
+ALTER TABLE tickets DROP CONSTRAINT IF EXISTS tickets_status_check;
+ALTER TABLE tickets DISABLE TRIGGER trg_ticket_status_event;
+
+UPDATE tickets SET status = CASE lower(btrim(status))
+    WHEN 'создан' THEN 'создан'
+    WHEN 'open' THEN 'создан'
+    WHEN 'new' THEN 'создан'
+    WHEN 'created' THEN 'создан'
+    WHEN 'назначен' THEN 'назначен'
+    WHEN 'assigned' THEN 'назначен'
+    WHEN 'в работе' THEN 'в работе'
+    WHEN 'in_progress' THEN 'в работе'
+    WHEN 'ожидает ответа пользователя' THEN 'ожидает ответа пользователя'
+    WHEN 'waiting_user' THEN 'ожидает ответа пользователя'
+    WHEN 'ожидает действий поддержки' THEN 'ожидает действий поддержки'
+    WHEN 'ожидает ответа' THEN 'ожидает действий поддержки'
+    WHEN 'waiting_support' THEN 'ожидает действий поддержки'
+    WHEN 'закрыт' THEN 'закрыт'
+    WHEN 'closed' THEN 'закрыт'
+    WHEN 'resolved' THEN 'закрыт'
+    WHEN 'отменён' THEN 'отменён'
+    WHEN 'отменен' THEN 'отменён'
+    WHEN 'cancelled' THEN 'отменён'
+    WHEN 'canceled' THEN 'отменён'
+    -- Неизвестные значения отдаем поддержке на разбор
+    ELSE 'ожидает действий поддержки'
+END
+WHERE status NOT IN ('создан', 'назначен', 'в работе', 'ожидает ответа пользователя', 'ожидает действий поддержки', 'закрыт', 'отменён');
+
+UPDATE tickets SET closed_at = created_at WHERE status = 'закрыт' AND closed_at IS NULL;
+
+ALTER TABLE tickets ENABLE TRIGGER trg_ticket_status_event;
+ALTER TABLE tickets ADD CONSTRAINT tickets_status_check
+    CHECK (status IN ('создан', 'назначен', 'в работе', 'ожидает ответа пользователя', 'ожидает действий поддержки', 'закрыт', 'отменён'));
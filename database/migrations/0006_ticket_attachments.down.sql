@@ -0,0 +1,22 @@
+CREATE TABLE IF NOT EXISTS ticket_photos (
+    id SERIAL PRIMARY KEY,
+    ticket_id INTEGER NOT NULL REFERENCES tickets(id) ON DELETE CASCADE,
+    sender_type VARCHAR(10) NOT NULL CHECK (sender_type IN ('user', 'support')),
+    sender_id BIGINT NOT NULL,
+    file_path VARCHAR(255) NOT NULL,
+    file_id VARCHAR(255) NOT NULL,
+    message_id INTEGER REFERENCES ticket_messages(id),
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_ticket_photos_ticket_id ON ticket_photos(ticket_id);
+CREATE INDEX IF NOT EXISTS idx_ticket_photos_ticket_id_created ON ticket_photos(ticket_id, created_at);
+
+-- Остальные типы вложений в старой схеме не представимы и теряются
+INSERT INTO ticket_photos (ticket_id, sender_type, sender_id, file_path, file_id, message_id, created_at)
+SELECT ticket_id, sender_type, sender_id, file_path, file_id, message_id, created_at
+FROM ticket_attachments
+WHERE kind = 'photo'
+ORDER BY id;
+
+DROP TABLE ticket_attachments;
@@ -0,0 +1,25 @@
+-- Вложения тикетов любых типов (фото, документы, голосовые, видео, аудио) вместо ticket_photos
+CREATE TABLE IF NOT EXISTS ticket_attachments (
+    id SERIAL PRIMARY KEY,
+    ticket_id INTEGER NOT NULL REFERENCES tickets(id) ON DELETE CASCADE,
+    kind VARCHAR(16) NOT NULL CHECK (kind IN ('photo', 'document', 'voice', 'video', 'video_note', 'audio')),
+    sender_type VARCHAR(10) NOT NULL CHECK (sender_type IN ('user', 'support')),
+    sender_id BIGINT NOT NULL,
+    file_path VARCHAR(255) NOT NULL,
+    file_id VARCHAR(255) NOT NULL,
+    mime_type VARCHAR(255) NOT NULL DEFAULT '',
+    file_size BIGINT NOT NULL DEFAULT 0,
+    file_name VARCHAR(255) NOT NULL DEFAULT '',
+    message_id INTEGER REFERENCES ticket_messages(id),
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_ticket_attachments_ticket_id_created ON ticket_attachments(ticket_id, created_at);
+
+-- Переносим существующие фотографии
+INSERT INTO ticket_attachments (ticket_id, kind, sender_type, sender_id, file_path, file_id, mime_type, message_id, created_at)
+SELECT ticket_id, 'photo', sender_type, sender_id, file_path, file_id, 'image/jpeg', message_id, created_at
+FROM ticket_photos
+ORDER BY id;
+
+DROP TABLE ticket_photos;
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS storage_objects;
+
+-- Перенесенные строки продолжат содержать ключи хранилища, а не пути к файлам
+ALTER TABLE ticket_attachments RENAME COLUMN storage_key TO file_path;
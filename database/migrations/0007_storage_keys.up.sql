@@ -0,0 +1,13 @@
+-- Вложения ссылаются на объекты хранилища по ключу, а не по пути в файловой системе.
+-- Строки со старыми путями переносит команда "supportbot storage migrate".
+ALTER TABLE ticket_attachments RENAME COLUMN file_path TO storage_key;
+ALTER TABLE ticket_attachments ALTER COLUMN storage_key TYPE TEXT;
+
+-- Объекты хранилища с backend = "database"
+CREATE TABLE IF NOT EXISTS storage_objects (
+    key TEXT PRIMARY KEY,
+    content_type TEXT NOT NULL DEFAULT '',
+    size BIGINT NOT NULL,
+    data BYTEA NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
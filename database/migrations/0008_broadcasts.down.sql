@@ -0,0 +1,3 @@
+ALTER TABLE users DROP COLUMN IF EXISTS bot_blocked_at;
+DROP TABLE IF EXISTS broadcast_recipients;
+DROP TABLE IF EXISTS broadcasts;
@@ -0,0 +1,33 @@
+-- Рассылки операторов всем пользователям или сегменту (см. database/broadcasts.go)
+CREATE TABLE IF NOT EXISTS broadcasts (
+    id BIGSERIAL PRIMARY KEY,
+    text TEXT NOT NULL,
+    parse_mode TEXT NOT NULL DEFAULT '',
+    -- Аудитория: условия объединяются через И, пустые условия не ограничивают выборку
+    audience_open_tickets BOOLEAN NOT NULL DEFAULT FALSE,
+    audience_category TEXT NOT NULL DEFAULT '',
+    audience_registered_after TIMESTAMPTZ,
+    status TEXT NOT NULL DEFAULT 'draft' CHECK (status IN ('draft', 'running', 'paused', 'completed', 'cancelled')),
+    created_by TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    started_at TIMESTAMPTZ,
+    finished_at TIMESTAMPTZ
+);
+
+-- Получатели фиксируются при создании рассылки, у каждого свой статус доставки
+CREATE TABLE IF NOT EXISTS broadcast_recipients (
+    broadcast_id BIGINT NOT NULL REFERENCES broadcasts(id) ON DELETE CASCADE,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'sending', 'sent', 'blocked', 'failed')),
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT,
+    claimed_at TIMESTAMPTZ,
+    sent_at TIMESTAMPTZ,
+    PRIMARY KEY (broadcast_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_broadcast_recipients_pending
+    ON broadcast_recipients(broadcast_id, user_id) WHERE status IN ('pending', 'sending');
+
+-- Момент, когда пользователь заблокировал бота (Telegram ответил 403); сбрасывается по /start
+ALTER TABLE users ADD COLUMN IF NOT EXISTS bot_blocked_at TIMESTAMPTZ;
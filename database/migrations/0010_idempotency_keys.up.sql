@@ -0,0 +1,13 @@
+-- Ключи идемпотентности внешних эндпоинтов (см. database/idempotency.go): повтор запроса
+-- с тем же ключом возвращает сохраненный ответ вместо повторного выполнения
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    scope TEXT NOT NULL,
+    key TEXT NOT NULL,
+    request_hash TEXT NOT NULL,
+    status_code INTEGER, -- NULL, пока запрос выполняется
+    response BYTEA,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (scope, key)
+);
+
+CREATE INDEX IF NOT EXISTS idx_idempotency_keys_created_at ON idempotency_keys(created_at);
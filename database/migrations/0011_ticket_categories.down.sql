@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_tickets_category;
+ALTER TABLE tickets DROP CONSTRAINT IF EXISTS tickets_category_fkey;
+ALTER TABLE tickets ALTER COLUMN category SET DEFAULT 'спросить';
+DROP TABLE IF EXISTS ticket_categories;
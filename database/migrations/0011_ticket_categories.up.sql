@@ -0,0 +1,32 @@
+-- Справочник категорий тикетов: из него строится клавиатура выбора категории,
+-- заголовки тикетов и названия категорий в сообщениях бота.
+CREATE TABLE IF NOT EXISTS ticket_categories (
+    code TEXT PRIMARY KEY,
+    name TEXT NOT NULL,
+    emoji TEXT NOT NULL DEFAULT '',
+    title_prefix TEXT NOT NULL DEFAULT '',
+    default_priority TEXT NOT NULL DEFAULT 'normal' CHECK (default_priority IN ('low', 'normal', 'high', 'urgent')),
+    routing_group TEXT NOT NULL DEFAULT '',
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    sort_order INTEGER NOT NULL DEFAULT 0
+);
+
+INSERT INTO ticket_categories (code, name, emoji, title_prefix, default_priority, sort_order) VALUES
+    ('вопрос', 'Вопрос', '💭', 'Вопрос', 'normal', 10),
+    ('важно,срочно', 'Важно,Срочно', '🚨', 'Срочно', 'urgent', 20),
+    ('финансы', 'Финансы', '💰', 'Финансы', 'high', 30)
+ON CONFLICT (code) DO NOTHING;
+
+-- 'спросить' - значение по умолчанию из первой версии схемы, ботом не использовалось
+UPDATE tickets SET category = 'вопрос' WHERE category = 'спросить';
+ALTER TABLE tickets ALTER COLUMN category SET DEFAULT 'вопрос';
+
+-- Прочие категории существующих тикетов сохраняем неактивными, чтобы их можно было переименовать
+INSERT INTO ticket_categories (code, name, title_prefix, active)
+SELECT DISTINCT category, category, category, FALSE FROM tickets
+ON CONFLICT (code) DO NOTHING;
+
+ALTER TABLE tickets DROP CONSTRAINT IF EXISTS tickets_category_fkey;
+ALTER TABLE tickets ADD CONSTRAINT tickets_category_fkey
+    FOREIGN KEY (category) REFERENCES ticket_categories(code) ON UPDATE CASCADE;
+CREATE INDEX IF NOT EXISTS idx_tickets_category ON tickets(category);
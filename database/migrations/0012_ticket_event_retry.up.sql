@@ -0,0 +1,2 @@
+-- Повторная доставка уведомлений с нарастающей задержкой: событие не захватывается раньше next_attempt_at
+ALTER TABLE ticket_events ADD COLUMN IF NOT EXISTS next_attempt_at TIMESTAMPTZ;
@@ -0,0 +1,194 @@
+package database
+
+// UserRepository - хранилище пользователей и их ролей
+type UserRepository interface {
+	CreateUser(userID int64) error
+	GetUserByID(userID int64) (*User, error)
+	IsUserRegistered(userID int64) (bool, error)
+	UpdateUserRegistration(user *User) error
+	UpdateUserAvatar(userID int64, hasAvatar bool) error
+	GetUserNameByID(userID int64) (string, error)
+	GetUserRole(userID int64) (string, error)
+	IsAgent(userID int64) (bool, error)
+	SetUserRole(userID int64, role string) error
+	SetUserBlocked(userID int64, blocked bool) error
+}
+
+// TicketRepository - хранилище тикетов
+type TicketRepository interface {
+	CreateTicket(ticket *Ticket) (int, error)
+	GetTicketByID(ticketID int) (*Ticket, error)
+	GetActiveTicketsByUserID(userID int64) ([]Ticket, error)
+	GetTicketHistory(userID int64) ([]Ticket, error)
+	UpdateTicketStatus(ticketID int, status TicketStatus) error
+	CloseTicket(ticketID int, userID int64) error
+	GetTicketQueue(limit int) ([]Ticket, error)
+	GetAgentTickets(agentID int64) ([]Ticket, error)
+	AssignTicket(ticketID int, agentID int64) error
+	ListTickets(filter TicketFilter) ([]Ticket, int, error)
+}
+
+// MessageRepository - хранилище сообщений тикетов
+type MessageRepository interface {
+	AddTicketMessage(message *TicketMessage) (int, error)
+	GetTicketMessages(ticketID int) ([]TicketMessage, error)
+	ListTicketMessages(ticketID, limit, offset int) ([]TicketMessage, int, error)
+	GetTicketMessageCount(ticketID int) (int, error)
+	GetTicketMessageByID(messageID int) (*TicketMessage, error)
+}
+
+// AttachmentRepository - хранилище вложений тикетов
+type AttachmentRepository interface {
+	AddTicketAttachment(attachment *TicketAttachment) (int, error)
+	GetTicketAttachments(ticketID int) ([]TicketAttachment, error)
+	UpdateTicketAttachmentFileID(attachmentID int, fileID string) error
+}
+
+// CategoryRepository - справочник категорий тикетов
+type CategoryRepository interface {
+	ListCategories(activeOnly bool) ([]Category, error)
+	GetCategory(code string) (*Category, error)
+}
+
+// PostgresStore реализует все репозитории поверх PostgreSQL.
+// Методы используют соединение DB, открытое через ConnectDBOptimized.
+type PostgresStore struct{}
+
+// NewPostgresStore создает хранилище на PostgreSQL
+func NewPostgresStore() *PostgresStore {
+	return &PostgresStore{}
+}
+
+func (PostgresStore) CreateUser(userID int64) error {
+	return CreateUser(userID)
+}
+
+func (PostgresStore) GetUserByID(userID int64) (*User, error) {
+	return GetUserByID(userID)
+}
+
+func (PostgresStore) IsUserRegistered(userID int64) (bool, error) {
+	return IsUserRegistered(userID)
+}
+
+func (PostgresStore) UpdateUserRegistration(user *User) error {
+	return UpdateUserRegistration(user)
+}
+
+func (PostgresStore) GetUserNameByID(userID int64) (string, error) {
+	return GetUserNameByID(userID)
+}
+
+func (PostgresStore) GetUserRole(userID int64) (string, error) {
+	return GetUserRole(userID)
+}
+
+func (PostgresStore) IsAgent(userID int64) (bool, error) {
+	return IsAgent(userID)
+}
+
+func (PostgresStore) SetUserRole(userID int64, role string) error {
+	return SetUserRole(userID, role)
+}
+
+func (PostgresStore) UpdateUserAvatar(userID int64, hasAvatar bool) error {
+	return UpdateUserAvatar(userID, hasAvatar)
+}
+
+func (PostgresStore) SetUserBlocked(userID int64, blocked bool) error {
+	return SetUserBlocked(userID, blocked)
+}
+
+func (PostgresStore) CreateTicket(ticket *Ticket) (int, error) {
+	return CreateTicket(ticket)
+}
+
+func (PostgresStore) GetTicketByID(ticketID int) (*Ticket, error) {
+	return GetTicketByID(ticketID)
+}
+
+func (PostgresStore) GetTicketHistory(userID int64) ([]Ticket, error) {
+	return GetTicketHistory(userID)
+}
+
+func (PostgresStore) CloseTicket(ticketID int, userID int64) error {
+	return CloseTicket(ticketID, userID)
+}
+
+func (PostgresStore) GetTicketQueue(limit int) ([]Ticket, error) {
+	return GetTicketQueue(limit)
+}
+
+func (PostgresStore) GetAgentTickets(agentID int64) ([]Ticket, error) {
+	return GetAgentTickets(agentID)
+}
+
+func (PostgresStore) AssignTicket(ticketID int, agentID int64) error {
+	return AssignTicket(ticketID, agentID)
+}
+
+func (PostgresStore) ListTickets(filter TicketFilter) ([]Ticket, int, error) {
+	return ListTickets(filter)
+}
+
+func (PostgresStore) GetActiveTicketsByUserID(userID int64) ([]Ticket, error) {
+	return GetActiveTicketsByUserID(userID)
+}
+
+func (PostgresStore) UpdateTicketStatus(ticketID int, status TicketStatus) error {
+	return UpdateTicketStatus(ticketID, status)
+}
+
+func (PostgresStore) AddTicketMessage(message *TicketMessage) (int, error) {
+	return AddTicketMessage(message)
+}
+
+func (PostgresStore) GetTicketMessages(ticketID int) ([]TicketMessage, error) {
+	return GetTicketMessages(ticketID)
+}
+
+func (PostgresStore) ListTicketMessages(ticketID, limit, offset int) ([]TicketMessage, int, error) {
+	return ListTicketMessages(ticketID, limit, offset)
+}
+
+func (PostgresStore) GetTicketMessageCount(ticketID int) (int, error) {
+	return GetTicketMessageCount(ticketID)
+}
+
+func (PostgresStore) GetTicketMessageByID(messageID int) (*TicketMessage, error) {
+	return GetTicketMessageByID(messageID)
+}
+
+func (PostgresStore) AddTicketAttachment(attachment *TicketAttachment) (int, error) {
+	return AddTicketAttachment(attachment)
+}
+
+func (PostgresStore) GetTicketAttachments(ticketID int) ([]TicketAttachment, error) {
+	return GetTicketAttachments(ticketID)
+}
+
+func (PostgresStore) UpdateTicketAttachmentFileID(attachmentID int, fileID string) error {
+	return UpdateTicketAttachmentFileID(attachmentID, fileID)
+}
+
+func (PostgresStore) ListCategories(activeOnly bool) ([]Category, error) {
+	return ListCategories(activeOnly)
+}
+
+func (PostgresStore) GetCategory(code string) (*Category, error) {
+	return GetCategory(code)
+}
+
+// Проверяем, что обе реализации удовлетворяют всем интерфейсам
+var (
+	_ UserRepository       = (*PostgresStore)(nil)
+	_ TicketRepository     = (*PostgresStore)(nil)
+	_ MessageRepository    = (*PostgresStore)(nil)
+	_ AttachmentRepository = (*PostgresStore)(nil)
+	_ CategoryRepository   = (*PostgresStore)(nil)
+	_ UserRepository       = (*MemoryStore)(nil)
+	_ TicketRepository     = (*MemoryStore)(nil)
+	_ MessageRepository    = (*MemoryStore)(nil)
+	_ AttachmentRepository = (*MemoryStore)(nil)
+	_ CategoryRepository   = (*MemoryStore)(nil)
+)
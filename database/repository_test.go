@@ -0,0 +1,255 @@
+package database
+
+import (
+	"errors"
+	"testing"
+)
+
+// repositoryStore - все репозитории одного хранилища
+type repositoryStore interface {
+	UserRepository
+	TicketRepository
+	MessageRepository
+	AttachmentRepository
+	CategoryRepository
+}
+
+// testRepositories проверяет поведение, общее для PostgresStore и MemoryStore.
+// newStore должен возвращать пустое хранилище с категориями по умолчанию.
+func testRepositories(t *testing.T, newStore func(t *testing.T) repositoryStore) {
+	// newTicket создает пользователя и его тикет в категории "вопрос"
+	newTicket := func(t *testing.T, store repositoryStore, userID int64) int {
+		t.Helper()
+		if err := store.CreateUser(userID); err != nil {
+			t.Fatalf("CreateUser: %v", err)
+		}
+		id, err := store.CreateTicket(&Ticket{UserID: userID, Title: "Вопрос: тест", Description: "описание", Category: "вопрос"})
+		if err != nil {
+			t.Fatalf("CreateTicket: %v", err)
+		}
+		return id
+	}
+
+	t.Run("registration", func(t *testing.T) {
+		store := newStore(t)
+		if err := store.CreateUser(1); err != nil {
+			t.Fatalf("CreateUser: %v", err)
+		}
+		if err := store.CreateUser(1); err != nil {
+			t.Fatalf("повторный CreateUser: %v", err)
+		}
+		if registered, _ := store.IsUserRegistered(1); registered {
+			t.Fatal("пользователь зарегистрирован до заполнения анкеты")
+		}
+
+		err := store.UpdateUserRegistration(&User{ID: 1, FullName: "Иван Петров", Phone: "+79990000000", IsRegistered: true})
+		if err != nil {
+			t.Fatalf("UpdateUserRegistration: %v", err)
+		}
+		if registered, _ := store.IsUserRegistered(1); !registered {
+			t.Fatal("пользователь не зарегистрирован после заполнения анкеты")
+		}
+		if name, _ := store.GetUserNameByID(1); name != "Иван Петров" {
+			t.Fatalf("GetUserNameByID = %q", name)
+		}
+	})
+
+	t.Run("create ticket", func(t *testing.T) {
+		store := newStore(t)
+		id := newTicket(t, store, 1)
+		ticket, err := store.GetTicketByID(id)
+		if err != nil {
+			t.Fatalf("GetTicketByID: %v", err)
+		}
+		if ticket.Status != StatusCreated || ticket.Category != "вопрос" || ticket.ClosedAt.Valid {
+			t.Fatalf("новый тикет: %+v", ticket)
+		}
+
+		_, err = store.CreateTicket(&Ticket{UserID: 1, Title: "t", Category: "нет такой"})
+		if !errors.Is(err, ErrCategoryNotFound) {
+			t.Fatalf("неизвестная категория: %v", err)
+		}
+		_, err = store.CreateTicket(&Ticket{UserID: 1, Title: "t", Category: "вопрос", Status: "open"})
+		if !errors.Is(err, ErrUnknownStatus) {
+			t.Fatalf("неизвестный статус: %v", err)
+		}
+	})
+
+	t.Run("close ticket", func(t *testing.T) {
+		store := newStore(t)
+		id := newTicket(t, store, 1)
+
+		if err := store.CloseTicket(id, 2); !errors.Is(err, ErrTicketNotFound) {
+			t.Fatalf("закрытие чужого тикета: %v", err)
+		}
+		if err := store.CloseTicket(id+100, 1); !errors.Is(err, ErrTicketNotFound) {
+			t.Fatalf("закрытие несуществующего тикета: %v", err)
+		}
+
+		if err := store.CloseTicket(id, 1); err != nil {
+			t.Fatalf("CloseTicket: %v", err)
+		}
+		closed, _ := store.GetTicketByID(id)
+		if closed.Status != StatusClosed || !closed.ClosedAt.Valid {
+			t.Fatalf("закрытый тикет: %+v", closed)
+		}
+
+		if err := store.CloseTicket(id, 1); !errors.Is(err, ErrStatusTransition) {
+			t.Fatalf("повторное закрытие: %v", err)
+		}
+		again, _ := store.GetTicketByID(id)
+		if !again.ClosedAt.Time.Equal(closed.ClosedAt.Time) {
+			t.Fatal("повторное закрытие изменило closed_at")
+		}
+	})
+
+	t.Run("cancelled ticket cannot be closed", func(t *testing.T) {
+		store := newStore(t)
+		id := newTicket(t, store, 1)
+		if err := store.UpdateTicketStatus(id, StatusCancelled); err != nil {
+			t.Fatalf("UpdateTicketStatus: %v", err)
+		}
+		if err := store.CloseTicket(id, 1); !errors.Is(err, ErrStatusTransition) {
+			t.Fatalf("закрытие отмененного тикета: %v", err)
+		}
+		if ticket, _ := store.GetTicketByID(id); ticket.Status != StatusCancelled || ticket.ClosedAt.Valid {
+			t.Fatalf("отмененный тикет изменился: %+v", ticket)
+		}
+	})
+
+	t.Run("status transitions", func(t *testing.T) {
+		store := newStore(t)
+		id := newTicket(t, store, 1)
+
+		if err := store.UpdateTicketStatus(id, "нет такого"); !errors.Is(err, ErrUnknownStatus) {
+			t.Fatalf("неизвестный статус: %v", err)
+		}
+		if err := store.UpdateTicketStatus(id+100, StatusInProgress); !errors.Is(err, ErrTicketNotFound) {
+			t.Fatalf("несуществующий тикет: %v", err)
+		}
+		if err := store.UpdateTicketStatus(id, StatusCreated); err != nil {
+			t.Fatalf("тот же статус: %v", err)
+		}
+		if err := store.UpdateTicketStatus(id, StatusClosed); err != nil {
+			t.Fatalf("закрытие поддержкой: %v", err)
+		}
+		if err := store.UpdateTicketStatus(id, StatusInProgress); !errors.Is(err, ErrStatusTransition) {
+			t.Fatalf("переход из закрытого: %v", err)
+		}
+	})
+
+	t.Run("assign and queue", func(t *testing.T) {
+		store := newStore(t)
+		question := newTicket(t, store, 1)
+		urgent, err := store.CreateTicket(&Ticket{UserID: 1, Title: "Срочно: тест", Description: "описание", Category: "важно,срочно"})
+		if err != nil {
+			t.Fatalf("CreateTicket: %v", err)
+		}
+
+		queue, _ := store.GetTicketQueue(10)
+		if len(queue) != 2 || queue[0].ID != urgent || queue[1].ID != question {
+			t.Fatalf("очередь не начинается со срочного тикета: %+v", queue)
+		}
+
+		if err := store.CreateUser(100); err != nil {
+			t.Fatalf("CreateUser: %v", err)
+		}
+		if err := store.AssignTicket(urgent, 100); err != nil {
+			t.Fatalf("AssignTicket: %v", err)
+		}
+		if err := store.AssignTicket(urgent, 100); err == nil {
+			t.Fatal("тикет назначен повторно")
+		}
+		ticket, _ := store.GetTicketByID(urgent)
+		if ticket.Status != StatusAssigned || ticket.AssignedTo.Int64 != 100 {
+			t.Fatalf("назначенный тикет: %+v", ticket)
+		}
+
+		queue, _ = store.GetTicketQueue(10)
+		if len(queue) != 1 || queue[0].ID != question {
+			t.Fatalf("очередь после назначения: %+v", queue)
+		}
+		mine, _ := store.GetAgentTickets(100)
+		if len(mine) != 1 || mine[0].ID != urgent {
+			t.Fatalf("тикеты агента: %+v", mine)
+		}
+	})
+
+	t.Run("active tickets and history", func(t *testing.T) {
+		store := newStore(t)
+		open := newTicket(t, store, 1)
+		closed := newTicket(t, store, 1)
+		if err := store.CloseTicket(closed, 1); err != nil {
+			t.Fatalf("CloseTicket: %v", err)
+		}
+
+		active, _ := store.GetActiveTicketsByUserID(1)
+		if len(active) != 1 || active[0].ID != open {
+			t.Fatalf("активные тикеты: %+v", active)
+		}
+		history, _ := store.GetTicketHistory(1)
+		if len(history) != 2 || history[0].ID != closed {
+			t.Fatalf("история (новые первыми): %+v", history)
+		}
+
+		page, total, err := store.ListTickets(TicketFilter{Statuses: []TicketStatus{StatusClosed}})
+		if err != nil || total != 1 || len(page) != 1 || page[0].ID != closed {
+			t.Fatalf("ListTickets: %+v, %d, %v", page, total, err)
+		}
+	})
+
+	t.Run("messages and attachments", func(t *testing.T) {
+		store := newStore(t)
+		id := newTicket(t, store, 1)
+
+		messageID, err := store.AddTicketMessage(&TicketMessage{TicketID: id, SenderType: "user", SenderID: 1, Message: "привет"})
+		if err != nil {
+			t.Fatalf("AddTicketMessage: %v", err)
+		}
+		if _, err := store.AddTicketMessage(&TicketMessage{TicketID: id + 100, SenderType: "user", SenderID: 1, Message: "x"}); !errors.Is(err, ErrTicketNotFound) {
+			t.Fatalf("сообщение в несуществующий тикет: %v", err)
+		}
+		if count, _ := store.GetTicketMessageCount(id); count != 1 {
+			t.Fatalf("GetTicketMessageCount = %d", count)
+		}
+		for _, text := range []string{"второе", "третье"} {
+			if _, err := store.AddTicketMessage(&TicketMessage{TicketID: id, SenderType: "support", SenderID: 7, Message: text}); err != nil {
+				t.Fatalf("AddTicketMessage: %v", err)
+			}
+		}
+		page, total, err := store.ListTicketMessages(id, 1, 1)
+		if err != nil || total != 3 || len(page) != 1 || page[0].Message != "второе" {
+			t.Fatalf("ListTicketMessages(1, 1): %+v, %d, %v", page, total, err)
+		}
+		if page, total, _ := store.ListTicketMessages(id, 10, 5); total != 3 || len(page) != 0 {
+			t.Fatalf("ListTicketMessages за концом списка: %+v, %d", page, total)
+		}
+
+		_, err = store.AddTicketAttachment(&TicketAttachment{
+			TicketID: id, Kind: AttachmentPhoto, SenderType: "user", SenderID: 1,
+			StorageKey: "tickets/1/photo.jpg", FileID: "file-1", MessageID: messageID,
+		})
+		if err != nil {
+			t.Fatalf("AddTicketAttachment: %v", err)
+		}
+		attachments, _ := store.GetTicketAttachments(id)
+		if len(attachments) != 1 || attachments[0].Kind != AttachmentPhoto {
+			t.Fatalf("вложения: %+v", attachments)
+		}
+	})
+
+	t.Run("categories", func(t *testing.T) {
+		store := newStore(t)
+		categories, _ := store.ListCategories(true)
+		if len(categories) != len(DefaultCategories()) || categories[0].Code != "вопрос" {
+			t.Fatalf("категории по умолчанию: %+v", categories)
+		}
+		if _, err := store.GetCategory("нет такой"); !errors.Is(err, ErrCategoryNotFound) {
+			t.Fatalf("GetCategory: %v", err)
+		}
+	})
+}
+
+func TestMemoryStore(t *testing.T) {
+	testRepositories(t, func(*testing.T) repositoryStore { return NewMemoryStore() })
+}
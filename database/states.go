@@ -0,0 +1,54 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+
+	"supportTicketBotGo/metrics"
+)
+
+// Функции для работы с состояниями диалогов пользователей
+
+// GetUserState возвращает сериализованное состояние пользователя.
+// Если состояния нет или оно старше ttl, возвращает nil.
+func GetUserState(userID int64, ttl time.Duration) ([]byte, error) {
+	defer metrics.ObserveQuery("getUserState", time.Now())
+	var data []byte
+	err := DB.QueryRow(
+		`SELECT state FROM user_states
+		WHERE user_id = $1 AND updated_at > $2`,
+		userID, time.Now().Add(-ttl),
+	).Scan(&data)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return data, err
+}
+
+// SaveUserState сохраняет сериализованное состояние пользователя
+func SaveUserState(userID int64, data []byte) error {
+	defer metrics.ObserveQuery("saveUserState", time.Now())
+	_, err := DB.Exec(
+		`INSERT INTO user_states (user_id, state, updated_at) VALUES ($1, $2, NOW())
+		ON CONFLICT (user_id) DO UPDATE SET state = EXCLUDED.state, updated_at = EXCLUDED.updated_at`,
+		userID, data,
+	)
+	return err
+}
+
+// DeleteUserState удаляет состояние пользователя
+func DeleteUserState(userID int64) error {
+	defer metrics.ObserveQuery("deleteUserState", time.Now())
+	_, err := DB.Exec("DELETE FROM user_states WHERE user_id = $1", userID)
+	return err
+}
+
+// DeleteExpiredUserStates удаляет состояния старше ttl и возвращает количество удаленных записей
+func DeleteExpiredUserStates(ttl time.Duration) (int64, error) {
+	defer metrics.ObserveQuery("deleteExpiredUserStates", time.Now())
+	result, err := DB.Exec("DELETE FROM user_states WHERE updated_at <= $1", time.Now().Add(-ttl))
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,146 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// TicketStatus - статус тикета. Значение совпадает с тем, что хранится в колонке tickets.status
+// и разрешено ограничением CHECK в схеме БД.
+type TicketStatus string
+
+// Статусы тикетов
+const (
+	StatusCreated        TicketStatus = "создан"
+	StatusAssigned       TicketStatus = "назначен"
+	StatusInProgress     TicketStatus = "в работе"
+	StatusWaitingUser    TicketStatus = "ожидает ответа пользователя"
+	StatusWaitingSupport TicketStatus = "ожидает действий поддержки"
+	StatusClosed         TicketStatus = "закрыт"
+	StatusCancelled      TicketStatus = "отменён"
+)
+
+// Ошибки изменения статуса
+var (
+	ErrUnknownStatus    = errors.New("неизвестный статус тикета")
+	ErrStatusTransition = errors.New("недопустимая смена статуса тикета")
+	ErrTicketNotFound   = errors.New("тикет не найден")
+)
+
+// ticketStatusInfo описывает статус: код для callback data и API, эмодзи, название и пояснение
+type ticketStatusInfo struct {
+	code        string
+	emoji       string
+	title       string
+	description string
+	next        []TicketStatus // статусы, в которые разрешен переход
+}
+
+// ticketStatuses - единый список статусов тикета в порядке жизненного цикла
+var ticketStatuses = []TicketStatus{
+	StatusCreated, StatusAssigned, StatusInProgress,
+	StatusWaitingUser, StatusWaitingSupport, StatusClosed, StatusCancelled,
+}
+
+var ticketStatusInfos = map[TicketStatus]ticketStatusInfo{
+	StatusCreated: {"created", "🆕", "Создан", "тикет ожидает назначения агенту",
+		[]TicketStatus{StatusAssigned, StatusInProgress, StatusWaitingUser, StatusWaitingSupport, StatusClosed, StatusCancelled}},
+	StatusAssigned: {"assigned", "👨‍💻", "Назначен", "ожидает начала работы агентом",
+		[]TicketStatus{StatusInProgress, StatusWaitingUser, StatusWaitingSupport, StatusClosed, StatusCancelled}},
+	StatusInProgress: {"in_progress", "🔧", "В работе", "агент работает над тикетом",
+		[]TicketStatus{StatusWaitingUser, StatusWaitingSupport, StatusClosed, StatusCancelled}},
+	StatusWaitingUser: {"waiting_user", "❓", "Ожидает ответа пользователя", "поддержка ждет вашего ответа",
+		[]TicketStatus{StatusInProgress, StatusWaitingSupport, StatusClosed, StatusCancelled}},
+	StatusWaitingSupport: {"waiting_support", "⏳", "Ожидает действий поддержки", "поддержка скоро ответит",
+		[]TicketStatus{StatusInProgress, StatusWaitingUser, StatusClosed, StatusCancelled}},
+	StatusClosed:    {"closed", "🗃", "Закрыт", "работа по тикету завершена", nil},
+	StatusCancelled: {"cancelled", "🚫", "Отменён", "тикет не требует решения", nil},
+}
+
+// legacyStatuses - значения, которые писали старые версии бота, и их канонические статусы
+var legacyStatuses = map[string]TicketStatus{
+	"open":           StatusCreated,
+	"new":            StatusCreated,
+	"resolved":       StatusClosed,
+	"canceled":       StatusCancelled,
+	"отменен":        StatusCancelled,
+	"ожидает ответа": StatusWaitingSupport,
+}
+
+// TicketStatuses возвращает все статусы тикета в порядке жизненного цикла
+func TicketStatuses() []TicketStatus {
+	return append([]TicketStatus(nil), ticketStatuses...)
+}
+
+// ParseTicketStatus приводит значение к каноническому статусу.
+// Принимает значения из БД (в любом регистре), коды статусов и устаревшие значения.
+func ParseTicketStatus(value string) (TicketStatus, error) {
+	normalized := strings.ToLower(strings.TrimSpace(value))
+	for _, status := range ticketStatuses {
+		if string(status) == normalized || ticketStatusInfos[status].code == normalized {
+			return status, nil
+		}
+	}
+	if status, ok := legacyStatuses[normalized]; ok {
+		return status, nil
+	}
+	return "", fmt.Errorf("%w: %q", ErrUnknownStatus, value)
+}
+
+// Valid проверяет, что статус входит в канонический список
+func (s TicketStatus) Valid() bool {
+	_, ok := ticketStatusInfos[s]
+	return ok
+}
+
+// Code возвращает латинский код статуса (для callback data и внешних API)
+func (s TicketStatus) Code() string {
+	return ticketStatusInfos[s].code
+}
+
+// Emoji возвращает эмодзи статуса
+func (s TicketStatus) Emoji() string {
+	if info, ok := ticketStatusInfos[s]; ok {
+		return info.emoji
+	}
+	return "❔"
+}
+
+// Title возвращает название статуса для показа пользователю
+func (s TicketStatus) Title() string {
+	if info, ok := ticketStatusInfos[s]; ok {
+		return info.title
+	}
+	return string(s)
+}
+
+// Description возвращает пояснение к статусу
+func (s TicketStatus) Description() string {
+	return ticketStatusInfos[s].description
+}
+
+// Label возвращает эмодзи и название статуса, например "🔧 В работе"
+func (s TicketStatus) Label() string {
+	return s.Emoji() + " " + s.Title()
+}
+
+// IsFinal сообщает, что тикет в этом статусе больше не меняется
+func (s TicketStatus) IsFinal() bool {
+	return s == StatusClosed || s == StatusCancelled
+}
+
+// Next возвращает статусы, в которые разрешен переход из текущего
+func (s TicketStatus) Next() []TicketStatus {
+	return append([]TicketStatus(nil), ticketStatusInfos[s].next...)
+}
+
+// CanTransitionTo проверяет, разрешен ли переход в статус next
+func (s TicketStatus) CanTransitionTo(next TicketStatus) bool {
+	for _, status := range ticketStatusInfos[s].next {
+		if status == next {
+			return true
+		}
+	}
+	return false
+}
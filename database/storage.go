@@ -0,0 +1,28 @@
+package database
+
+// Функции для хранилища файлов в базе данных (storage.DatabaseStorage)
+
+// PutStorageObject сохраняет объект под ключом, перезаписывая существующий
+func PutStorageObject(key, contentType string, data []byte) error {
+	_, err := DB.Exec(
+		`INSERT INTO storage_objects (key, content_type, size, data, created_at)
+		VALUES ($1, $2, $3, $4, NOW())
+		ON CONFLICT (key) DO UPDATE
+		SET content_type = EXCLUDED.content_type, size = EXCLUDED.size, data = EXCLUDED.data, created_at = NOW()`,
+		key, contentType, len(data), data,
+	)
+	return err
+}
+
+// GetStorageObject возвращает содержимое объекта или sql.ErrNoRows, если его нет
+func GetStorageObject(key string) ([]byte, error) {
+	var data []byte
+	err := DB.QueryRow("SELECT data FROM storage_objects WHERE key = $1", key).Scan(&data)
+	return data, err
+}
+
+// DeleteStorageObject удаляет объект
+func DeleteStorageObject(key string) error {
+	_, err := DB.Exec("DELETE FROM storage_objects WHERE key = $1", key)
+	return err
+}
@@ -0,0 +1,106 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"supportTicketBotGo/metrics"
+
+	"github.com/lib/pq"
+)
+
+// TicketFilter - условия выборки тикетов для ListTickets. Пустые поля не ограничивают выборку.
+type TicketFilter struct {
+	Statuses   []TicketStatus
+	Category   string
+	UserID     int64
+	AssignedTo int64
+	Limit      int // 0 - без ограничения
+	Offset     int
+}
+
+// match проверяет тикет на соответствие фильтру (без учета Limit и Offset)
+func (f TicketFilter) match(t *Ticket) bool {
+	if len(f.Statuses) > 0 {
+		found := false
+		for _, status := range f.Statuses {
+			if t.Status == status {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if f.Category != "" && t.Category != f.Category {
+		return false
+	}
+	if f.UserID != 0 && t.UserID != f.UserID {
+		return false
+	}
+	if f.AssignedTo != 0 && (!t.AssignedTo.Valid || t.AssignedTo.Int64 != f.AssignedTo) {
+		return false
+	}
+	return true
+}
+
+// ListTickets возвращает страницу тикетов, подходящих под фильтр, новые первыми,
+// и общее число таких тикетов
+func ListTickets(filter TicketFilter) ([]Ticket, int, error) {
+	defer metrics.ObserveQuery("listTickets", time.Now())
+	var conditions []string
+	var args []interface{}
+	addCondition := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if len(filter.Statuses) > 0 {
+		statuses := make([]string, len(filter.Statuses))
+		for i, status := range filter.Statuses {
+			statuses[i] = string(status)
+		}
+		addCondition("status = ANY($%d::text[])", pq.Array(statuses))
+	}
+	if filter.Category != "" {
+		addCondition("category = $%d", filter.Category)
+	}
+	if filter.UserID != 0 {
+		addCondition("user_id = $%d", filter.UserID)
+	}
+	if filter.AssignedTo != 0 {
+		addCondition("assigned_to = $%d", filter.AssignedTo)
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	var total int
+	if err := DB.QueryRow("SELECT COUNT(*) FROM tickets"+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	query := `SELECT id, user_id, title, description, status, category, created_at, closed_at, assigned_to
+		FROM tickets` + where + " ORDER BY created_at DESC, id DESC"
+	if filter.Limit > 0 {
+		args = append(args, filter.Limit)
+		query += fmt.Sprintf(" LIMIT $%d", len(args))
+	}
+	if filter.Offset > 0 {
+		args = append(args, filter.Offset)
+		query += fmt.Sprintf(" OFFSET $%d", len(args))
+	}
+
+	rows, err := DB.Query(query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	tickets, err := scanTickets(rows)
+	return tickets, total, err
+}
@@ -0,0 +1,411 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Типы событий исходящих вебхуков
+const (
+	WebhookTicketCreated       = "ticket.created"
+	WebhookTicketMessageAdded  = "ticket.message_added"
+	WebhookTicketStatusChanged = "ticket.status_changed"
+	WebhookTicketClosed        = "ticket.closed"
+	WebhookUserRegistered      = "user.registered"
+	WebhookAttachmentAdded     = "attachment.added"
+)
+
+// webhookEventTypes - все типы событий вебхуков
+var webhookEventTypes = []string{
+	WebhookTicketCreated, WebhookTicketMessageAdded, WebhookTicketStatusChanged,
+	WebhookTicketClosed, WebhookUserRegistered, WebhookAttachmentAdded,
+}
+
+// Статусы доставки вебхуков
+const (
+	WebhookPending   = "pending"   // ожидает отправки (в том числе повторной)
+	WebhookSending   = "sending"   // захвачена обработчиком
+	WebhookDelivered = "delivered" // подписчик ответил кодом 2xx
+	WebhookDead      = "dead"      // попытки исчерпаны, нужна повторная отправка вручную
+)
+
+// ErrInvalidReplayFilter - не задано ни одно условие выбора доставок для повторной отправки
+var ErrInvalidReplayFilter = errors.New("не задано условие выбора доставок")
+
+// WebhookEventTypes возвращает все типы событий вебхуков
+func WebhookEventTypes() []string {
+	return append([]string(nil), webhookEventTypes...)
+}
+
+// IsWebhookEventType проверяет, что тип события известен
+func IsWebhookEventType(eventType string) bool {
+	for _, t := range webhookEventTypes {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookSubscription - подписчик вебхуков: адрес и интересующие его события (пустой список - все)
+type WebhookSubscription struct {
+	URL    string
+	Events []string
+}
+
+// accepts проверяет, подписан ли подписчик на событие
+func (s WebhookSubscription) accepts(eventType string) bool {
+	if len(s.Events) == 0 {
+		return true
+	}
+	for _, e := range s.Events {
+		if e == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookDelivery - доставка события вебхука одному подписчику
+type WebhookDelivery struct {
+	ID             int64
+	EventID        int64
+	EventType      string
+	Payload        json.RawMessage // данные события (поле data в теле запроса)
+	EventCreatedAt time.Time
+	URL            string
+	Status         string
+	Attempts       int
+	NextAttemptAt  time.Time
+	LastError      sql.NullString
+	DeliveredAt    sql.NullTime
+}
+
+// WebhookReplayFilter - выбор доставок для повторной отправки. Условия объединяются через И.
+type WebhookReplayFilter struct {
+	EventID int64      // доставки одного события
+	Dead    bool       // только доставки с исчерпанными попытками
+	Since   *time.Time // события, созданные не раньше этого момента
+	URL     string     // доставки одному подписчику
+}
+
+var (
+	webhookMu            sync.RWMutex
+	webhookSubscriptions []WebhookSubscription
+	webhookHooks         []func()
+)
+
+// SetWebhookSubscriptions задает подписчиков вебхуков. Без подписчиков события не записываются.
+func SetWebhookSubscriptions(subscriptions []WebhookSubscription) {
+	webhookMu.Lock()
+	defer webhookMu.Unlock()
+	webhookSubscriptions = append([]WebhookSubscription(nil), subscriptions...)
+}
+
+// OnWebhookEvent регистрирует функцию, вызываемую после записей бота,
+// которые могли поставить в очередь доставку вебхуков
+func OnWebhookEvent(hook func()) {
+	webhookMu.Lock()
+	defer webhookMu.Unlock()
+	webhookHooks = append(webhookHooks, hook)
+}
+
+// fireWebhookHooks вызывает зарегистрированные обработчики вебхуков
+func fireWebhookHooks() {
+	webhookMu.RLock()
+	defer webhookMu.RUnlock()
+	for _, hook := range webhookHooks {
+		hook()
+	}
+}
+
+// webhookURLs возвращает адреса подписчиков события
+func webhookURLs(eventType string) []string {
+	webhookMu.RLock()
+	defer webhookMu.RUnlock()
+	var urls []string
+	for _, s := range webhookSubscriptions {
+		if s.accepts(eventType) {
+			urls = append(urls, s.URL)
+		}
+	}
+	return urls
+}
+
+// emitWebhookEvent записывает событие и доставки подписчикам в транзакции изменения,
+// которое его породило: событие не теряется при падении и не отправляется при откате
+func emitWebhookEvent(tx *sql.Tx, eventType string, data interface{}) error {
+	urls := webhookURLs(eventType)
+	if len(urls) == 0 {
+		return nil
+	}
+
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("ошибка при сериализации события %s: %v", eventType, err)
+	}
+
+	var eventID int64
+	err = tx.QueryRow(
+		"INSERT INTO webhook_events (type, payload) VALUES ($1, $2) RETURNING id",
+		eventType, payload,
+	).Scan(&eventID)
+	if err != nil {
+		return fmt.Errorf("ошибка при записи события %s: %v", eventType, err)
+	}
+
+	_, err = tx.Exec(
+		"INSERT INTO webhook_deliveries (event_id, url) SELECT $1, unnest($2::text[])",
+		eventID, pq.Array(urls),
+	)
+	if err != nil {
+		return fmt.Errorf("ошибка при записи доставок события %s: %v", eventType, err)
+	}
+	return nil
+}
+
+// webhookTicket - тикет в данных событий вебхуков
+type webhookTicket struct {
+	ID           int        `json:"id"`
+	UserID       int64      `json:"user_id"`
+	Title        string     `json:"title"`
+	Description  string     `json:"description"`
+	Status       string     `json:"status"`
+	Category     string     `json:"category"`
+	Priority     string     `json:"priority"`
+	RoutingGroup string     `json:"routing_group"`
+	AssignedTo   *int64     `json:"assigned_to"`
+	CreatedAt    time.Time  `json:"created_at"`
+	ClosedAt     *time.Time `json:"closed_at"`
+}
+
+// webhookTicketData - данные событий тикета
+type webhookTicketData struct {
+	Ticket    webhookTicket   `json:"ticket"`
+	Message   *webhookMessage `json:"message,omitempty"`    // ticket.message_added
+	OldStatus string          `json:"old_status,omitempty"` // ticket.status_changed, ticket.closed
+	NewStatus string          `json:"new_status,omitempty"` // ticket.status_changed
+	ClosedBy  string          `json:"closed_by,omitempty"`  // ticket.closed: user или support
+}
+
+// webhookMessage - сообщение тикета в данных событий вебхуков
+type webhookMessage struct {
+	ID         int       `json:"id"`
+	SenderType string    `json:"sender_type"`
+	SenderID   int64     `json:"sender_id"`
+	Text       string    `json:"text"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// webhookAttachmentData - данные события attachment.added
+type webhookAttachmentData struct {
+	TicketID   int       `json:"ticket_id"`
+	ID         int       `json:"id"`
+	Kind       string    `json:"kind"`
+	SenderType string    `json:"sender_type"`
+	SenderID   int64     `json:"sender_id"`
+	MimeType   string    `json:"mime_type,omitempty"`
+	FileSize   int64     `json:"file_size,omitempty"`
+	FileName   string    `json:"file_name,omitempty"`
+	MessageID  int       `json:"message_id,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// webhookUserData - данные события user.registered
+type webhookUserData struct {
+	User struct {
+		ID           int64     `json:"id"`
+		FullName     string    `json:"full_name"`
+		Phone        string    `json:"phone"`
+		BirthDate    time.Time `json:"birth_date"`
+		RegisteredAt time.Time `json:"registered_at"`
+	} `json:"user"`
+}
+
+// emitTicketWebhook записывает событие тикета с его состоянием на момент изменения
+func emitTicketWebhook(tx *sql.Tx, eventType string, ticketID int, data webhookTicketData) error {
+	if len(webhookURLs(eventType)) == 0 {
+		return nil
+	}
+
+	var t Ticket
+	var priority, group string
+	err := tx.QueryRow(
+		`SELECT t.id, t.user_id, t.title, t.description, t.status, t.category, t.created_at, t.closed_at, t.assigned_to,
+			COALESCE(c.default_priority, 'normal'), COALESCE(c.routing_group, '')
+		FROM tickets t LEFT JOIN ticket_categories c ON c.code = t.category WHERE t.id = $1`,
+		ticketID,
+	).Scan(&t.ID, &t.UserID, &t.Title, &t.Description, &t.Status, &t.Category, &t.CreatedAt, &t.ClosedAt, &t.AssignedTo,
+		&priority, &group)
+	if err != nil {
+		return fmt.Errorf("ошибка при получении тикета #%d для события %s: %v", ticketID, eventType, err)
+	}
+
+	data.Ticket = webhookTicket{
+		ID:           t.ID,
+		UserID:       t.UserID,
+		Title:        t.Title,
+		Description:  t.Description,
+		Status:       t.Status.Code(),
+		Category:     t.Category,
+		Priority:     priority,
+		RoutingGroup: group,
+		CreatedAt:    t.CreatedAt,
+	}
+	if t.AssignedTo.Valid {
+		data.Ticket.AssignedTo = &t.AssignedTo.Int64
+	}
+	if t.ClosedAt.Valid {
+		data.Ticket.ClosedAt = &t.ClosedAt.Time
+	}
+	return emitWebhookEvent(tx, eventType, data)
+}
+
+// emitStatusWebhooks записывает события смены статуса тикета и, если тикет закрыт, его закрытия
+func emitStatusWebhooks(tx *sql.Tx, ticketID int, oldStatus, newStatus TicketStatus, closedBy string) error {
+	err := emitTicketWebhook(tx, WebhookTicketStatusChanged, ticketID, webhookTicketData{
+		OldStatus: oldStatus.Code(),
+		NewStatus: newStatus.Code(),
+	})
+	if err != nil || newStatus != StatusClosed {
+		return err
+	}
+	return emitTicketWebhook(tx, WebhookTicketClosed, ticketID, webhookTicketData{
+		OldStatus: oldStatus.Code(),
+		ClosedBy:  closedBy,
+	})
+}
+
+// ClaimWebhookDeliveries захватывает до limit доставок, время которых подошло.
+// Доставки, зависшие в статусе "sending" дольше staleAfter, захватываются повторно.
+func ClaimWebhookDeliveries(limit int, staleAfter time.Duration) ([]WebhookDelivery, error) {
+	rows, err := DB.Query(
+		`UPDATE webhook_deliveries d SET status = 'sending', attempts = d.attempts + 1, claimed_at = NOW()
+		FROM webhook_events e
+		WHERE e.id = d.event_id AND d.id IN (
+			SELECT id FROM webhook_deliveries
+			WHERE (status = 'pending' AND next_attempt_at <= NOW()) OR (status = 'sending' AND claimed_at < $2)
+			ORDER BY id LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING d.id, d.event_id, e.type, e.payload, e.created_at, d.url, d.status, d.attempts,
+			d.next_attempt_at, d.last_error, d.delivered_at`,
+		limit, time.Now().Add(-staleAfter),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanWebhookDeliveries(rows)
+}
+
+// ListWebhookDeliveries возвращает последние доставки; пустой status - в любом статусе
+func ListWebhookDeliveries(status string, limit int) ([]WebhookDelivery, error) {
+	rows, err := DB.Query(
+		`SELECT d.id, d.event_id, e.type, e.payload, e.created_at, d.url, d.status, d.attempts,
+			d.next_attempt_at, d.last_error, d.delivered_at
+		FROM webhook_deliveries d JOIN webhook_events e ON e.id = d.event_id
+		WHERE $1 = '' OR d.status = $1
+		ORDER BY d.id DESC LIMIT $2`,
+		status, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanWebhookDeliveries(rows)
+}
+
+func scanWebhookDeliveries(rows *sql.Rows) ([]WebhookDelivery, error) {
+	var deliveries []WebhookDelivery
+	for rows.Next() {
+		var d WebhookDelivery
+		if err := rows.Scan(
+			&d.ID, &d.EventID, &d.EventType, &d.Payload, &d.EventCreatedAt, &d.URL, &d.Status,
+			&d.Attempts, &d.NextAttemptAt, &d.LastError, &d.DeliveredAt,
+		); err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
+
+// MarkWebhookDelivered отмечает успешную доставку
+func MarkWebhookDelivered(deliveryID int64) error {
+	_, err := DB.Exec(
+		"UPDATE webhook_deliveries SET status = 'delivered', delivered_at = NOW(), last_error = NULL WHERE id = $1",
+		deliveryID,
+	)
+	return err
+}
+
+// RetryWebhookDelivery сохраняет ошибку и откладывает следующую попытку до nextAttempt
+func RetryWebhookDelivery(deliveryID int64, deliveryErr error, nextAttempt time.Time) error {
+	_, err := DB.Exec(
+		"UPDATE webhook_deliveries SET status = 'pending', last_error = $2, next_attempt_at = $3 WHERE id = $1",
+		deliveryID, deliveryErr.Error(), nextAttempt,
+	)
+	return err
+}
+
+// MarkWebhookDead сохраняет ошибку и прекращает попытки доставки
+func MarkWebhookDead(deliveryID int64, deliveryErr error) error {
+	_, err := DB.Exec(
+		"UPDATE webhook_deliveries SET status = 'dead', last_error = $2 WHERE id = $1",
+		deliveryID, deliveryErr.Error(),
+	)
+	return err
+}
+
+// ReplayWebhookDeliveries возвращает выбранные доставки в очередь со сброшенным счетчиком попыток
+// и возвращает их количество. Доставки, которые сейчас отправляются, не затрагиваются.
+func ReplayWebhookDeliveries(filter WebhookReplayFilter) (int64, error) {
+	query, args, err := replayWebhookQuery(filter)
+	if err != nil {
+		return 0, err
+	}
+	result, err := DB.Exec(query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// replayWebhookQuery строит запрос ReplayWebhookDeliveries
+func replayWebhookQuery(filter WebhookReplayFilter) (string, []interface{}, error) {
+	conditions := []string{"status <> 'sending'"}
+	var args []interface{}
+	addCondition := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if filter.EventID != 0 {
+		addCondition("event_id = $%d", filter.EventID)
+	}
+	if filter.Dead {
+		conditions = append(conditions, "status = 'dead'")
+	}
+	if filter.Since != nil {
+		addCondition("event_id IN (SELECT id FROM webhook_events WHERE created_at >= $%d)", *filter.Since)
+	}
+	if filter.URL != "" {
+		addCondition("url = $%d", filter.URL)
+	}
+	if len(conditions) == 1 {
+		return "", nil, ErrInvalidReplayFilter
+	}
+
+	query := `UPDATE webhook_deliveries SET status = 'pending', attempts = 0, next_attempt_at = NOW(),
+		last_error = NULL, delivered_at = NULL
+		WHERE ` + strings.Join(conditions, " AND ")
+	return query, args, nil
+}
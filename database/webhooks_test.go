@@ -0,0 +1,44 @@
+package database
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReplayWebhookQuery(t *testing.T) {
+	since := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name      string
+		filter    WebhookReplayFilter
+		condition string
+		args      []interface{}
+	}{
+		{"событие", WebhookReplayFilter{EventID: 7},
+			"status <> 'sending' AND event_id = $1", []interface{}{int64(7)}},
+		{"dead", WebhookReplayFilter{Dead: true},
+			"status <> 'sending' AND status = 'dead'", nil},
+		{"dead подписчика с даты", WebhookReplayFilter{Dead: true, Since: &since, URL: "https://example.com/hook"},
+			"status <> 'sending' AND status = 'dead' AND event_id IN (SELECT id FROM webhook_events WHERE created_at >= $1) AND url = $2",
+			[]interface{}{since, "https://example.com/hook"}},
+	}
+	for _, tt := range tests {
+		query, args, err := replayWebhookQuery(tt.filter)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if !strings.Contains(query, "attempts = 0") || !strings.HasSuffix(query, "WHERE "+tt.condition) {
+			t.Errorf("%s: запрос %q", tt.name, query)
+		}
+		if !reflect.DeepEqual(args, tt.args) {
+			t.Errorf("%s: аргументы %v, ожидалось %v", tt.name, args, tt.args)
+		}
+	}
+
+	if _, _, err := replayWebhookQuery(WebhookReplayFilter{}); !errors.Is(err, ErrInvalidReplayFilter) {
+		t.Errorf("пустой фильтр: %v", err)
+	}
+}
@@ -0,0 +1,210 @@
+// Package fsm реализует декларативный конечный автомат для диалогов бота.
+//
+// Каждое состояние объявляет свой обработчик, допустимые переходы,
+// приглашение при входе и клавиатуру. Кнопки отмены/возврата обрабатываются
+// машиной централизованно, поэтому новый сценарий (например, редактирование
+// профиля) добавляется регистрацией состояний, а не новой веткой switch.
+package fsm
+
+import (
+	"errors"
+	"fmt"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Специальные значения, которые может вернуть обработчик состояния
+const (
+	// Stay - остаться в текущем состоянии
+	Stay = ""
+	// Exit - завершить диалог; вызывающий код удаляет состояние пользователя
+	Exit = "__exit"
+)
+
+var (
+	// ErrUnknownState возвращается при обращении к незарегистрированному состоянию
+	ErrUnknownState = errors.New("неизвестное состояние")
+	// ErrTransitionNotAllowed возвращается, если обработчик запросил переход, не объявленный в Transitions
+	ErrTransitionNotAllowed = errors.New("переход не разрешен")
+)
+
+// Context передается обработчикам состояний
+type Context struct {
+	Bot     *tgbotapi.BotAPI
+	Message *tgbotapi.Message // nil при входе в диалог не из сообщения (например, из callback)
+	UserID  int64
+	ChatID  int64
+	// State - имя текущего состояния
+	State string
+	// Data - данные диалога, принадлежат вызывающему коду
+	Data interface{}
+}
+
+// Text возвращает текст сообщения или пустую строку
+func (c *Context) Text() string {
+	if c.Message == nil {
+		return ""
+	}
+	return c.Message.Text
+}
+
+// HandlerFunc обрабатывает сообщение и возвращает имя следующего состояния, Stay или Exit
+type HandlerFunc func(ctx *Context) (string, error)
+
+// SendFunc отправляет пользователю текст с клавиатурой (markup может быть nil)
+type SendFunc func(ctx *Context, text string, markup interface{})
+
+// State описывает одно состояние диалога
+type State struct {
+	Name string
+	// Handle обрабатывает сообщения пользователя в этом состоянии
+	Handle HandlerFunc
+	// Transitions - состояния, в которые разрешено перейти из этого (Stay и Exit разрешены всегда)
+	Transitions []string
+	// OnEnter вызывается при входе в состояние до отправки Prompt.
+	// Может вернуть другое состояние (или Exit), чтобы сразу перенаправить пользователя.
+	OnEnter HandlerFunc
+	// Prompt - приглашение, отправляемое при входе в состояние
+	Prompt string
+	// Keyboard возвращает клавиатуру для Prompt
+	Keyboard func() interface{}
+	// Back - состояние, в которое ведут кнопки отмены/возврата.
+	// Если не задано, применяется глобальное поведение отмены машины.
+	Back string
+	// DisableCancel отключает обработку кнопок отмены (например, во время регистрации)
+	DisableCancel bool
+}
+
+// Machine хранит зарегистрированные состояния и выполняет переходы между ними
+type Machine struct {
+	states      map[string]*State
+	cancelTexts map[string]bool
+	onCancel    HandlerFunc
+	send        SendFunc
+}
+
+// New создает машину состояний, которая отправляет приглашения через send
+func New(send SendFunc) *Machine {
+	return &Machine{
+		states:      make(map[string]*State),
+		cancelTexts: make(map[string]bool),
+		send:        send,
+	}
+}
+
+// Register добавляет состояние. Паникует при пустом или повторяющемся имени,
+// так как это ошибка программиста, обнаруживаемая при запуске.
+func (m *Machine) Register(state State) {
+	if state.Name == "" || state.Name == Exit {
+		panic("fsm: недопустимое имя состояния")
+	}
+	if state.Handle == nil {
+		panic("fsm: у состояния " + state.Name + " нет обработчика")
+	}
+	if _, exists := m.states[state.Name]; exists {
+		panic("fsm: состояние " + state.Name + " уже зарегистрировано")
+	}
+	m.states[state.Name] = &state
+}
+
+// OnCancel задает тексты кнопок отмены/возврата и глобальный обработчик для состояний без Back
+func (m *Machine) OnCancel(texts []string, handler HandlerFunc) {
+	for _, text := range texts {
+		m.cancelTexts[text] = true
+	}
+	m.onCancel = handler
+}
+
+// Has сообщает, зарегистрировано ли состояние
+func (m *Machine) Has(name string) bool {
+	_, ok := m.states[name]
+	return ok
+}
+
+// Start входит в состояние name и возвращает итоговое состояние (с учетом перенаправлений OnEnter)
+func (m *Machine) Start(ctx *Context, name string) (string, error) {
+	return m.enter(ctx, name)
+}
+
+// Handle обрабатывает сообщение в состоянии ctx.State и возвращает итоговое состояние
+func (m *Machine) Handle(ctx *Context) (string, error) {
+	state, ok := m.states[ctx.State]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrUnknownState, ctx.State)
+	}
+
+	var next string
+	var err error
+	if !state.DisableCancel && m.cancelTexts[ctx.Text()] {
+		switch {
+		case state.Back != "":
+			next = state.Back
+		case m.onCancel != nil:
+			next, err = m.onCancel(ctx)
+		default:
+			next = Exit
+		}
+	} else {
+		next, err = state.Handle(ctx)
+	}
+	if err != nil {
+		return ctx.State, err
+	}
+
+	switch next {
+	case Stay, ctx.State:
+		return ctx.State, nil
+	case Exit:
+		return Exit, nil
+	}
+
+	if next != state.Back && !state.allows(next) {
+		return ctx.State, fmt.Errorf("%w: %s -> %s", ErrTransitionNotAllowed, ctx.State, next)
+	}
+	return m.enter(ctx, next)
+}
+
+// enter выполняет вход в состояние: OnEnter, затем Prompt с клавиатурой
+func (m *Machine) enter(ctx *Context, name string) (string, error) {
+	state, ok := m.states[name]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrUnknownState, name)
+	}
+	ctx.State = name
+
+	if state.OnEnter != nil {
+		redirect, err := state.OnEnter(ctx)
+		if err != nil {
+			return name, err
+		}
+		switch redirect {
+		case Stay, name:
+		case Exit:
+			return Exit, nil
+		default:
+			if !state.allows(redirect) {
+				return name, fmt.Errorf("%w: %s -> %s", ErrTransitionNotAllowed, name, redirect)
+			}
+			return m.enter(ctx, redirect)
+		}
+	}
+
+	if state.Prompt != "" && m.send != nil {
+		var markup interface{}
+		if state.Keyboard != nil {
+			markup = state.Keyboard()
+		}
+		m.send(ctx, state.Prompt, markup)
+	}
+	return name, nil
+}
+
+// allows проверяет, объявлен ли переход в состояние next
+func (s *State) allows(next string) bool {
+	for _, t := range s.Transitions {
+		if t == next {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,225 @@
+package fsm
+
+import (
+	"errors"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const cancelText = "❌ Отмена"
+
+// prompt - отправленное машиной приглашение
+type prompt struct {
+	text   string
+	markup interface{}
+}
+
+// testMachine - машина диалога создания тикета: title -> description -> confirm.
+// Обработчики переходят в состояние, записанное в next, или в него же с ошибкой err.
+type testMachine struct {
+	*Machine
+	prompts []prompt
+	next    map[string]string
+	err     error
+	// skipConfirm - OnEnter состояния confirm сразу завершает диалог
+	skipConfirm bool
+}
+
+func newTestMachine() *testMachine {
+	tm := &testMachine{next: make(map[string]string)}
+	tm.Machine = New(func(ctx *Context, text string, markup interface{}) {
+		tm.prompts = append(tm.prompts, prompt{text, markup})
+	})
+	tm.Register(State{Name: "title", Handle: tm.handle, Transitions: []string{"description"}, Prompt: "Введите заголовок"})
+	tm.Register(State{
+		Name: "description", Handle: tm.handle, Transitions: []string{"confirm"}, Back: "title",
+		Prompt: "Опишите проблему", Keyboard: func() interface{} { return "keyboard" },
+	})
+	tm.Register(State{
+		Name: "confirm", Handle: tm.handle, Transitions: []string{"title"}, Prompt: "Отправить?",
+		OnEnter: func(ctx *Context) (string, error) {
+			if tm.skipConfirm {
+				return Exit, nil
+			}
+			return Stay, nil
+		},
+	})
+	tm.Register(State{Name: "registration", Handle: tm.handle, DisableCancel: true})
+	return tm
+}
+
+func (tm *testMachine) handle(ctx *Context) (string, error) {
+	return tm.next[ctx.State], tm.err
+}
+
+func message(text string) *tgbotapi.Message {
+	return &tgbotapi.Message{Text: text}
+}
+
+func TestStartSendsPrompt(t *testing.T) {
+	m := newTestMachine()
+	ctx := &Context{}
+	state, err := m.Start(ctx, "description")
+	if err != nil || state != "description" || ctx.State != "description" {
+		t.Fatalf("Start = %q, %v (ctx.State %q)", state, err, ctx.State)
+	}
+	if len(m.prompts) != 1 || m.prompts[0] != (prompt{"Опишите проблему", "keyboard"}) {
+		t.Fatalf("приглашения: %+v", m.prompts)
+	}
+
+	if _, err := m.Start(ctx, "missing"); !errors.Is(err, ErrUnknownState) {
+		t.Fatalf("Start в неизвестное состояние: %v", err)
+	}
+}
+
+func TestHandleTransitions(t *testing.T) {
+	tests := []struct {
+		name        string
+		state       string
+		next        string
+		want        string
+		wantErr     error
+		wantPrompts int
+	}{
+		{"разрешенный переход", "title", "description", "description", nil, 1},
+		{"Stay", "title", Stay, "title", nil, 0},
+		{"переход в себя", "title", "title", "title", nil, 0},
+		{"Exit", "description", Exit, Exit, nil, 0},
+		{"необъявленный переход", "title", "confirm", "title", ErrTransitionNotAllowed, 0},
+		{"переход в Back без объявления", "description", "title", "title", nil, 1},
+		{"переход в неизвестное состояние", "confirm", "missing", "confirm", ErrTransitionNotAllowed, 0},
+	}
+	for _, tt := range tests {
+		m := newTestMachine()
+		m.next[tt.state] = tt.next
+		got, err := m.Handle(&Context{State: tt.state, Message: message("текст")})
+		if got != tt.want || !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: Handle = %q, %v, ожидалось %q, %v", tt.name, got, err, tt.want, tt.wantErr)
+		}
+		if len(m.prompts) != tt.wantPrompts {
+			t.Errorf("%s: приглашений %d, ожидалось %d", tt.name, len(m.prompts), tt.wantPrompts)
+		}
+	}
+}
+
+func TestHandleErrors(t *testing.T) {
+	m := newTestMachine()
+	if _, err := m.Handle(&Context{State: "missing"}); !errors.Is(err, ErrUnknownState) {
+		t.Fatalf("неизвестное состояние: %v", err)
+	}
+
+	// Ошибка обработчика оставляет пользователя в текущем состоянии
+	failure := errors.New("база недоступна")
+	m.next["title"], m.err = "description", failure
+	if got, err := m.Handle(&Context{State: "title"}); got != "title" || !errors.Is(err, failure) {
+		t.Fatalf("ошибка обработчика: %q, %v", got, err)
+	}
+	if len(m.prompts) != 0 {
+		t.Fatalf("приглашения после ошибки: %+v", m.prompts)
+	}
+}
+
+func TestCancel(t *testing.T) {
+	m := newTestMachine()
+
+	// Без OnCancel текст отмены обрабатывается как обычное сообщение
+	m.next["title"] = Stay
+	if got, _ := m.Handle(&Context{State: "title", Message: message(cancelText)}); got != "title" {
+		t.Fatalf("отмена без OnCancel: %q", got)
+	}
+
+	var cancelled []string
+	m.OnCancel([]string{cancelText}, func(ctx *Context) (string, error) {
+		cancelled = append(cancelled, ctx.State)
+		return Exit, nil
+	})
+
+	// Состояние с Back возвращает назад, не вызывая обработчик и OnCancel
+	m.next["description"] = "confirm"
+	got, err := m.Handle(&Context{State: "description", Message: message(cancelText)})
+	if err != nil || got != "title" || len(cancelled) != 0 {
+		t.Fatalf("отмена с Back: %q, %v, OnCancel %q", got, err, cancelled)
+	}
+	if len(m.prompts) != 1 || m.prompts[0].text != "Введите заголовок" {
+		t.Fatalf("приглашения: %+v", m.prompts)
+	}
+
+	// Без Back вызывается глобальный обработчик отмены
+	if got, err := m.Handle(&Context{State: "title", Message: message(cancelText)}); err != nil || got != Exit {
+		t.Fatalf("отмена без Back: %q, %v", got, err)
+	}
+	if len(cancelled) != 1 || cancelled[0] != "title" {
+		t.Fatalf("OnCancel вызван в %q", cancelled)
+	}
+
+	// DisableCancel передает текст отмены обработчику состояния
+	m.next["registration"] = Stay
+	if got, _ := m.Handle(&Context{State: "registration", Message: message(cancelText)}); got != "registration" || len(cancelled) != 1 {
+		t.Fatalf("отмена при DisableCancel: %q, OnCancel %q", got, cancelled)
+	}
+}
+
+func TestOnEnterRedirect(t *testing.T) {
+	m := newTestMachine()
+	m.next["description"] = "confirm"
+	if got, err := m.Handle(&Context{State: "description"}); err != nil || got != "confirm" {
+		t.Fatalf("вход в confirm: %q, %v", got, err)
+	}
+
+	// OnEnter может сразу завершить диалог, тогда приглашение не отправляется
+	m = newTestMachine()
+	m.skipConfirm = true
+	m.next["description"] = "confirm"
+	if got, err := m.Handle(&Context{State: "description"}); err != nil || got != Exit {
+		t.Fatalf("OnEnter с Exit: %q, %v", got, err)
+	}
+	if len(m.prompts) != 0 {
+		t.Fatalf("приглашения: %+v", m.prompts)
+	}
+
+	// Перенаправление проверяется по Transitions и выполняет вход в новое состояние
+	m = newTestMachine()
+	m.Register(State{
+		Name: "resume", Handle: m.handle, Transitions: []string{"description"},
+		OnEnter: func(ctx *Context) (string, error) { return "description", nil },
+	})
+	ctx := &Context{}
+	if got, err := m.Start(ctx, "resume"); err != nil || got != "description" || ctx.State != "description" {
+		t.Fatalf("перенаправление: %q, %v (ctx.State %q)", got, err, ctx.State)
+	}
+	if len(m.prompts) != 1 || m.prompts[0].text != "Опишите проблему" {
+		t.Fatalf("приглашения: %+v", m.prompts)
+	}
+
+	m.Register(State{
+		Name: "broken", Handle: m.handle,
+		OnEnter: func(ctx *Context) (string, error) { return "confirm", nil },
+	})
+	if got, err := m.Start(&Context{}, "broken"); got != "broken" || !errors.Is(err, ErrTransitionNotAllowed) {
+		t.Fatalf("необъявленное перенаправление: %q, %v", got, err)
+	}
+}
+
+func TestRegisterPanics(t *testing.T) {
+	handle := func(ctx *Context) (string, error) { return Stay, nil }
+	tests := []struct {
+		name  string
+		state State
+	}{
+		{"пустое имя", State{Handle: handle}},
+		{"имя Exit", State{Name: Exit, Handle: handle}},
+		{"без обработчика", State{Name: "new"}},
+		{"повтор", State{Name: "title", Handle: handle}},
+	}
+	for _, tt := range tests {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s: Register не паникует", tt.name)
+				}
+			}()
+			newTestMachine().Register(tt.state)
+		}()
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"supportTicketBotGo/bot"
+	"supportTicketBotGo/database"
+	"supportTicketBotGo/metrics"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// readinessTimeout - сколько ждать ответа каждой зависимости при проверке готовности
+const readinessTimeout = 3 * time.Second
+
+// registerHealthHandlers добавляет в mux эндпоинты мониторинга:
+//
+//	GET /healthz - процесс запущен
+//	GET /readyz  - доступны база данных и Telegram Bot API
+//	GET /metrics - метрики в формате Prometheus
+func registerHealthHandlers(mux *http.ServeMux, botAPI *tgbotapi.BotAPI, updatePool *bot.UpdatePool) {
+	metrics.RegisterOpenTickets(database.CountOpenTicketsByStatus)
+	metrics.RegisterGauge("update_queue_depth", "Обновления в очередях обработчиков.",
+		func() float64 { return float64(updatePool.Stats().Queued) })
+	metrics.RegisterGauge("update_queue_max_depth", "Длина самой длинной очереди обработчика.",
+		func() float64 { return float64(updatePool.Stats().MaxQueueDepth) })
+	metrics.RegisterGauge("update_workers_busy", "Обработчики, занятые обновлением.",
+		func() float64 { return float64(updatePool.Stats().Busy) })
+
+	mux.Handle("/metrics", metrics.Handler())
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	})
+	mux.HandleFunc("/readyz", readinessHandler(botAPI))
+}
+
+// readinessHandler проверяет соединение с БД и доступность Bot API (метод getMe)
+func readinessHandler(botAPI *tgbotapi.BotAPI) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		checks := map[string]string{
+			"database": checkReady(r.Context(), database.DB.PingContext),
+			"telegram": checkReady(r.Context(), func(context.Context) error {
+				_, err := botAPI.GetMe()
+				return err
+			}),
+		}
+
+		status, code := "ok", http.StatusOK
+		for _, result := range checks {
+			if result != "ok" {
+				status, code = "unavailable", http.StatusServiceUnavailable
+			}
+		}
+		writeJSON(w, code, map[string]interface{}{"status": status, "checks": checks})
+	}
+}
+
+// checkReady выполняет проверку не дольше readinessTimeout и возвращает "ok" или текст ошибки
+func checkReady(ctx context.Context, check func(context.Context) error) string {
+	ctx, cancel := context.WithTimeout(ctx, readinessTimeout)
+	defer cancel()
+
+	result := make(chan error, 1)
+	go func() { result <- check(ctx) }()
+	select {
+	case err := <-result:
+		if err != nil {
+			return err.Error()
+		}
+		return "ok"
+	case <-ctx.Done():
+		return "нет ответа за " + readinessTimeout.String()
+	}
+}
@@ -1,31 +1,199 @@
+// Package logger - журнал бота на основе log/slog.
+// Info, Warning и Error сохраняют привычный интерфейс Printf/Println/Fatalf, а With добавляет к записи
+// поля (user_id, chat_id, ticket_id, update_id). Записи фильтруются по уровню, пишутся в консоль
+// и в файл с ротацией; номера телефонов и тексты сообщений пользователей маскируются.
 package logger
 
 import (
+	"context"
+	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
 )
 
+// Options - параметры журнала; нулевые значения заменяются значениями по умолчанию
+type Options struct {
+	File             string // путь к файлу журнала; пусто - только консоль
+	Level            string // debug, info (по умолчанию), warn или error
+	Format           string // text (по умолчанию) или json
+	MaxSizeMB        int    // ротация при достижении размера (100 МБ)
+	RotateEveryHours int    // ротация по времени (раз в 24 часа)
+	MaxBackups       int    // сколько старых файлов хранить (7)
+	MaxAgeDays       int    // сколько дней хранить старые файлы (30)
+	LogMessageText   bool   // записывать тексты сообщений пользователей без маскировки
+}
+
+// Logger пишет записи одного уровня
+type Logger struct {
+	level slog.Level
+	attrs []slog.Attr
+}
+
 var (
-	Info    *log.Logger
-	Warning *log.Logger
-	Error   *log.Logger
+	Debug   = &Logger{level: slog.LevelDebug}
+	Info    = &Logger{level: slog.LevelInfo}
+	Warning = &Logger{level: slog.LevelWarn}
+	Error   = &Logger{level: slog.LevelError}
 )
 
-// InitLogger инициализирует логеры с записью в файл и консоль
-func InitLogger(logFilePath string) error {
-	logFile, err := os.OpenFile(logFilePath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+var (
+	// level - минимальный уровень записей, меняется без пересоздания обработчика (см. SetLevel)
+	level slog.LevelVar
+	// handler - обработчик записей; до вызова Init записи уходят в консоль
+	handler slog.Handler = newHandler(os.Stdout, "text")
+)
+
+// Init настраивает журнал
+func Init(opts Options) error {
+	minLevel, err := parseLevel(opts.Level)
 	if err != nil {
 		return err
 	}
+	format := strings.ToLower(opts.Format)
+	if format == "" {
+		format = "text"
+	}
+	if format != "text" && format != "json" {
+		return fmt.Errorf("неизвестный формат журнала %q (допустимо: text, json)", opts.Format)
+	}
 
-	// Мультиплексируем вывод в файл и консоль
-	multiWriter := io.MultiWriter(os.Stdout, logFile)
+	var out io.Writer = os.Stdout
+	if opts.File != "" {
+		file, err := openRotatingFile(opts.File, rotationPolicy{
+			maxSize:    int64(orDefault(opts.MaxSizeMB, 100)) << 20,
+			interval:   time.Duration(orDefault(opts.RotateEveryHours, 24)) * time.Hour,
+			maxBackups: orDefault(opts.MaxBackups, 7),
+			maxAge:     time.Duration(orDefault(opts.MaxAgeDays, 30)) * 24 * time.Hour,
+		})
+		if err != nil {
+			return err
+		}
+		// Мультиплексируем вывод в файл и консоль
+		out = io.MultiWriter(os.Stdout, file)
+	}
 
-	// Инициализируем логеры
-	Info = log.New(multiWriter, "INFO: ", log.Ldate|log.Ltime|log.Lshortfile)
-	Warning = log.New(multiWriter, "WARNING: ", log.Ldate|log.Ltime|log.Lshortfile)
-	Error = log.New(multiWriter, "ERROR: ", log.Ldate|log.Ltime|log.Lshortfile)
+	level.Set(minLevel)
+	redactText.Store(!opts.LogMessageText)
+	handler = newHandler(out, format)
+	return nil
+}
 
+// SetLevel меняет минимальный уровень записей во время работы
+func SetLevel(name string) error {
+	minLevel, err := parseLevel(name)
+	if err != nil {
+		return err
+	}
+	level.Set(minLevel)
 	return nil
 }
+
+// SetLogMessageText включает или выключает запись текстов сообщений пользователей без маскировки
+func SetLogMessageText(enabled bool) {
+	redactText.Store(!enabled)
+}
+
+// With возвращает логгер того же уровня, добавляющий к записям поля:
+// пары ключ-значение или slog.Attr (см. UserID, ChatID, TicketID, UpdateID)
+func (l *Logger) With(args ...any) *Logger {
+	attrs := make([]slog.Attr, 0, len(l.attrs)+len(args))
+	attrs = append(attrs, l.attrs...)
+	record := slog.NewRecord(time.Time{}, l.level, "", 0)
+	record.Add(args...)
+	record.Attrs(func(a slog.Attr) bool {
+		attrs = append(attrs, a)
+		return true
+	})
+	return &Logger{level: l.level, attrs: attrs}
+}
+
+// Printf пишет запись, форматируя сообщение как fmt.Sprintf
+func (l *Logger) Printf(format string, args ...any) {
+	l.log(fmt.Sprintf(format, args...))
+}
+
+// Println пишет запись, форматируя сообщение как fmt.Sprint
+func (l *Logger) Println(args ...any) {
+	l.log(strings.TrimSuffix(fmt.Sprintln(args...), "\n"))
+}
+
+// Fatalf пишет запись и завершает программу с кодом 1
+func (l *Logger) Fatalf(format string, args ...any) {
+	l.log(fmt.Sprintf(format, args...))
+	os.Exit(1)
+}
+
+func (l *Logger) log(msg string) {
+	ctx := context.Background()
+	h := handler
+	if !h.Enabled(ctx, l.level) {
+		return
+	}
+	// Пропускаем runtime.Callers, log и Printf/Println/Fatalf
+	var pcs [1]uintptr
+	runtime.Callers(3, pcs[:])
+	record := slog.NewRecord(time.Now(), l.level, redactPhones(msg), pcs[0])
+	record.AddAttrs(l.attrs...)
+	_ = h.Handle(ctx, record)
+}
+
+// UserID - поле с ID пользователя Telegram
+func UserID(id int64) slog.Attr { return slog.Int64("user_id", id) }
+
+// ChatID - поле с ID чата Telegram
+func ChatID(id int64) slog.Attr { return slog.Int64("chat_id", id) }
+
+// TicketID - поле с номером тикета
+func TicketID(id int) slog.Attr { return slog.Int("ticket_id", id) }
+
+// UpdateID - поле с ID обновления Telegram
+func UpdateID(id int) slog.Attr { return slog.Int("update_id", id) }
+
+func newHandler(out io.Writer, format string) slog.Handler {
+	opts := &slog.HandlerOptions{
+		AddSource: true,
+		Level:     &level,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			switch {
+			case a.Key == slog.SourceKey:
+				// Как раньше с log.Lshortfile: только имя файла и строка
+				if src, ok := a.Value.Any().(*slog.Source); ok {
+					a.Value = slog.StringValue(fmt.Sprintf("%s:%d", filepath.Base(src.File), src.Line))
+				}
+			case a.Value.Kind() == slog.KindString:
+				a.Value = slog.StringValue(redactPhones(a.Value.String()))
+			}
+			return a
+		},
+	}
+	if format == "json" {
+		return slog.NewJSONHandler(out, opts)
+	}
+	return slog.NewTextHandler(out, opts)
+}
+
+func parseLevel(s string) (slog.Level, error) {
+	switch strings.ToLower(s) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "", "info":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	}
+	return 0, fmt.Errorf("неизвестный уровень журнала %q (допустимо: debug, info, warn, error)", s)
+}
+
+func orDefault(v, def int) int {
+	if v <= 0 {
+		return def
+	}
+	return v
+}
@@ -0,0 +1,53 @@
+package logger
+
+import (
+	"fmt"
+	"log/slog"
+	"regexp"
+	"sync/atomic"
+	"unicode/utf8"
+)
+
+// redactText - маскировать ли тексты сообщений пользователей (см. Options.LogMessageText)
+var redactText atomic.Bool
+
+func init() {
+	redactText.Store(true)
+}
+
+// phonePattern - номера телефонов: международный формат с "+" или российский из 11 цифр на 7 или 8.
+// ID пользователей и чатов Telegram под него не попадают.
+var phonePattern = regexp.MustCompile(`\+\d[\d\s\-()]{8,16}\d|\b[78][\s\-(]*\d{3}[\s\-)]*\d{3}[\s\-]*\d{2}[\s\-]*\d{2}\b`)
+
+// redactPhones оставляет от номеров телефонов только последние две цифры
+func redactPhones(s string) string {
+	return phonePattern.ReplaceAllStringFunc(s, func(phone string) string {
+		digits := make([]byte, 0, len(phone))
+		for i := 0; i < len(phone); i++ {
+			if phone[i] >= '0' && phone[i] <= '9' {
+				digits = append(digits, phone[i])
+			}
+		}
+		return "***" + string(digits[len(digits)-2:])
+	})
+}
+
+// Text - текст сообщения пользователя. В журнал попадает только его длина,
+// если в настройках не включено Options.LogMessageText.
+type Text string
+
+// String возвращает текст или его маску
+func (t Text) String() string {
+	if !redactText.Load() {
+		return string(t)
+	}
+	if t == "" {
+		return `""`
+	}
+	return fmt.Sprintf("[текст скрыт, %d симв.]", utf8.RuneCountInString(string(t)))
+}
+
+// LogValue позволяет передавать Text как поле записи
+func (t Text) LogValue() slog.Value {
+	return slog.StringValue(t.String())
+}
@@ -0,0 +1,132 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestRedactPhones(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"+7 (912) 345-67-89", "***89"},
+		{"+79123456789", "***89"},
+		{"89123456789", "***89"},
+		{"8-912-345-67-89", "***89"},
+		{"7 912 345 67 89", "***89"},
+		{"+44 20 7946 0958", "***58"},
+		{"+1-202-555-0143", "***43"},
+		{"Контакт: +7 912 345-67-89, звонить вечером", "Контакт: ***89, звонить вечером"},
+		{"номера 89123456789 и +79990001122", "номера ***89 и ***22"},
+
+		// ID пользователей, чатов и тикетов не маскируются
+		{"user_id=123456789", "user_id=123456789"},
+		{"user_id=5123456789", "user_id=5123456789"},
+		{"user_id=7912345678", "user_id=7912345678"},
+		{"chat_id=-1001234567890", "chat_id=-1001234567890"},
+		{"chat_id=-1007912345678", "chat_id=-1007912345678"},
+		{"Тикет #78912 создан", "Тикет #78912 создан"},
+		{"ticket_id=8912345", "ticket_id=8912345"},
+		{"update_id=891234567890", "update_id=891234567890"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := redactPhones(tt.in); got != tt.want {
+			t.Errorf("redactPhones(%q) = %q, ожидалось %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+// setRedactText задает маскировку текстов до конца теста
+func setRedactText(t *testing.T, enabled bool) {
+	previous := redactText.Load()
+	redactText.Store(enabled)
+	t.Cleanup(func() { redactText.Store(previous) })
+}
+
+func TestText(t *testing.T) {
+	setRedactText(t, true)
+	tests := []struct {
+		text Text
+		want string
+	}{
+		{"Не могу войти", "[текст скрыт, 13 симв.]"},
+		{"hello", "[текст скрыт, 5 симв.]"},
+		{"", `""`},
+	}
+	for _, tt := range tests {
+		if got := tt.text.String(); got != tt.want {
+			t.Errorf("Text(%q).String() = %q, ожидалось %q", string(tt.text), got, tt.want)
+		}
+		if got := tt.text.LogValue().String(); got != tt.want {
+			t.Errorf("Text(%q).LogValue() = %q, ожидалось %q", string(tt.text), got, tt.want)
+		}
+	}
+
+	SetLogMessageText(true)
+	if got := Text("Не могу войти").String(); got != "Не могу войти" {
+		t.Errorf("с LogMessageText: %q", got)
+	}
+}
+
+// captureJSON направляет записи в буфер в формате json до конца теста
+func captureJSON(t *testing.T) *bytes.Buffer {
+	var buf bytes.Buffer
+	previous, previousLevel := handler, level.Level()
+	handler = newHandler(&buf, "json")
+	t.Cleanup(func() {
+		handler = previous
+		level.Set(previousLevel)
+	})
+	return &buf
+}
+
+func TestRecordRedaction(t *testing.T) {
+	setRedactText(t, true)
+	buf := captureJSON(t)
+
+	Info.With(UserID(7912345678), ChatID(-1001234567890), "text", Text("мой номер +7 912 345-67-89")).
+		Printf("Пользователь оставил телефон %s", "8 912 345 67 89")
+
+	var record map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("запись %s: %v", buf.Bytes(), err)
+	}
+	if record["msg"] != "Пользователь оставил телефон ***89" {
+		t.Errorf("msg = %q", record["msg"])
+	}
+	if record["text"] != "[текст скрыт, 26 симв.]" {
+		t.Errorf("text = %q", record["text"])
+	}
+	if record["user_id"] != float64(7912345678) || record["chat_id"] != float64(-1001234567890) {
+		t.Errorf("ID изменены: %v, %v", record["user_id"], record["chat_id"])
+	}
+
+	// Без маскировки текста номера телефонов в нем все равно скрываются
+	buf.Reset()
+	SetLogMessageText(true)
+	Info.With("text", Text("мой номер +7 912 345-67-89")).Printf("Сообщение")
+	record = nil
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("запись %s: %v", buf.Bytes(), err)
+	}
+	if record["text"] != "мой номер ***89" {
+		t.Errorf("text без маскировки = %q", record["text"])
+	}
+}
+
+func TestSetLevel(t *testing.T) {
+	buf := captureJSON(t)
+	if err := SetLevel("warn"); err != nil {
+		t.Fatalf("SetLevel: %v", err)
+	}
+	Info.Printf("не попадет в журнал")
+	Warning.Printf("попадет в журнал")
+	if bytes.Contains(buf.Bytes(), []byte("не попадет")) || !bytes.Contains(buf.Bytes(), []byte("попадет в журнал")) {
+		t.Fatalf("записи при уровне warn: %s", buf.Bytes())
+	}
+	if err := SetLevel("verbose"); err == nil {
+		t.Fatal("неизвестный уровень принят")
+	}
+}
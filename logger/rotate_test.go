@@ -0,0 +1,171 @@
+package logger
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// logPolicy - политика, при которой короткие записи теста сами не вызывают ротацию
+var logPolicy = rotationPolicy{maxSize: 1 << 20, interval: time.Hour, maxBackups: 7, maxAge: 24 * time.Hour}
+
+func openTestFile(t *testing.T, dir string, policy rotationPolicy) *rotatingFile {
+	t.Helper()
+	f, err := openRotatingFile(filepath.Join(dir, "bot.log"), policy)
+	if err != nil {
+		t.Fatalf("openRotatingFile: %v", err)
+	}
+	t.Cleanup(func() { f.file.Close() })
+	return f
+}
+
+func write(t *testing.T, f *rotatingFile, s string) {
+	t.Helper()
+	if _, err := f.Write([]byte(s)); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+}
+
+// backups возвращает содержимое старых файлов журнала от старых к новым
+func backups(t *testing.T, dir string) []string {
+	t.Helper()
+	names, err := filepath.Glob(filepath.Join(dir, "bot-*.log"))
+	if err != nil {
+		t.Fatalf("Glob: %v", err)
+	}
+	sort.Strings(names)
+	var contents []string
+	for _, name := range names {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatalf("ReadFile: %v", err)
+		}
+		contents = append(contents, string(data))
+	}
+	return contents
+}
+
+func readLog(t *testing.T, dir string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(dir, "bot.log"))
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	return string(data)
+}
+
+func TestRotateBySize(t *testing.T) {
+	dir := t.TempDir()
+	policy := logPolicy
+	policy.maxSize = 10
+	f := openTestFile(t, dir, policy)
+
+	write(t, f, "first\n")
+	write(t, f, "second\n") // 6+7 > 10: first уходит в архив
+	// Имена архивов различаются по миллисекундам
+	time.Sleep(2 * time.Millisecond)
+	write(t, f, "third\n")
+
+	if got := backups(t, dir); strings.Join(got, "|") != "first\n|second\n" {
+		t.Fatalf("архивы: %q", got)
+	}
+	if got := readLog(t, dir); got != "third\n" {
+		t.Fatalf("текущий файл: %q", got)
+	}
+
+	// Запись больше maxSize в пустой файл не приводит к ротации пустого файла
+	f2 := openTestFile(t, t.TempDir(), policy)
+	write(t, f2, strings.Repeat("x", 20))
+	if f2.size != 20 {
+		t.Fatalf("размер после большой записи: %d", f2.size)
+	}
+}
+
+func TestRotateByTime(t *testing.T) {
+	dir := t.TempDir()
+	f := openTestFile(t, dir, logPolicy)
+
+	write(t, f, "old\n")
+	write(t, f, "same hour\n")
+	if got := backups(t, dir); len(got) != 0 {
+		t.Fatalf("ротация до истечения интервала: %q", got)
+	}
+
+	f.mu.Lock()
+	f.openedAt = time.Now().Add(-logPolicy.interval)
+	f.mu.Unlock()
+	write(t, f, "new\n")
+
+	if got := backups(t, dir); len(got) != 1 || got[0] != "old\nsame hour\n" {
+		t.Fatalf("архивы: %q", got)
+	}
+	if got := readLog(t, dir); got != "new\n" {
+		t.Fatalf("текущий файл: %q", got)
+	}
+}
+
+func TestReopenKeepsRotationTime(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "bot.log")
+	if err := os.WriteFile(path, []byte("before restart\n"), 0640); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	modified := time.Now().Add(-2 * logPolicy.interval)
+	if err := os.Chtimes(path, modified, modified); err != nil {
+		t.Fatalf("Chtimes: %v", err)
+	}
+
+	// Перезапуск не откладывает ротацию файла, начатого раньше интервала
+	f := openTestFile(t, dir, logPolicy)
+	write(t, f, "after restart\n")
+	if got := backups(t, dir); len(got) != 1 || got[0] != "before restart\n" {
+		t.Fatalf("архивы: %q", got)
+	}
+}
+
+func TestPruneRetention(t *testing.T) {
+	ages := []time.Duration{time.Hour, 2 * time.Hour, 25 * time.Hour, 49 * time.Hour, 100 * time.Hour}
+	// Файлы, которые не являются архивами этого журнала, не удаляются
+	foreign := []string{"bot-notes.log", "other-2020-01-01T00-00-00.000.log", "bot-2020-01-01T00-00-00.000.txt"}
+	tests := []struct {
+		name       string
+		maxBackups int
+		maxAge     time.Duration
+		kept       int // сколько самых новых архивов остается
+	}{
+		{"по числу", 2, 30 * 24 * time.Hour, 2},
+		{"по возрасту", 10, 36 * time.Hour, 3},
+		{"оба ограничения", 1, 36 * time.Hour, 1},
+	}
+	for _, tt := range tests {
+		dir := t.TempDir()
+		var names []string
+		for _, age := range ages {
+			names = append(names, "bot-"+time.Now().Add(-age).Format(backupTimeFormat)+".log")
+		}
+		for _, name := range append(names, foreign...) {
+			if err := os.WriteFile(filepath.Join(dir, name), nil, 0640); err != nil {
+				t.Fatalf("WriteFile: %v", err)
+			}
+		}
+
+		policy := logPolicy
+		policy.maxBackups, policy.maxAge = tt.maxBackups, tt.maxAge
+		openTestFile(t, dir, policy)
+
+		for i, name := range names {
+			_, err := os.Stat(filepath.Join(dir, name))
+			if exists := err == nil; exists != (i < tt.kept) {
+				t.Errorf("%s: архив возрастом %v существует: %v", tt.name, ages[i], exists)
+			}
+		}
+		for _, name := range foreign {
+			if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+				t.Errorf("%s: удален чужой файл %s", tt.name, name)
+			}
+		}
+	}
+}
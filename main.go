@@ -6,50 +6,149 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
-	"path/filepath"
-	"strconv"
-	"strings"
-	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
+	"supportTicketBotGo/api"
 	"supportTicketBotGo/bot"
 	"supportTicketBotGo/config"
 	"supportTicketBotGo/database"
 	"supportTicketBotGo/logger"
+	"supportTicketBotGo/metrics"
+	"supportTicketBotGo/webhook"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
 
 func main() {
 	// Парсим флаги командной строки
-	configPath := flag.String("config", "config.json", "Путь к конфигурационному файлу")
+	configPath := flag.String("config", "config.json", "Путь к конфигурационному файлу (JSON или YAML)")
 	webhookHost := flag.String("webhook", "", "URL для webhook (например, https://example.com)")
-	port := flag.String("port", "8443", "Порт для webhook сервера")
+	port := flag.String("port", "8443", "Порт HTTP сервера (webhook и внешние эндпоинты)")
+	var overrides config.Overrides
+	flag.Var(&overrides, "set", "Значение настройки путь=значение поверх файла и окружения (можно указывать несколько раз)")
 	flag.Parse()
 
-	// Загружаем конфигурацию
-	err := config.LoadConfig(*configPath)
+	// Загружаем конфигурацию: значения по умолчанию, файл, переменные окружения, флаги -set
+	err := config.LoadConfig(configFile(*configPath), overrides)
 	if err != nil {
-		panic("Ошибка загрузки конфигурации: " + err.Error())
+		fmt.Fprintf(os.Stderr, "Ошибка загрузки конфигурации: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Настройки запуска берутся из первого снимка; изменения по SIGHUP применяются в reloadConfig
+	cfg := config.Get()
+
+	// Подкоманда config показывает итоговую конфигурацию, в том числе некорректную
+	if flag.Arg(0) == "config" {
+		os.Exit(runConfigCommand(flag.Args()[1:]))
+	}
+
+	// Сообщаем обо всех ошибках конфигурации сразу, до подключения к чему-либо
+	err = cfg.Validate(*webhookHost != "")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
 	}
 
 	// Инициализируем логер
-	err = logger.InitLogger(config.AppConfig.LogFile)
+	logConfig := cfg.Log
+	err = logger.Init(logger.Options{
+		File:             cfg.LogFile,
+		Level:            logConfig.Level,
+		Format:           logConfig.Format,
+		MaxSizeMB:        logConfig.MaxSizeMB,
+		RotateEveryHours: logConfig.RotateEveryHours,
+		MaxBackups:       logConfig.MaxBackups,
+		MaxAgeDays:       logConfig.MaxAgeDays,
+		LogMessageText:   logConfig.LogMessageText,
+	})
 	if err != nil {
 		panic("Ошибка инициализации логера: " + err.Error())
 	}
 	logger.Info.Println("Логер инициализирован")
 
-	// Подключаемся к базе данных
+	// Подкоманда migrate работает с базой и завершает процесс, не запуская бота
+	if flag.Arg(0) == "migrate" {
+		os.Exit(runMigrateCommand(flag.Args()[1:]))
+	}
+
+	// Подкоманда storage переносит файлы старых версий в хранилище и завершает процесс
+	if flag.Arg(0) == "storage" {
+		os.Exit(runStorageCommand(flag.Args()[1:]))
+	}
+
+	// Подкоманда broadcast управляет рассылками, отправляет их запущенный бот
+	if flag.Arg(0) == "broadcast" {
+		os.Exit(runBroadcastCommand(flag.Args()[1:]))
+	}
+
+	// Подкоманда webhooks показывает доставки вебхуков и возвращает их в очередь
+	if flag.Arg(0) == "webhooks" {
+		os.Exit(runWebhooksCommand(flag.Args()[1:]))
+	}
+
+	// Подкоманда categories управляет справочником категорий тикетов
+	if flag.Arg(0) == "categories" {
+		os.Exit(runCategoriesCommand(flag.Args()[1:]))
+	}
+
+	// Проверяем подписчиков вебхуков до подключения к базе: события пишутся с первых записей
+	subscribers := webhookSubscribers()
+	if err := webhook.Validate(subscribers); err != nil {
+		logger.Error.Fatalf("Ошибка настройки вебхуков: %v", err)
+	}
+	database.SetWebhookSubscriptions(webhook.Subscriptions(subscribers))
+
+	// Подключаемся к базе данных и проверяем схему до подготовки запросов
+	err = database.OpenDB()
+	if err != nil {
+		logger.Error.Fatalf("Ошибка подключения к базе данных: %v", err)
+	}
+	err = ensureSchema(cfg.Database.AutoMigrate)
+	if err != nil {
+		logger.Error.Fatalf("Ошибка проверки схемы БД: %v", err)
+	}
 	err = database.ConnectDBOptimized()
 	if err != nil {
 		logger.Error.Fatalf("Ошибка подключения к базе данных: %v", err)
 	}
 	logger.Info.Println("Подключение к базе данных установлено")
 
+	// Настраиваем хранилище состояний диалогов
+	stateTTL := bot.DefaultStateTTL
+	if cfg.StateStore.TTLMinutes > 0 {
+		stateTTL = time.Duration(cfg.StateStore.TTLMinutes) * time.Minute
+	}
+	var states bot.StateStore
+	switch cfg.StateStore.Backend {
+	case "", "memory":
+		states = bot.NewMemoryStateStore(stateTTL)
+		logger.Info.Println("Состояния диалогов хранятся в памяти процесса")
+	case "postgres":
+		states = bot.NewPostgresStateStore(stateTTL)
+		logger.Info.Println("Состояния диалогов хранятся в PostgreSQL")
+	default:
+		logger.Error.Fatalf("Неизвестное хранилище состояний: %s", cfg.StateStore.Backend)
+	}
+
+	// Настраиваем хранилище вложений и аватаров
+	files, err := openStorage()
+	if err != nil {
+		logger.Error.Fatalf("Ошибка открытия хранилища файлов: %v", err)
+	}
+	logger.Info.Printf("Хранилище файлов: %s", storageBackendName())
+	deps := bot.NewPostgresDeps(states, files)
+	apiServer := api.NewServer(api.Deps{
+		Users: deps.Users, Tickets: deps.Tickets, Messages: deps.Messages,
+		Attachments: deps.Attachments, Storage: deps.Storage,
+	}, cfg.APIToken)
+
 	// Инициализируем Telegram бота
-	botAPI, err := tgbotapi.NewBotAPI(config.AppConfig.TelegramToken)
+	// Запросы к Bot API учитываются в метриках
+	botAPI, err := tgbotapi.NewBotAPIWithClient(cfg.TelegramToken, tgbotapi.APIEndpoint,
+		metrics.InstrumentTelegramClient(&http.Client{}))
 	if err != nil {
 		logger.Error.Fatalf("Ошибка инициализации Telegram бота: %v", err)
 	}
@@ -59,13 +158,54 @@ func main() {
 
 	logger.Info.Printf("Авторизован как %s", botAPI.Self.UserName)
 
+	// Все исходящие сообщения идут через очередь с учетом ограничений Telegram
+	dispatcher := bot.NewDispatcher(botAPI, rateLimits(cfg))
+	handler := bot.NewHandler(botAPI, deps, dispatcher)
+
+	// Запускаем доставку уведомлений об ответах поддержки и смене статуса тикетов
+	notifier, err := bot.NewNotifier(deps, dispatcher, database.ConnString())
+	if err != nil {
+		logger.Error.Fatalf("Ошибка запуска уведомлений: %v", err)
+	}
+	database.OnTicketEvent(notifier.Wake)
+	notifier.Start()
+
+	// Запускаем отправку рассылок
+	broadcaster := bot.NewBroadcaster(dispatcher, cfg.Broadcast.RatePerSecond)
+	broadcaster.Start()
+
+	// Запускаем доставку вебхуков. Без подписчиков события не записываются, но доставки,
+	// оставшиеся в очереди, все равно дорабатываются (и уходят в dead как удаленные).
+	webhookSender := webhook.NewSender(subscribers, webhookOptions())
+	database.OnWebhookEvent(webhookSender.Wake)
+	webhookSender.Start()
+
 	// Канал для перехвата сигналов завершения
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
 
-	// Флаг для корректного завершения работы бота
-	isRunning := true
-	var wg sync.WaitGroup
+	// По SIGHUP перечитываем конфигурацию без перезапуска
+	reloads := watchReload(configFile(*configPath), overrides, *webhookHost != "", dispatcher, broadcaster)
+
+	// Обновления обрабатываются пулом: обновления одного пользователя - по порядку
+	updatePool := bot.NewUpdatePool(cfg.Updates.Workers, cfg.Updates.QueueSize,
+		func(update tgbotapi.Update) { handleUpdate(handler, update) })
+
+	// HTTP-эндпоинты (/superconnect, /admin/, /api/v1/, мониторинг) работают в обоих режимах,
+	// в режиме webhook на том же сервере принимаются обновления от Telegram
+	mux := http.NewServeMux()
+	mux.HandleFunc("/superconnect", superConnectHandler(dispatcher))
+	registerAdminHandlers(mux, broadcaster, updatePool)
+	registerHealthHandlers(mux, botAPI, updatePool)
+	apiServer.Register(mux)
+
+	// В режиме long polling обновления, полученные после сигнала завершения, еще не подтверждены
+	// Telegram (подтверждением служит следующий запрос getUpdates): их не обрабатываем,
+	// Telegram отдаст их снова после перезапуска
+	var accepting atomic.Bool
+	accepting.Store(true)
+	var updates tgbotapi.UpdatesChannel
+	var webhookUpdates *webhookReceiver
 
 	// Определяем режим работы: webhook или long polling
 	if *webhookHost != "" {
@@ -74,7 +214,7 @@ func main() {
 		// *port - это внутренний порт, на котором слушает Go приложение, например, "8443"
 
 		// Формируем публичный URL, который будет вызван Telegram
-		publicWebhookURL := *webhookHost + "/webhook/" + config.AppConfig.SecureWebhookToken
+		publicWebhookURL := *webhookHost + "/webhook/" + cfg.SecureWebhookToken
 		logger.Info.Printf("Публичный URL для Telegram webhook: %s", publicWebhookURL)
 
 		// Настраиваем webhook для Telegram
@@ -101,153 +241,104 @@ func main() {
 			logger.Warning.Printf("URL вебхука в Telegram (%s) не совпадает с настроенным (%s)", info.URL, publicWebhookURL)
 		}
 
-		// Настраиваем внутренний HTTP-сервер для приема обновлений от Nginx.
-		// Nginx проксирует запросы с https://mb0.tech/webhook/BOT_TOKEN на http://localhost:PORT/BOT_TOKEN.
-		// Поэтому ListenForWebhook должен слушать на "/"+botAPI.Token.
-		internalWebhookPath := "/" + config.AppConfig.SecureWebhookToken
-		updates := botAPI.ListenForWebhook(internalWebhookPath)
+		// Nginx проксирует запросы с https://mb0.tech/webhook/TOKEN на http://localhost:PORT/TOKEN,
+		// поэтому обновления принимаются на пути "/"+secure_webhook_token
+		internalWebhookPath := "/" + cfg.SecureWebhookToken
+		webhookUpdates = newWebhookReceiver(botAPI)
+		updates = webhookUpdates.Updates()
+		mux.Handle(internalWebhookPath, webhookUpdates)
 		logger.Info.Printf("Внутренний HTTP-сервер настроен на путь: %s", internalWebhookPath)
+	} else {
+		// Режим long polling
+		// Telegram не отдает обновления через getUpdates, пока установлен webhook,
+		// поэтому на всякий случай удаляем его (накопленные обновления сохраняются)
+		_, err := botAPI.Request(tgbotapi.DeleteWebhookConfig{DropPendingUpdates: false})
+		if err != nil {
+			logger.Error.Fatalf("Ошибка при удалении webhook перед запуском long polling: %v", err)
+		}
 
-		// Добавляем обработчик для /superconnect
-		http.HandleFunc("/superconnect", func(w http.ResponseWriter, r *http.Request) {
-			// Проверяем, что метод запроса - POST
-			if r.Method != http.MethodPost {
-				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-				return
-			}
-
-			// Парсим форму для получения параметров
-			if err := r.ParseForm(); err != nil {
-				logger.Error.Printf("Ошибка при парсинге формы: %v", err)
-				http.Error(w, "Bad request", http.StatusBadRequest)
-				return
-			}
-
-			// Получаем параметры
-			senderID := r.FormValue("sender_id")
-			message := r.FormValue("message")
-			accepterID := r.FormValue("accepter_id")
-			token := r.FormValue("super_connect_token")
-
-			// Проверяем токен
-			if token != config.AppConfig.SuperConnectToken {
-				logger.Error.Printf("Неверный токен: %s", token)
-				http.Error(w, "Unauthorized", http.StatusUnauthorized)
-				return
-			}
-
-			// Проверяем наличие всех необходимых параметров
-			if senderID == "" || message == "" || accepterID == "" {
-				logger.Error.Printf("Отсутствуют обязательные параметры")
-				http.Error(w, "Missing required parameters", http.StatusBadRequest)
-				return
-			}
-
-			// Преобразуем accepterID в int64
-			userID, err := strconv.ParseInt(accepterID, 10, 64)
-			if err != nil {
-				logger.Error.Printf("Ошибка при преобразовании accepter_id: %v", err)
-				http.Error(w, "Invalid accepter_id", http.StatusBadRequest)
-				return
-			}
-
-			// Получаем информацию о пользователе
-			user, err := database.GetUserByID(userID)
-			if err != nil {
-				logger.Error.Printf("Пользователь не найден: %v", err)
-				http.Error(w, "User not found", http.StatusNotFound)
-				return
-			}
-
-			// Формируем сообщение с ФИО пользователя
-			fullMessage := fmt.Sprintf("📢 *Уведомление*\n\nОт: %s\n\n%s", user.FullName, message)
-
-			// Отправляем сообщение пользователю
-			msg := tgbotapi.NewMessage(userID, fullMessage)
-			msg.ParseMode = "Markdown"
-			_, err = botAPI.Send(msg)
-			if err != nil {
-				logger.Error.Printf("Ошибка при отправке сообщения: %v", err)
-				http.Error(w, "Failed to send message", http.StatusInternalServerError)
-				return
-			}
-
-			// Отправляем успешный ответ
-			w.WriteHeader(http.StatusOK)
-			w.Write([]byte("Message sent successfully"))
-		})
-
-		// Запускаем HTTP-сервер в отдельной горутине на внутреннем порту *port
-		go func() {
-			logger.Info.Printf("Запуск внутреннего webhook HTTP-сервера на порту %s", *port)
-			// http.ListenAndServe будет слушать на всех интерфейсах на :*port
-			// Путь internalWebhookPath обрабатывается через botAPI.ListenForWebhook
-			err := http.ListenAndServe(":"+*port, nil)
-			if err != nil {
-				// Эта ошибка возникнет, если сервер не сможет запуститься (например, порт занят)
-				// или если он неожиданно остановится.
-				// Если остановка плановая (через sigChan), эта горутина просто завершится.
-				// Для более чистого завершения HTTP-сервера при сигнале можно использовать http.Server с Shutdown().
-				logger.Error.Fatalf("Ошибка при работе внутреннего webhook HTTP-сервера: %v", err)
-			}
-		}()
-
-		// Обрабатываем обновления
-		go func() {
-			for update := range updates {
-				if !isRunning {
-					break
-				}
-
-				wg.Add(1)
-				go func(upd tgbotapi.Update) {
-					defer wg.Done()
-					handleUpdate(botAPI, upd)
-				}(update)
-			}
-			logger.Info.Println("Канал обновлений закрыт, прекращаем прием новых задач.")
-		}()
+		updateConfig := tgbotapi.NewUpdate(0)
+		// Долгий опрос короче времени ожидания при завершении: остановка не ждет лишнего
+		updateConfig.Timeout = 25
+		updates = botAPI.GetUpdatesChan(updateConfig)
+		logger.Info.Println("Запущен режим long polling")
+	}
+
+	server, err := startHTTPServer(":"+*port, mux)
+	if err != nil {
+		logger.Error.Fatalf("Ошибка запуска HTTP-сервера на порту %s: %v", *port, err)
 	}
+	logger.Info.Printf("HTTP-сервер запущен на порту %s", *port)
+
+	// Обрабатываем обновления
+	dispatchDone := make(chan struct{})
+	go func() {
+		dispatchUpdates(updates, updatePool, &accepting)
+		close(dispatchDone)
+	}()
 
 	// Начинаем обработку сообщений
 	logger.Info.Println("Начинаем обработку сообщений")
 
-	// Ожидаем сигнал завершения
-	<-sigChan
-
-	// Устанавливаем флаг завершения
-	logger.Info.Println("Получен сигнал завершения, останавливаем обработку новых обновлений...")
-	isRunning = false
+	// Ожидаем сигнал завершения или остановку HTTP-сервера
+	select {
+	case <-sigChan:
+		logger.Info.Println("Получен сигнал завершения, останавливаем прием новых обновлений...")
+	case err := <-server.Errors():
+		logger.Error.Printf("Ошибка при работе HTTP-сервера: %v. Завершаем работу...", err)
+	}
+	deadline := time.Now().Add(shutdownTimeout)
 
-	// Если использовался webhook, удаляем его при завершении
 	if *webhookHost != "" {
-		// _, err := botAPI.RemoveWebhook() // Старый способ
-		_, err := botAPI.Request(tgbotapi.DeleteWebhookConfig{DropPendingUpdates: false}) // Новый способ удаления вебхука
+		// Удаляем webhook, чтобы Telegram копил обновления до запуска новой версии
+		_, err := botAPI.Request(tgbotapi.DeleteWebhookConfig{DropPendingUpdates: false})
 		if err != nil {
 			logger.Error.Printf("Ошибка при удалении webhook: %v", err)
 		} else {
 			logger.Info.Println("Webhook успешно удален")
 		}
+	} else {
+		accepting.Store(false)
+		// Останавливаем цикл getUpdates, канал обновлений будет закрыт
+		botAPI.StopReceivingUpdates()
+		logger.Info.Println("Получение обновлений через long polling остановлено")
 	}
 
-	logger.Info.Println("Ожидание завершения активных обработчиков...")
-	// Создаем канал для сигнализации о завершении wg.Wait()
-	waitGroupDone := make(chan struct{})
-	go func() {
-		wg.Wait() // Ожидаем завершения всех горутин handleUpdate
-		close(waitGroupDone)
-	}()
+	// Прекращаем прием запросов и дожидаемся начатых: принятые вебхуки попадут в канал обновлений
+	if err := server.Shutdown(time.Until(deadline)); err != nil {
+		logger.Error.Printf("Ошибка при остановке HTTP-сервера: %v", err)
+	} else {
+		logger.Info.Println("HTTP-сервер остановлен")
+	}
+	// Если Shutdown не дождался запросов, ждущих места в очереди, они получат 503
+	if webhookUpdates != nil {
+		webhookUpdates.Close()
+	}
 
-	// Устанавливаем таймаут для ожидания
+	logger.Info.Println("Ожидание завершения активных обработчиков...")
 	select {
-	case <-waitGroupDone:
-		logger.Info.Println("Все обработчики успешно завершили работу.")
-	case <-time.After(30 * time.Second): // Таймаут, например, 30 секунд
-		logger.Error.Println("Тайм-аут ожидания завершения обработчиков. Некоторые задачи могли не завершиться.")
+	case <-dispatchDone:
+		updatePool.Close()
+		if updatePool.Wait(time.Until(deadline)) {
+			logger.Info.Println("Все обработчики успешно завершили работу.")
+		} else {
+			logger.Error.Printf("Тайм-аут ожидания завершения обработчиков. Необработанных обновлений: %d", updatePool.Stats().Queued)
+		}
+	case <-time.After(time.Until(deadline)):
+		logger.Error.Println("Тайм-аут ожидания закрытия канала обновлений. Некоторые задачи могли не завершиться.")
 	}
 
 	// Закрываем соединение с базой данных и завершаем программу
 	logger.Info.Println("Закрываем соединения...")
+	reloads.Stop()
+	notifier.Stop()
+	broadcaster.Stop()
+	webhookSender.Stop()
+	if dispatcher.Stop(10 * time.Second) {
+		logger.Info.Println("Очередь исходящих сообщений отправлена.")
+	} else {
+		logger.Error.Println("Тайм-аут отправки очереди исходящих сообщений. Часть сообщений не доставлена.")
+	}
 	if database.DB != nil {
 		err := database.DB.Close()
 		if err != nil {
@@ -259,27 +350,69 @@ func main() {
 	logger.Info.Println("Бот завершает работу")
 }
 
+// dispatchUpdates читает обновления из канала и передает их в пул обработчиков.
+// Используется и в режиме webhook, и в режиме long polling.
+// Канал читается до закрытия; обновления, пришедшие после сброса accepting, пропускаются.
+func dispatchUpdates(updates tgbotapi.UpdatesChannel, pool *bot.UpdatePool, accepting *atomic.Bool) {
+	for update := range updates {
+		metrics.UpdateReceived(update)
+		if !accepting.Load() {
+			logger.Info.Printf("Обновление %d получено после сигнала завершения и будет обработано после перезапуска", update.UpdateID)
+			continue
+		}
+		pool.Submit(update)
+	}
+	logger.Info.Println("Канал обновлений закрыт, прекращаем прием новых задач.")
+}
+
+// updateLogFields возвращает поля журнала для обновления: update_id, user_id и chat_id
+func updateLogFields(update tgbotapi.Update) []any {
+	fields := []any{logger.UpdateID(update.UpdateID)}
+	if user := update.SentFrom(); user != nil {
+		fields = append(fields, logger.UserID(user.ID))
+	}
+	if chat := update.FromChat(); chat != nil {
+		fields = append(fields, logger.ChatID(chat.ID))
+	}
+	return fields
+}
+
 // handleUpdate обрабатывает обновления от Telegram API
-func handleUpdate(botAPI *tgbotapi.BotAPI, update tgbotapi.Update) {
+func handleUpdate(handler *bot.Handler, update tgbotapi.Update) {
+	fields := updateLogFields(update)
 	defer func() {
 		if r := recover(); r != nil {
-			logger.Error.Printf("Восстановление после паники при обработке обновления: %v", r)
+			logger.Error.With(fields...).Printf("Восстановление после паники при обработке обновления: %v", r)
 		}
 	}()
 
-	// Обрабатываем только сообщения
+	// Время обработки учитывается в метриках; обычные сообщения учитывает Handler.HandleMessage
+	// по состоянию диалога пользователя
+	start := time.Now()
+
+	// Нажатия на inline-кнопки
+	if update.CallbackQuery != nil {
+		defer metrics.ObserveHandler("callback", start)
+		handler.HandleCallbackQuery(update.CallbackQuery)
+		return
+	}
+
+	// Остальные типы обновлений пропускаем
 	if update.Message == nil {
 		return
 	}
 
-	logger.Info.Printf("[%s] %s", update.Message.From.UserName, update.Message.Text)
+	// Текст сообщения - персональные данные: по умолчанию в журнал попадает только его длина
+	logger.Info.With(fields...).Printf("[%s] %s", update.Message.From.UserName, logger.Text(update.Message.Text))
 
 	// Проверяем, является ли сообщение командой
 	if update.Message.IsCommand() {
 		switch update.Message.Command() {
 		case "start":
-			bot.HandleStart(botAPI, update.Message)
+			defer metrics.ObserveHandler("command_start", start)
+			handler.HandleStart(update.Message)
 		case "help":
+			defer metrics.ObserveHandler("command_help", start)
 			// Добавляем обработку команды help
 			helpText := "🤖 *Справка по использованию бота*\n\n" +
 				"Этот бот предназначен для создания и управления тикетами поддержки.\n\n" +
@@ -296,158 +429,24 @@ func handleUpdate(botAPI *tgbotapi.BotAPI, update tgbotapi.Update) {
 
 			msg := tgbotapi.NewMessage(update.Message.Chat.ID, helpText)
 			msg.ParseMode = "Markdown"
-			bot.SafeSendMessage(botAPI, msg)
+			handler.SafeSendMessage(msg)
 
 			// Отправляем случайный совет
-			bot.SendRandomTip(botAPI, update.Message.Chat.ID)
+			handler.SendRandomTip(update.Message.Chat.ID)
+		case "agent":
+			defer metrics.ObserveHandler("command_agent", start)
+			// Режим агента поддержки
+			handler.HandleAgentCommand(update.Message)
 		case "ticket":
+			defer metrics.ObserveHandler("command_ticket", start)
 			// Обработка команды /ticket <ID>
-			args := update.Message.CommandArguments()
-			if args == "" {
-				msg := tgbotapi.NewMessage(update.Message.Chat.ID, "⚠️ Пожалуйста, укажите ID тикета: /ticket <ID>")
-				bot.SafeSendMessage(botAPI, msg)
-				return
-			}
-
-			// Преобразуем ID тикета в число
-			ticketID, err := strconv.Atoi(args)
-			if err != nil {
-				msg := tgbotapi.NewMessage(update.Message.Chat.ID, "⚠️ Некорректный ID тикета. Используйте формат: /ticket <ID>")
-				bot.SafeSendMessage(botAPI, msg)
-				return
-			}
-
-			// Получаем информацию о тикете
-			ticket, err := database.GetTicketByID(ticketID)
-			if err != nil {
-				logger.Error.Printf("Ошибка при получении тикета %d: %v", ticketID, err)
-				msg := tgbotapi.NewMessage(update.Message.Chat.ID, "⚠️ Тикет не найден или произошла ошибка при его получении.")
-				bot.SafeSendMessage(botAPI, msg)
-				return
-			}
-
-			// Проверяем, принадлежит ли тикет пользователю
-			if ticket.UserID != update.Message.From.ID {
-				msg := tgbotapi.NewMessage(update.Message.Chat.ID, "⚠️ У вас нет доступа к этому тикету.")
-				bot.SafeSendMessage(botAPI, msg)
-				return
-			}
-
-			// Получаем сообщения тикета
-			messages, err := database.GetTicketMessages(ticketID)
-			if err != nil {
-				logger.Error.Printf("Ошибка при получении сообщений тикета %d: %v", ticketID, err)
-				msg := tgbotapi.NewMessage(update.Message.Chat.ID, "⚠️ Ошибка при получении сообщений тикета.")
-				bot.SafeSendMessage(botAPI, msg)
-				return
-			}
-
-			// Форматируем даты
-			createdDate := ticket.CreatedAt.Format("02.01.2006 15:04")
-			closedDate := ""
-			if ticket.Status == "закрыт" && ticket.ClosedAt.Valid {
-				closedDate = fmt.Sprintf("\n🔒 Закрыт: %s", ticket.ClosedAt.Time.Format("02.01.2006 15:04"))
-			}
-
-			// Определяем эмодзи статуса
-			statusEmoji := bot.GetStatusEmoji(ticket.Status)
-
-			// Создаем сообщение с информацией о тикете
-			ticketInfo := fmt.Sprintf(
-				"🔖 *Тикет #%d*\n%s %s\n\n📝 Категория: %s\n📅 Создан: %s%s\n💬 Сообщений: %d\n\n*Описание:*\n%s",
-				ticket.ID,
-				statusEmoji,
-				strings.ReplaceAll(ticket.Title, "*", "\\*"), // Экранируем звездочки
-				ticket.Category,
-				createdDate,
-				closedDate,
-				len(messages),
-				strings.ReplaceAll(ticket.Description, "*", "\\*"), // Экранируем звездочки
-			)
-
-			msg := tgbotapi.NewMessage(update.Message.Chat.ID, ticketInfo)
-			msg.ParseMode = "Markdown"
-			bot.SafeSendMessage(botAPI, msg)
-
-			// Отправляем историю сообщений
-			if len(messages) > 0 {
-				historyMsg := "📜 *История сообщений:*\n\n"
-				for i, m := range messages {
-					senderType := "👤 Вы"
-					if m.SenderType == "admin" || m.SenderType == "support" {
-						senderType = "👨‍💼 Поддержка"
-					}
-					msgTime := m.CreatedAt.Format("02.01.2006 15:04")
-					// Экранируем специальные символы в сообщении
-					messageText := strings.ReplaceAll(m.Message, "*", "\\*")
-					messageText = strings.ReplaceAll(messageText, "_", "\\_")
-					historyMsg += fmt.Sprintf("%d. %s (%s):\n%s\n\n", i+1, senderType, msgTime, messageText)
-				}
-
-				msg := tgbotapi.NewMessage(update.Message.Chat.ID, historyMsg)
-				msg.ParseMode = "Markdown"
-				bot.SafeSendMessage(botAPI, msg)
-			}
-
-			// Получаем и отправляем фотографии тикета
-			photos, err := database.GetTicketPhotos(ticketID)
-			if err != nil {
-				logger.Error.Printf("Ошибка при получении фотографий тикета %d: %v", ticketID, err)
-			} else if len(photos) > 0 {
-				photoMsg := tgbotapi.NewMessage(update.Message.Chat.ID, "📸 *Прикрепленные фотографии:*")
-				photoMsg.ParseMode = "Markdown"
-				bot.SafeSendMessage(botAPI, photoMsg)
-
-				for i, photo := range photos {
-					file, err := os.Open(photo.FilePath)
-					if err != nil {
-						logger.Error.Printf("Ошибка при открытии файла %s: %v", photo.FilePath, err)
-						continue
-					}
-					defer file.Close()
-
-					ext := filepath.Ext(photo.FilePath)
-					if ext == "" {
-						ext = ".jpg"
-					}
-
-					photoConfig := tgbotapi.NewPhoto(update.Message.Chat.ID, tgbotapi.FileReader{
-						Name:   fmt.Sprintf("photo_%d%s", i+1, ext),
-						Reader: file,
-					})
-
-					caption := fmt.Sprintf("📷 Фото #%d", i+1)
-					if photo.SenderType == "user" {
-						caption += " (от вас)"
-					} else {
-						caption += " (от поддержки)"
-					}
-					photoConfig.Caption = caption
-
-					_, err = botAPI.Send(photoConfig)
-					if err != nil {
-						logger.Error.Printf("Ошибка при отправке фото %s: %v", photo.FilePath, err)
-					}
-
-					time.Sleep(100 * time.Millisecond) // Небольшая задержка между отправкой фото
-				}
-			}
-
-			// Показываем клавиатуру для навигации
-			keyboard := tgbotapi.NewReplyKeyboard(
-				tgbotapi.NewKeyboardButtonRow(
-					tgbotapi.NewKeyboardButton("⬅️ Назад к истории"),
-				),
-			)
-			navMsg := tgbotapi.NewMessage(update.Message.Chat.ID, "Используйте кнопку ниже для возврата к истории тикетов")
-			navMsg.ReplyMarkup = keyboard
-			bot.SafeSendMessage(botAPI, navMsg)
+			handler.HandleTicketCommand(update.Message)
 		default:
 			// Неизвестные команды обрабатываем как обычные сообщения
-			bot.HandleMessage(botAPI, update.Message)
+			handler.HandleMessage(update.Message)
 		}
 	} else {
 		// Обычные сообщения
-		bot.HandleMessage(botAPI, update.Message)
+		handler.HandleMessage(update.Message)
 	}
 }
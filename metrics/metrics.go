@@ -0,0 +1,204 @@
+// Package metrics - метрики бота в формате Prometheus (эндпоинт /metrics).
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"supportTicketBotGo/logger"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "supportbot"
+
+// Registry содержит все метрики бота, а также метрики процесса и среды выполнения Go
+var Registry = prometheus.NewRegistry()
+
+var (
+	updatesReceived = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "updates_received_total",
+		Help:      "Обновления, полученные от Telegram, по типу.",
+	}, []string{"type"})
+
+	handlerDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "handler_duration_seconds",
+		Help:      "Время обработки обновления по состоянию диалога пользователя.",
+		Buckets:   []float64{.01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30},
+	}, []string{"state"})
+
+	telegramRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "telegram_api_requests_total",
+		Help:      "Запросы к Telegram Bot API по методу.",
+	}, []string{"method"})
+
+	telegramErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "telegram_api_errors_total",
+		Help:      "Неудачные запросы к Telegram Bot API по методу и коду ответа (network - сетевая ошибка).",
+	}, []string{"method", "code"})
+
+	dbQueryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "db_query_duration_seconds",
+		Help:      "Время выполнения запросов к базе данных по имени запроса.",
+		Buckets:   []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"query"})
+
+	ticketsCreated = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "tickets_created_total",
+		Help:      "Созданные тикеты по категории.",
+	}, []string{"category"})
+
+	ticketsClosed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "tickets_closed_total",
+		Help:      "Закрытые тикеты по категории.",
+	}, []string{"category"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		updatesReceived, handlerDuration, telegramRequests, telegramErrors,
+		dbQueryDuration, ticketsCreated, ticketsClosed,
+	)
+}
+
+// Handler возвращает обработчик эндпоинта /metrics
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{ErrorLog: promLogger{}})
+}
+
+// UpdateReceived учитывает полученное обновление
+func UpdateReceived(update tgbotapi.Update) {
+	updatesReceived.WithLabelValues(updateType(update)).Inc()
+}
+
+// ObserveHandler учитывает время обработки обновления, начатой в start
+func ObserveHandler(state string, start time.Time) {
+	handlerDuration.WithLabelValues(state).Observe(time.Since(start).Seconds())
+}
+
+// ObserveQuery учитывает время выполнения запроса к БД, начатого в start
+func ObserveQuery(name string, start time.Time) {
+	dbQueryDuration.WithLabelValues(name).Observe(time.Since(start).Seconds())
+}
+
+// TicketCreated учитывает созданный тикет
+func TicketCreated(category string) {
+	ticketsCreated.WithLabelValues(categoryLabel(category)).Inc()
+}
+
+// TicketClosed учитывает закрытый тикет
+func TicketClosed(category string) {
+	ticketsClosed.WithLabelValues(categoryLabel(category)).Inc()
+}
+
+// RegisterGauge добавляет метрику, значение которой вычисляется при каждом запросе /metrics
+func RegisterGauge(name, help string, value func() float64) {
+	Registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      name,
+		Help:      help,
+	}, value))
+}
+
+// openTickets - число незакрытых тикетов по статусу, считается при каждом запросе /metrics
+type openTickets struct {
+	desc  *prometheus.Desc
+	count func() (map[string]int, error)
+}
+
+// RegisterOpenTickets добавляет метрику open_tickets; count возвращает число тикетов по статусу
+func RegisterOpenTickets(count func() (map[string]int, error)) {
+	Registry.MustRegister(&openTickets{
+		desc:  prometheus.NewDesc(namespace+"_open_tickets", "Незакрытые тикеты по статусу.", []string{"status"}, nil),
+		count: count,
+	})
+}
+
+func (c *openTickets) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c *openTickets) Collect(ch chan<- prometheus.Metric) {
+	counts, err := c.count()
+	if err != nil {
+		logger.Error.Printf("Ошибка при подсчете открытых тикетов для метрик: %v", err)
+		ch <- prometheus.NewInvalidMetric(c.desc, err)
+		return
+	}
+	for status, n := range counts {
+		ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, float64(n), status)
+	}
+}
+
+// telegramClient считает запросы к Bot API и их ошибки
+type telegramClient struct {
+	next tgbotapi.HTTPClient
+}
+
+// InstrumentTelegramClient оборачивает HTTP-клиент бота (см. tgbotapi.NewBotAPIWithClient)
+func InstrumentTelegramClient(next tgbotapi.HTTPClient) tgbotapi.HTTPClient {
+	return &telegramClient{next: next}
+}
+
+func (c *telegramClient) Do(req *http.Request) (*http.Response, error) {
+	// Путь запроса: /bot<токен>/<метод>
+	method := req.URL.Path[strings.LastIndex(req.URL.Path, "/")+1:]
+	telegramRequests.WithLabelValues(method).Inc()
+
+	resp, err := c.next.Do(req)
+	if err != nil {
+		telegramErrors.WithLabelValues(method, "network").Inc()
+		return resp, err
+	}
+	if resp.StatusCode >= 400 {
+		telegramErrors.WithLabelValues(method, strconv.Itoa(resp.StatusCode)).Inc()
+	}
+	return resp, nil
+}
+
+// updateType возвращает тип обновления для метки updates_received_total
+func updateType(update tgbotapi.Update) string {
+	switch {
+	case update.Message != nil && update.Message.IsCommand():
+		return "command"
+	case update.Message != nil:
+		return "message"
+	case update.EditedMessage != nil:
+		return "edited_message"
+	case update.CallbackQuery != nil:
+		return "callback_query"
+	case update.MyChatMember != nil:
+		return "my_chat_member"
+	case update.ChannelPost != nil:
+		return "channel_post"
+	}
+	return "other"
+}
+
+func categoryLabel(category string) string {
+	if category == "" {
+		return "без категории"
+	}
+	return category
+}
+
+// promLogger передает ошибки формирования ответа /metrics в журнал бота
+type promLogger struct{}
+
+func (promLogger) Println(v ...interface{}) {
+	logger.Error.Println(append([]interface{}{"Ошибка при формировании метрик:"}, v...)...)
+}
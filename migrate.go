@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"supportTicketBotGo/database"
+	"supportTicketBotGo/logger"
+)
+
+const migrateUsage = `Использование: supportbot [-config config.json] migrate <команда>
+
+Команды:
+  up          применить все неприменённые миграции
+  down [N]    откатить N последних миграций (по умолчанию 1)
+  status      показать состояние миграций`
+
+// runMigrateCommand выполняет подкоманду migrate и возвращает код завершения процесса
+func runMigrateCommand(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+
+	if err := database.OpenDB(); err != nil {
+		fmt.Fprintf(os.Stderr, "Ошибка подключения к базе данных: %v\n", err)
+		return 1
+	}
+	defer database.DB.Close()
+
+	switch args[0] {
+	case "up":
+		applied, err := database.MigrateUp()
+		for _, m := range applied {
+			fmt.Printf("применена %04d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Ошибка применения миграций: %v\n", err)
+			return 1
+		}
+		if len(applied) == 0 {
+			fmt.Println("Схема БД актуальна")
+		}
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n <= 0 {
+				fmt.Fprintf(os.Stderr, "Некорректное количество миграций: %s\n", args[1])
+				return 2
+			}
+			steps = n
+		}
+		reverted, err := database.MigrateDown(steps)
+		for _, m := range reverted {
+			fmt.Printf("откачена %04d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Ошибка отката миграций: %v\n", err)
+			return 1
+		}
+		if len(reverted) == 0 {
+			fmt.Println("Нет примененных миграций")
+		}
+
+	case "status":
+		states, err := database.GetMigrationStates()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Ошибка получения состояния миграций: %v\n", err)
+			return 1
+		}
+		for _, state := range states {
+			appliedAt := "не применена"
+			if state.Applied {
+				appliedAt = state.AppliedAt.Time.Format("02.01.2006 15:04:05")
+			}
+			fmt.Printf("%04d_%-20s %s\n", state.Version, state.Name, appliedAt)
+		}
+
+	default:
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+	return 0
+}
+
+// ensureSchema проверяет, что к базе применены все миграции.
+// При autoMigrate недостающие миграции применяются, иначе запуск прерывается.
+func ensureSchema(autoMigrate bool) error {
+	if autoMigrate {
+		applied, err := database.MigrateUp()
+		if err != nil {
+			return err
+		}
+		for _, m := range applied {
+			logger.Info.Printf("Применена миграция %04d_%s", m.Version, m.Name)
+		}
+		return nil
+	}
+
+	pending, err := database.PendingMigrations()
+	if err != nil {
+		return err
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("схема БД устарела: не применено миграций: %d (первая %04d_%s), выполните `supportbot migrate up`",
+			len(pending), pending[0].Version, pending[0].Name)
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	"supportTicketBotGo/bot"
+	"supportTicketBotGo/config"
+	"supportTicketBotGo/logger"
+)
+
+// reloader перечитывает конфигурацию по сигналу SIGHUP и применяет настройки,
+// которые можно менять без перезапуска (теги reload:"live" в config.Config)
+type reloader struct {
+	path        string
+	overrides   []string
+	webhookMode bool
+	dispatcher  *bot.Dispatcher
+	broadcaster *bot.Broadcaster
+	signals     chan os.Signal
+	done        chan struct{}
+}
+
+// watchReload начинает перечитывать конфигурацию по SIGHUP
+func watchReload(path string, overrides []string, webhookMode bool, dispatcher *bot.Dispatcher, broadcaster *bot.Broadcaster) *reloader {
+	r := &reloader{
+		path:        path,
+		overrides:   overrides,
+		webhookMode: webhookMode,
+		dispatcher:  dispatcher,
+		broadcaster: broadcaster,
+		signals:     make(chan os.Signal, 1),
+		done:        make(chan struct{}),
+	}
+	signal.Notify(r.signals, syscall.SIGHUP)
+	go r.run()
+	return r
+}
+
+// Stop прекращает обработку SIGHUP
+func (r *reloader) Stop() {
+	signal.Stop(r.signals)
+	close(r.signals)
+	<-r.done
+}
+
+func (r *reloader) run() {
+	defer close(r.done)
+	for range r.signals {
+		r.reload()
+	}
+}
+
+// reload перечитывает конфигурацию; при ошибке продолжает работать с прежней
+func (r *reloader) reload() {
+	logger.Info.Println("Получен SIGHUP, перечитываем конфигурацию")
+	changes, err := config.Reload(r.path, r.overrides, r.webhookMode)
+	if err != nil {
+		logger.Error.Printf("Конфигурация не перезагружена, продолжаем с прежней: %v", err)
+		return
+	}
+	if len(changes) == 0 {
+		logger.Info.Println("Конфигурация не изменилась")
+		return
+	}
+	for _, c := range changes {
+		logger.Info.Printf("Настройка %s изменена: %q -> %q", c.Path, c.Old, c.New)
+	}
+
+	cfg := config.Get()
+	if err := logger.SetLevel(cfg.Log.Level); err != nil {
+		logger.Error.Printf("Ошибка при смене уровня журнала: %v", err)
+	}
+	logger.SetLogMessageText(cfg.Log.LogMessageText)
+	r.dispatcher.SetLimits(rateLimits(cfg))
+	r.broadcaster.SetRate(cfg.Broadcast.RatePerSecond)
+	logger.Info.Printf("Конфигурация перезагружена, изменено настроек: %d", len(changes))
+}
+
+// rateLimits возвращает ограничения скорости отправки из конфигурации
+func rateLimits(cfg *config.Config) bot.RateLimits {
+	return bot.RateLimits{
+		GlobalPerSecond: cfg.RateLimit.GlobalPerSecond,
+		ChatPerSecond:   cfg.RateLimit.ChatPerSecond,
+		ChatBurst:       cfg.RateLimit.ChatBurst,
+		GroupPerMinute:  cfg.RateLimit.GroupPerMinute,
+		MaxAttempts:     cfg.RateLimit.MaxAttempts,
+	}
+}
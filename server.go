@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"supportTicketBotGo/logger"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Параметры HTTP-сервера
+const (
+	httpReadHeaderTimeout = 10 * time.Second
+	httpReadTimeout       = 60 * time.Second // с запасом на загрузку вложений через API
+	httpWriteTimeout      = 60 * time.Second
+	httpIdleTimeout       = 120 * time.Second
+	httpMaxBodyBytes      = 25 << 20 // вложения API до 20 МБ плюс служебные поля формы
+	// shutdownTimeout - сколько ждать завершения начатых запросов и обработчиков обновлений
+	shutdownTimeout = 30 * time.Second
+)
+
+// httpServer - HTTP-сервер бота (вебхук Telegram и внешние эндпоинты)
+type httpServer struct {
+	server   *http.Server
+	listener net.Listener
+	errors   chan error
+}
+
+// startHTTPServer занимает порт и начинает обслуживать запросы в отдельной горутине.
+// Ошибка занятия порта возвращается сразу; ошибка во время работы приходит в канал Errors().
+func startHTTPServer(addr string, handler http.Handler) (*httpServer, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &httpServer{
+		server: &http.Server{
+			Handler:           http.MaxBytesHandler(handler, httpMaxBodyBytes),
+			ReadHeaderTimeout: httpReadHeaderTimeout,
+			ReadTimeout:       httpReadTimeout,
+			WriteTimeout:      httpWriteTimeout,
+			IdleTimeout:       httpIdleTimeout,
+		},
+		listener: listener,
+		errors:   make(chan error, 1),
+	}
+	go func() {
+		if err := s.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.errors <- err
+		}
+	}()
+	return s, nil
+}
+
+// Errors возвращает канал с ошибкой, остановившей сервер
+func (s *httpServer) Errors() <-chan error {
+	return s.errors
+}
+
+// Shutdown прекращает прием соединений и ждет завершения начатых запросов не дольше timeout
+func (s *httpServer) Shutdown(timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return s.server.Shutdown(ctx)
+}
+
+// webhookReceiver принимает обновления от Telegram и передает их в канал Updates.
+// Telegram получает ответ 200 только после того, как обновление принято в обработку,
+// поэтому после Shutdown сервера все подтвержденные обновления уже находятся в канале.
+type webhookReceiver struct {
+	botAPI  *tgbotapi.BotAPI
+	updates chan tgbotapi.Update
+	done    chan struct{}
+
+	// mu защищает закрытие канала: обработчики отправляют в него под RLock,
+	// Close закрывает его под Lock, когда ни одной отправки не осталось
+	mu     sync.RWMutex
+	closed bool
+}
+
+func newWebhookReceiver(botAPI *tgbotapi.BotAPI) *webhookReceiver {
+	return &webhookReceiver{
+		botAPI:  botAPI,
+		updates: make(chan tgbotapi.Update, botAPI.Buffer),
+		done:    make(chan struct{}),
+	}
+}
+
+// Updates возвращает канал принятых обновлений; он закрывается в Close
+func (wr *webhookReceiver) Updates() tgbotapi.UpdatesChannel {
+	return wr.updates
+}
+
+// Close прекращает прием обновлений и закрывает канал. Запросы, которые еще ждут места
+// в очереди (Shutdown сервера завершился по тайм-ауту), получают 503: Telegram повторит их позже.
+func (wr *webhookReceiver) Close() {
+	close(wr.done)
+	wr.mu.Lock()
+	defer wr.mu.Unlock()
+	wr.closed = true
+	close(wr.updates)
+}
+
+func (wr *webhookReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	update, err := wr.botAPI.HandleUpdate(r)
+	if err != nil {
+		logger.Warning.Printf("Некорректное обновление от Telegram: %v", err)
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	wr.mu.RLock()
+	defer wr.mu.RUnlock()
+	if wr.closed {
+		http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	select {
+	case wr.updates <- *update:
+		w.WriteHeader(http.StatusOK)
+	case <-wr.done:
+		http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
+	}
+}
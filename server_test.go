@@ -0,0 +1,71 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"supportTicketBotGo/telegramtest"
+)
+
+func newTestReceiver(t *testing.T, buffer int) *webhookReceiver {
+	t.Helper()
+	server := telegramtest.NewServer()
+	t.Cleanup(server.Close)
+	botAPI, err := server.Bot()
+	if err != nil {
+		t.Fatalf("подключение к поддельному серверу: %v", err)
+	}
+	botAPI.Buffer = buffer
+	return newWebhookReceiver(botAPI)
+}
+
+func postUpdate(wr *webhookReceiver, id int) int {
+	body := `{"update_id":` + strconv.Itoa(id) + `,"message":{"message_id":1,"chat":{"id":42},"text":"привет"}}`
+	rec := httptest.NewRecorder()
+	wr.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body)))
+	return rec.Code
+}
+
+func TestWebhookReceiverAcceptsUpdates(t *testing.T) {
+	wr := newTestReceiver(t, 1)
+	if code := postUpdate(wr, 1); code != http.StatusOK {
+		t.Fatalf("код ответа %d, ожидался 200", code)
+	}
+	if update := <-wr.Updates(); update.Message == nil || update.Message.Text != "привет" {
+		t.Fatalf("получено обновление %+v", update)
+	}
+}
+
+func TestWebhookReceiverCloseUnblocksWaitingRequests(t *testing.T) {
+	wr := newTestReceiver(t, 0)
+
+	codes := make(chan int, 1)
+	go func() { codes <- postUpdate(wr, 1) }()
+
+	// Запрос ждет места в очереди, которое уже не освободится
+	select {
+	case code := <-codes:
+		t.Fatalf("запрос завершился до Close с кодом %d", code)
+	case <-time.After(50 * time.Millisecond):
+	}
+	wr.Close()
+
+	select {
+	case code := <-codes:
+		if code != http.StatusServiceUnavailable {
+			t.Fatalf("код ответа %d, ожидался 503", code)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("запрос не завершился после Close")
+	}
+	if _, ok := <-wr.Updates(); ok {
+		t.Fatal("канал обновлений не закрыт")
+	}
+	if code := postUpdate(wr, 2); code != http.StatusServiceUnavailable {
+		t.Fatalf("код ответа после Close %d, ожидался 503", code)
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"supportTicketBotGo/config"
+	"supportTicketBotGo/database"
+	"supportTicketBotGo/storage"
+)
+
+const storageUsage = `Использование: supportbot [-config config.json] storage migrate [-workdir DIR] [-dry-run]
+
+Переносит файлы, сохраненные старыми версиями бота в ../uploads, в настроенное хранилище
+и заменяет пути к файлам в базе данных ключами хранилища.
+
+  -workdir DIR  рабочий каталог старой версии бота, относительно которого записаны пути (по умолчанию ".")
+  -dry-run      только показать, что будет перенесено`
+
+// openStorage создает хранилище файлов по настройкам из конфигурации
+func openStorage() (storage.Storage, error) {
+	cfg := config.Get().Storage
+	switch cfg.Backend {
+	case "", "local":
+		dir := cfg.Local.Dir
+		if dir == "" {
+			dir = "uploads"
+		}
+		return storage.NewLocalStorage(dir, cfg.Local.BaseURL)
+	case "s3":
+		return storage.NewS3Storage(storage.S3Config{
+			Endpoint:  cfg.S3.Endpoint,
+			Region:    cfg.S3.Region,
+			Bucket:    cfg.S3.Bucket,
+			AccessKey: cfg.S3.AccessKey,
+			SecretKey: cfg.S3.SecretKey,
+			PathStyle: cfg.S3.PathStyle,
+			URLExpiry: time.Duration(cfg.S3.URLExpiryMinutes) * time.Minute,
+		})
+	case "database":
+		return storage.NewDatabaseStorage(), nil
+	default:
+		return nil, fmt.Errorf("неизвестное хранилище файлов: %s", cfg.Backend)
+	}
+}
+
+// storageBackendName возвращает название настроенного хранилища файлов для журнала
+func storageBackendName() string {
+	if config.Get().Storage.Backend == "" {
+		return "local"
+	}
+	return config.Get().Storage.Backend
+}
+
+// runStorageCommand выполняет подкоманду storage и возвращает код завершения процесса
+func runStorageCommand(args []string) int {
+	if len(args) == 0 || args[0] != "migrate" {
+		fmt.Fprintln(os.Stderr, storageUsage)
+		return 2
+	}
+
+	flags := flag.NewFlagSet("storage migrate", flag.ContinueOnError)
+	flags.Usage = func() { fmt.Fprintln(os.Stderr, storageUsage) }
+	workdir := flags.String("workdir", ".", "рабочий каталог старой версии бота")
+	dryRun := flags.Bool("dry-run", false, "только показать, что будет перенесено")
+	if err := flags.Parse(args[1:]); err != nil {
+		return 2
+	}
+
+	if err := database.OpenDB(); err != nil {
+		fmt.Fprintf(os.Stderr, "Ошибка подключения к базе данных: %v\n", err)
+		return 1
+	}
+	defer database.DB.Close()
+
+	files, err := openStorage()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Ошибка открытия хранилища файлов: %v\n", err)
+		return 1
+	}
+
+	failed := 0
+
+	// Вложения тикетов: в storage_key записан путь к файлу
+	attachments, err := database.GetAttachmentsWithLegacyPaths()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Ошибка получения вложений: %v\n", err)
+		return 1
+	}
+	migrated := 0
+	for _, a := range attachments {
+		path := legacyPath(*workdir, a.StorageKey)
+		key := storage.AttachmentKey(a.TicketID, filepath.Base(path))
+		if *dryRun {
+			fmt.Printf("вложение #%d: %s -> %s\n", a.ID, path, key)
+			continue
+		}
+		if err := copyToStorage(files, path, key, a.MimeType); err != nil {
+			fmt.Fprintf(os.Stderr, "вложение #%d: %v\n", a.ID, err)
+			failed++
+			continue
+		}
+		if err := database.UpdateAttachmentStorageKey(a.ID, key); err != nil {
+			fmt.Fprintf(os.Stderr, "вложение #%d: ошибка обновления ключа: %v\n", a.ID, err)
+			failed++
+			continue
+		}
+		migrated++
+	}
+
+	// Аватары: старые версии сохраняли их в ../uploads/avatars/<id>.png
+	userIDs, err := database.GetUserIDsWithAvatar()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Ошибка получения пользователей с аватарами: %v\n", err)
+		return 1
+	}
+	avatars := 0
+	for _, userID := range userIDs {
+		path := filepath.Join(*workdir, "..", "uploads", "avatars", strconv.FormatInt(userID, 10)+".png")
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			continue
+		}
+		key := storage.AvatarKey(userID)
+		if *dryRun {
+			fmt.Printf("аватар %d: %s -> %s\n", userID, path, key)
+			continue
+		}
+		if err := copyToStorage(files, path, key, "image/png"); err != nil {
+			fmt.Fprintf(os.Stderr, "аватар %d: %v\n", userID, err)
+			failed++
+			continue
+		}
+		avatars++
+	}
+
+	if *dryRun {
+		fmt.Printf("Будет перенесено вложений: %d\n", len(attachments))
+		return 0
+	}
+	fmt.Printf("Перенесено вложений: %d, аватаров: %d, ошибок: %d\n", migrated, avatars, failed)
+	if failed > 0 {
+		return 1
+	}
+	fmt.Println("Старые файлы не удаляются, их можно удалить вручную после проверки")
+	return 0
+}
+
+// legacyPath возвращает путь к файлу, записанный старой версией бота относительно ее рабочего каталога
+func legacyPath(workdir, path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(workdir, path)
+}
+
+// copyToStorage копирует файл с диска в хранилище под ключом key
+func copyToStorage(files storage.Storage, path, key, contentType string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	return files.Put(key, file, info.Size(), contentType)
+}
@@ -0,0 +1,50 @@
+package storage
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+
+	"supportTicketBotGo/database"
+)
+
+// DatabaseStorage хранит объекты в таблице storage_objects PostgreSQL.
+// Подходит для небольших установок, где не хочется поднимать отдельное объектное хранилище.
+type DatabaseStorage struct{}
+
+// NewDatabaseStorage создает хранилище поверх соединения database.DB
+func NewDatabaseStorage() DatabaseStorage {
+	return DatabaseStorage{}
+}
+
+func (DatabaseStorage) Put(key string, r io.Reader, size int64, contentType string) error {
+	if err := validateKey(key); err != nil {
+		return err
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	return database.PutStorageObject(key, contentType, data)
+}
+
+func (DatabaseStorage) Get(key string) (io.ReadCloser, error) {
+	data, err := database.GetStorageObject(key)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (DatabaseStorage) Delete(key string) error {
+	return database.DeleteStorageObject(key)
+}
+
+func (DatabaseStorage) URL(key string) (string, error) {
+	return "", ErrURLUnsupported
+}
@@ -0,0 +1,60 @@
+// Package storage хранит файлы бота (вложения тикетов и аватары) по ключам,
+// не привязанным к файловой системе конкретного процесса.
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Storage - хранилище файлов. Ключ - относительный путь с "/" в качестве разделителя,
+// например "attachments/12/1700000000_AgAC.jpg". В базе данных хранятся только ключи.
+type Storage interface {
+	// Put сохраняет содержимое под ключом, перезаписывая существующий объект.
+	// size - размер содержимого или -1, если он неизвестен.
+	Put(key string, r io.Reader, size int64, contentType string) error
+	// Get открывает объект для чтения. Если объекта нет, возвращает ErrNotFound.
+	Get(key string) (io.ReadCloser, error)
+	// Delete удаляет объект. Удаление отсутствующего объекта не считается ошибкой.
+	Delete(key string) error
+	// URL возвращает адрес, по которому объект можно скачать в обход бота
+	URL(key string) (string, error)
+}
+
+// Ошибки хранилища
+var (
+	ErrNotFound       = errors.New("объект не найден в хранилище")
+	ErrInvalidKey     = errors.New("некорректный ключ объекта")
+	ErrURLUnsupported = errors.New("хранилище не выдает прямые ссылки на объекты")
+)
+
+// Префиксы ключей
+const (
+	AttachmentsPrefix = "attachments/"
+	AvatarsPrefix     = "avatars/"
+)
+
+// AttachmentKey возвращает ключ вложения тикета
+func AttachmentKey(ticketID int, fileName string) string {
+	return fmt.Sprintf("%s%d/%s", AttachmentsPrefix, ticketID, fileName)
+}
+
+// AvatarKey возвращает ключ аватара пользователя
+func AvatarKey(userID int64) string {
+	return fmt.Sprintf("%s%d.png", AvatarsPrefix, userID)
+}
+
+// validateKey запрещает пустые, абсолютные ключи и выход за пределы хранилища через ".."
+func validateKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") {
+		return fmt.Errorf("%w: %q", ErrInvalidKey, key)
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == "" || part == "." || part == ".." {
+			return fmt.Errorf("%w: %q", ErrInvalidKey, key)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,382 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"supportTicketBotGo/bot"
+	"supportTicketBotGo/config"
+	"supportTicketBotGo/database"
+	"supportTicketBotGo/logger"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Ограничения /superconnect
+const (
+	superConnectMaxText    = 3500 // остальное место в сообщении Telegram занимает заголовок
+	superConnectMaxButtons = 10
+	superConnectScope      = "superconnect" // область ключей идемпотентности
+)
+
+// superConnectRequest - параметры /superconnect (JSON или форма)
+type superConnectRequest struct {
+	SenderID       int64                `json:"sender_id"`
+	AccepterID     int64                `json:"accepter_id"`
+	Message        string               `json:"message"`
+	TicketID       int                  `json:"ticket_id,omitempty"`
+	Buttons        []superConnectButton `json:"buttons,omitempty"`
+	IdempotencyKey string               `json:"idempotency_key,omitempty"`
+}
+
+// superConnectButton - inline-кнопка со ссылкой под сообщением
+type superConnectButton struct {
+	Text string `json:"text"`
+	URL  string `json:"url"`
+}
+
+// superConnectResponse - ответ /superconnect
+type superConnectResponse struct {
+	OK                bool `json:"ok"`
+	TelegramMessageID int  `json:"telegram_message_id,omitempty"`
+	TicketMessageID   int  `json:"ticket_message_id,omitempty"`
+	Queued            bool `json:"queued,omitempty"` // отправка не удалась, сообщение доставят уведомления тикета
+}
+
+// superConnectError - ошибка запроса с HTTP-кодом и машиночитаемым кодом
+type superConnectError struct {
+	status  int
+	code    string
+	message string
+}
+
+func (e *superConnectError) Error() string {
+	return e.message
+}
+
+func superConnectBadRequest(message string) *superConnectError {
+	return &superConnectError{status: http.StatusBadRequest, code: "bad_request", message: message}
+}
+
+// superConnectHandler возвращает обработчик эндпоинта /superconnect, через который
+// внешние сервисы отправляют сообщения пользователям бота от имени другого пользователя
+func superConnectHandler(dispatcher *bot.Dispatcher) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := config.Get().SuperConnectToken
+		if token == "" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			writeSuperConnectError(w, &superConnectError{http.StatusMethodNotAllowed, "method_not_allowed", "метод не поддерживается"})
+			return
+		}
+
+		// Тело разбирается до проверки токена: старые клиенты передают его в форме
+		req, parseErr := parseSuperConnectRequest(r)
+		if !superConnectAuthorized(r, token) {
+			logger.Warning.Printf("Попытка доступа к /superconnect с неверным токеном с адреса %s", r.RemoteAddr)
+			writeSuperConnectError(w, &superConnectError{http.StatusUnauthorized, "unauthorized", "неверный или отсутствующий токен"})
+			return
+		}
+		if parseErr != nil {
+			writeSuperConnectError(w, parseErr)
+			return
+		}
+		if key := r.Header.Get("Idempotency-Key"); key != "" {
+			req.IdempotencyKey = key
+		}
+		if err := req.validate(); err != nil {
+			writeSuperConnectError(w, err)
+			return
+		}
+
+		if req.IdempotencyKey == "" {
+			status, body := superConnect(dispatcher, req)
+			writeSuperConnectBody(w, status, body)
+			return
+		}
+
+		stored, err := database.BeginIdempotentRequest(superConnectScope, req.IdempotencyKey, req.hash())
+		switch {
+		case errors.Is(err, database.ErrIdempotencyInProgress), errors.Is(err, database.ErrIdempotencyMismatch):
+			writeSuperConnectError(w, &superConnectError{http.StatusConflict, "idempotency_conflict", err.Error()})
+			return
+		case err != nil:
+			logger.Error.Printf("Ошибка при проверке ключа идемпотентности /superconnect: %v", err)
+			writeSuperConnectError(w, &superConnectError{http.StatusInternalServerError, "internal", "внутренняя ошибка сервера"})
+			return
+		case stored != nil:
+			w.Header().Set("Idempotent-Replayed", "true")
+			writeSuperConnectBody(w, stored.StatusCode, stored.Body)
+			return
+		}
+
+		status, body := superConnect(dispatcher, req)
+		// Неудачный запрос можно повторить с тем же ключом, результат удачного сохраняется
+		if status >= 400 {
+			err = database.ReleaseIdempotentRequest(superConnectScope, req.IdempotencyKey)
+		} else {
+			err = database.CompleteIdempotentRequest(superConnectScope, req.IdempotencyKey, status, body)
+		}
+		if err != nil {
+			logger.Error.Printf("Ошибка при сохранении ключа идемпотентности /superconnect: %v", err)
+		}
+		writeSuperConnectBody(w, status, body)
+	}
+}
+
+// superConnectAuthorized проверяет токен из заголовка "Authorization: Bearer <токен>"
+// или "X-Super-Connect-Token". Поле формы super_connect_token поддерживается для старых клиентов.
+func superConnectAuthorized(r *http.Request, token string) bool {
+	provided := ""
+	switch {
+	case strings.HasPrefix(r.Header.Get("Authorization"), "Bearer "):
+		provided = strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	case r.Header.Get("X-Super-Connect-Token") != "":
+		provided = r.Header.Get("X-Super-Connect-Token")
+	case r.PostForm.Get("super_connect_token") != "":
+		provided = r.PostForm.Get("super_connect_token")
+		logger.Warning.Printf("/superconnect: токен передан в теле запроса, используйте заголовок Authorization")
+	}
+	return provided != "" && subtle.ConstantTimeCompare([]byte(provided), []byte(token)) == 1
+}
+
+// parseSuperConnectRequest читает параметры из JSON или из формы
+func parseSuperConnectRequest(r *http.Request) (*superConnectRequest, error) {
+	r.Body = http.MaxBytesReader(nil, r.Body, 1<<20)
+	req := &superConnectRequest{}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "application/json" {
+		decoder := json.NewDecoder(r.Body)
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(req); err != nil {
+			return nil, superConnectBadRequest("некорректный JSON: " + err.Error())
+		}
+		return req, nil
+	}
+
+	if err := r.ParseForm(); err != nil {
+		return nil, superConnectBadRequest("некорректная форма: " + err.Error())
+	}
+	form := r.PostForm
+	var err error
+	if req.SenderID, err = parseFormInt(form.Get("sender_id"), "sender_id"); err != nil {
+		return nil, err
+	}
+	if req.AccepterID, err = parseFormInt(form.Get("accepter_id"), "accepter_id"); err != nil {
+		return nil, err
+	}
+	ticketID, err := parseFormInt(form.Get("ticket_id"), "ticket_id")
+	if err != nil {
+		return nil, err
+	}
+	req.TicketID = int(ticketID)
+	req.Message = form.Get("message")
+	req.IdempotencyKey = form.Get("idempotency_key")
+	if buttons := form.Get("buttons"); buttons != "" {
+		if err := json.Unmarshal([]byte(buttons), &req.Buttons); err != nil {
+			return nil, superConnectBadRequest("buttons должен быть JSON-массивом [{\"text\": ..., \"url\": ...}]")
+		}
+	}
+	return req, nil
+}
+
+func parseFormInt(value, name string) (int64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, superConnectBadRequest("некорректный " + name)
+	}
+	return n, nil
+}
+
+// validate проверяет обязательные параметры и кнопки
+func (req *superConnectRequest) validate() error {
+	if req.SenderID <= 0 || req.AccepterID <= 0 || strings.TrimSpace(req.Message) == "" {
+		return superConnectBadRequest("обязательны sender_id, accepter_id и message")
+	}
+	if req.TicketID < 0 {
+		return superConnectBadRequest("некорректный ticket_id")
+	}
+	if utf8.RuneCountInString(req.Message) > superConnectMaxText {
+		return superConnectBadRequest(fmt.Sprintf("message длиннее %d символов", superConnectMaxText))
+	}
+	if len(req.IdempotencyKey) > 255 {
+		return superConnectBadRequest("ключ идемпотентности длиннее 255 символов")
+	}
+	if len(req.Buttons) > superConnectMaxButtons {
+		return superConnectBadRequest(fmt.Sprintf("не больше %d кнопок", superConnectMaxButtons))
+	}
+	for _, button := range req.Buttons {
+		if strings.TrimSpace(button.Text) == "" {
+			return superConnectBadRequest("у кнопки не задан text")
+		}
+		u, err := url.Parse(button.URL)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http" && u.Scheme != "tg") {
+			return superConnectBadRequest(fmt.Sprintf("некорректная ссылка кнопки: %q", button.URL))
+		}
+	}
+	return nil
+}
+
+// hash возвращает отпечаток параметров запроса для проверки повторов с тем же ключом
+func (req *superConnectRequest) hash() string {
+	params := *req
+	params.IdempotencyKey = ""
+	data, _ := json.Marshal(params)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// superConnect отправляет сообщение и возвращает HTTP-код и тело ответа
+func superConnect(dispatcher *bot.Dispatcher, req *superConnectRequest) (int, []byte) {
+	status, body, err := sendSuperConnect(dispatcher, req)
+	if err != nil {
+		var scErr *superConnectError
+		if !errors.As(err, &scErr) {
+			logger.Error.Printf("Ошибка /superconnect: %v", err)
+			scErr = &superConnectError{http.StatusInternalServerError, "internal", "внутренняя ошибка сервера"}
+		}
+		return scErr.status, superConnectErrorBody(scErr)
+	}
+	data, _ := json.Marshal(body)
+	return status, data
+}
+
+func sendSuperConnect(dispatcher *bot.Dispatcher, req *superConnectRequest) (int, superConnectResponse, error) {
+	var response superConnectResponse
+
+	if _, err := database.GetUserByID(req.AccepterID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, response, &superConnectError{http.StatusNotFound, "accepter_not_found",
+				fmt.Sprintf("получатель %d не найден", req.AccepterID)}
+		}
+		return 0, response, err
+	}
+	sender, err := database.GetUserByID(req.SenderID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, response, &superConnectError{http.StatusNotFound, "sender_not_found",
+				fmt.Sprintf("отправитель %d не найден", req.SenderID)}
+		}
+		return 0, response, err
+	}
+	senderName := sender.FullName
+	if senderName == "" {
+		senderName = fmt.Sprintf("Пользователь %d", sender.ID)
+	}
+
+	var ticket *database.Ticket
+	if req.TicketID != 0 {
+		ticket, err = database.GetTicketByID(req.TicketID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, response, &superConnectError{http.StatusNotFound, "ticket_not_found",
+				fmt.Sprintf("тикет #%d не найден", req.TicketID)}
+		}
+		if err != nil {
+			return 0, response, err
+		}
+		if ticket.UserID != req.AccepterID {
+			return 0, response, superConnectBadRequest(fmt.Sprintf("тикет #%d принадлежит другому пользователю", ticket.ID))
+		}
+		if ticket.Status.IsFinal() {
+			return 0, response, &superConnectError{http.StatusConflict, "ticket_closed",
+				fmt.Sprintf("тикет #%d в статусе «%s»", ticket.ID, ticket.Status.Title())}
+		}
+	}
+
+	// Текст экранируется: разметка в сообщении и имени отправителя не ломает отправку
+	text := fmt.Sprintf("📢 <b>Уведомление</b>\n\nОт: %s\n", html.EscapeString(senderName))
+	if ticket != nil {
+		text += fmt.Sprintf("По тикету #%d: %s\n", ticket.ID, html.EscapeString(ticket.Title))
+	}
+	text += "\n" + html.EscapeString(req.Message)
+
+	msg := tgbotapi.NewMessage(req.AccepterID, text)
+	msg.ParseMode = tgbotapi.ModeHTML
+	if len(req.Buttons) > 0 {
+		var rows [][]tgbotapi.InlineKeyboardButton
+		for _, button := range req.Buttons {
+			rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonURL(button.Text, button.URL)))
+		}
+		msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
+	}
+
+	// Сообщение по тикету сохраняется до отправки: если отправить не удастся,
+	// его доставит обработчик уведомлений тикета
+	if ticket != nil {
+		response.TicketMessageID, err = database.AddSentTicketMessage(&database.TicketMessage{
+			TicketID:   ticket.ID,
+			SenderType: "support",
+			SenderID:   req.SenderID,
+			Message:    fmt.Sprintf("%s: %s", senderName, req.Message),
+		})
+		if err != nil {
+			return 0, response, fmt.Errorf("ошибка при сохранении сообщения в тикет #%d: %v", ticket.ID, err)
+		}
+	}
+
+	sent, err := dispatcher.Send(msg)
+	if err != nil {
+		if ticket == nil {
+			logger.Error.Printf("/superconnect: ошибка при отправке сообщения пользователю %d: %v", req.AccepterID, err)
+			return 0, response, &superConnectError{http.StatusBadGateway, "send_failed", "не удалось отправить сообщение в Telegram"}
+		}
+		logger.Warning.With(logger.TicketID(ticket.ID)).Printf("/superconnect: сообщение в тикет #%d не отправлено, доставку выполнят уведомления: %v", ticket.ID, err)
+		if err := database.RequeueMessageNotification(response.TicketMessageID); err != nil {
+			return 0, response, fmt.Errorf("ошибка при постановке уведомления в очередь: %v", err)
+		}
+		response.OK, response.Queued = true, true
+		return http.StatusAccepted, response, nil
+	}
+
+	logger.Info.Printf("/superconnect: сообщение от %d отправлено пользователю %d", req.SenderID, req.AccepterID)
+	response.OK = true
+	response.TelegramMessageID = sent.MessageID
+	return http.StatusOK, response, nil
+}
+
+func superConnectErrorBody(e *superConnectError) []byte {
+	var body struct {
+		OK    bool `json:"ok"`
+		Error struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	body.Error.Code = e.code
+	body.Error.Message = e.message
+	data, _ := json.Marshal(body)
+	return data
+}
+
+func writeSuperConnectError(w http.ResponseWriter, err error) {
+	var scErr *superConnectError
+	if !errors.As(err, &scErr) {
+		scErr = &superConnectError{http.StatusInternalServerError, "internal", "внутренняя ошибка сервера"}
+	}
+	writeSuperConnectBody(w, scErr.status, superConnectErrorBody(scErr))
+}
+
+func writeSuperConnectBody(w http.ResponseWriter, status int, body []byte) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	w.Write(body)
+}
@@ -0,0 +1,597 @@
+// Package telegramtest содержит поддельный сервер Telegram Bot API для сквозных тестов бота.
+//
+// Сервер запускается на httptest, записывает все вызовы методов API
+// и отдает заранее зарегистрированные файлы и фотографии профиля.
+// Бот, созданный через Server.Bot, ходит только в этот сервер,
+// включая скачивание файлов по адресу api.telegram.org/file/...
+package telegramtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Token - токен бота, который ожидает сервер
+const Token = "123456:TEST-TOKEN"
+
+// BotID и BotUserName описывают пользователя-бота, которого возвращает getMe
+const (
+	BotID       int64 = 123456
+	BotUserName       = "support_test_bot"
+)
+
+// mediaParams - параметр с файлом для каждого метода отправки медиа
+var mediaParams = map[string]string{
+	"sendPhoto":     "photo",
+	"sendDocument":  "document",
+	"sendVoice":     "voice",
+	"sendVideo":     "video",
+	"sendVideoNote": "video_note",
+	"sendAudio":     "audio",
+}
+
+// errWrongFileID - ответ Telegram на отправку по неизвестному или устаревшему file_id
+const errWrongFileID = "Bad Request: wrong file identifier/HTTP URL specified"
+
+// maxPollWait ограничивает ожидание обновлений в getUpdates, чтобы тесты не зависали
+const maxPollWait = 2 * time.Second
+
+// Call - записанный вызов метода Bot API
+type Call struct {
+	Method string
+	Params map[string]string
+	Files  map[string]File
+}
+
+// File - файл, загруженный ботом в multipart-запросе (например, в sendPhoto)
+type File struct {
+	Name string
+	Data []byte
+}
+
+// Text возвращает текст сообщения (text) или подпись (caption)
+func (c Call) Text() string {
+	if text, ok := c.Params["text"]; ok {
+		return text
+	}
+	return c.Params["caption"]
+}
+
+// ChatID возвращает ID чата получателя
+func (c Call) ChatID() int64 {
+	id, _ := strconv.ParseInt(c.Params["chat_id"], 10, 64)
+	return id
+}
+
+// ReplyMarkup разбирает клавиатуру из параметра reply_markup в v
+// (*tgbotapi.ReplyKeyboardMarkup, *tgbotapi.InlineKeyboardMarkup и т.п.)
+func (c Call) ReplyMarkup(v interface{}) error {
+	markup, ok := c.Params["reply_markup"]
+	if !ok {
+		return fmt.Errorf("вызов %s без reply_markup", c.Method)
+	}
+	return json.Unmarshal([]byte(markup), v)
+}
+
+// Buttons возвращает тексты всех кнопок клавиатуры сообщения (обычной или inline)
+func (c Call) Buttons() []string {
+	var markup struct {
+		Keyboard [][]struct {
+			Text string `json:"text"`
+		} `json:"keyboard"`
+		InlineKeyboard [][]struct {
+			Text string `json:"text"`
+		} `json:"inline_keyboard"`
+	}
+	if err := c.ReplyMarkup(&markup); err != nil {
+		return nil
+	}
+
+	var buttons []string
+	for _, row := range append(markup.Keyboard, markup.InlineKeyboard...) {
+		for _, button := range row {
+			buttons = append(buttons, button.Text)
+		}
+	}
+	return buttons
+}
+
+// apiFailure - ошибка, которую сервер вернет на очередной вызов метода
+type apiFailure struct {
+	code       int
+	retryAfter int
+}
+
+// storedFile - файл, доступный через getFile и скачивание
+type storedFile struct {
+	path        string
+	contentType string
+	data        []byte
+}
+
+// Server - поддельный сервер Telegram Bot API
+type Server struct {
+	*httptest.Server
+
+	mu            sync.Mutex
+	calls         []Call
+	files         map[string]storedFile
+	profilePhotos map[int64][]string
+	updates       []tgbotapi.Update
+	lastUpdateID  int
+	lastMessageID int
+	lastUploadID  int
+	webhookURL    string
+	failures      map[string][]apiFailure
+	newCall       chan struct{}
+	newUpdate     chan struct{}
+}
+
+// NewServer запускает поддельный сервер. Его нужно остановить через Close.
+func NewServer() *Server {
+	s := &Server{
+		files:         make(map[string]storedFile),
+		profilePhotos: make(map[int64][]string),
+		failures:      make(map[string][]apiFailure),
+		newCall:       make(chan struct{}),
+		newUpdate:     make(chan struct{}),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// Client возвращает HTTP-клиент, который направляет все запросы в поддельный сервер
+// независимо от хоста. Так перехватываются и адреса файлов api.telegram.org/file/...
+func (s *Server) Client() *http.Client {
+	target, _ := url.Parse(s.URL)
+	return &http.Client{Transport: &redirectTransport{target: target, base: s.Server.Client().Transport}}
+}
+
+// Bot создает клиента Bot API, подключенного к поддельному серверу
+func (s *Server) Bot() (*tgbotapi.BotAPI, error) {
+	return tgbotapi.NewBotAPIWithClient(Token, tgbotapi.APIEndpoint, s.Client())
+}
+
+// AddFile регистрирует файл, который бот сможет получить через getFile и скачать
+func (s *Server) AddFile(fileID, contentType string, data []byte) tgbotapi.PhotoSize {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.files[fileID] = storedFile{path: "photos/" + fileID, contentType: contentType, data: data}
+	return tgbotapi.PhotoSize{FileID: fileID, FileUniqueID: fileID, Width: 640, Height: 480, FileSize: len(data)}
+}
+
+// RemoveFile удаляет файл, имитируя устаревший file_id: отправка по нему завершится ошибкой
+func (s *Server) RemoveFile(fileID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.files, fileID)
+}
+
+// FailNext заставляет сервер ответить ошибкой с кодом code на следующий вызов метода.
+// Для кода 429 retryAfter передается в parameters.retry_after (в секундах).
+// Несколько вызовов FailNext для одного метода складываются в очередь.
+func (s *Server) FailNext(method string, code, retryAfter int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures[method] = append(s.failures[method], apiFailure{code: code, retryAfter: retryAfter})
+}
+
+// SetProfilePhotos задает фотографии профиля пользователя (ID ранее добавленных файлов)
+func (s *Server) SetProfilePhotos(userID int64, fileIDs ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.profilePhotos[userID] = fileIDs
+}
+
+// Calls возвращает все записанные вызовы в порядке поступления
+func (s *Server) Calls() []Call {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Call(nil), s.calls...)
+}
+
+// CallsTo возвращает записанные вызовы указанного метода
+func (s *Server) CallsTo(method string) []Call {
+	var calls []Call
+	for _, call := range s.Calls() {
+		if call.Method == method {
+			calls = append(calls, call)
+		}
+	}
+	return calls
+}
+
+// LastCall возвращает последний вызов метода и false, если метод не вызывался
+func (s *Server) LastCall(method string) (Call, bool) {
+	calls := s.CallsTo(method)
+	if len(calls) == 0 {
+		return Call{}, false
+	}
+	return calls[len(calls)-1], true
+}
+
+// WaitForCall ждет вызова метода (для фоновых отправок, например уведомлений)
+func (s *Server) WaitForCall(method string, timeout time.Duration) (Call, bool) {
+	deadline := time.After(timeout)
+	for {
+		s.mu.Lock()
+		for i := len(s.calls) - 1; i >= 0; i-- {
+			if s.calls[i].Method == method {
+				call := s.calls[i]
+				s.mu.Unlock()
+				return call, true
+			}
+		}
+		wait := s.newCall
+		s.mu.Unlock()
+
+		select {
+		case <-wait:
+		case <-deadline:
+			return Call{}, false
+		}
+	}
+}
+
+// Reset очищает записанные вызовы
+func (s *Server) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls = nil
+}
+
+// WebhookURL возвращает адрес, установленный через setWebhook
+func (s *Server) WebhookURL() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.webhookURL
+}
+
+// InjectUpdate ставит обновление в очередь getUpdates и возвращает его с присвоенным update_id
+func (s *Server) InjectUpdate(update tgbotapi.Update) tgbotapi.Update {
+	s.mu.Lock()
+	s.lastUpdateID++
+	update.UpdateID = s.lastUpdateID
+	s.updates = append(s.updates, update)
+	close(s.newUpdate)
+	s.newUpdate = make(chan struct{})
+	s.mu.Unlock()
+	return update
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if strings.HasPrefix(r.URL.Path, "/file/bot") {
+		s.serveFile(w, r)
+		return
+	}
+
+	token, method, ok := strings.Cut(strings.TrimPrefix(r.URL.Path, "/bot"), "/")
+	if !ok || !strings.HasPrefix(r.URL.Path, "/bot") {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	if token != Token {
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	call, err := parseCall(method, r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Bad Request: "+err.Error())
+		return
+	}
+	s.record(call)
+
+	if failure, ok := s.nextFailure(method); ok {
+		writeFailure(w, failure)
+		return
+	}
+
+	switch method {
+	case "getMe":
+		writeResult(w, tgbotapi.User{ID: BotID, IsBot: true, FirstName: "Support", UserName: BotUserName})
+	case "sendMessage":
+		writeResult(w, s.newMessage(call))
+	case "sendPhoto", "sendDocument", "sendVoice", "sendVideo", "sendVideoNote", "sendAudio":
+		message := s.newMessage(call)
+		fileID, ok := s.resolveMedia(call, call.Params[mediaParams[method]], mediaParams[method])
+		if !ok {
+			writeError(w, http.StatusBadRequest, errWrongFileID)
+			return
+		}
+		setMessageMedia(&message, method, fileID)
+		writeResult(w, message)
+	case "sendMediaGroup":
+		var media []struct {
+			Type  string `json:"type"`
+			Media string `json:"media"`
+		}
+		_ = json.Unmarshal([]byte(call.Params["media"]), &media)
+		messages := make([]tgbotapi.Message, 0, len(media))
+		for _, item := range media {
+			fileID, ok := s.resolveMedia(call, item.Media, "")
+			if !ok {
+				writeError(w, http.StatusBadRequest, errWrongFileID)
+				return
+			}
+			message := s.newMessage(call)
+			if item.Type != "" {
+				setMessageMedia(&message, "send"+strings.ToUpper(item.Type[:1])+item.Type[1:], fileID)
+			}
+			messages = append(messages, message)
+		}
+		writeResult(w, messages)
+	case "getFile":
+		s.serveGetFile(w, call)
+	case "getUserProfilePhotos":
+		s.serveProfilePhotos(w, call)
+	case "setWebhook":
+		s.mu.Lock()
+		s.webhookURL = call.Params["url"]
+		s.mu.Unlock()
+		writeResult(w, true)
+	case "deleteWebhook":
+		s.mu.Lock()
+		s.webhookURL = ""
+		s.mu.Unlock()
+		writeResult(w, true)
+	case "getWebhookInfo":
+		writeResult(w, tgbotapi.WebhookInfo{URL: s.WebhookURL()})
+	case "answerCallbackQuery", "editMessageReplyMarkup", "deleteMessage":
+		writeResult(w, true)
+	case "getUpdates":
+		s.serveUpdates(w, call)
+	default:
+		writeError(w, http.StatusNotFound, "Not Found: method "+method)
+	}
+}
+
+func (s *Server) record(call Call) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if call.Method == "getUpdates" {
+		return
+	}
+	s.calls = append(s.calls, call)
+	close(s.newCall)
+	s.newCall = make(chan struct{})
+}
+
+// nextFailure извлекает ошибку, заданную через FailNext для метода
+func (s *Server) nextFailure(method string) (apiFailure, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	queue := s.failures[method]
+	if len(queue) == 0 {
+		return apiFailure{}, false
+	}
+	s.failures[method] = queue[1:]
+	return queue[0], true
+}
+
+func (s *Server) newMessage(call Call) tgbotapi.Message {
+	s.mu.Lock()
+	s.lastMessageID++
+	id := s.lastMessageID
+	s.mu.Unlock()
+
+	chatID := call.ChatID()
+	return tgbotapi.Message{
+		MessageID: id,
+		From:      &tgbotapi.User{ID: BotID, IsBot: true, UserName: BotUserName},
+		Date:      int(time.Now().Unix()),
+		Chat:      &tgbotapi.Chat{ID: chatID, Type: "private"},
+		Text:      call.Params["text"],
+		Caption:   call.Params["caption"],
+	}
+}
+
+// resolveMedia возвращает file_id отправленного файла. Загруженный в запросе файл
+// регистрируется под новым file_id, как это делает Telegram; ссылка на неизвестный
+// file_id считается ошибкой. field - имя multipart-поля для методов с одним файлом.
+func (s *Server) resolveMedia(call Call, media, field string) (string, bool) {
+	name := field
+	if strings.HasPrefix(media, "attach://") {
+		name = strings.TrimPrefix(media, "attach://")
+	} else if media != "" {
+		s.mu.Lock()
+		_, ok := s.files[media]
+		s.mu.Unlock()
+		return media, ok
+	}
+
+	upload, ok := call.Files[name]
+	if !ok {
+		return "", false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastUploadID++
+	fileID := fmt.Sprintf("uploaded_%d", s.lastUploadID)
+	s.files[fileID] = storedFile{path: "uploads/" + fileID, contentType: http.DetectContentType(upload.Data), data: upload.Data}
+	return fileID, true
+}
+
+// setMessageMedia добавляет в ответное сообщение отправленный файл
+func setMessageMedia(message *tgbotapi.Message, method, fileID string) {
+	switch method {
+	case "sendPhoto":
+		message.Photo = []tgbotapi.PhotoSize{{FileID: fileID, FileUniqueID: fileID}}
+	case "sendDocument":
+		message.Document = &tgbotapi.Document{FileID: fileID, FileUniqueID: fileID}
+	case "sendVoice":
+		message.Voice = &tgbotapi.Voice{FileID: fileID, FileUniqueID: fileID}
+	case "sendVideo":
+		message.Video = &tgbotapi.Video{FileID: fileID, FileUniqueID: fileID}
+	case "sendVideoNote":
+		message.VideoNote = &tgbotapi.VideoNote{FileID: fileID, FileUniqueID: fileID}
+	case "sendAudio":
+		message.Audio = &tgbotapi.Audio{FileID: fileID, FileUniqueID: fileID}
+	}
+}
+
+func (s *Server) serveGetFile(w http.ResponseWriter, call Call) {
+	fileID := call.Params["file_id"]
+	s.mu.Lock()
+	file, ok := s.files[fileID]
+	s.mu.Unlock()
+	if !ok {
+		writeError(w, http.StatusBadRequest, "Bad Request: invalid file_id")
+		return
+	}
+	writeResult(w, tgbotapi.File{FileID: fileID, FileUniqueID: fileID, FileSize: len(file.data), FilePath: file.path})
+}
+
+func (s *Server) serveFile(w http.ResponseWriter, r *http.Request) {
+	token, path, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/file/bot"), "/")
+	if token != Token {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, file := range s.files {
+		if file.path == path {
+			w.Header().Set("Content-Type", file.contentType)
+			w.Write(file.data)
+			return
+		}
+	}
+	http.NotFound(w, r)
+}
+
+func (s *Server) serveProfilePhotos(w http.ResponseWriter, call Call) {
+	userID, _ := strconv.ParseInt(call.Params["user_id"], 10, 64)
+
+	s.mu.Lock()
+	fileIDs := s.profilePhotos[userID]
+	photos := tgbotapi.UserProfilePhotos{TotalCount: len(fileIDs)}
+	for _, fileID := range fileIDs {
+		size := len(s.files[fileID].data)
+		photos.Photos = append(photos.Photos, []tgbotapi.PhotoSize{
+			{FileID: fileID, FileUniqueID: fileID, Width: 640, Height: 640, FileSize: size},
+		})
+	}
+	s.mu.Unlock()
+
+	writeResult(w, photos)
+}
+
+// serveUpdates отдает обновления с update_id >= offset, ожидая новые не дольше maxPollWait
+func (s *Server) serveUpdates(w http.ResponseWriter, call Call) {
+	offset, _ := strconv.Atoi(call.Params["offset"])
+	wait := maxPollWait
+	if timeout, err := strconv.Atoi(call.Params["timeout"]); err == nil && time.Duration(timeout)*time.Second < wait {
+		wait = time.Duration(timeout) * time.Second
+	}
+	deadline := time.After(wait)
+
+	for {
+		s.mu.Lock()
+		var pending []tgbotapi.Update
+		for _, update := range s.updates {
+			if update.UpdateID >= offset {
+				pending = append(pending, update)
+			}
+		}
+		newUpdate := s.newUpdate
+		s.mu.Unlock()
+
+		if len(pending) > 0 {
+			writeResult(w, pending)
+			return
+		}
+
+		select {
+		case <-newUpdate:
+		case <-deadline:
+			writeResult(w, []tgbotapi.Update{})
+			return
+		}
+	}
+}
+
+// parseCall читает параметры запроса: form-urlencoded или multipart с файлами
+func parseCall(method string, r *http.Request) (Call, error) {
+	call := Call{Method: method, Params: make(map[string]string)}
+
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		if err := r.ParseMultipartForm(32 << 20); err != nil {
+			return call, err
+		}
+		for name, headers := range r.MultipartForm.File {
+			file, err := headers[0].Open()
+			if err != nil {
+				return call, err
+			}
+			data, err := io.ReadAll(file)
+			file.Close()
+			if err != nil {
+				return call, err
+			}
+			if call.Files == nil {
+				call.Files = make(map[string]File)
+			}
+			call.Files[name] = File{Name: headers[0].Filename, Data: data}
+		}
+	} else if err := r.ParseForm(); err != nil {
+		return call, err
+	}
+
+	for name, values := range r.Form {
+		call.Params[name] = values[0]
+	}
+	return call, nil
+}
+
+func writeResult(w http.ResponseWriter, result interface{}) {
+	data, err := json.Marshal(result)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tgbotapi.APIResponse{Ok: true, Result: data})
+}
+
+func writeError(w http.ResponseWriter, code int, description string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(tgbotapi.APIResponse{Ok: false, ErrorCode: code, Description: description})
+}
+
+func writeFailure(w http.ResponseWriter, failure apiFailure) {
+	response := tgbotapi.APIResponse{Ok: false, ErrorCode: failure.code, Description: http.StatusText(failure.code)}
+	if failure.code == http.StatusTooManyRequests {
+		response.Description = fmt.Sprintf("Too Many Requests: retry after %d", failure.retryAfter)
+		response.Parameters = &tgbotapi.ResponseParameters{RetryAfter: failure.retryAfter}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(failure.code)
+	json.NewEncoder(w).Encode(response)
+}
+
+// redirectTransport отправляет все запросы на адрес поддельного сервера
+type redirectTransport struct {
+	target *url.URL
+	base   http.RoundTripper
+}
+
+func (t *redirectTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	r = r.Clone(r.Context())
+	r.URL.Scheme = t.target.Scheme
+	r.URL.Host = t.target.Host
+	r.Host = t.target.Host
+	return t.base.RoundTrip(r)
+}
@@ -0,0 +1,110 @@
+package telegramtest
+
+import (
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// lastIncomingID - счетчик ID входящих сообщений и callback-запросов
+var lastIncomingID int64
+
+func nextIncomingID() int {
+	return int(atomic.AddInt64(&lastIncomingID, 1))
+}
+
+// User возвращает пользователя Telegram с указанным ID
+func User(userID int64) *tgbotapi.User {
+	return &tgbotapi.User{ID: userID, FirstName: "Test", UserName: "user" + strconv.FormatInt(userID, 10)}
+}
+
+// TextMessage создает входящее текстовое сообщение пользователя в личном чате.
+// Текст, начинающийся с "/", помечается как команда.
+func TextMessage(userID int64, text string) *tgbotapi.Message {
+	message := newMessage(userID)
+	message.Text = text
+	if strings.HasPrefix(text, "/") {
+		command := strings.SplitN(text, " ", 2)[0]
+		message.Entities = []tgbotapi.MessageEntity{{Type: "bot_command", Offset: 0, Length: len(command)}}
+	}
+	return message
+}
+
+// ContactMessage создает сообщение с контактом пользователя (кнопка "Поделиться номером")
+func ContactMessage(userID int64, phone string) *tgbotapi.Message {
+	message := newMessage(userID)
+	message.Contact = &tgbotapi.Contact{PhoneNumber: phone, FirstName: "Test", UserID: userID}
+	return message
+}
+
+// PhotoMessage создает сообщение с фотографией. Файл нужно заранее добавить через Server.AddFile.
+func PhotoMessage(userID int64, photo tgbotapi.PhotoSize, caption string) *tgbotapi.Message {
+	message := newMessage(userID)
+	message.Photo = []tgbotapi.PhotoSize{photo}
+	message.Caption = caption
+	return message
+}
+
+// DocumentMessage создает сообщение с документом. Файл нужно заранее добавить через Server.AddFile.
+func DocumentMessage(userID int64, file tgbotapi.PhotoSize, fileName, mimeType, caption string) *tgbotapi.Message {
+	message := newMessage(userID)
+	message.Document = &tgbotapi.Document{
+		FileID: file.FileID, FileUniqueID: file.FileUniqueID,
+		FileName: fileName, MimeType: mimeType, FileSize: file.FileSize,
+	}
+	message.Caption = caption
+	return message
+}
+
+// VoiceMessage создает голосовое сообщение. Файл нужно заранее добавить через Server.AddFile.
+func VoiceMessage(userID int64, file tgbotapi.PhotoSize, duration int) *tgbotapi.Message {
+	message := newMessage(userID)
+	message.Voice = &tgbotapi.Voice{
+		FileID: file.FileID, FileUniqueID: file.FileUniqueID,
+		Duration: duration, MimeType: "audio/ogg", FileSize: file.FileSize,
+	}
+	return message
+}
+
+// VideoMessage создает сообщение с видео. Файл нужно заранее добавить через Server.AddFile.
+func VideoMessage(userID int64, file tgbotapi.PhotoSize, duration int, caption string) *tgbotapi.Message {
+	message := newMessage(userID)
+	message.Video = &tgbotapi.Video{
+		FileID: file.FileID, FileUniqueID: file.FileUniqueID,
+		Duration: duration, MimeType: "video/mp4", FileSize: file.FileSize,
+	}
+	message.Caption = caption
+	return message
+}
+
+// CallbackQuery создает нажатие на inline-кнопку с callback data
+func CallbackQuery(userID int64, data string) *tgbotapi.CallbackQuery {
+	return &tgbotapi.CallbackQuery{
+		ID:      strconv.Itoa(nextIncomingID()),
+		From:    User(userID),
+		Message: newMessage(userID),
+		Data:    data,
+	}
+}
+
+// MessageUpdate оборачивает сообщение в обновление (update_id присваивает Server.InjectUpdate)
+func MessageUpdate(message *tgbotapi.Message) tgbotapi.Update {
+	return tgbotapi.Update{Message: message}
+}
+
+// CallbackUpdate оборачивает callback-запрос в обновление
+func CallbackUpdate(query *tgbotapi.CallbackQuery) tgbotapi.Update {
+	return tgbotapi.Update{CallbackQuery: query}
+}
+
+func newMessage(userID int64) *tgbotapi.Message {
+	return &tgbotapi.Message{
+		MessageID: nextIncomingID(),
+		From:      User(userID),
+		Date:      int(time.Now().Unix()),
+		Chat:      &tgbotapi.Chat{ID: userID, Type: "private"},
+	}
+}
@@ -0,0 +1,329 @@
+// Package webhook доставляет события бота (тикеты, сообщения, регистрации) внешним системам.
+// События и доставки записываются в БД пакетом database (таблицы webhook_events и webhook_deliveries)
+// в одной транзакции с изменением; Sender отправляет их подписчикам с повторами.
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"supportTicketBotGo/database"
+	"supportTicketBotGo/logger"
+)
+
+// Параметры доставки вебхуков
+const (
+	batchSize    = 50
+	pollInterval = 10 * time.Second // так подхватываются повторы и доставки, возвращенные командой replay
+	staleAfter   = 5 * time.Minute
+	baseDelay    = 30 * time.Second
+	maxDelay     = time.Hour
+	// DefaultMaxAttempts - попыток доставки до перевода в статус dead (около 3 часов повторов)
+	DefaultMaxAttempts = 10
+	// DefaultTimeout - время ожидания ответа подписчика
+	DefaultTimeout = 10 * time.Second
+)
+
+// Заголовки запросов к подписчикам
+const (
+	HeaderEvent     = "X-Webhook-Event"     // тип события
+	HeaderEventID   = "X-Webhook-Id"        // ID события, одинаковый для всех подписчиков и повторов
+	HeaderTimestamp = "X-Webhook-Timestamp" // время отправки, Unix-секунды
+	HeaderSignature = "X-Webhook-Signature" // sha256=<HMAC-SHA256(secret, timestamp + "." + тело) в hex>
+)
+
+// Subscriber - подписчик вебхуков
+type Subscriber struct {
+	URL    string
+	Secret string   // ключ подписи HMAC
+	Events []string // пустой список - все события
+}
+
+// Options - параметры доставки; нулевые значения заменяются значениями по умолчанию
+type Options struct {
+	MaxAttempts int
+	Timeout     time.Duration
+	// Queue - очередь доставок; по умолчанию таблица webhook_deliveries
+	Queue Queue
+}
+
+// Queue - очередь доставок вебхуков, из которой Sender берет доставки и куда записывает результат
+type Queue interface {
+	ClaimWebhookDeliveries(limit int, staleAfter time.Duration) ([]database.WebhookDelivery, error)
+	MarkWebhookDelivered(deliveryID int64) error
+	RetryWebhookDelivery(deliveryID int64, deliveryErr error, nextAttempt time.Time) error
+	MarkWebhookDead(deliveryID int64, deliveryErr error) error
+}
+
+// dbQueue - очередь доставок в PostgreSQL
+type dbQueue struct{}
+
+func (dbQueue) ClaimWebhookDeliveries(limit int, staleAfter time.Duration) ([]database.WebhookDelivery, error) {
+	return database.ClaimWebhookDeliveries(limit, staleAfter)
+}
+
+func (dbQueue) MarkWebhookDelivered(deliveryID int64) error {
+	return database.MarkWebhookDelivered(deliveryID)
+}
+
+func (dbQueue) RetryWebhookDelivery(deliveryID int64, deliveryErr error, nextAttempt time.Time) error {
+	return database.RetryWebhookDelivery(deliveryID, deliveryErr, nextAttempt)
+}
+
+func (dbQueue) MarkWebhookDead(deliveryID int64, deliveryErr error) error {
+	return database.MarkWebhookDead(deliveryID, deliveryErr)
+}
+
+// envelope - тело запроса к подписчику
+type envelope struct {
+	ID        int64           `json:"id"`
+	Type      string          `json:"type"`
+	CreatedAt time.Time       `json:"created_at"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// Sender отправляет накопленные доставки вебхуков. Доставки разным подписчикам идут параллельно,
+// неудачные повторяются с экспоненциальной задержкой, после MaxAttempts попыток переводятся в dead.
+type Sender struct {
+	secrets     map[string]string
+	queue       Queue
+	maxAttempts int
+	client      *http.Client
+	wake        chan struct{}
+	stop        chan struct{}
+	done        chan struct{}
+	stopOnce    sync.Once
+}
+
+// Subscriptions возвращает подписки для database.SetWebhookSubscriptions
+func Subscriptions(subscribers []Subscriber) []database.WebhookSubscription {
+	result := make([]database.WebhookSubscription, 0, len(subscribers))
+	for _, s := range subscribers {
+		result = append(result, database.WebhookSubscription{URL: s.URL, Events: s.Events})
+	}
+	return result
+}
+
+// Validate проверяет адреса подписчиков и типы событий
+func Validate(subscribers []Subscriber) error {
+	seen := make(map[string]bool)
+	for _, s := range subscribers {
+		if s.URL == "" {
+			return errors.New("у подписчика вебхуков не задан url")
+		}
+		if seen[s.URL] {
+			return fmt.Errorf("подписчик вебхуков %s указан дважды", s.URL)
+		}
+		seen[s.URL] = true
+		for _, event := range s.Events {
+			if !database.IsWebhookEventType(event) {
+				return fmt.Errorf("неизвестное событие вебхука %q у подписчика %s", event, s.URL)
+			}
+		}
+	}
+	return nil
+}
+
+// NewSender создает обработчик доставки вебхуков
+func NewSender(subscribers []Subscriber, opts Options) *Sender {
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = DefaultMaxAttempts
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultTimeout
+	}
+	if opts.Queue == nil {
+		opts.Queue = dbQueue{}
+	}
+	secrets := make(map[string]string, len(subscribers))
+	for _, s := range subscribers {
+		secrets[s.URL] = s.Secret
+	}
+	return &Sender{
+		secrets:     secrets,
+		queue:       opts.Queue,
+		maxAttempts: opts.MaxAttempts,
+		client:      &http.Client{Timeout: opts.Timeout},
+		wake:        make(chan struct{}, 1),
+		stop:        make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+}
+
+// Start запускает доставку в отдельной горутине
+func (s *Sender) Start() {
+	go s.run()
+}
+
+// Wake сообщает о новых событиях. Не блокирует вызывающего.
+func (s *Sender) Wake() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Stop останавливает доставку, дожидаясь уже начатых запросов
+func (s *Sender) Stop() {
+	s.stopOnce.Do(func() {
+		close(s.stop)
+		<-s.done
+	})
+}
+
+func (s *Sender) run() {
+	defer close(s.done)
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	// Доставляем события, накопившиеся за время простоя
+	s.processPending()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-s.wake:
+		case <-ticker.C:
+		}
+		s.processPending()
+	}
+}
+
+// processPending отправляет все доставки, время которых подошло
+func (s *Sender) processPending() {
+	for {
+		deliveries, err := s.queue.ClaimWebhookDeliveries(batchSize, staleAfter)
+		if err != nil {
+			logger.Error.Printf("Ошибка при получении доставок вебхуков: %v", err)
+			return
+		}
+
+		// Доставки одному подписчику отправляются последовательно, разным подписчикам - параллельно.
+		// Порядок событий не гарантируется: неудачная доставка повторяется позже, не задерживая следующие.
+		byURL := make(map[string][]database.WebhookDelivery)
+		for _, d := range deliveries {
+			byURL[d.URL] = append(byURL[d.URL], d)
+		}
+		var wg sync.WaitGroup
+		for _, group := range byURL {
+			wg.Add(1)
+			go func(group []database.WebhookDelivery) {
+				defer wg.Done()
+				for _, d := range group {
+					s.deliver(d)
+				}
+			}(group)
+		}
+		wg.Wait()
+
+		if len(deliveries) < batchSize {
+			return
+		}
+		select {
+		case <-s.stop:
+			return
+		default:
+		}
+	}
+}
+
+// deliver отправляет одну доставку и записывает результат
+func (s *Sender) deliver(d database.WebhookDelivery) {
+	secret, ok := s.secrets[d.URL]
+	if !ok {
+		s.dead(d, errors.New("подписчик удален из конфигурации"))
+		return
+	}
+
+	err := s.post(d, secret)
+	if err == nil {
+		if err := s.queue.MarkWebhookDelivered(d.ID); err != nil {
+			logger.Error.Printf("Ошибка при отметке доставки вебхука %d: %v", d.ID, err)
+		}
+		return
+	}
+
+	if d.Attempts >= s.maxAttempts {
+		s.dead(d, err)
+		return
+	}
+	next := time.Now().Add(backoff(d.Attempts))
+	logger.Warning.Printf("Не удалось доставить событие %d (%s) на %s (попытка %d), повтор в %s: %v",
+		d.EventID, d.EventType, d.URL, d.Attempts, next.Format("15:04:05"), err)
+	if err := s.queue.RetryWebhookDelivery(d.ID, err, next); err != nil {
+		logger.Error.Printf("Ошибка при сохранении результата доставки вебхука %d: %v", d.ID, err)
+	}
+}
+
+// post отправляет подписчику подписанный запрос с событием
+func (s *Sender) post(d database.WebhookDelivery, secret string) error {
+	body, err := json.Marshal(envelope{ID: d.EventID, Type: d.EventType, CreatedAt: d.EventCreatedAt, Data: d.Payload})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, d.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "SupportTicketBot-Webhook/1.0")
+	req.Header.Set(HeaderEvent, d.EventType)
+	req.Header.Set(HeaderEventID, strconv.FormatInt(d.EventID, 10))
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderSignature, "sha256="+Sign(secret, timestamp, body))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("подписчик ответил %s", resp.Status)
+	}
+	return nil
+}
+
+func (s *Sender) dead(d database.WebhookDelivery, deliveryErr error) {
+	logger.Error.Printf("Доставка события %d (%s) на %s прекращена после %d попыток: %v",
+		d.EventID, d.EventType, d.URL, d.Attempts, deliveryErr)
+	if err := s.queue.MarkWebhookDead(d.ID, deliveryErr); err != nil {
+		logger.Error.Printf("Ошибка при сохранении результата доставки вебхука %d: %v", d.ID, err)
+	}
+}
+
+// Sign возвращает подпись тела запроса: HMAC-SHA256 от "timestamp.body" в hex
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// backoff возвращает задержку перед следующей попыткой: 30 с, 1 мин, 2 мин... но не больше часа
+func backoff(attempts int) time.Duration {
+	delay := baseDelay
+	for i := 1; i < attempts && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxDelay {
+		delay = maxDelay
+	}
+	return delay
+}
@@ -0,0 +1,274 @@
+package webhook
+
+import (
+	"database/sql"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"supportTicketBotGo/database"
+)
+
+func TestSign(t *testing.T) {
+	tests := []struct {
+		secret, timestamp, body string
+		want                    string
+	}{
+		{"secret", "1700000000", `{"id":1}`, "3dd1b9aef568d75f6790a84bd2e5dfa1f44409eef3cbdbd3f10b837376100c11"},
+		{"secret", "1700000001", `{"id":1}`, "d0c79a345e51a61362e0123dd2fc00ec01a78397760f2babc7a052bbbf46c313"},
+		{"", "0", "", "b849d5a581847b281957065739df36df2463d1977ea8d6e1e4e6cf33fadc68c3"},
+	}
+	for _, tt := range tests {
+		if got := Sign(tt.secret, tt.timestamp, []byte(tt.body)); got != tt.want {
+			t.Errorf("Sign(%q, %q, %q) = %s, ожидалось %s", tt.secret, tt.timestamp, tt.body, got, tt.want)
+		}
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{0, 30 * time.Second},
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{3, 2 * time.Minute},
+		{7, 32 * time.Minute},
+		{8, time.Hour},
+		{50, time.Hour},
+	}
+	for _, tt := range tests {
+		if got := backoff(tt.attempts); got != tt.want {
+			t.Errorf("backoff(%d) = %v, ожидалось %v", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+// memQueue - очередь доставок в памяти. Время следующей попытки записывается, но не учитывается:
+// тест сам решает, когда обрабатывать очередь.
+type memQueue struct {
+	mu         sync.Mutex
+	deliveries []*database.WebhookDelivery
+}
+
+func (q *memQueue) add(d database.WebhookDelivery) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	d.Status = "pending"
+	q.deliveries = append(q.deliveries, &d)
+}
+
+func (q *memQueue) get(id int64) database.WebhookDelivery {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, d := range q.deliveries {
+		if d.ID == id {
+			return *d
+		}
+	}
+	return database.WebhookDelivery{}
+}
+
+// replay повторяет действие команды "webhooks replay": сбрасывает попытки и возвращает доставку в очередь
+func (q *memQueue) replay(id int64) {
+	q.update(id, func(d *database.WebhookDelivery) {
+		d.Status, d.Attempts, d.LastError = "pending", 0, sql.NullString{}
+	})
+}
+
+func (q *memQueue) update(id int64, change func(d *database.WebhookDelivery)) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, d := range q.deliveries {
+		if d.ID == id {
+			change(d)
+		}
+	}
+}
+
+func (q *memQueue) ClaimWebhookDeliveries(limit int, staleAfter time.Duration) ([]database.WebhookDelivery, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var claimed []database.WebhookDelivery
+	for _, d := range q.deliveries {
+		if d.Status == "pending" && len(claimed) < limit {
+			d.Status = "sending"
+			d.Attempts++
+			claimed = append(claimed, *d)
+		}
+	}
+	return claimed, nil
+}
+
+func (q *memQueue) MarkWebhookDelivered(deliveryID int64) error {
+	q.update(deliveryID, func(d *database.WebhookDelivery) {
+		d.Status, d.LastError = "delivered", sql.NullString{}
+	})
+	return nil
+}
+
+func (q *memQueue) RetryWebhookDelivery(deliveryID int64, deliveryErr error, nextAttempt time.Time) error {
+	q.update(deliveryID, func(d *database.WebhookDelivery) {
+		d.Status, d.NextAttemptAt = "pending", nextAttempt
+		d.LastError = sql.NullString{String: deliveryErr.Error(), Valid: true}
+	})
+	return nil
+}
+
+func (q *memQueue) MarkWebhookDead(deliveryID int64, deliveryErr error) error {
+	q.update(deliveryID, func(d *database.WebhookDelivery) {
+		d.Status = "dead"
+		d.LastError = sql.NullString{String: deliveryErr.Error(), Valid: true}
+	})
+	return nil
+}
+
+// subscriber - подписчик, отвечающий заданными кодами; после их окончания отвечает 200
+type subscriber struct {
+	*httptest.Server
+	mu       sync.Mutex
+	codes    []int
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func newSubscriber(t *testing.T, codes ...int) *subscriber {
+	s := &subscriber{codes: codes}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		s.mu.Lock()
+		s.requests = append(s.requests, r)
+		s.bodies = append(s.bodies, body)
+		code := http.StatusOK
+		if len(s.codes) > 0 {
+			code, s.codes = s.codes[0], s.codes[1:]
+		}
+		s.mu.Unlock()
+		w.WriteHeader(code)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *subscriber) received() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.requests)
+}
+
+func (s *subscriber) request(i int) (*http.Request, []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests[i], s.bodies[i]
+}
+
+func newTestSender(sub *subscriber, maxAttempts int) (*Sender, *memQueue) {
+	queue := &memQueue{}
+	queue.add(database.WebhookDelivery{
+		ID: 1, EventID: 7, EventType: database.WebhookTicketCreated, URL: sub.URL,
+		Payload: json.RawMessage(`{"ticket_id":42}`), EventCreatedAt: time.Unix(1700000000, 0).UTC(),
+	})
+	sender := NewSender([]Subscriber{{URL: sub.URL, Secret: "s3cr3t"}}, Options{MaxAttempts: maxAttempts, Queue: queue})
+	return sender, queue
+}
+
+func TestSenderRetriesUntilDelivered(t *testing.T) {
+	sub := newSubscriber(t, http.StatusInternalServerError)
+	sender, queue := newTestSender(sub, 3)
+
+	start := time.Now()
+	sender.processPending()
+	d := queue.get(1)
+	if d.Status != "pending" || d.Attempts != 1 || !d.LastError.Valid {
+		t.Fatalf("после ответа 500: %+v", d)
+	}
+	if delay := d.NextAttemptAt.Sub(start); delay < baseDelay || delay > baseDelay+time.Second {
+		t.Fatalf("повтор через %v, ожидалось %v", delay, baseDelay)
+	}
+
+	sender.processPending()
+	if d := queue.get(1); d.Status != "delivered" || d.Attempts != 2 || d.LastError.Valid {
+		t.Fatalf("после ответа 200: %+v", d)
+	}
+	if n := sub.received(); n != 2 {
+		t.Fatalf("подписчик получил %d запросов, ожидалось 2", n)
+	}
+
+	// Повтор отправляет то же событие с действительной подписью
+	req, body := sub.request(1)
+	if req.Header.Get(HeaderEventID) != "7" || req.Header.Get(HeaderEvent) != database.WebhookTicketCreated {
+		t.Fatalf("заголовки повтора: %v", req.Header)
+	}
+	want := "sha256=" + Sign("s3cr3t", req.Header.Get(HeaderTimestamp), body)
+	if got := req.Header.Get(HeaderSignature); got != want {
+		t.Fatalf("подпись %s, ожидалась %s", got, want)
+	}
+	var payload envelope
+	if err := json.Unmarshal(body, &payload); err != nil || payload.ID != 7 || string(payload.Data) != `{"ticket_id":42}` {
+		t.Fatalf("тело запроса %s: %v", body, err)
+	}
+}
+
+func TestSenderMarksDeadAndReplays(t *testing.T) {
+	sub := newSubscriber(t, http.StatusInternalServerError, http.StatusBadGateway)
+	sender, queue := newTestSender(sub, 2)
+
+	sender.processPending()
+	sender.processPending()
+	d := queue.get(1)
+	if d.Status != "dead" || d.Attempts != 2 || d.LastError.String != "подписчик ответил 502 Bad Gateway" {
+		t.Fatalf("после исчерпания попыток: %+v", d)
+	}
+
+	// Dead-доставки больше не отправляются
+	sender.processPending()
+	if n := sub.received(); n != 2 {
+		t.Fatalf("подписчик получил %d запросов, ожидалось 2", n)
+	}
+
+	// webhooks replay возвращает доставку в очередь со сброшенным счетчиком попыток
+	queue.replay(1)
+	sender.processPending()
+	if d := queue.get(1); d.Status != "delivered" || d.Attempts != 1 {
+		t.Fatalf("после replay: %+v", d)
+	}
+}
+
+func TestSenderDropsRemovedSubscriber(t *testing.T) {
+	sub := newSubscriber(t)
+	queue := &memQueue{}
+	queue.add(database.WebhookDelivery{ID: 1, EventID: 7, EventType: database.WebhookTicketCreated, URL: sub.URL})
+	sender := NewSender(nil, Options{Queue: queue})
+
+	sender.processPending()
+	if d := queue.get(1); d.Status != "dead" {
+		t.Fatalf("доставка удаленному подписчику: %+v", d)
+	}
+	if n := sub.received(); n != 0 {
+		t.Fatalf("подписчик получил %d запросов", n)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name        string
+		subscribers []Subscriber
+		wantErr     bool
+	}{
+		{"пусто", nil, false},
+		{"корректный", []Subscriber{{URL: "https://example.com/hook", Events: []string{database.WebhookTicketCreated}}}, false},
+		{"без url", []Subscriber{{Secret: "s"}}, true},
+		{"дубликат", []Subscriber{{URL: "https://example.com/hook"}, {URL: "https://example.com/hook"}}, true},
+		{"неизвестное событие", []Subscriber{{URL: "https://example.com/hook", Events: []string{"ticket.deleted"}}}, true},
+	}
+	for _, tt := range tests {
+		if err := Validate(tt.subscribers); (err != nil) != tt.wantErr {
+			t.Errorf("%s: Validate() = %v", tt.name, err)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"supportTicketBotGo/config"
+	"supportTicketBotGo/database"
+	"supportTicketBotGo/webhook"
+)
+
+const webhooksUsage = `Использование: supportbot [-config config.json] webhooks <команда>
+
+Команды:
+  list [-status pending|sending|delivered|dead] [-limit N]
+                      последние доставки вебхуков
+  replay [-event ID] [-dead] [-since ГГГГ-ММ-ДД] [-url URL]
+                      вернуть доставки в очередь со сброшенным счетчиком попыток;
+                      нужно хотя бы одно условие, условия объединяются через И
+
+Доставки отправляет запущенный бот: он подхватывает их в течение 10 секунд.`
+
+// webhookSubscribers возвращает подписчиков вебхуков из конфигурации
+func webhookSubscribers() []webhook.Subscriber {
+	var subscribers []webhook.Subscriber
+	for _, s := range config.Get().Webhooks.Subscribers {
+		subscribers = append(subscribers, webhook.Subscriber{URL: s.URL, Secret: s.Secret, Events: s.Events})
+	}
+	return subscribers
+}
+
+// webhookOptions возвращает параметры доставки вебхуков из конфигурации
+func webhookOptions() webhook.Options {
+	return webhook.Options{
+		MaxAttempts: config.Get().Webhooks.MaxAttempts,
+		Timeout:     time.Duration(config.Get().Webhooks.TimeoutSeconds) * time.Second,
+	}
+}
+
+// runWebhooksCommand выполняет подкоманду webhooks и возвращает код завершения процесса
+func runWebhooksCommand(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, webhooksUsage)
+		return 2
+	}
+
+	if err := database.OpenDB(); err != nil {
+		fmt.Fprintf(os.Stderr, "Ошибка подключения к базе данных: %v\n", err)
+		return 1
+	}
+	defer database.DB.Close()
+
+	switch args[0] {
+	case "list":
+		return runWebhooksList(args[1:])
+	case "replay":
+		return runWebhooksReplay(args[1:])
+	default:
+		fmt.Fprintln(os.Stderr, webhooksUsage)
+		return 2
+	}
+}
+
+func runWebhooksList(args []string) int {
+	flags := flag.NewFlagSet("webhooks list", flag.ContinueOnError)
+	flags.Usage = func() { fmt.Fprintln(os.Stderr, webhooksUsage) }
+	status := flags.String("status", "", "только доставки в этом статусе")
+	limit := flags.Int("limit", 50, "сколько доставок показать")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	deliveries, err := database.ListWebhookDeliveries(*status, *limit)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Ошибка получения доставок: %v\n", err)
+		return 1
+	}
+	for _, d := range deliveries {
+		fmt.Printf("#%d  событие %d %-22s %-9s попыток: %d  %s  %s\n",
+			d.ID, d.EventID, d.EventType, d.Status, d.Attempts, d.EventCreatedAt.Format("02.01.2006 15:04"), d.URL)
+		if d.LastError.Valid && d.Status != database.WebhookDelivered {
+			fmt.Printf("    ошибка: %s\n", truncateText(d.LastError.String, 100))
+		}
+	}
+	return 0
+}
+
+func runWebhooksReplay(args []string) int {
+	flags := flag.NewFlagSet("webhooks replay", flag.ContinueOnError)
+	flags.Usage = func() { fmt.Fprintln(os.Stderr, webhooksUsage) }
+	eventID := flags.Int64("event", 0, "доставки события с этим ID")
+	dead := flags.Bool("dead", false, "только доставки с исчерпанными попытками")
+	since := flags.String("since", "", "события, созданные не раньше даты (ГГГГ-ММ-ДД)")
+	url := flags.String("url", "", "доставки одному подписчику")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	filter := database.WebhookReplayFilter{EventID: *eventID, Dead: *dead, URL: *url}
+	if *since != "" {
+		t, err := time.ParseInLocation("2006-01-02", *since, time.Local)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Некорректная дата -since: %s\n", *since)
+			return 2
+		}
+		filter.Since = &t
+	}
+
+	count, err := database.ReplayWebhookDeliveries(filter)
+	if errors.Is(err, database.ErrInvalidReplayFilter) {
+		fmt.Fprintln(os.Stderr, webhooksUsage)
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Ошибка: %v\n", err)
+		return 1
+	}
+	fmt.Printf("Возвращено в очередь доставок: %d\n", count)
+	return 0
+}